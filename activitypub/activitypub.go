@@ -0,0 +1,288 @@
+// Package activitypub publishes shared bookmarks as the notes of a single ActivityPub actor, which
+// users of Mastodon and other fediverse servers can follow
+package activitypub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+const (
+	// ContentType is the media type of ActivityPub documents
+	ContentType = `application/activity+json`
+
+	// Public addresses an activity to everyone
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+
+	// ActivityStreams is the json-ld context of ActivityPub documents
+	ActivityStreams = "https://www.w3.org/ns/activitystreams"
+
+	// keyBits is the size of the key that signs requests
+	keyBits = 2048
+)
+
+// Actor is the single actor whose notes are the shared bookmarks, its documents are served under
+// URL, like https://example.com/api/activitypub
+type Actor struct {
+	Username    string
+	URL         string
+	key         *rsa.PrivateKey
+	keys        *keyCache
+	checkHost   func(ctx context.Context, address string) error
+	fetchClient func() *http.Client
+}
+
+// New creates the actor named username, URL is the absolute address its documents are served under
+// and key signs its requests
+func New(username, URL string, key *rsa.PrivateKey) *Actor {
+	return &Actor{
+		Username:    username,
+		URL:         strings.TrimSuffix(URL, "/"),
+		key:         key,
+		keys:        newKeyCache(),
+		checkHost:   checkHost,
+		fetchClient: storage.PublicFetchClient,
+	}
+}
+
+// LoadKey reads the private key of the actor from the pem file at path, a new key is generated and
+// saved if the file does not exist. Followers know the actor by this key, so it must not change.
+func LoadKey(path string) (*rsa.PrivateKey, error) {
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		key, err := rsa.GenerateKey(rand.Reader, keyBits)
+		if err != nil {
+			return nil, err
+		}
+
+		contents = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if err := ioutil.WriteFile(path, contents, 0600); err != nil {
+			return nil, err
+		}
+
+		return key, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.New("No pem encoded key found in " + path)
+	}
+
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// ID is the address of the actor document
+func (actor *Actor) ID() string {
+	return actor.URL + "/actor"
+}
+
+// Account is the address of the actor in the fediverse, like bookmarks@example.com
+func (actor *Actor) Account() string {
+	host := ""
+	if parsed, err := url.Parse(actor.URL); err == nil {
+		host = parsed.Host
+	}
+
+	return actor.Username + "@" + host
+}
+
+// PublicKey is the key others verify the signatures of the actor with
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+// Person is the document that describes an actor
+type Person struct {
+	Context           []string  `json:"@context"`
+	ID                string    `json:"id"`
+	Type              string    `json:"type"`
+	PreferredUsername string    `json:"preferredUsername"`
+	Name              string    `json:"name"`
+	Summary           string    `json:"summary"`
+	Inbox             string    `json:"inbox"`
+	Outbox            string    `json:"outbox"`
+	Followers         string    `json:"followers"`
+	PublicKey         PublicKey `json:"publicKey"`
+}
+
+// Person describes the actor, including the public key of its signatures
+func (actor *Actor) Person() *Person {
+	der, _ := x509.MarshalPKIXPublicKey(&actor.key.PublicKey)
+
+	return &Person{
+		Context:           []string{ActivityStreams, "https://w3id.org/security/v1"},
+		ID:                actor.ID(),
+		Type:              "Person",
+		PreferredUsername: actor.Username,
+		Name:              actor.Username,
+		Summary:           "Shared bookmarks",
+		Inbox:             actor.URL + "/inbox",
+		Outbox:            actor.URL + "/outbox",
+		Followers:         actor.URL + "/followers",
+		PublicKey: PublicKey{
+			ID:           actor.ID() + "#main-key",
+			Owner:        actor.ID(),
+			PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		},
+	}
+}
+
+// Webfinger is the response of /.well-known/webfinger that finds the actor by its account
+type Webfinger struct {
+	Subject string          `json:"subject"`
+	Links   []WebfingerLink `json:"links"`
+}
+
+// WebfingerLink points to a document about the subject of a Webfinger response
+type WebfingerLink struct {
+	Rel  string `json:"rel"`
+	Type string `json:"type"`
+	Href string `json:"href"`
+}
+
+// Webfinger describes the actor if resource is its account, like acct:bookmarks@example.com, or its
+// address
+func (actor *Actor) Webfinger(resource string) (*Webfinger, bool) {
+	if !strings.EqualFold(resource, "acct:"+actor.Account()) && resource != actor.ID() {
+		return nil, false
+	}
+
+	return &Webfinger{
+		Subject: "acct:" + actor.Account(),
+		Links:   []WebfingerLink{{Rel: "self", Type: ContentType, Href: actor.ID()}},
+	}, true
+}
+
+// Hashtag is a tag of a note
+type Hashtag struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// Note is a shared bookmark as the fediverse sees it
+type Note struct {
+	Context      string    `json:"@context,omitempty"`
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	AttributedTo string    `json:"attributedTo"`
+	Published    time.Time `json:"published"`
+	Content      string    `json:"content"`
+	URL          string    `json:"url"`
+	To           []string  `json:"to"`
+	Cc           []string  `json:"cc"`
+	Tag          []Hashtag `json:"tag"`
+}
+
+// Note turns a bookmark into a public note with a link to the page, its excerpt and its tags as
+// hashtags. The tags that track the state of a bookmark, like shared, are left out.
+func (actor *Actor) Note(bookmark *storage.Bookmark) *Note {
+	hashtags := []Hashtag{}
+	links := []string{}
+
+	for _, tag := range bookmark.Tags {
+		if tag == capture.Shared || tag == capture.ReadItLater || tag == capture.Archived {
+			continue
+		}
+
+		// Hashtags in the fediverse are a single word of letters, digits and underscores
+		name := "#" + strings.NewReplacer(" ", "_", "-", "_", ".", "_").Replace(tag)
+		hashtags = append(hashtags, Hashtag{Type: "Hashtag", Name: name})
+		links = append(links, html.EscapeString(name))
+	}
+
+	content := fmt.Sprintf(`<p><a href="%s">%s</a></p>`, html.EscapeString(bookmark.URL), html.EscapeString(bookmark.Title))
+	if bookmark.Excerpt != "" {
+		content += "<p>" + html.EscapeString(bookmark.Excerpt) + "</p>"
+	}
+	if len(links) != 0 {
+		content += "<p>" + strings.Join(links, " ") + "</p>"
+	}
+
+	return &Note{
+		ID:           actor.URL + "/notes/" + bookmark.ID,
+		Type:         "Note",
+		AttributedTo: actor.ID(),
+		Published:    bookmark.Created.UTC(),
+		Content:      content,
+		URL:          bookmark.URL,
+		To:           []string{Public},
+		Cc:           []string{actor.URL + "/followers"},
+		Tag:          hashtags,
+	}
+}
+
+// Activity is something the actor or a follower did, like creating a note or following
+type Activity struct {
+	Context string      `json:"@context,omitempty"`
+	ID      string      `json:"id"`
+	Type    string      `json:"type"`
+	Actor   string      `json:"actor"`
+	To      []string    `json:"to,omitempty"`
+	Cc      []string    `json:"cc,omitempty"`
+	Object  interface{} `json:"object"`
+}
+
+// Create is the activity that publishes the note of a bookmark
+func (actor *Actor) Create(bookmark *storage.Bookmark) *Activity {
+	note := actor.Note(bookmark)
+
+	return &Activity{
+		ID:     note.ID + "/activity",
+		Type:   "Create",
+		Actor:  actor.ID(),
+		To:     note.To,
+		Cc:     note.Cc,
+		Object: note,
+	}
+}
+
+// Accept is the activity that accepts a follow request
+func (actor *Actor) Accept(follow *Activity) *Activity {
+	return &Activity{
+		Context: ActivityStreams,
+		ID:      actor.URL + "/accepts/" + fmt.Sprint(time.Now().UnixNano()),
+		Type:    "Accept",
+		Actor:   actor.ID(),
+		Object:  follow,
+	}
+}
+
+// Collection lists the notes or followers of the actor
+type Collection struct {
+	Context      string        `json:"@context"`
+	ID           string        `json:"id"`
+	Type         string        `json:"type"`
+	TotalItems   int           `json:"totalItems"`
+	OrderedItems []interface{} `json:"orderedItems,omitempty"`
+}
+
+// Collection creates an ordered collection with the given total number of items, of which items
+// are the first
+func (actor *Actor) Collection(name string, totalItems int, items []interface{}) *Collection {
+	return &Collection{
+		Context:      ActivityStreams,
+		ID:           actor.URL + "/" + name,
+		Type:         "OrderedCollection",
+		TotalItems:   totalItems,
+		OrderedItems: items,
+	}
+}
@@ -0,0 +1,147 @@
+package activitypub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func newTestActor(t *testing.T, username, URL string) *Actor {
+	key, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(username, URL, key)
+}
+
+// allowPrivate lets actor send requests to the test servers on the loopback address
+func allowPrivate(actor *Actor) {
+	actor.checkHost = func(ctx context.Context, address string) error { return nil }
+	actor.fetchClient = storage.FetchClient
+}
+
+func TestLoadKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "activitypub.pem")
+
+	generated, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadKey(path)
+	if err != nil || !loaded.Equal(generated) {
+		t.Fatalf("Expected the generated key to be loaded again, got %v", err)
+	}
+}
+
+func TestNote(t *testing.T) {
+	actor := newTestActor(t, "bookmarks", "https://example.com/api/activitypub/")
+
+	if finger, ok := actor.Webfinger("acct:bookmarks@example.com"); !ok || finger.Links[0].Href != "https://example.com/api/activitypub/actor" {
+		t.Fatalf("Expected webfinger to find the actor, got %v", finger)
+	}
+
+	note := actor.Note(&storage.Bookmark{ID: "abc", URL: "https://go.dev/?a=1&b=2", Title: "<Go>", Tags: storage.Tags{"shared", "web-dev"}})
+
+	if note.ID != "https://example.com/api/activitypub/notes/abc" || note.Content != `<p><a href="https://go.dev/?a=1&amp;b=2">&lt;Go&gt;</a></p><p>#web_dev</p>` || len(note.Tag) != 1 {
+		t.Fatalf("Expected an escaped note with a hashtag for every tag but shared, got %v", note)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	var local, remote *Actor
+	received := make(chan string, 1)
+	fetches := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actor":
+			fetches++
+			json.NewEncoder(w).Encode(remote.Person())
+		case "/inbox":
+			body, _ := ioutil.ReadAll(r.Body)
+			if _, err := local.Verify(r.Context(), r, body); err != nil {
+				w.WriteHeader(401)
+				return
+			}
+			received <- string(body)
+			w.WriteHeader(202)
+		}
+	}))
+	defer server.Close()
+
+	remote = newTestActor(t, "alice", server.URL)
+	local = newTestActor(t, "bookmarks", "https://example.com/api/activitypub")
+	follow := &Activity{ID: server.URL + "/follow", Type: "Follow", Actor: remote.ID(), Object: local.ID()}
+
+	if err := remote.Deliver(context.Background(), server.URL+"/inbox", follow); !errors.Is(err, ErrPrivateHost) {
+		t.Fatalf("Expected a delivery to a private host to be refused, got %v", err)
+	}
+
+	allowPrivate(remote)
+
+	if err := remote.Deliver(context.Background(), server.URL+"/inbox", follow); err == nil {
+		t.Fatal("Expected the key of an actor on a private host to be rejected")
+	}
+
+	allowPrivate(local)
+
+	for i := 0; i < 2; i++ {
+		if err := remote.Deliver(context.Background(), server.URL+"/inbox", follow); err != nil {
+			t.Fatal(err)
+		}
+
+		if body := <-received; !strings.Contains(body, `"type":"Follow"`) {
+			t.Fatalf("Expected the follow to be delivered, got %s", body)
+		}
+	}
+
+	if fetches != 1 {
+		t.Fatalf("Expected the key of the actor to be fetched once, got %d", fetches)
+	}
+
+	response, err := http.Post(server.URL+"/inbox", ContentType, strings.NewReader(`{"type":"Follow"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != 401 {
+		t.Fatalf("Expected 401 for an unsigned activity, got %d", response.StatusCode)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	for _, address := range []string{"http://93.184.216.34/actor", "https://127.0.0.1/actor", "https://[::1]/actor", "https://10.0.0.1/actor", "https://192.168.1.1/actor", "https://169.254.169.254/actor", "https://localhost/actor", "/actor"} {
+		if err := checkHost(context.Background(), address); err == nil {
+			t.Fatalf("Expected %s to be rejected", address)
+		}
+	}
+
+	if err := checkHost(context.Background(), "https://93.184.216.34/actor#main-key"); err != nil {
+		t.Fatalf("Expected an https address of a public host to be accepted, got %v", err)
+	}
+
+	actor := newTestActor(t, "bookmarks", "https://example.com/api/activitypub")
+	remote := &RemoteActor{ID: "https://93.184.216.34/actor", Inbox: "https://93.184.216.34/inbox"}
+
+	if err := actor.CheckInbox(context.Background(), remote); err != nil {
+		t.Fatalf("Expected a public inbox to be accepted, got %v", err)
+	}
+
+	remote.Endpoints.SharedInbox = "https://100.64.0.1/inbox"
+	if err := actor.CheckInbox(context.Background(), remote); !errors.Is(err, ErrPrivateHost) {
+		t.Fatalf("Expected a shared inbox in the shared address space to be rejected, got %v", err)
+	}
+}
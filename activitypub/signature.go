@@ -0,0 +1,370 @@
+package activitypub
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+const (
+	// maxSignatureAge is how old the date of a signed request may be, Mastodon uses the same window
+	maxSignatureAge = 12 * time.Hour
+
+	// keyCacheTTL is how long the key of another actor is used before it is fetched again, a key
+	// that no longer verifies is fetched again sooner in case the actor changed it
+	keyCacheTTL = time.Hour
+
+	// maxCachedKeys limits how many keys of other actors are kept
+	maxCachedKeys = 1024
+)
+
+var (
+	// ErrInvalidSignature is returned if the signature of a request is missing or does not match
+	// the key of its actor
+	ErrInvalidSignature = errors.New("Invalid http signature")
+
+	// ErrPrivateHost is returned for an inbox, the key of a signature or a redirect that is not an
+	// https address of a public host, so a request to the inbox can not make the server send
+	// requests into its own network
+	ErrPrivateHost = errors.New("Only https addresses of public hosts can be sent to")
+)
+
+// RemoteActor is the part of the document of another actor that is needed to deliver to it and to
+// verify its signatures
+type RemoteActor struct {
+	ID        string
+	Inbox     string
+	Endpoints struct {
+		SharedInbox string
+	}
+	PublicKey PublicKey
+}
+
+// DeliveryInbox is the inbox activities for the actor are delivered to, the shared inbox of its
+// server if it has one
+func (remote *RemoteActor) DeliveryInbox() string {
+	if remote.Endpoints.SharedInbox != "" {
+		return remote.Endpoints.SharedInbox
+	}
+
+	return remote.Inbox
+}
+
+// Deliver posts an activity to the inbox of another actor, signed by this actor
+func (actor *Actor) Deliver(ctx context.Context, inbox string, activity *Activity) error {
+	activity.Context = ActivityStreams
+
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", ContentType)
+
+	response, err := actor.do(request, body)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		failure, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Error delivering to %s: %d %s", inbox, response.StatusCode, strings.TrimSpace(string(failure)))
+	}
+
+	return nil
+}
+
+// Fetch gets the document of another actor, the request is signed because servers in authorized
+// fetch mode only answer signed requests
+func (actor *Actor) Fetch(ctx context.Context, ID string) (*RemoteActor, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", ContentType)
+
+	response, err := actor.do(request, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("Error fetching actor %s: %s", ID, response.Status)
+	}
+
+	remote := &RemoteActor{}
+	if err := json.NewDecoder(response.Body).Decode(remote); err != nil {
+		return nil, err
+	}
+
+	return remote, nil
+}
+
+// Verify checks the http signature of a request to the inbox and returns the actor that signed it
+func (actor *Actor) Verify(ctx context.Context, r *http.Request, body []byte) (*RemoteActor, error) {
+	params := map[string]string{}
+	for _, param := range strings.Split(r.Header.Get("Signature"), ",") {
+		if parts := strings.SplitN(strings.TrimSpace(param), "=", 2); len(parts) == 2 {
+			params[parts[0]] = strings.Trim(parts[1], `"`)
+		}
+	}
+
+	headers := strings.Fields(params["headers"])
+	if params["keyId"] == "" || !contains(headers, "(request-target)") || !contains(headers, "host") || !contains(headers, "date") || (len(body) != 0 && !contains(headers, "digest")) {
+		return nil, ErrInvalidSignature
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil || time.Since(date) > maxSignatureAge || time.Until(date) > maxSignatureAge {
+		return nil, ErrInvalidSignature
+	}
+
+	if len(body) != 0 && r.Header.Get("Digest") != digest(body) {
+		return nil, ErrInvalidSignature
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	keyID := params["keyId"]
+	hash := sha256.Sum256([]byte(signingString(r, r.RequestURI, headers)))
+
+	if remote, ok := actor.keys.get(keyID); ok && verifies(remote, keyID, hash[:], signature) {
+		return remote, nil
+	}
+
+	remote, err := actor.Fetch(ctx, strings.SplitN(keyID, "#", 2)[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if !verifies(remote, keyID, hash[:], signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	actor.keys.put(keyID, remote)
+
+	return remote, nil
+}
+
+// verifies checks if signature is the signature of hash by the key keyID of remote
+func verifies(remote *RemoteActor, keyID string, hash []byte, signature []byte) bool {
+	if remote.PublicKey.ID != keyID || remote.PublicKey.Owner != remote.ID {
+		return false
+	}
+
+	block, _ := pem.Decode([]byte(remote.PublicKey.PublicKeyPem))
+	if block == nil {
+		return false
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return false
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return false
+	}
+
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash, signature) == nil
+}
+
+// checkHost returns ErrPrivateHost unless address is an https url of a host that resolves to
+// public addresses only. The client checks the address again when it connects, in case the host
+// resolves to another address by then.
+func checkHost(ctx context.Context, address string) error {
+	location, err := url.Parse(address)
+	if err != nil || location.Scheme != "https" || location.Hostname() == "" {
+		return ErrPrivateHost
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, location.Hostname())
+	if err != nil {
+		return err
+	}
+
+	for _, address := range addresses {
+		if !storage.IsPublic(address.IP) {
+			return ErrPrivateHost
+		}
+	}
+
+	return nil
+}
+
+// CheckInbox returns ErrPrivateHost unless the inboxes of remote are https addresses of public
+// hosts, a follower with another inbox can not be delivered to
+func (actor *Actor) CheckInbox(ctx context.Context, remote *RemoteActor) error {
+	if err := actor.checkHost(ctx, remote.Inbox); err != nil {
+		return err
+	}
+
+	return actor.checkHost(ctx, remote.DeliveryInbox())
+}
+
+// keyCache keeps the documents of other actors by the id of their key, so not every activity they
+// send makes the inbox fetch their key again
+type keyCache struct {
+	mutex  sync.Mutex
+	actors map[string]cachedKey
+}
+
+type cachedKey struct {
+	remote  *RemoteActor
+	fetched time.Time
+}
+
+func newKeyCache() *keyCache {
+	return &keyCache{actors: map[string]cachedKey{}}
+}
+
+// get returns the actor of keyID if it was fetched less than keyCacheTTL ago
+func (cache *keyCache) get(keyID string) (*RemoteActor, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cached, ok := cache.actors[keyID]
+	if !ok || time.Since(cached.fetched) > keyCacheTTL {
+		return nil, false
+	}
+
+	return cached.remote, true
+}
+
+// put keeps the actor of keyID, making room by dropping expired keys or else any key once the
+// cache holds maxCachedKeys
+func (cache *keyCache) put(keyID string, remote *RemoteActor) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if len(cache.actors) >= maxCachedKeys {
+		for cachedID, cached := range cache.actors {
+			if time.Since(cached.fetched) > keyCacheTTL {
+				delete(cache.actors, cachedID)
+			}
+		}
+	}
+
+	if len(cache.actors) >= maxCachedKeys {
+		for cachedID := range cache.actors {
+			delete(cache.actors, cachedID)
+			break
+		}
+	}
+
+	cache.actors[keyID] = cachedKey{remote, time.Now()}
+}
+
+// do signs the request with the key of the actor and sends it, if it goes to an https address of
+// a public host
+func (actor *Actor) do(request *http.Request, body []byte) (*http.Response, error) {
+	if err := actor.checkHost(request.Context(), request.URL.String()); err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		request.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+
+	hash := sha256.Sum256([]byte(signingString(request, request.URL.RequestURI(), headers)))
+	signature, err := rsa.SignPKCS1v15(nil, actor.key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		actor.ID()+"#main-key", strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature)))
+
+	return actor.client().Do(request)
+}
+
+// client is the shared client of storage that only connects to public hosts, refusing to follow
+// a redirect to an address that checkHost rejects
+func (actor *Actor) client() *http.Client {
+	client := *actor.fetchClient()
+	checkRedirect := client.CheckRedirect
+
+	client.CheckRedirect = func(request *http.Request, via []*http.Request) error {
+		if err := actor.checkHost(request.Context(), request.URL.String()); err != nil {
+			return err
+		}
+
+		if checkRedirect != nil {
+			return checkRedirect(request, via)
+		}
+
+		return nil
+	}
+
+	return &client
+}
+
+// signingString builds the string that is signed from the given headers of the request
+func signingString(r *http.Request, requestURI string, headers []string) string {
+	lines := []string{}
+
+	for _, header := range headers {
+		switch header {
+		case "(request-target)":
+			lines = append(lines, "(request-target): "+strings.ToLower(r.Method)+" "+requestURI)
+		case "host":
+			host := r.Host
+			if host == "" {
+				host = r.URL.Host
+			}
+			lines = append(lines, "host: "+host)
+		default:
+			lines = append(lines, header+": "+r.Header.Get(header))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// digest is the Digest header of a body
+func digest(body []byte) string {
+	hash := sha256.Sum256(body)
+
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/activitypub"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+)
+
+// outboxSize is the number of recently shared bookmarks listed in the outbox
+const outboxSize = 20
+
+// fediverse serves the documents of the ActivityPub actor and accepts followers in its inbox, the
+// inbox verifies the http signatures of other servers instead of the username and password
+type fediverse struct {
+	store *storage.Store
+	actor *activitypub.Actor
+}
+
+func (api fediverse) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/actor", api.person)
+	r.With(timeout(timeouts.Read)).Get("/outbox", api.outbox)
+	r.With(timeout(timeouts.Read)).Get("/followers", api.followers)
+	r.With(timeout(timeouts.Read)).Get("/notes/{id}", api.note)
+	r.With(timeout(timeouts.Fetch)).Post("/inbox", api.inbox)
+
+	return r
+}
+
+func activityResponse(w http.ResponseWriter, code int, object interface{}) {
+	w.Header().Set("Content-Type", activitypub.ContentType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(object)
+}
+
+// webfinger lets other servers find the actor by its account, like bookmarks@example.com
+func webfinger(actor *activitypub.Actor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, ok := actor.Webfinger(r.URL.Query().Get("resource"))
+		if !ok {
+			jsonError(w, "Unknown resource", 404)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/jrd+json")
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+func (api *fediverse) person(w http.ResponseWriter, r *http.Request) {
+	activityResponse(w, 200, api.actor.Person())
+}
+
+// outbox lists the most recently shared bookmarks
+func (api *fediverse) outbox(w http.ResponseWriter, r *http.Request) {
+	bookmarks, totalCount := api.store.BookmarkList(r.Context(), &storage.BookmarkListOptions{
+		Tags:  storage.Tags{capture.Shared},
+		Limit: outboxSize,
+	})
+
+	items := []interface{}{}
+	for _, bookmark := range *bookmarks {
+		items = append(items, api.actor.Create(bookmark))
+	}
+
+	activityResponse(w, 200, api.actor.Collection("outbox", totalCount, items))
+}
+
+// followers only reports the number of followers, who they are is nobody's business
+func (api *fediverse) followers(w http.ResponseWriter, r *http.Request) {
+	activityResponse(w, 200, api.actor.Collection("followers", len(*api.store.FollowerList(r.Context())), nil))
+}
+
+func (api *fediverse) note(w http.ResponseWriter, r *http.Request) {
+	bookmark := &storage.Bookmark{ID: chi.URLParam(r, "id")}
+	if err := api.store.BookmarkGet(r.Context(), bookmark); err != nil {
+		jsonError(w, "Note not found", 404)
+		return
+	}
+
+	for _, tag := range bookmark.Tags {
+		if tag == capture.Shared {
+			note := api.actor.Note(bookmark)
+			note.Context = activitypub.ActivityStreams
+			activityResponse(w, 200, note)
+			return
+		}
+	}
+
+	jsonError(w, "Note not found", 404)
+}
+
+// inbox handles follow requests and unfollows, other activities are ignored
+func (api *fediverse) inbox(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	remote, err := api.actor.Verify(r.Context(), r, body)
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Msg("Rejected activity with an invalid signature")
+		jsonError(w, "Unauthorized", 401)
+		return
+	}
+
+	activity := struct {
+		activitypub.Activity
+		Context json.RawMessage `json:"@context"`
+		Object  json.RawMessage `json:"object"`
+	}{}
+	if err := json.Unmarshal(body, &activity); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if activity.Actor != remote.ID {
+		jsonError(w, "Activity is not signed by its actor", 401)
+		return
+	}
+
+	follower := &storage.Follower{ID: remote.ID, Inbox: remote.DeliveryInbox()}
+
+	switch activity.Type {
+	case "Follow":
+		if err := api.actor.CheckInbox(r.Context(), remote); err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Str("follower", remote.ID).Msg("Rejected follower with a private inbox")
+			jsonError(w, err.Error(), 422)
+			return
+		}
+
+		if err := api.store.FollowerPersist(r.Context(), follower); err != nil {
+			storeError(w, err)
+			return
+		}
+
+		follow := activity.Activity
+		follow.Object = api.actor.ID()
+		if err := api.actor.Deliver(r.Context(), remote.Inbox, api.actor.Accept(&follow)); err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Str("follower", remote.ID).Msg("Error accepting follower")
+		}
+	case "Undo":
+		undone := struct{ Type string }{}
+		json.Unmarshal(activity.Object, &undone)
+
+		if undone.Type == "Follow" {
+			if err := api.store.FollowerDelete(r.Context(), follower); err != nil {
+				storeError(w, err)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(202)
+}
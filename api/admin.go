@@ -0,0 +1,378 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/logging"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/scheduler"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+)
+
+type admin struct {
+	store     *storage.Store
+	queue     *queue.Queue
+	refresher *scheduler.Refresher
+	logging   *logging.Output
+}
+
+// Routes for maintenance tasks, these can take a long time and therefore have no timeout
+func (api admin) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/vacuum", api.vacuum)
+	r.Post("/optimize", api.optimize)
+	r.Post("/fts/optimize", api.optimizeFTS)
+	r.Post("/fts/rebuild", api.rebuildFTS)
+	r.Post("/cleanup", api.cleanup)
+	r.Post("/purge", api.purge)
+	r.Post("/integrity", api.integrity)
+	r.Get("/db-stats", api.stats)
+	r.Get("/backup", api.backup)
+	r.Post("/restore", api.restore)
+	r.Delete("/jobs/dead", api.purgeDeadJobs)
+	r.Post("/jobs/dead/{id}/retry", api.retryDeadJob)
+	r.Delete("/jobs/dead/{id}", api.purgeDeadJob)
+	r.Mount("/debug", profiling())
+	if api.refresher != nil {
+		r.Get("/refresh", api.refreshSettings)
+		r.Patch("/refresh", api.updateRefreshSettings)
+	}
+	if api.logging != nil {
+		r.Get("/logging", api.loggingSettings)
+		r.Patch("/logging", api.updateLoggingSettings)
+	}
+
+	return r
+}
+
+// adminOnly only allows access to admin routes if authentication is enabled, to admin users and
+// the configured username
+func adminOnly(store storage.Storer, options Options) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if options.Unauthenticated {
+				jsonError(w, "Admin endpoints require a username and password or a user to be configured", 403)
+				return
+			}
+
+			enabled, err := authenticationEnabled(r, store, options.Username, options.Password)
+			if err != nil {
+				jsonError(w, "Service Unavailable", 503)
+				return
+			} else if !enabled {
+				jsonError(w, "Admin endpoints require a username and password or a user to be configured", 403)
+				return
+			} else if !isAdmin(r, options.Username) {
+				jsonError(w, "Admin endpoints require an admin user", 403)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type maintenanceResult struct {
+	Task     string
+	Duration time.Duration
+	Result   interface{} `json:",omitempty"`
+}
+
+func (api *admin) vacuum(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if err := api.store.Vacuum(r.Context()); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "vacuum", Duration: time.Since(start)})
+}
+
+func (api *admin) optimize(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if err := api.store.Optimize(r.Context()); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "optimize", Duration: time.Since(start)})
+}
+
+func (api *admin) optimizeFTS(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if err := api.store.OptimizeFTS(r.Context()); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "fts/optimize", Duration: time.Since(start)})
+}
+
+func (api *admin) rebuildFTS(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	if err := api.store.RebuildFTS(r.Context()); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "fts/rebuild", Duration: time.Since(start)})
+}
+
+func (api *admin) cleanup(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	cleaned, err := api.store.Cleanup(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "cleanup", Duration: time.Since(start), Result: map[string]int64{"Cleaned": cleaned}})
+}
+
+func (api *admin) purge(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	olderThan := time.Duration(0)
+	if value := r.URL.Query().Get("older_than"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			jsonError(w, "Invalid older_than: "+err.Error(), 400)
+			return
+		}
+		olderThan = duration
+	}
+
+	purged, err := api.store.Purge(r.Context(), start.Add(-olderThan))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "purge", Duration: time.Since(start), Result: map[string]int64{"Purged": purged}})
+}
+
+func (api *admin) integrity(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	result, err := api.store.Check(r.Context(), r.URL.Query().Get("repair") == "true")
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "integrity", Duration: time.Since(start), Result: map[string]interface{}{"Ok": result.Ok(), "Problems": result.Integrity, "FTS": result.FTS, "Orphans": result.Orphans, "Repaired": result.Repaired}})
+}
+
+func (api *admin) stats(w http.ResponseWriter, r *http.Request) {
+	stats, err := api.store.Stats(r.Context())
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, stats)
+}
+
+func (api *admin) backup(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(filepath.Base(api.store.Path()), filepath.Ext(api.store.Path()))
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+"-"+time.Now().UTC().Format("20060102T150405Z")+".db\"")
+
+	written, err := api.store.BackupTo(r.Context(), w)
+	if err != nil && written == 0 {
+		w.Header().Del("Content-Disposition")
+		storeError(w, err)
+	} else if err != nil {
+		// Once the snapshot is streaming the status code can no longer change
+		hlog.FromRequest(r).Error().Err(err).Int64("written", written).Msg("Error streaming backup")
+	}
+}
+
+func (api *admin) restore(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("confirm") != "true" {
+		jsonError(w, "Restoring a backup replaces all data, pass confirm=true to continue", 400)
+		return
+	}
+
+	start := time.Now()
+
+	file, err := ioutil.TempFile("", "bookmarks-restore")
+	if err != nil {
+		internalError(w, err)
+		return
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, r.Body)
+	file.Close()
+	if err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if err := api.store.Restore(r.Context(), file.Name()); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, maintenanceResult{Task: "restore", Duration: time.Since(start)})
+}
+
+func (api *admin) purgeDeadJobs(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+
+	purged := api.queue.PurgeAll()
+
+	jsonResponse(w, 200, maintenanceResult{Task: "jobs/purge", Duration: time.Since(start), Result: map[string]int{"Purged": purged}})
+}
+
+func (api *admin) retryDeadJob(w http.ResponseWriter, r *http.Request) {
+	job, err := api.queue.Retry(chi.URLParam(r, "id"))
+	if err != nil {
+		queueError(w, err)
+		return
+	}
+
+	jsonResponse(w, 202, job)
+}
+
+func (api *admin) purgeDeadJob(w http.ResponseWriter, r *http.Request) {
+	if err := api.queue.Purge(chi.URLParam(r, "id")); err != nil {
+		queueError(w, err)
+		return
+	}
+
+	jsonResponse(w, 204, nil)
+}
+
+// refreshSettings are the scheduler.RefreshSettings with a readable window like 1h30m
+type refreshSettings struct {
+	Interval  string
+	BatchSize int
+	Window    string
+	MaxErrors int
+}
+
+// instanceSettings are the refresh and logging settings as they are exported and imported
+type instanceSettings struct {
+	Refresh *refreshSettings  `json:",omitempty"`
+	Logging *logging.Settings `json:",omitempty"`
+}
+
+// settings reads and changes the settings that are not stored in the database, either can be nil
+type settings struct {
+	refresher *scheduler.Refresher
+	logging   *logging.Output
+}
+
+// current returns the settings to export, or nil if there are none
+func (s settings) current() *instanceSettings {
+	if s.refresher == nil && s.logging == nil {
+		return nil
+	}
+
+	current := &instanceSettings{}
+	if s.refresher != nil {
+		refresh := s.refresher.Settings()
+		current.Refresh = &refreshSettings{refresh.Interval, refresh.BatchSize, refresh.Window.String(), refresh.MaxErrors}
+	}
+	if s.logging != nil {
+		logging := s.logging.Settings()
+		current.Logging = &logging
+	}
+
+	return current
+}
+
+// update applies imported settings, settings that are left out or that this instance does not
+// have keep their current value
+func (s settings) update(imported *instanceSettings) error {
+	if imported.Refresh != nil && s.refresher != nil {
+		window, err := time.ParseDuration(imported.Refresh.Window)
+		if err != nil {
+			return errors.New("Settings.Refresh.Window must be a duration like 1h30m")
+		}
+
+		if err := s.refresher.Update(scheduler.RefreshSettings{Interval: imported.Refresh.Interval, BatchSize: imported.Refresh.BatchSize, Window: window, MaxErrors: imported.Refresh.MaxErrors}); err != nil {
+			return err
+		}
+	}
+
+	if imported.Logging != nil && s.logging != nil {
+		if err := s.logging.Update(*imported.Logging); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (api *admin) refreshSettings(w http.ResponseWriter, r *http.Request) {
+	settings := api.refresher.Settings()
+
+	jsonResponse(w, 200, refreshSettings{settings.Interval, settings.BatchSize, settings.Window.String(), settings.MaxErrors})
+}
+
+func (api *admin) updateRefreshSettings(w http.ResponseWriter, r *http.Request) {
+	settings := api.refresher.Settings()
+
+	// Fields that are left out keep their current value
+	update := refreshSettings{settings.Interval, settings.BatchSize, settings.Window.String(), settings.MaxErrors}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	window, err := time.ParseDuration(update.Window)
+	if err != nil {
+		jsonErrorWithFields(w, "Invalid request body", 422, map[string]string{"Window": "must be a duration like 1h30m"})
+		return
+	}
+
+	if err := api.refresher.Update(scheduler.RefreshSettings{Interval: update.Interval, BatchSize: update.BatchSize, Window: window, MaxErrors: update.MaxErrors}); err != nil {
+		jsonError(w, err.Error(), 422)
+		return
+	}
+
+	hlog.FromRequest(r).Info().Str("interval", update.Interval).Int("batch_size", update.BatchSize).Dur("window", window).Int("max_errors", update.MaxErrors).Msg("Changed the refresh settings")
+
+	api.refreshSettings(w, r)
+}
+
+func (api *admin) loggingSettings(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, 200, api.logging.Settings())
+}
+
+func (api *admin) updateLoggingSettings(w http.ResponseWriter, r *http.Request) {
+	// Fields that are left out keep their current value
+	settings := api.logging.Settings()
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if err := api.logging.Update(settings); err != nil {
+		jsonError(w, err.Error(), 422)
+		return
+	}
+
+	hlog.FromRequest(r).Warn().Str("log_level", settings.Level).Str("log_format", settings.Format).Msg("Changed the logging settings")
+
+	api.loggingSettings(w, r)
+}
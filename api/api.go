@@ -2,41 +2,153 @@ package api
 
 import (
 	"encoding/json"
-	"mime"
+	"io"
 	"net/http"
-	"path/filepath"
+	"os"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/nrocco/bookmarks/activitypub"
+	"github.com/nrocco/bookmarks/logging"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/readlater"
+	"github.com/nrocco/bookmarks/scheduler"
 	"github.com/nrocco/bookmarks/storage"
-	"github.com/nrocco/bookmarks/web"
 	"github.com/nrocco/qb"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 )
 
+// Options configures a Bookmarks API instance
+type Options struct {
+	// Username and Password protect the rest api, authentication is disabled if either is empty
+	// and there are no users
+	Username string
+	Password string
+
+	// Unauthenticated disables authentication altogether, for when a reverse proxy in front of the
+	// rest api authenticates. The admin routes are forbidden then.
+	Unauthenticated bool
+
+	// Timeouts limit how long requests to the rest api may take
+	Timeouts Timeouts
+
+	// MaxBodySize limits the size in bytes of request bodies sent to the rest api
+	MaxBodySize int64
+
+	// MaxImportSize limits the size in bytes of documents sent to the import endpoint
+	MaxImportSize int64
+
+	// TLSCert and TLSKey are the paths to the certificate and key used to serve https
+	TLSCert string
+	TLSKey  string
+
+	// AutocertHosts enables certificates from Let's Encrypt for these hosts, cached in AutocertCache
+	AutocertHosts []string
+	AutocertCache string
+
+	// BasePath serves the application under a sub path, for example /bookmarks
+	BasePath string
+
+	// AssetsDir serves the frontend from this directory instead of the embedded assets, useful during development
+	AssetsDir string
+
+	// SocketMode sets the permissions of the unix socket when listening on unix:/path/to/socket
+	SocketMode os.FileMode
+
+	// SlashSigningSecret verifies slash commands sent by Slack, SlashToken those sent by Mattermost,
+	// the slash command endpoint is disabled if both are empty
+	SlashSigningSecret string
+	SlashToken         string
+
+	// ShaarliSecret signs the requests of Shaarli clients, the Shaarli api is disabled if it is empty
+	ShaarliSecret string
+
+	// LinkdingToken authenticates linkding clients, the linkding api is disabled if it is empty
+	LinkdingToken string
+
+	// InboundTokens maps the tokens of inbound webhooks to how their payload is read, inbound
+	// webhooks are disabled if there are none
+	InboundTokens map[string]InboundMapping
+
+	// ReadLater are the read it later services bookmarks can be pushed to, by name like pocket
+	ReadLater map[string]readlater.Service
+
+	// ArchiveSecret signs the links in the email digest that archive a bookmark without logging in,
+	// the links are disabled if it is empty
+	ArchiveSecret string
+
+	// PeriodicalPath is the EPUB of unread feed items and bookmarks compiled by the scheduler, it is
+	// not served if it is empty
+	PeriodicalPath string
+
+	// ActivityPub publishes the shared bookmarks as the notes of this actor, disabled if it is nil
+	ActivityPub *activitypub.Actor
+
+	// Refresher tunes how feeds are refreshed through the admin routes, they are left out if it is nil
+	Refresher *scheduler.Refresher
+
+	// Logging switches the level and format of the logs through the admin routes, they are left out if
+	// it is nil
+	Logging *logging.Output
+
+	// HealthChecks are reported by /healthz next to the database and disk checks
+	HealthChecks map[string]HealthCheck
+
+	// ReadinessChecks are reported by /readyz next to the database and migrations checks
+	ReadinessChecks map[string]HealthCheck
+}
+
+const (
+	// listFlushSize is the number of list items written before they are flushed to the client
+	listFlushSize = 100
+
+	// listStreamSize is the largest _limit of a list that is loaded, and cached, as a whole. Longer
+	// lists, or all with a negative _limit, are read from the database one item at a time while
+	// they are written. They have no next cursor, it is only known once the last item is written.
+	listStreamSize = 500
+)
+
+// Timeouts holds the maximum duration of requests per kind of route, a zero duration disables the timeout
+type Timeouts struct {
+	// Read applies to routes that only read from the database
+	Read time.Duration
+
+	// Write applies to routes that write to the database
+	Write time.Duration
+
+	// Fetch applies to routes that fetch remote content, like creating a bookmark or refreshing a feed
+	Fetch time.Duration
+}
+
 // New instantiates a new Bookmarks API instance
-func New(logger zerolog.Logger, store *storage.Store, username, password string) *API {
+func New(logger zerolog.Logger, store *storage.Store, jobs *queue.Queue, options Options) *API {
+	options.BasePath = strings.TrimSuffix("/"+strings.Trim(options.BasePath, "/"), "/")
+
 	r := chi.NewRouter()
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(5 * time.Second))
 	r.Use(middleware.Heartbeat("/ping"))
 
+	// Every request gets its own logger, tagged with a request id, stored in the request context
+	r.Use(hlog.NewHandler(logger))
+	r.Use(hlog.RemoteAddrHandler("ip"))
+	r.Use(hlog.RequestIDHandler("req_id", "X-Request-Id"))
+
+	// Clients learn from the events stream when the content of a bookmark was fetched in the background
+	bookmarkEvents := newEvents()
+	jobs.OnSucceeded(publishFetched(bookmarkEvents, storage.BookmarkFetched))
+	jobs.OnDead(publishFetched(bookmarkEvents, storage.BookmarkFailed))
+
 	r.Route("/api", func(r chi.Router) {
-		r.Use(hlog.NewHandler(logger))
 		r.Use(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
 			hlog.FromRequest(r).Info().Str("method", r.Method).Str("url", r.URL.String()).Int("status", status).Int("size", size).Dur("duration", duration).Msg("")
 		}))
-		r.Use(hlog.RemoteAddrHandler("ip"))
-		r.Use(hlog.RequestIDHandler("req_id", "X-Request-Id"))
-
-		if username != "" && password != "" {
-			r.Use(authenticator(username, password))
-		}
 
 		r.Use(func(next http.Handler) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -48,24 +160,146 @@ func New(logger zerolog.Logger, store *storage.Store, username, password string)
 			})
 		})
 
-		r.Mount("/bookmarks", bookmarks{store}.Routes())
-		r.Mount("/feeds", feeds{store}.Routes())
-		r.Mount("/thoughts", thoughts{store}.Routes())
+		// Hooks and compatible apis are called by other services, which sign their requests instead of logging in
+		if options.SlashSigningSecret != "" || options.SlashToken != "" {
+			r.With(limitBody(options.MaxBodySize)).Mount("/hooks/slash", slash{store, options.SlashSigningSecret, options.SlashToken}.Routes(options.Timeouts))
+		}
+
+		if options.ShaarliSecret != "" {
+			r.With(limitBody(options.MaxBodySize)).Mount("/shaarli/api/v1", shaarli{store, options.ShaarliSecret}.Routes(options.Timeouts))
+		}
+
+		if options.LinkdingToken != "" {
+			r.With(limitBody(options.MaxBodySize)).Mount("/linkding/api", linkding{store, options.LinkdingToken}.Routes(options.Timeouts))
+		}
+
+		if len(options.InboundTokens) != 0 {
+			r.With(limitBody(options.MaxBodySize)).Mount("/inbound", inbound{store, options.InboundTokens}.Routes(options.Timeouts))
+		}
+
+		if options.ArchiveSecret != "" {
+			r.With(limitBody(options.MaxBodySize)).Mount("/archive", archiveLinks{store, options.ArchiveSecret}.Routes(options.Timeouts))
+		}
+
+		if options.ActivityPub != nil {
+			r.With(limitBody(options.MaxBodySize)).Mount("/activitypub", fediverse{store, options.ActivityPub}.Routes(options.Timeouts))
+		}
+
+		r.Group(func(r chi.Router) {
+			if !options.Unauthenticated {
+				r.Use(authenticator(store, options.Username, options.Password, options.BasePath+"/"))
+			}
+
+			r.Route("/v1", v1(store, jobs, bookmarkEvents, options))
+
+			// Unversioned routes are kept for older clients and will be removed in a future release
+			r.Group(func(r chi.Router) {
+				r.Use(deprecated("/api", options.BasePath+"/api/v1"))
+				v1(store, jobs, bookmarkEvents, options)(r)
+			})
+		})
 	})
 
-	r.Get("/*", webAssetHandler)
+	if options.ActivityPub != nil {
+		r.Get("/.well-known/webfinger", webfinger(options.ActivityPub))
+	}
+
+	r.Get("/healthz", healthHandler(store, options.HealthChecks))
+	r.Get("/livez", livenessHandler)
+	r.Get("/readyz", readinessHandler(store, options.ReadinessChecks))
+
+	// Metrics reveal what the server is doing, scrapers authenticate with the api token of a user
+	r.Group(func(r chi.Router) {
+		if !options.Unauthenticated {
+			r.Use(authenticator(store, options.Username, options.Password, options.BasePath+"/"))
+		}
+
+		r.Handle("/metrics", promhttp.Handler())
+	})
 
-	return &API{r}
+	r.Get("/*", assetHandler(options.AssetsDir))
+
+	if options.BasePath == "" {
+		return &API{r, options}
+	}
+
+	root := chi.NewRouter()
+	root.Handle(options.BasePath+"/*", http.StripPrefix(options.BasePath, r))
+	if options.ActivityPub != nil {
+		// Webfinger is always looked up at the root of the host
+		root.Get("/.well-known/webfinger", webfinger(options.ActivityPub))
+	}
+	root.Get(options.BasePath, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, options.BasePath+"/", 301)
+	})
+
+	return &API{root, options}
 }
 
 // API represents a Bookmarks rest API instance
 type API struct {
-	router chi.Router
+	router  chi.Router
+	options Options
+}
+
+// v1 registers the routes that make up version 1 of the rest api
+func v1(store *storage.Store, q *queue.Queue, bookmarkEvents *events, options Options) func(r chi.Router) {
+	return func(r chi.Router) {
+		r.With(limitBody(options.MaxBodySize)).Mount("/bookmarks", bookmarks{store, q, bookmarkEvents, options.ReadLater}.Routes(options.Timeouts))
+		r.With(limitBody(options.MaxBodySize)).Mount("/feeds", feeds{store, q}.Routes(options.Timeouts))
+		r.With(limitBody(options.MaxBodySize)).Mount("/items", items{store}.Routes(options.Timeouts))
+		r.With(limitBody(options.MaxBodySize)).Mount("/thoughts", thoughts{store}.Routes(options.Timeouts))
+		r.With(limitBody(options.MaxBodySize)).Mount("/tags", tags{store}.Routes(options.Timeouts))
+		r.With(limitBody(options.MaxImportSize)).Mount("/import", imports{store, q, settings{options.Refresher, options.Logging}, options.Username}.Routes(options.Timeouts))
+		r.Mount("/export", exports{store, settings{options.Refresher, options.Logging}}.Routes())
+		r.Mount("/jobs", jobs{q}.Routes(options.Timeouts))
+		r.Mount("/schedules", schedules{q}.Routes(options.Timeouts))
+		if options.PeriodicalPath != "" {
+			r.Mount("/periodical", periodical{options.PeriodicalPath}.Routes(options.Timeouts))
+		}
+		r.With(adminOnly(store, options)).Mount("/admin", admin{store, q, options.Refresher, options.Logging}.Routes())
+	}
+}
+
+// timeout cancels the request context after duration, a duration of 0 disables the timeout
+func timeout(duration time.Duration) func(http.Handler) http.Handler {
+	if duration <= 0 {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return middleware.Timeout(duration)
+}
+
+// limitBody caps the request body to size bytes, a size of 0 disables the limit
+func limitBody(size int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if size > 0 {
+				if r.ContentLength > size {
+					jsonError(w, "Request body too large", 413)
+					return
+				}
+
+				r.Body = http.MaxBytesReader(w, r.Body, size)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
-// ListenAndServe listens on the given address:port and serve the Bookmarks rest API
-func (api *API) ListenAndServe(address string) error {
-	return http.ListenAndServe(address, api.router)
+// deprecated marks responses as deprecated and points clients to the successor version of the requested resource
+func deprecated(prefix, successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+strings.TrimPrefix(r.URL.Path, prefix)+">; rel=\"successor-version\"")
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 type contextKey string
@@ -80,29 +314,106 @@ func jsonResponse(w http.ResponseWriter, code int, object interface{}) {
 	json.NewEncoder(w).Encode(object)
 }
 
-func jsonError(w http.ResponseWriter, message string, code int) {
-	jsonResponse(w, code, map[string]string{"error": message})
+// jsonList writes list, a slice or a pointer to one, as a json array, see jsonStream
+func jsonList(w http.ResponseWriter, r *http.Request, list interface{}) {
+	items := reflect.Indirect(reflect.ValueOf(list))
+
+	jsonStream(w, r, func(write func(item interface{}) error) error {
+		for i := 0; i < items.Len(); i++ {
+			if err := write(items.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// jsonStream writes the items each passes to write as a json array one item at a time and flushes
+// every listFlushSize items, so a long list is never encoded in memory as a whole. Items are
+// reduced to the comma separated fields requested with the _fields query parameter, matching
+// field names case insensitively. An error before the first item is reported like storeError
+// does, after that the array is cut short.
+func jsonStream(w http.ResponseWriter, r *http.Request, each func(write func(item interface{}) error) error) {
+	fields := r.URL.Query().Get("_fields")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started, written := false, 0
+
+	start := func() {
+		started = true
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		io.WriteString(w, "[")
+	}
+
+	err := each(func(item interface{}) error {
+		if !started {
+			start()
+		} else {
+			io.WriteString(w, ",")
+		}
+
+		if err := encoder.Encode(sparse(fields, item)); err != nil {
+			return err
+		}
+
+		written++
+		if flusher != nil && written%listFlushSize == 0 {
+			flusher.Flush()
+		}
+
+		return nil
+	})
+
+	if err != nil && !started {
+		storeError(w, err)
+		return
+	} else if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Int("written", written).Msg("Error streaming list")
+		return
+	}
+
+	if !started {
+		start()
+	}
+
+	io.WriteString(w, "]\n")
 }
 
-func webAssetHandler(w http.ResponseWriter, r *http.Request) {
-	file := strings.TrimPrefix(r.URL.Path, "/")
-	if file == "" {
-		file = "index.html"
+// sparse reduces object to the comma separated fields, all fields are kept if fields is empty
+func sparse(fields string, object interface{}) interface{} {
+	if fields == "" {
+		return object
 	}
 
-	asset, err := web.Assets.ReadFile("dist/" + file)
+	data, err := json.Marshal(object)
 	if err != nil {
-		w.WriteHeader(404)
-		return
+		return object
+	}
+
+	reduced := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &reduced); err != nil {
+		return object
+	}
+
+	for key := range reduced {
+		if !hasField(fields, key) {
+			delete(reduced, key)
+		}
 	}
 
-	if mimetype := mime.TypeByExtension(filepath.Ext(file)); mimetype != "" {
-		w.Header().Set("Content-Type", mimetype)
+	return reduced
+}
+
+func hasField(fields string, key string) bool {
+	for _, field := range strings.Split(fields, ",") {
+		if strings.EqualFold(strings.TrimSpace(field), key) {
+			return true
+		}
 	}
 
-	w.Header().Set("Cache-Control", "public, max-age=31557600") // 1 year
-	w.WriteHeader(200)
-	w.Write(asset)
+	return false
 }
 
 func asInt(value string, defaults int) int {
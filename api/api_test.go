@@ -0,0 +1,1463 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/logging"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/readlater"
+	"github.com/nrocco/bookmarks/scheduler"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog"
+)
+
+func TestThoughts(t *testing.T) {
+	router := thoughts{storage.NewMemory()}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", strings.NewReader("Hello world"))
+	r.Header.Set("X-Tags", "a,b")
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || w.Header().Get("X-Id") == "" {
+		t.Fatalf("Expected the thought to be created, got %d", w.Code)
+	}
+
+	ID := w.Header().Get("X-Id")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/"+ID, nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "Hello world" || w.Header().Get("X-Tags") != "a,b" {
+		t.Fatalf("Expected to get the thought, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?tags=b", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("X-Pagination-Total") != "1" {
+		t.Fatalf("Expected 1 thought tagged b, got %s", w.Header().Get("X-Pagination-Total"))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/0123456789abcdef", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a thought that does not exist, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?_cursor=garbage", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a malformed cursor, got %d", w.Code)
+	}
+}
+
+func TestJSONList(t *testing.T) {
+	store := storage.NewMemory()
+	for i := 0; i < listFlushSize+1; i++ {
+		if err := store.ThoughtPersist(context.Background(), &storage.Thought{Content: "Thought " + strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := thoughts{store}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?_limit=200&_fields=id,content", nil))
+
+	list := []map[string]interface{}{}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != listFlushSize+1 || len(list[0]) != 2 || list[0]["ID"] == nil || list[0]["Content"] == nil {
+		t.Fatalf("Expected %d thoughts with only an ID and Content, got %d: %v", listFlushSize+1, len(list), list[0])
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?tags=none", nil))
+
+	if w.Body.String() != "[]\n" {
+		t.Fatalf("Expected an empty list, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?_limit=-1&_offset=1&_fields=content", nil))
+
+	list = []map[string]interface{}{}
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list) != listFlushSize || w.Header().Get("X-Pagination-Total") != strconv.Itoa(listFlushSize+1) || w.Header().Get("X-Pagination-Next-Cursor") != "" {
+		t.Fatalf("Expected all but the first thought streamed with the total and without a cursor, got %d %v", len(list), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?_limit=-1&tags=none", nil))
+
+	if w.Body.String() != "[]\n" || w.Header().Get("X-Pagination-Total") != "0" {
+		t.Fatalf("Expected an empty streamed list, got %q", w.Body.String())
+	}
+}
+
+func TestStoreError(t *testing.T) {
+	w := httptest.NewRecorder()
+	storeError(w, storage.ErrUnsupported)
+
+	if w.Code != 501 || !strings.Contains(w.Body.String(), `"code":"not_implemented"`) {
+		t.Fatalf("Expected 501 not_implemented, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	storeError(w, errors.New("no such table: bookmarks"))
+
+	if w.Code != 500 || strings.Contains(w.Body.String(), "no such table") || !strings.Contains(w.Body.String(), `"message":"Internal server error"`) {
+		t.Fatalf("Expected 500 without the details of the error, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestSlash(t *testing.T) {
+	router := slash{storage.NewMemory(), "secret", "token"}.Routes(Timeouts{})
+	body := "command=%2Fbookmark&text=http%3A%2F%2F127.0.0.1%3A1%2Fa+%23go"
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	hash := hmac.New(sha256.New, []byte("secret"))
+	hash.Write([]byte("v0:" + timestamp + ":" + body))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(hash.Sum(nil)))
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Saved http://127.0.0.1:1/a") {
+		t.Fatalf("Expected the bookmark to be saved, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/", strings.NewReader(body))
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0=0123456789abcdef")
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an invalid signature, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/", strings.NewReader("token=token&"+body))
+	r.Header.Set("X-Slack-Signature", "v0=0123456789abcdef")
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an invalid signature with a valid token, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("token=token&command=%2Fbookmark&text=hello")))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Usage: /bookmark") {
+		t.Fatalf("Expected the token of Mattermost to be accepted next to a Slack signing secret, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("token=wrong&command=%2Fbookmark&text=hello")))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an invalid token, got %d", w.Code)
+	}
+
+	replies := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply, _ := ioutil.ReadAll(r.Body)
+		replies <- string(reply)
+	}))
+	defer server.Close()
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader("token=token&"+body+"&response_url="+url.QueryEscape(server.URL))))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Saving http://127.0.0.1:1/a") {
+		t.Fatalf("Expected the bookmark to be saved in the background, got %d %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case reply := <-replies:
+		if !strings.Contains(reply, "Saved http://127.0.0.1:1/a") {
+			t.Fatalf("Expected the title in the delayed reply, got %s", reply)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Expected a delayed reply to the response url")
+	}
+}
+
+func shaarliToken(secret string, issued time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"HS512"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iat":` + strconv.FormatInt(issued.Unix(), 10) + `}`))
+
+	hash := hmac.New(sha512.New, []byte(secret))
+	hash.Write([]byte(header + "." + payload))
+
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(hash.Sum(nil))
+}
+
+func newTestStore(t *testing.T) *storage.Store {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	store, err := storage.New(context.Background(), filepath.Join(tmpDir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+func TestShaarli(t *testing.T) {
+	router := shaarli{newTestStore(t), "secret"}.Routes(Timeouts{})
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+shaarliToken("secret", time.Now()))
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("POST", "/links", `{"url":"http://127.0.0.1:1/a","title":"A","tags":["go","web"]}`)
+
+	link := shaarliLink{}
+	if err := json.Unmarshal(w.Body.Bytes(), &link); err != nil || w.Code != http.StatusCreated || link.ID == 0 || link.Title != "A" {
+		t.Fatalf("Expected the link to be created, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := request("POST", "/links", `{"url":"http://127.0.0.1:1/a"}`); w.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 for a link that exists, got %d", w.Code)
+	}
+
+	if w := request("GET", "/links/"+strconv.FormatInt(link.ID, 10), ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"url":"http://127.0.0.1:1/a"`) {
+		t.Fatalf("Expected to get the link, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := request("GET", "/links?searchtags=go", ""); !strings.Contains(w.Body.String(), `"id":`+strconv.FormatInt(link.ID, 10)) {
+		t.Fatalf("Expected to list the link tagged go, got %s", w.Body.String())
+	}
+
+	if w := request("DELETE", "/tags/web", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the tag to be deleted, got %d", w.Code)
+	}
+
+	if w := request("GET", "/tags", ""); w.Body.String() != "[{\"name\":\"go\",\"occurrences\":1}]\n" {
+		t.Fatalf("Expected only tag go to remain, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/info", nil)
+	r.Header.Set("Authorization", "Bearer "+shaarliToken("secret", time.Now().Add(-time.Hour)))
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an expired token, got %d", w.Code)
+	}
+}
+
+func TestLinkding(t *testing.T) {
+	router := linkding{newTestStore(t), "token"}.Routes(Timeouts{})
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Authorization", "Token token")
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := request("POST", "/bookmarks/", `{"url":"http://127.0.0.1:1/a","title":"A","unread":true,"tag_names":["go"]}`)
+
+	bookmark := linkdingBookmark{}
+	if err := json.Unmarshal(w.Body.Bytes(), &bookmark); err != nil || w.Code != http.StatusCreated || bookmark.ID == 0 || !bookmark.Unread {
+		t.Fatalf("Expected the bookmark to be created, got %d %s", w.Code, w.Body.String())
+	}
+
+	id := strconv.FormatInt(bookmark.ID, 10)
+
+	page := linkdingPage{}
+	json.Unmarshal(request("GET", "/bookmarks/?q=%23go+!unread", "").Body.Bytes(), &page)
+	if page.Count != 1 || page.Results[0].ID != bookmark.ID {
+		t.Fatalf("Expected to find the unread bookmark tagged go, got %d", page.Count)
+	}
+
+	if w := request("POST", "/bookmarks/"+id+"/archive/", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the bookmark to be archived, got %d", w.Code)
+	}
+
+	page = linkdingPage{}
+	json.Unmarshal(request("GET", "/bookmarks/", "").Body.Bytes(), &page)
+	if page.Count != 0 {
+		t.Fatalf("Expected archived bookmarks to be hidden, got %d", page.Count)
+	}
+
+	page = linkdingPage{}
+	json.Unmarshal(request("GET", "/bookmarks/archived/", "").Body.Bytes(), &page)
+	if page.Count != 1 || !page.Results[0].IsArchived || page.Results[0].Title != "A" {
+		t.Fatalf("Expected to list the archived bookmark, got %d", page.Count)
+	}
+
+	if w := request("PATCH", "/bookmarks/"+id+"/", `{"title":"B"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"title":"B"`) || !strings.Contains(w.Body.String(), `"is_archived":true`) {
+		t.Fatalf("Expected only the title to change, got %d %s", w.Code, w.Body.String())
+	}
+
+	if w := request("GET", "/bookmarks/check/?url=http%3A%2F%2F127.0.0.1%3A1%2Fa", ""); !strings.Contains(w.Body.String(), `"id":`+id) {
+		t.Fatalf("Expected the url to be bookmarked, got %s", w.Body.String())
+	}
+}
+
+func TestInbound(t *testing.T) {
+	mapping, err := ParseInboundMapping("url=data.links.1 tags=labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseInboundMapping("link=data"); err == nil {
+		t.Fatal("Expected an error for an unknown field")
+	}
+
+	router := inbound{storage.NewMemory(), map[string]InboundMapping{"token": mapping}}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/token", strings.NewReader(`{"data": {"links": ["x", "http://127.0.0.1:1/a"]}, "labels": "#Go, web", "title": "Mine", "note": 42}`)))
+
+	bookmark := storage.Bookmark{}
+	json.Unmarshal(w.Body.Bytes(), &bookmark)
+
+	if w.Code != http.StatusCreated || bookmark.Title != "Mine" || bookmark.Excerpt != "42" || !reflect.DeepEqual(bookmark.Tags, storage.Tags{"read-it-later", "go", "web"}) {
+		t.Fatalf("Expected the bookmark to be saved from the mapped fields, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/token", strings.NewReader(`{"url": "http://127.0.0.1:1/a"}`)))
+
+	if w.Code != 422 {
+		t.Fatalf("Expected 422 for a payload without url at the mapped path, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/wrong", strings.NewReader(`{"url": "http://127.0.0.1:1/a"}`)))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for an unknown token, got %d", w.Code)
+	}
+}
+
+type fakeService struct {
+	pushed []*storage.Bookmark
+}
+
+func (service *fakeService) Push(ctx context.Context, bookmarks []*storage.Bookmark) error {
+	service.pushed = append(service.pushed, bookmarks...)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	store := storage.NewMemory()
+	service := &fakeService{}
+	router := bookmarks{store, queue.New(1), newEvents(), map[string]readlater.Service{"pocket": service}}.Routes(Timeouts{})
+
+	first := &storage.Bookmark{URL: "https://example.com/a"}
+	second := &storage.Bookmark{URL: "https://example.com/b"}
+	store.BookmarkPersist(context.Background(), first)
+	store.BookmarkPersist(context.Background(), second)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/"+first.ID+"/push/pocket", nil))
+
+	if w.Code != http.StatusOK || len(service.pushed) != 1 || service.pushed[0].URL != first.URL {
+		t.Fatalf("Expected the bookmark to be pushed, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/push/pocket", strings.NewReader(`{"IDs": ["`+first.ID+`", "`+second.ID+`"]}`)))
+
+	if w.Code != http.StatusOK || len(service.pushed) != 3 || !strings.Contains(w.Body.String(), `"Pushed":2`) {
+		t.Fatalf("Expected both bookmarks to be pushed, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/push/instapaper", strings.NewReader(`{"IDs": ["`+first.ID+`"]}`)))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a service that is not configured, got %d", w.Code)
+	}
+}
+
+func TestArchiveLinks(t *testing.T) {
+	store := storage.NewMemory()
+	router := archiveLinks{store, "secret"}.Routes(Timeouts{})
+
+	bookmark := &storage.Bookmark{URL: "https://example.com/a", Title: "A", Tags: storage.Tags{capture.ReadItLater}}
+	store.BookmarkPersist(context.Background(), bookmark)
+	link := "/" + bookmark.ID + "?signature=" + capture.ArchiveSignature("secret", bookmark.ID)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", link, nil))
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<form method="post">`) || strings.Contains(w.Body.String(), "<script>") {
+		t.Fatalf("Expected a page with a button that archives the bookmark, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", link, nil))
+	store.BookmarkGet(context.Background(), bookmark)
+
+	if w.Code != http.StatusOK || !reflect.DeepEqual(bookmark.Tags, storage.Tags{capture.Archived}) {
+		t.Fatalf("Expected the bookmark to be archived, got %d %v", w.Code, bookmark.Tags)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/"+bookmark.ID+"?signature="+capture.ArchiveSignature("other", bookmark.ID), nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for a link signed with another secret, got %d", w.Code)
+	}
+}
+
+func TestAssetETags(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "index.html")
+	if err := ioutil.WriteFile(file, []byte("<h1>First</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := assetHandler(dir)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/bookmarks", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" || w.Body.String() != "<h1>First</h1>" {
+		t.Fatalf("Expected index.html with an ETag, got %d %q: %s", w.Code, etag, w.Body.String())
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != 304 {
+		t.Fatalf("Expected 304 for the same ETag, got %d", w.Code)
+	}
+
+	if err := ioutil.WriteFile(file, []byte("<h1>Second</h1>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, r)
+	if w.Code != 200 || w.Header().Get("ETag") == etag || w.Body.String() != "<h1>Second</h1>" {
+		t.Fatalf("Expected a new ETag for the modified index.html, got %d %q: %s", w.Code, w.Header().Get("ETag"), w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/missing.js", nil))
+	if w.Code != 404 {
+		t.Fatalf("Expected 404 for a missing asset, got %d", w.Code)
+	}
+}
+
+func TestPeriodical(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "periodical.epub")
+	router := periodical{path}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected 404 before the periodical is compiled, got %d", w.Code)
+	}
+
+	ioutil.WriteFile(path, []byte("epub"), 0600)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/epub+zip" || w.Body.String() != "epub" {
+		t.Fatalf("Expected the periodical, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if disposition := w.Header().Get("Content-Disposition"); !strings.HasPrefix(disposition, "attachment; filename=bookmarks-") {
+		t.Fatalf("Expected a dated file name, got %s", disposition)
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	store := newTestStore(t)
+	router := authenticator(store, "", "", "/")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/bookmarks", nil))
+	if w.Code != 200 {
+		t.Fatalf("Expected 200 without credentials or users, got %d", w.Code)
+	}
+
+	user := &storage.User{Username: "alice"}
+	user.SetPassword("secret")
+	token := user.NewToken()
+	if err := store.UserPersist(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/bookmarks", nil))
+	if w.Code != 401 {
+		t.Fatalf("Expected 401 once a user exists, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/v1/bookmarks", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("Expected 200 for the api token, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", "/api/v1/token", strings.NewReader("username=alice&password=secret"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, r)
+	if w.Code != 204 || len(w.Result().Cookies()) != 1 {
+		t.Fatalf("Expected 204 and a token cookie for the password of alice, got %d", w.Code)
+	}
+
+	cookie := w.Result().Cookies()[0]
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/bookmarks", nil)
+	r.AddCookie(cookie)
+	router.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("Expected 200 for the token cookie, got %d", w.Code)
+	}
+
+	user.SetPassword("changed")
+	if err := store.UserPersist(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/bookmarks", nil)
+	r.AddCookie(cookie)
+	router.ServeHTTP(w, r)
+	if w.Code != 401 {
+		t.Fatalf("Expected 401 for the cookie of the old password, got %d", w.Code)
+	}
+
+	user.Disabled = true
+	if err := store.UserPersist(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/bookmarks", nil))
+	if w.Code != 401 {
+		t.Fatalf("Expected 401 once the only user is disabled, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/api/v1/bookmarks", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, r)
+	if w.Code != 401 {
+		t.Fatalf("Expected 401 for the api token of a disabled user, got %d", w.Code)
+	}
+
+	store.Close()
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/bookmarks", nil))
+	if w.Code != 503 {
+		t.Fatalf("Expected 503 if the users can not be counted, got %d", w.Code)
+	}
+}
+
+func TestRefreshSettings(t *testing.T) {
+	store := newTestStore(t)
+	q := queue.New(1)
+
+	refresher, err := scheduler.NewRefresher(q, scheduler.DefaultRefreshBatchSize, scheduler.DefaultRefreshWindow, scheduler.DefaultRefreshMaxErrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler.RegisterJobs(q, store, scheduler.DefaultRetention, refresher)
+	if err := scheduler.RegisterSchedules(q, map[string]string{"feeds": "*/15 * * * *"}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := admin{store, q, refresher, nil}.Routes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/refresh", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Interval":"*/15 * * * *","BatchSize":100,"Window":"1h0m0s","MaxErrors":10`) {
+		t.Fatalf("Expected the default refresh settings, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PATCH", "/refresh", strings.NewReader(`{"Interval": "*/5 * * * *", "Window": "30m", "MaxErrors": 3}`)))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Interval":"*/5 * * * *","BatchSize":100,"Window":"30m0s","MaxErrors":3`) {
+		t.Fatalf("Expected the changed refresh settings, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if schedules := q.Schedules(); len(schedules) != 1 || schedules[0].Spec != "*/5 * * * *" {
+		t.Fatalf("Expected the feeds schedule to run every 5 minutes, got %v", schedules)
+	}
+
+	for _, body := range []string{`{"Window": "soon"}`, `{"BatchSize": 0}`, `{"MaxErrors": -1}`, `{"Interval": "often"}`} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PATCH", "/refresh", strings.NewReader(body)))
+		if w.Code != 422 {
+			t.Fatalf("Expected 422 for %s, got %d", body, w.Code)
+		}
+	}
+
+	if settings := refresher.Settings(); settings.Interval != "*/5 * * * *" || settings.Window != 30*time.Minute {
+		t.Fatalf("Expected invalid settings to be ignored, got %+v", settings)
+	}
+}
+
+func TestLoggingSettings(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	output, err := logging.New(ioutil.Discard, logging.Settings{Level: "info", Format: logging.FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := admin{newTestStore(t), queue.New(1), nil, output}.Routes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("PATCH", "/logging", strings.NewReader(`{"Level": "debug"}`)))
+	if w.Code != 200 || w.Body.String() != `{"Level":"debug","Format":"json"}`+"\n" {
+		t.Fatalf("Expected the changed logging settings, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if zerolog.GlobalLevel() != zerolog.DebugLevel {
+		t.Fatalf("Expected to log debug messages, got %s", zerolog.GlobalLevel())
+	}
+
+	for _, body := range []string{`{"Level": "loud"}`, `{"Format": "xml"}`} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("PATCH", "/logging", strings.NewReader(body)))
+		if w.Code != 422 {
+			t.Fatalf("Expected 422 for %s, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestExportSettings(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	output, err := logging.New(ioutil.Discard, logging.Settings{Level: "info", Format: logging.FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTestStore(t)
+
+	w := httptest.NewRecorder()
+	exports{store, settings{nil, output}}.Routes().ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Settings":{"Logging":{"Level":"info","Format":"json"}}`) {
+		t.Fatalf("Expected the logging settings in the export, got %d: %s", w.Code, w.Body.String())
+	}
+
+	router := imports{store, queue.New(1), settings{nil, output}, ""}.Routes(Timeouts{})
+	body := `{"Settings": {"Logging": {"Level": "debug", "Format": "json"}}}`
+
+	for _, admin := range []bool{false, true} {
+		r := httptest.NewRequest("POST", "/?strategy=overwrite", strings.NewReader(body))
+		r = r.WithContext(context.WithValue(r.Context(), contextKeyUser, &storage.User{Username: "alice", Admin: admin}))
+
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != 200 {
+			t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+
+		if level := output.Settings().Level; (admin && level != "debug") || (!admin && level != "info") {
+			t.Fatalf("Expected only an admin to import the settings, got %s for admin %v", level, admin)
+		}
+	}
+}
+
+func TestExportFeeds(t *testing.T) {
+	store := storage.NewMemory()
+	for _, feed := range []*storage.Feed{
+		{URL: "https://example.com/go.xml", Title: "Go & more", Tags: storage.Tags{"go", "dev"}},
+		{URL: "https://example.com/news.xml", Title: "News"},
+		{URL: "https://example.com/rust.xml", Title: "Rust", Tags: storage.Tags{"dev"}},
+	} {
+		if err := store.FeedPersist(context.Background(), feed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := feeds{store, queue.New(1)}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/export", nil))
+
+	document := opmlDocument{}
+	if err := xml.Unmarshal(w.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != 200 || w.Header().Get("Content-Type") != "text/x-opml; charset=utf-8" || document.Version != "2.0" || len(document.Outlines) != 3 {
+		t.Fatalf("Expected an OPML document with 3 outlines, got %d %s", w.Code, w.Body.String())
+	}
+
+	dev, goFolder, news := document.Outlines[0], document.Outlines[1], document.Outlines[2]
+	if dev.Text != "dev" || len(dev.Outlines) != 1 || dev.Outlines[0].XMLURL != "https://example.com/rust.xml" {
+		t.Fatalf("Expected the dev folder with Rust, got %+v", dev)
+	}
+	if goFolder.Text != "go" || len(goFolder.Outlines) != 1 || goFolder.Outlines[0].Title != "Go & more" || goFolder.Outlines[0].Category != "/go,/dev" {
+		t.Fatalf("Expected the go folder with Go & more, got %+v", goFolder)
+	}
+	if news.XMLURL != "https://example.com/news.xml" || news.Type != "rss" {
+		t.Fatalf("Expected the untagged feed last, got %+v", news)
+	}
+}
+
+func TestCreateFeedDiscovery(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/feed.xml" {
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Blog</title><item><title>Post</title><link>http://127.0.0.1:1/post</link></item></channel></rss>`))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" title="Blog" href="/feed.xml"></head></html>`))
+	}))
+	defer site.Close()
+
+	router := feeds{storage.NewMemory(), queue.New(1)}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/discover?url="+site.URL, nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"URL":"`+site.URL+`/feed.xml"`) {
+		t.Fatalf("Expected the discovered feed, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"URL": "`+site.URL+`"}`)))
+
+	feed := storage.Feed{}
+	json.NewDecoder(w.Body).Decode(&feed)
+
+	if w.Code != 200 || feed.URL != site.URL+"/feed.xml" || feed.Title != "Blog" || len(feed.Items) != 1 {
+		t.Fatalf("Expected the feed the site links to, got %d %s %s", w.Code, feed.URL, feed.Title)
+	}
+}
+
+func TestReadFeedItems(t *testing.T) {
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml", Items: storage.FeedItems{{ID: "old", Date: time.Now().Add(-48 * time.Hour)}, {ID: "new", Date: time.Now()}}}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := feeds{store, queue.New(1)}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("POST", "/"+feed.ID+"/read?before=yesterday", nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for an invalid date, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("POST", "/"+feed.ID+"/read?before="+time.Now().Add(-time.Hour).Format(time.RFC3339), nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Feeds":1`) {
+		t.Fatalf("Expected the old item to be read, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	items{store}.Routes(Timeouts{}).ServeHTTP(w, httptest.NewRequest("POST", "/read", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Feeds":1`) {
+		t.Fatalf("Expected the new item to be read, got %d %s", w.Code, w.Body.String())
+	}
+
+	store.FeedGet(ctx, feed)
+	if len(feed.Items) != 0 {
+		t.Fatalf("Expected every item to be read, got %d", len(feed.Items))
+	}
+}
+
+func TestStarFeedItem(t *testing.T) {
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml", Items: storage.FeedItems{{ID: "interesting", Date: time.Now()}, {ID: "boring", Date: time.Now()}}}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := feeds{store, queue.New(1)}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("PATCH", "/"+feed.ID+"/items/missing/", strings.NewReader(`{"Starred": true}`)))
+	if w.Code != 404 {
+		t.Fatalf("Expected 404 for a missing item, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("PATCH", "/"+feed.ID+"/items/interesting/", strings.NewReader(`{"ID": "renamed", "Starred": true}`)))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"ID":"interesting"`) || !strings.Contains(w.Body.String(), `"Starred":true`) {
+		t.Fatalf("Expected the item to be starred, got %d %s", w.Code, w.Body.String())
+	}
+
+	items := items{store}.Routes(Timeouts{})
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("POST", "/read", nil))
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?starred=true", nil))
+	if w.Code != 200 || w.Header().Get("X-Pagination-Total") != "1" || !strings.Contains(w.Body.String(), `"FeedID":"`+feed.ID+`"`) {
+		t.Fatalf("Expected the starred item to be kept, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestListFeedItems(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml", Items: storage.FeedItems{
+		{ID: "old", Title: "Bravo", Date: now.Add(-time.Hour)},
+		{ID: "new", Title: "Charlie", Date: now},
+		{ID: "older", Title: "Alpha", Date: now.Add(-2 * time.Hour)},
+	}}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	items := items{store}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?_sort=title", nil))
+	if w.Code != 200 || strings.Index(w.Body.String(), "Alpha") > strings.Index(w.Body.String(), "Bravo") {
+		t.Fatalf("Expected the items sorted on title, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?_sort=content", nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for an unknown sort field, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?_limit=2", nil))
+	cursor := w.Header().Get("X-Pagination-Next-Cursor")
+	if w.Code != 200 || cursor == "" {
+		t.Fatalf("Expected a cursor to the next page, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?_sort=title&_cursor="+cursor, nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for a cursor combined with a sort, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?_sort=title&_limit=2", nil))
+	if w.Code != 200 || w.Header().Get("X-Pagination-Next-Cursor") != "" {
+		t.Fatalf("Expected no cursor for a sorted page, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?_cursor=garbage", nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for a malformed cursor, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?q=brav&_limit=1", nil))
+	if w.Code != 200 || w.Header().Get("X-Pagination-Total") != "1" || !strings.Contains(w.Body.String(), "Bravo") || w.Header().Get("X-Pagination-Next-Cursor") != "" {
+		t.Fatalf("Expected to find the item by its title, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("GET", "/?q=brav&_cursor="+cursor, nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for a cursor combined with a search, got %d", w.Code)
+	}
+}
+
+func TestRankedSearchPaging(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	titles := []string{"golang", "golang golang", "Learning golang", "golang tips and golang tricks", "Why golang"}
+	for i, title := range titles {
+		bookmark := &storage.Bookmark{Title: title, URL: "https://example.com/" + strconv.Itoa(i)}
+		if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := bookmarks{store: store}.Routes(Timeouts{})
+	seen := map[string]int{}
+
+	for offset := 0; offset < len(titles); offset += 2 {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/?q=golang&_limit=2&_offset="+strconv.Itoa(offset), nil))
+		if w.Code != 200 || w.Header().Get("X-Pagination-Next-Cursor") != "" {
+			t.Fatalf("Expected a page of search results without a cursor, got %d", w.Code)
+		}
+
+		page := []storage.Bookmark{}
+		if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+			t.Fatal(err)
+		}
+		for _, bookmark := range page {
+			seen[bookmark.ID]++
+		}
+	}
+
+	if len(seen) != len(titles) {
+		t.Fatalf("Expected to see all %d matches, got %d", len(titles), len(seen))
+	}
+	for ID, count := range seen {
+		if count != 1 {
+			t.Fatalf("Expected to see %s once, got %d times", ID, count)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?q=golang&_cursor="+storage.NewCursor(time.Now(), "x"), nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for a cursor combined with a search, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/?_cursor=garbage", nil))
+	if w.Code != 400 {
+		t.Fatalf("Expected 400 for a malformed cursor, got %d", w.Code)
+	}
+}
+
+func TestBookmarkFeedItem(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/article" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Page title</title></head><body><article><p>` + strings.Repeat("The full content of the article. ", 20) + `</p></article></body></html>`))
+	}))
+	defer site.Close()
+
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml", Items: storage.FeedItems{
+		{ID: "article", Title: "Item title", URL: site.URL + "/article", Content: "Summary", Date: time.Now()},
+		{ID: "gone", Title: "Gone", URL: "http://127.0.0.1:1/gone", Content: "Only the summary", Date: time.Now()},
+	}}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	items := items{store}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("POST", "/missing/bookmark", nil))
+	if w.Code != 404 {
+		t.Fatalf("Expected 404 for a missing item, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("POST", "/article/bookmark", nil))
+
+	bookmark := storage.Bookmark{}
+	json.NewDecoder(w.Body).Decode(&bookmark)
+
+	if w.Code != 200 || bookmark.Title != "Item title" || !strings.Contains(bookmark.Content, "The full content") || bookmark.Tags[0] != "read-it-later" {
+		t.Fatalf("Expected a bookmark with the content of the page, got %d %v", w.Code, bookmark)
+	}
+
+	w = httptest.NewRecorder()
+	items.ServeHTTP(w, httptest.NewRequest("POST", "/gone/bookmark?read=true", nil))
+
+	bookmark = storage.Bookmark{}
+	json.NewDecoder(w.Body).Decode(&bookmark)
+
+	if w.Code != 200 || bookmark.Content != "Only the summary" || bookmark.Status != storage.BookmarkFailed {
+		t.Fatalf("Expected a bookmark with the content of the item, got %d %v", w.Code, bookmark)
+	}
+
+	store.FeedGet(ctx, feed)
+	if len(feed.Items) != 1 || feed.Items[0].ID != "article" {
+		t.Fatalf("Expected only the bookmarked item to be read, got %d items", len(feed.Items))
+	}
+}
+
+func TestFeedRefreshInterval(t *testing.T) {
+	store := storage.NewMemory()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml"}
+	if err := store.FeedPersist(context.Background(), feed); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := feeds{store, queue.New(1)}.Routes(Timeouts{})
+
+	for body, code := range map[string]int{`{"RefreshInterval": "soon"}`: 400, `{"RefreshInterval": "-1h"}`: 422, `{"RefreshInterval": "15m"}`: 200} {
+		w := httptest.NewRecorder()
+		feeds.ServeHTTP(w, httptest.NewRequest("PATCH", "/"+feed.ID+"/", strings.NewReader(body)))
+		if w.Code != code {
+			t.Fatalf("Expected %d for %s, got %d %s", code, body, w.Code, w.Body.String())
+		}
+	}
+
+	w := httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("GET", "/"+feed.ID+"/", nil))
+	if !strings.Contains(w.Body.String(), `"RefreshInterval":"15m0s"`) {
+		t.Fatalf("Expected the refresh interval of the feed, got %s", w.Body.String())
+	}
+}
+
+func TestPauseFeed(t *testing.T) {
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml", Refreshed: time.Now().Add(-2 * time.Hour)}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := feeds{store, queue.New(1)}.Routes(Timeouts{})
+	due := func() int {
+		_, totalCount := store.FeedList(ctx, &storage.FeedListOptions{NotRefreshedSince: time.Now().Add(-time.Hour), Limit: 10})
+		return totalCount
+	}
+
+	w := httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("POST", "/"+feed.ID+"/pause", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Paused":true`) || due() != 0 {
+		t.Fatalf("Expected the feed to be paused, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("POST", "/"+feed.ID+"/resume", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Paused":false`) || due() != 1 {
+		t.Fatalf("Expected the feed to be resumed, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFeedIcon(t *testing.T) {
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml"}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := feeds{store, queue.New(1)}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("GET", "/"+feed.ID+"/icon", nil))
+	if w.Code != 404 {
+		t.Fatalf("Expected 404 for a feed without an icon, got %d", w.Code)
+	}
+
+	if err := store.FeedIconPersist(ctx, &storage.FeedIcon{FeedID: feed.ID, ContentType: "image/png", Data: []byte("png")}); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("GET", "/"+feed.ID+"/icon", nil))
+	if w.Code != 200 || w.Header().Get("Content-Type") != "image/png" || w.Body.String() != "png" {
+		t.Fatalf("Expected the icon of the feed, got %d %s %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	svg := `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`
+	if err := store.FeedIconPersist(ctx, &storage.FeedIcon{FeedID: feed.ID, ContentType: "image/svg+xml", Data: []byte(svg)}); err != nil {
+		t.Fatal(err)
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("GET", "/"+feed.ID+"/icon", nil))
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || !strings.Contains(w.Header().Get("Content-Security-Policy"), "sandbox") {
+		t.Fatalf("Expected an svg icon to be served in a sandbox, got %v", w.Header())
+	}
+}
+
+func TestFeedFilters(t *testing.T) {
+	store := storage.NewMemory()
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml"}
+	if err := store.FeedPersist(context.Background(), feed); err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := feeds{store, queue.New(1)}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("POST", "/"+feed.ID+"/filters", strings.NewReader(`{"Pattern": "(", "Action": "drop"}`)))
+	if w.Code != 422 {
+		t.Fatalf("Expected 422 for an invalid pattern, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("POST", "/"+feed.ID+"/filters", strings.NewReader(`{"Field": "title", "Pattern": "(?i)sponsored", "Action": "drop"}`)))
+
+	filter := storage.FeedFilter{}
+	json.NewDecoder(w.Body).Decode(&filter)
+
+	if w.Code != 200 || filter.ID == "" || filter.Pattern != "(?i)sponsored" {
+		t.Fatalf("Expected the filter to be created, got %d %+v", w.Code, filter)
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("PATCH", "/"+feed.ID+"/filters/"+filter.ID+"/", strings.NewReader(`{"Action": "keep"}`)))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"Action":"keep"`) {
+		t.Fatalf("Expected the filter to be updated, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("GET", "/"+feed.ID+"/filters", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"ID":"`+filter.ID+`"`) || strings.Count(w.Body.String(), `"ID"`) != 1 {
+		t.Fatalf("Expected the filter of the feed, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("DELETE", "/"+feed.ID+"/filters/"+filter.ID+"/", nil))
+	if w.Code != 204 {
+		t.Fatalf("Expected the filter to be deleted, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	feeds.ServeHTTP(w, httptest.NewRequest("GET", "/"+feed.ID+"/filters/"+filter.ID+"/", nil))
+	if w.Code != 404 {
+		t.Fatalf("Expected 404 for a deleted filter, got %d", w.Code)
+	}
+}
+
+func TestPatchKeepsHiddenFields(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	bookmark := &storage.Bookmark{URL: "https://example.com/article", Etag: `"v1"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}
+	if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := &storage.Feed{URL: "https://example.com/feed.xml", Seen: storage.Seen{"first", "second"}}
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	bookmarks{store, queue.New(1), newEvents(), nil}.Routes(Timeouts{}).ServeHTTP(w, httptest.NewRequest("PATCH", "/"+bookmark.ID+"/", strings.NewReader(`{"Title": "Renamed"}`)))
+	if w.Code != 200 {
+		t.Fatalf("Expected the bookmark to be updated, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	feeds{store, queue.New(1)}.Routes(Timeouts{}).ServeHTTP(w, httptest.NewRequest("PATCH", "/"+feed.ID+"/", strings.NewReader(`{"Title": "Renamed"}`)))
+	if w.Code != 200 {
+		t.Fatalf("Expected the feed to be updated, got %d %s", w.Code, w.Body.String())
+	}
+
+	bookmark = &storage.Bookmark{ID: bookmark.ID}
+	if err := store.BookmarkGet(ctx, bookmark); err != nil || bookmark.Title != "Renamed" || bookmark.Etag != `"v1"` || bookmark.LastModified != "Wed, 21 Oct 2015 07:28:00 GMT" {
+		t.Fatalf("Expected the validators of the bookmark to survive the patch, got %q %q %q (%v)", bookmark.Title, bookmark.Etag, bookmark.LastModified, err)
+	}
+
+	feed = &storage.Feed{ID: feed.ID}
+	if err := store.FeedGet(ctx, feed); err != nil || feed.Title != "Renamed" || len(feed.Seen) != 2 {
+		t.Fatalf("Expected the seen entries of the feed to survive the patch, got %q %v (%v)", feed.Title, feed.Seen, err)
+	}
+}
+
+func TestProfiling(t *testing.T) {
+	router := admin{newTestStore(t), queue.New(1), nil, nil}.Routes()
+
+	for path, expected := range map[string]int{
+		"/debug/pprof/":             200,
+		"/debug/pprof/heap?debug=1": 200,
+		"/debug/pprof/goroutine":    200,
+		"/debug/pprof/unknown":      404,
+		"/debug/vars":               200,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != expected {
+			t.Fatalf("Expected %d for %s, got %d", expected, path, w.Code)
+		}
+	}
+}
+
+func TestCreateBookmarkAsync(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Fetched later</title></head><body><p>Some content worth reading</p></body></html>`))
+	}))
+	defer page.Close()
+
+	store := newTestStore(t)
+	q := queue.New(1)
+
+	refresher, _ := scheduler.NewRefresher(q, scheduler.DefaultRefreshBatchSize, scheduler.DefaultRefreshWindow, scheduler.DefaultRefreshMaxErrors)
+	scheduler.RegisterJobs(q, store, scheduler.DefaultRetention, refresher)
+
+	events := newEvents()
+	q.OnSucceeded(publishFetched(events, storage.BookmarkFetched))
+
+	server := httptest.NewServer(bookmarks{store, q, events, nil}.Routes(Timeouts{}))
+	defer server.Close()
+
+	stream, err := http.Get(server.URL + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+
+	if stream.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", stream.Header.Get("Content-Type"))
+	}
+
+	response, err := http.Post(server.URL, "application/json", strings.NewReader(`{"URL": "`+page.URL+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bookmark := storage.Bookmark{}
+	json.NewDecoder(response.Body).Decode(&bookmark)
+	response.Body.Close()
+
+	if response.StatusCode != 202 || bookmark.Status != storage.BookmarkPending {
+		t.Fatalf("Expected a pending bookmark, got %d %s", response.StatusCode, bookmark.Status)
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	lines := bufio.NewScanner(stream.Body)
+	for lines.Scan() && !strings.HasPrefix(lines.Text(), "data: ") {
+	}
+
+	if expected := `data: {"ID":"` + bookmark.ID + `","Status":"fetched"}`; lines.Text() != expected {
+		t.Fatalf("Expected %s, got %s", expected, lines.Text())
+	}
+
+	if err := store.BookmarkGet(context.Background(), &bookmark); err != nil || bookmark.Status != storage.BookmarkFetched || bookmark.Title != "Fetched later" {
+		t.Fatalf("Expected the fetched bookmark, got %s %s (%v)", bookmark.Status, bookmark.Title, err)
+	}
+}
+
+func TestSaveBookmark(t *testing.T) {
+	store := newTestStore(t)
+	q := queue.New(1)
+	q.Register(scheduler.JobFetchBookmark, func(ctx context.Context, job *queue.Job) error { return nil }, queue.RetryPolicy{})
+	router := bookmarks{store, q, newEvents(), nil}.Routes(Timeouts{})
+
+	for _, request := range []*http.Request{
+		httptest.NewRequest("POST", "/", strings.NewReader(`{"URL": "foo"}`)),
+		httptest.NewRequest("POST", "/", strings.NewReader(`{"URL": "ftp://example.com/file"}`)),
+		httptest.NewRequest("GET", "/save?url="+url.QueryEscape("javascript:alert(1)"), nil),
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, request)
+
+		if w.Code != 422 || !strings.Contains(w.Body.String(), "absolute http or https url") {
+			t.Fatalf("Expected 422 for an invalid url, got %d %s", w.Code, w.Body.String())
+		}
+	}
+
+	if _, totalCount := store.BookmarkList(context.Background(), &storage.BookmarkListOptions{}); totalCount != 0 {
+		t.Fatalf("Expected no bookmark to be saved with an invalid url, got %d", totalCount)
+	}
+
+	saved := &storage.Bookmark{URL: "https://example.com/saved", Title: "Saved", Content: "Content worth keeping", Tags: storage.Tags{"go"}}
+	if err := store.BookmarkPersist(context.Background(), saved); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/save?url="+url.QueryEscape(saved.URL), nil))
+
+	if w.Code != 302 || w.Header().Get("Location") != saved.URL {
+		t.Fatalf("Expected a redirect to the saved bookmark, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	bookmark := storage.Bookmark{ID: saved.ID}
+	if err := store.BookmarkGet(context.Background(), &bookmark); err != nil || bookmark.Title != "Saved" || bookmark.Content != "Content worth keeping" || bookmark.Status != storage.BookmarkFetched || strings.Join(bookmark.Tags, ",") != "go,read-it-later" {
+		t.Fatalf("Expected the saved bookmark to keep its content and get the new tag, got %+v (%v)", bookmark, err)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	store := newTestStore(t)
+	router := imports{store, queue.New(1), settings{}, ""}.Routes(Timeouts{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/?dry_run=true", strings.NewReader(`{"Bookmarks": [{"URL": "https://example.com"}, {"URL": "https://example.com"}]}`)))
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	result := storage.ImportResult{}
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.DryRun || result.Created != 1 || result.Skipped != 1 || len(result.Records) != 2 || result.Records[1].Action != "skip" {
+		t.Fatalf("Expected a dry run that creates the first bookmark and skips the duplicate, got %+v", result)
+	}
+
+	if _, totalCount := store.BookmarkList(context.Background(), &storage.BookmarkListOptions{}); totalCount != 0 {
+		t.Fatalf("Expected the dry run to write nothing, got %d bookmarks", totalCount)
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	for name, store := range map[string]storage.Storer{"sqlite": newTestStore(t), "memory": storage.NewMemory()} {
+		options := Options{Username: "root", Password: "secret"}
+		router := authenticator(store, options.Username, options.Password, "/")(adminOnly(store, options)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(200)
+		})))
+
+		tokens := map[string]string{}
+		for _, user := range []*storage.User{{Username: "alice", Admin: true}, {Username: "bob"}} {
+			tokens[user.Username] = user.NewToken()
+			if err := store.UserPersist(context.Background(), user); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for username, code := range map[string]int{"alice": 200, "bob": 403} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/api/v1/admin/stats", nil)
+			r.Header.Set("Authorization", "Bearer "+tokens[username])
+			router.ServeHTTP(w, r)
+			if w.Code != code {
+				t.Fatalf("%s: Expected %d for %s, got %d", name, code, username, w.Code)
+			}
+		}
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/api/v1/token", strings.NewReader("username=root&password=secret"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(w, r)
+		if w.Code != 204 || len(w.Result().Cookies()) != 1 {
+			t.Fatalf("%s: Expected a token cookie for the configured username, got %d", name, w.Code)
+		}
+
+		cookie := w.Result().Cookies()[0]
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest("GET", "/api/v1/admin/stats", nil)
+		r.AddCookie(cookie)
+		router.ServeHTTP(w, r)
+		if w.Code != 200 {
+			t.Fatalf("%s: Expected 200 for the configured username, got %d", name, w.Code)
+		}
+
+		options.Unauthenticated = true
+		w = httptest.NewRecorder()
+		adminOnly(store, options)(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/stats", nil))
+		if w.Code != 403 {
+			t.Fatalf("%s: Expected 403 without authentication, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestMetricsRequireAuthentication(t *testing.T) {
+	store := newTestStore(t)
+
+	user := &storage.User{Username: "alice"}
+	token := user.NewToken()
+	if err := store.UserPersist(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	api := New(zerolog.Nop(), store, queue.New(1), Options{})
+
+	w := httptest.NewRecorder()
+	api.router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 401 {
+		t.Fatalf("Expected 401 for the metrics without credentials, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	api.router.ServeHTTP(w, r)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "go_goroutines") {
+		t.Fatalf("Expected the metrics for the api token, got %d", w.Code)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	store := newTestStore(t)
+	q := queue.New(1)
+
+	w := httptest.NewRecorder()
+	livenessHandler(w, httptest.NewRequest("GET", "/livez", nil))
+	if w.Code != 200 {
+		t.Fatalf("Expected 200 for /livez, got %d", w.Code)
+	}
+
+	readiness := readinessHandler(store, map[string]HealthCheck{"workers": q.Ready})
+
+	w = httptest.NewRecorder()
+	readiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != 503 || !strings.Contains(w.Body.String(), `"workers":{"status":"error"`) {
+		t.Fatalf("Expected 503 before the workers started, got %d: %s", w.Code, w.Body.String())
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	w = httptest.NewRecorder()
+	readiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), `"migrations":{"status":"ok"}`) {
+		t.Fatalf("Expected 200 once the workers started, got %d: %s", w.Code, w.Body.String())
+	}
+}
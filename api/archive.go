@@ -0,0 +1,93 @@
+package api
+
+import (
+	"crypto/hmac"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// archiveLinks archives bookmarks from the links in the email digest, the link is signed for a
+// single bookmark so it works without logging in
+type archiveLinks struct {
+	store  storage.Storer
+	secret string
+}
+
+func (api archiveLinks) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/{id}", api.confirm)
+	r.With(timeout(timeouts.Write)).Post("/{id}", api.archive)
+
+	return r
+}
+
+// archivePage asks to click a button before it archives the bookmark, so the link scanners of mail
+// providers, which open links and sometimes run their scripts, do not archive it
+var archivePage = template.Must(template.New("archive").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{ .Title }}</title>
+    <style>body { max-width: 40em; margin: 2em auto; padding: 0 1em; font-family: Georgia, serif; line-height: 1.6; }</style>
+  </head>
+  <body>
+    {{ if .Archived }}<p>Archived <a href="{{ .URL }}">{{ .Title }}</a></p>
+    {{ else }}<form method="post">
+      <p><a href="{{ .URL }}">{{ .Title }}</a></p>
+      <button type="submit">Archive</button>
+    </form>
+    {{ end }}
+  </body>
+</html>
+`))
+
+// bookmark gets the bookmark of the link, links with an invalid signature are delayed like failed
+// logins
+func (api *archiveLinks) bookmark(w http.ResponseWriter, r *http.Request) (*storage.Bookmark, bool) {
+	ID := chi.URLParam(r, "id")
+
+	if !hmac.Equal([]byte(r.URL.Query().Get("signature")), []byte(capture.ArchiveSignature(api.secret, ID))) {
+		time.Sleep(2 * time.Second)
+		jsonError(w, "Unauthorized", 401)
+		return nil, false
+	}
+
+	bookmark := &storage.Bookmark{ID: ID}
+	if err := api.store.BookmarkGet(r.Context(), bookmark); err != nil {
+		jsonError(w, "Bookmark Not Found", 404)
+		return nil, false
+	}
+
+	return bookmark, true
+}
+
+func (api *archiveLinks) confirm(w http.ResponseWriter, r *http.Request) {
+	bookmark, ok := api.bookmark(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	archivePage.Execute(w, map[string]interface{}{"Title": bookmark.Title, "URL": bookmark.URL, "Archived": false})
+}
+
+func (api *archiveLinks) archive(w http.ResponseWriter, r *http.Request) {
+	bookmark, ok := api.bookmark(w, r)
+	if !ok {
+		return
+	}
+
+	if err := capture.Archive(r.Context(), api.store, bookmark); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	archivePage.Execute(w, map[string]interface{}{"Title": bookmark.Title, "URL": bookmark.URL, "Archived": true})
+}
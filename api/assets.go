@@ -0,0 +1,152 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nrocco/bookmarks/web"
+)
+
+var (
+	// hashedAsset matches file names fingerprinted by the frontend build, like js/app.3f2a9c1d.js
+	hashedAsset = regexp.MustCompile(`\.[0-9a-f]{8,}\.(js|css)$`)
+
+	// startTime is used as the modification time of embedded assets, which do not have one
+	startTime = time.Now()
+)
+
+// assetETag is the ETag of an asset as it was at its modification time
+type assetETag struct {
+	modified time.Time
+	etag     string
+}
+
+// assetETags caches the ETags of assets, an asset is only hashed again when it is modified
+type assetETags struct {
+	mutex sync.Mutex
+	etags map[string]assetETag
+}
+
+// get returns the ETag of the file, hashing it if it was modified since it was last hashed
+func (etags *assetETags) get(assets fs.FS, file string, modified time.Time) (string, error) {
+	etags.mutex.Lock()
+	cached, ok := etags.etags[file]
+	etags.mutex.Unlock()
+
+	if ok && cached.modified.Equal(modified) {
+		return cached.etag, nil
+	}
+
+	asset, err := fs.ReadFile(assets, file)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha1.Sum(asset)
+	etag := `"` + hex.EncodeToString(hash[:8]) + `"`
+
+	etags.mutex.Lock()
+	etags.etags[file] = assetETag{modified, etag}
+	etags.mutex.Unlock()
+
+	return etag, nil
+}
+
+// openAsset opens a file of assets with its modification time, directories do not exist
+func openAsset(assets fs.FS, file string) (fs.File, time.Time, error) {
+	f, err := assets.Open(file)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		f.Close()
+		return nil, time.Time{}, fs.ErrNotExist
+	}
+
+	// Embedded assets do not have a modification time
+	if info.ModTime().IsZero() {
+		return f, startTime, nil
+	}
+
+	return f, info.ModTime(), nil
+}
+
+// assetHandler serves the frontend from dir, or the embedded assets if dir is empty. Paths that
+// do not exist and look like application routes fall back to index.html. The ETags of embedded
+// assets are computed once, those of assets in dir whenever they are modified.
+func assetHandler(dir string) http.HandlerFunc {
+	etags := &assetETags{etags: map[string]assetETag{}}
+
+	var assets fs.FS
+	if dir != "" {
+		assets = os.DirFS(dir)
+	} else {
+		assets, _ = fs.Sub(web.Assets, "dist")
+		fs.WalkDir(assets, ".", func(file string, entry fs.DirEntry, err error) error {
+			if err == nil && !entry.IsDir() {
+				etags.get(assets, file, startTime)
+			}
+			return nil
+		})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		file := strings.TrimPrefix(path.Clean(r.URL.Path), "/")
+		if file == "" {
+			file = "index.html"
+		}
+
+		f, modified, err := openAsset(assets, file)
+		if err != nil && path.Ext(file) == "" {
+			file = "index.html"
+			f, modified, err = openAsset(assets, file)
+		}
+
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+		defer f.Close()
+
+		etag, err := etags.get(assets, file, modified)
+		if err != nil {
+			w.WriteHeader(404)
+			return
+		}
+
+		content, ok := f.(io.ReadSeeker)
+		if !ok {
+			asset, err := io.ReadAll(f)
+			if err != nil {
+				w.WriteHeader(404)
+				return
+			}
+			content = bytes.NewReader(asset)
+		}
+
+		w.Header().Set("ETag", etag)
+
+		if file == "index.html" {
+			w.Header().Set("Cache-Control", "no-cache")
+		} else if hashedAsset.MatchString(file) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=86400")
+		}
+
+		// ServeContent sets the content type and answers conditional requests with a 304
+		http.ServeContent(w, r, file, modified, content)
+	}
+}
@@ -1,38 +1,59 @@
 package api
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/nrocco/bookmarks/storage"
 	"github.com/rs/zerolog/hlog"
 )
 
-func authenticator(username, password string) func(http.Handler) http.Handler {
+var (
+	contextKeyUser = contextKey("user")
+)
+
+// authenticator allows requests with the token cookie of the configured username and password or
+// of a user in the database, or with the api token of a user. Without a configured username and
+// password and without users all requests are allowed. If the users can not be counted all
+// requests are refused. The authenticated user is kept in the request context, the configured
+// username as a user without an ID.
+func authenticator(store storage.Storer, username, password, cookiePath string) func(http.Handler) http.Handler {
 	f := func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
 			logger := hlog.FromRequest(r)
 
-			if r.Method == "DELETE" && r.URL.Path == "/api/token" {
-				setTokenCookie(w, "", time.Unix(0, 0))
+			enabled, err := authenticationEnabled(r, store, username, password)
+			if err != nil {
+				jsonError(w, "Service Unavailable", 503)
+				return
+			}
+
+			if !enabled {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.Method == "DELETE" && isTokenPath(r.URL.Path) {
+				setTokenCookie(w, cookiePath, "", time.Unix(0, 0))
 				return
 			}
 
-			if r.Method == "POST" && r.URL.Path == "/api/token" {
-				if username != r.PostFormValue("username") && password != r.PostFormValue("password") {
+			if r.Method == "POST" && isTokenPath(r.URL.Path) {
+				token, ok := login(r, store, username, password)
+				if !ok {
 					time.Sleep(2 * time.Second)
-					w.WriteHeader(401)
+					jsonError(w, "Unauthorized", 401)
 					return
 				}
 
-				hash := hmac.New(sha256.New, []byte(password))
-				io.WriteString(hash, username)
-				token := base64.StdEncoding.EncodeToString(hash.Sum(nil))
-				setTokenCookie(w, token, time.Now().Add(7*24*time.Hour))
-				logger.Info().Str("username", username).Msg("User authenticated successfully")
+				setTokenCookie(w, cookiePath, token, time.Now().Add(7*24*time.Hour))
+				logger.Info().Str("username", r.PostFormValue("username")).Msg("User authenticated successfully")
 
 				if next := r.PostFormValue("next"); next != "" {
 					http.Redirect(w, r, next, 301)
@@ -43,44 +64,132 @@ func authenticator(username, password string) func(http.Handler) http.Handler {
 				return
 			}
 
-			cookie, err := r.Cookie("token")
-			if err != nil {
-				w.WriteHeader(401)
+			if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+				user, err := store.UserByToken(r.Context(), strings.TrimPrefix(bearer, "Bearer "))
+				if err != nil {
+					time.Sleep(2 * time.Second)
+					jsonError(w, "Unauthorized", 401)
+					return
+				}
+
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyUser, user)))
 				return
 			}
 
-			decoded, err := base64.StdEncoding.DecodeString(cookie.Value)
+			cookie, err := r.Cookie("token")
 			if err != nil {
-				time.Sleep(2 * time.Second)
-				w.WriteHeader(401)
+				jsonError(w, "Unauthorized", 401)
 				return
 			}
 
-			hash := hmac.New(sha256.New, []byte(password))
-			io.WriteString(hash, username)
-
-			if !hmac.Equal(hash.Sum(nil), decoded) {
+			user, ok := validToken(r, store, username, password, cookie.Value)
+			if !ok {
 				time.Sleep(2 * time.Second)
-				w.WriteHeader(401)
+				jsonError(w, "Unauthorized", 401)
 				return
 			}
 
-			setTokenCookie(w, cookie.Value, time.Now().Add(7*24*time.Hour))
+			setTokenCookie(w, cookiePath, cookie.Value, time.Now().Add(7*24*time.Hour))
 
 			// Token is authenticated, pass it through
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyUser, user)))
 		}
 		return http.HandlerFunc(fn)
 	}
 	return f
 }
 
-func setTokenCookie(w http.ResponseWriter, value string, expires time.Time) {
+// authenticationEnabled is true if a username and password are configured or users exist, even if
+// all of them are disabled
+func authenticationEnabled(r *http.Request, store storage.Storer, username, password string) (bool, error) {
+	if username != "" && password != "" {
+		return true, nil
+	}
+
+	count, err := store.UserCount(r.Context())
+	if err != nil {
+		return true, err
+	}
+
+	return count != 0, nil
+}
+
+// login checks the posted username and password against the configured ones and the users in the
+// database, and returns the value of the token cookie
+func login(r *http.Request, store storage.Storer, username, password string) (string, bool) {
+	postedUsername := r.PostFormValue("username")
+	postedPassword := r.PostFormValue("password")
+
+	if username != "" && password != "" && postedUsername == username && postedPassword == password {
+		return signToken(password, username), true
+	}
+
+	user, err := store.UserAuthenticate(r.Context(), postedUsername, postedPassword)
+	if err != nil {
+		return "", false
+	}
+
+	// The token of a user is signed with the password hash so changing the password logs out
+	return user.Username + ":" + signToken(user.PasswordHash, user.Username), true
+}
+
+// validToken checks the value of a token cookie handed out by login and returns who it belongs to
+func validToken(r *http.Request, store storage.Storer, username, password, token string) (*storage.User, bool) {
+	if i := strings.LastIndex(token, ":"); i != -1 {
+		user := &storage.User{Username: token[:i]}
+		if store.UserGet(r.Context(), user) != nil || user.Disabled || user.PasswordHash == "" {
+			return nil, false
+		}
+
+		return user, equalTokens(token[i+1:], signToken(user.PasswordHash, user.Username))
+	}
+
+	if username == "" || password == "" {
+		return nil, false
+	}
+
+	return &storage.User{Username: username}, equalTokens(token, signToken(password, username))
+}
+
+// isAdmin is true if the request was authenticated as an admin user or with the configured
+// username and password
+func isAdmin(r *http.Request, username string) bool {
+	user, ok := r.Context().Value(contextKeyUser).(*storage.User)
+	if !ok {
+		return false
+	}
+
+	return user.Admin || (user.ID == "" && username != "" && user.Username == username)
+}
+
+func signToken(key, username string) string {
+	hash := hmac.New(sha256.New, []byte(key))
+	io.WriteString(hash, username)
+
+	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
+}
+
+func equalTokens(a, b string) bool {
+	decodedA, err := base64.StdEncoding.DecodeString(a)
+	if err != nil {
+		return false
+	}
+
+	decodedB, _ := base64.StdEncoding.DecodeString(b)
+
+	return hmac.Equal(decodedA, decodedB)
+}
+
+func setTokenCookie(w http.ResponseWriter, path, value string, expires time.Time) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "token",
-		Path:     "/",
+		Path:     path,
 		HttpOnly: true,
 		Value:    value,
 		Expires:  expires,
 	})
 }
+
+func isTokenPath(path string) bool {
+	return path == "/api/v1/token" || path == "/api/token"
+}
@@ -3,11 +3,17 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/readlater"
+	"github.com/nrocco/bookmarks/scheduler"
 	"github.com/nrocco/bookmarks/storage"
 )
 
@@ -16,35 +22,93 @@ var (
 )
 
 type bookmarks struct {
-	store *storage.Store
+	store    storage.Storer
+	queue    *queue.Queue
+	events   *events
+	services map[string]readlater.Service
 }
 
-func (api bookmarks) Routes() chi.Router {
+func (api bookmarks) Routes(timeouts Timeouts) chi.Router {
 	r := chi.NewRouter()
-	r.Get("/", api.list)
-	r.Post("/", api.create)
-	r.Get("/save", api.save)
+	r.With(timeout(timeouts.Read)).Get("/", api.list)
+	r.With(timeout(timeouts.Write)).Post("/", api.create)
+	r.With(timeout(timeouts.Write)).Get("/save", api.save)
+	r.Get("/events", api.events.stream)
+	r.With(timeout(timeouts.Write)).Post("/{id}/restore", api.restore)
+	r.With(timeout(timeouts.Fetch)).Post("/push/{service}", api.pushMany)
 	r.Route("/{id}", func(r chi.Router) {
 		r.Use(api.middleware)
-		r.Get("/", api.get)
-		r.Patch("/", api.update)
-		r.Delete("/", api.delete)
+		r.With(timeout(timeouts.Read)).Get("/", api.get)
+		r.With(timeout(timeouts.Write)).Patch("/", api.update)
+		r.With(timeout(timeouts.Write)).Delete("/", api.delete)
+		r.With(timeout(timeouts.Write)).Post("/fetch", api.fetch)
+		r.With(timeout(timeouts.Fetch)).Post("/push/{service}", api.push)
 	})
 
 	return r
 }
 
 func (api *bookmarks) list(w http.ResponseWriter, r *http.Request) {
-	bookmarks, totalCount := api.store.BookmarkList(r.Context(), &storage.BookmarkListOptions{
-		Search: r.URL.Query().Get("q"),
-		Tags:   strings.Split(r.URL.Query().Get("tags"), ","),
-		Limit:  asInt(r.URL.Query().Get("_limit"), 50),
-		Offset: asInt(r.URL.Query().Get("_offset"), 0),
-	})
+	sort, err := storage.ParseSort(r.URL.Query().Get("_sort"), storage.BookmarkSortFields)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
+	if len(sort) != 0 && r.URL.Query().Get("_cursor") != "" {
+		jsonError(w, "Cannot combine _cursor with _sort", 400)
+		return
+	}
+
+	if r.URL.Query().Get("q") != "" && r.URL.Query().Get("_cursor") != "" {
+		jsonError(w, "Cannot combine _cursor with q", 400)
+		return
+	}
+
+	if cursor := r.URL.Query().Get("_cursor"); cursor != "" {
+		if _, err := storage.ParseCursor(cursor); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+
+	limit := asInt(r.URL.Query().Get("_limit"), 50)
+
+	options := &storage.BookmarkListOptions{
+		Search:         r.URL.Query().Get("q"),
+		Tags:           strings.Split(r.URL.Query().Get("tags"), ","),
+		IncludeDeleted: r.URL.Query().Get("include_deleted") == "true",
+		Sort:           sort,
+		Cursor:         r.URL.Query().Get("_cursor"),
+		Limit:          limit,
+		Offset:         asInt(r.URL.Query().Get("_offset"), 0),
+	}
+
+	if limit < 0 || limit > listStreamSize {
+		// A page of no bookmarks only counts them
+		counted := *options
+		counted.Limit = 0
+		_, totalCount := api.store.BookmarkList(r.Context(), &counted)
+
+		w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
+		jsonStream(w, r, func(write func(item interface{}) error) error {
+			return api.store.BookmarkEach(r.Context(), options, func(bookmark *storage.Bookmark) error { return write(bookmark) })
+		})
+		return
+	}
+
+	bookmarks, totalCount := api.store.BookmarkList(r.Context(), options)
 
 	w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
 
-	jsonResponse(w, 200, bookmarks)
+	// Search results are ranked and other sorts are not by creation date, so only pages in the
+	// default order can continue after the last one
+	if items := *bookmarks; len(items) != 0 && len(items) == limit && len(sort) == 0 && r.URL.Query().Get("q") == "" {
+		last := items[len(items)-1]
+		w.Header().Set("X-Pagination-Next-Cursor", storage.NewCursor(last.Created, last.ID))
+	}
+
+	jsonList(w, r, bookmarks)
 }
 
 func (api *bookmarks) create(w http.ResponseWriter, r *http.Request) {
@@ -54,21 +118,16 @@ func (api *bookmarks) create(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	if err := decoder.Decode(&bookmark); err != nil {
-		jsonError(w, err.Error(), 400)
+		decodeError(w, err)
 		return
 	}
 
-	if err := bookmark.Fetch(r.Context()); err != nil {
-		jsonError(w, err.Error(), 500)
+	if err := api.persistPending(r, &bookmark); err != nil {
+		storeError(w, err)
 		return
 	}
 
-	if err := api.store.BookmarkPersist(r.Context(), &bookmark); err != nil {
-		jsonError(w, err.Error(), 500)
-		return
-	}
-
-	jsonResponse(w, 200, &bookmark)
+	jsonResponse(w, 202, &bookmark)
 }
 
 func (api *bookmarks) save(w http.ResponseWriter, r *http.Request) {
@@ -77,17 +136,55 @@ func (api *bookmarks) save(w http.ResponseWriter, r *http.Request) {
 		Tags: storage.Tags{"read-it-later"},
 	}
 
-	if err := bookmark.Fetch(r.Context()); err != nil {
-		jsonError(w, err.Error(), 500)
+	if err := api.persistPending(r, &bookmark); err != nil {
+		storeError(w, err)
 		return
 	}
 
-	if err := api.store.BookmarkPersist(r.Context(), &bookmark); err != nil {
-		jsonError(w, err.Error(), 500)
-		return
+	http.Redirect(w, r, bookmark.URL, 302)
+}
+
+// persistPending saves the bookmark right away and fetches its content in the background, clients
+// learn that the content was fetched from the events stream. A bookmark that is already saved only
+// gets the new tags, its content stays until fetching it again succeeds.
+func (api *bookmarks) persistPending(r *http.Request, bookmark *storage.Bookmark) error {
+	if bookmark.URL != "" {
+		location, err := url.ParseRequestURI(bookmark.URL)
+		if err != nil || (location.Scheme != "http" && location.Scheme != "https") || location.Host == "" {
+			return storage.ErrInvalidBookmarkURL
+		}
 	}
 
-	http.Redirect(w, r, bookmark.URL, 302)
+	existing := storage.Bookmark{URL: bookmark.URL}
+	if bookmark.URL != "" && api.store.BookmarkGet(r.Context(), &existing) == nil {
+		existing.Tags = existing.Tags.Merge(bookmark.Tags)
+		*bookmark = existing
+	} else {
+		bookmark.Status = storage.BookmarkPending
+	}
+
+	if err := api.store.BookmarkPersist(r.Context(), bookmark); err != nil {
+		return err
+	}
+
+	_, err := scheduler.EnqueueFetchBookmark(api.queue, bookmark.ID, queue.PriorityHigh)
+
+	return err
+}
+
+// bookmarkEvent tells clients that the content of a pending bookmark was fetched or could not be
+type bookmarkEvent struct {
+	ID     string
+	Status string
+}
+
+// publishFetched publishes a bookmark event with status for every job that fetched a bookmark
+func publishFetched(events *events, status string) func(job *queue.Job) {
+	return func(job *queue.Job) {
+		if job.Kind == scheduler.JobFetchBookmark {
+			events.publish("bookmark", bookmarkEvent{job.Payload, status})
+		}
+	}
 }
 
 func (api *bookmarks) middleware(next http.Handler) http.Handler {
@@ -104,25 +201,76 @@ func (api *bookmarks) middleware(next http.Handler) http.Handler {
 	})
 }
 
+var articleTemplate = template.Must(template.New("article").Parse(`<!DOCTYPE html>
+<html>
+  <head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{ .Title }}</title>
+    <style>body { max-width: 40em; margin: 2em auto; padding: 0 1em; font-family: Georgia, serif; line-height: 1.6; }</style>
+  </head>
+  <body>
+    <article>
+      <h1>{{ .Title }}</h1>
+      <p><a href="{{ .URL }}">{{ .URL }}</a></p>
+      {{ range .Paragraphs }}<p>{{ . }}</p>
+      {{ end }}
+    </article>
+  </body>
+</html>
+`))
+
 func (api *bookmarks) get(w http.ResponseWriter, r *http.Request) {
 	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
 
-	jsonResponse(w, 200, bookmark)
+	w.Header().Set("Vary", "Accept")
+
+	switch negotiate(r, "application/json", "text/html", "text/markdown") {
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(200)
+		articleTemplate.Execute(w, map[string]interface{}{
+			"Title":      bookmark.Title,
+			"URL":        bookmark.URL,
+			"Paragraphs": paragraphs(bookmark.Content),
+		})
+	case "text/markdown":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(200)
+		fmt.Fprintf(w, "# %s\n\n<%s>\n\n%s\n", bookmark.Title, bookmark.URL, strings.Join(paragraphs(bookmark.Content), "\n\n"))
+	default:
+		jsonResponse(w, 200, bookmark)
+	}
+}
+
+// paragraphs splits plain text content into paragraphs on empty lines
+func paragraphs(content string) []string {
+	result := []string{}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+
+	return result
 }
 
 func (api *bookmarks) update(w http.ResponseWriter, r *http.Request) {
 	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+	id := bookmark.ID
 
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
-	if err := decoder.Decode(bookmark); err != nil {
-		jsonError(w, err.Error(), 400)
+	if err := mergePatch(bookmark, r.Body); err != nil {
+		decodeError(w, err)
 		return
 	}
 
+	bookmark.ID = id
+
 	if err := api.store.BookmarkPersist(r.Context(), bookmark); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
@@ -133,9 +281,96 @@ func (api *bookmarks) delete(w http.ResponseWriter, r *http.Request) {
 	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
 
 	if err := api.store.BookmarkDelete(r.Context(), bookmark); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
 	jsonResponse(w, 204, nil)
 }
+
+// fetch fetches the content of the bookmark again in the background, the page is only downloaded
+// again if it changed since it was fetched
+func (api *bookmarks) fetch(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	if _, err := scheduler.EnqueueFetchBookmark(api.queue, bookmark.ID, queue.PriorityHigh); err != nil {
+		queueError(w, err)
+		return
+	}
+
+	jsonResponse(w, 202, bookmark)
+}
+
+func (api *bookmarks) restore(w http.ResponseWriter, r *http.Request) {
+	bookmark := storage.Bookmark{ID: chi.URLParam(r, "id")}
+
+	if err := api.store.BookmarkRestore(r.Context(), &bookmark); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, &bookmark)
+}
+
+// service finds the read it later service named in the url
+func (api *bookmarks) service(w http.ResponseWriter, r *http.Request) (readlater.Service, bool) {
+	service, ok := api.services[chi.URLParam(r, "service")]
+	if !ok {
+		jsonError(w, "Unknown or unconfigured service "+chi.URLParam(r, "service"), 404)
+	}
+
+	return service, ok
+}
+
+// push sends a single bookmark to Pocket or Instapaper
+func (api *bookmarks) push(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	service, ok := api.service(w, r)
+	if !ok {
+		return
+	}
+
+	if err := service.Push(r.Context(), []*storage.Bookmark{bookmark}); err != nil {
+		jsonError(w, err.Error(), 502)
+		return
+	}
+
+	jsonResponse(w, 200, map[string]int{"Pushed": 1})
+}
+
+// pushMany sends the bookmarks with the given IDs to Pocket or Instapaper
+func (api *bookmarks) pushMany(w http.ResponseWriter, r *http.Request) {
+	service, ok := api.service(w, r)
+	if !ok {
+		return
+	}
+
+	selection := struct{ IDs []string }{}
+	if err := json.NewDecoder(r.Body).Decode(&selection); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if len(selection.IDs) == 0 {
+		jsonErrorWithFields(w, "Missing IDs", 422, map[string]string{"IDs": "is required"})
+		return
+	}
+
+	selected := []*storage.Bookmark{}
+	for _, ID := range selection.IDs {
+		bookmark := &storage.Bookmark{ID: ID}
+		if err := api.store.BookmarkGet(r.Context(), bookmark); err != nil {
+			jsonError(w, "Bookmark Not Found: "+ID, 404)
+			return
+		}
+		selected = append(selected, bookmark)
+	}
+
+	if err := service.Push(r.Context(), selected); err != nil {
+		jsonError(w, err.Error(), 502)
+		return
+	}
+
+	jsonResponse(w, 200, map[string]int{"Pushed": len(selected)})
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+var errorCodes = map[int]string{
+	400: "bad_request",
+	401: "unauthorized",
+	404: "not_found",
+	405: "method_not_allowed",
+	409: "conflict",
+	413: "request_too_large",
+	422: "validation_failed",
+	500: "internal_error",
+	501: "not_implemented",
+	502: "upstream_error",
+	503: "unavailable",
+}
+
+// apiError is the envelope for every error returned by the rest api
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func jsonError(w http.ResponseWriter, message string, status int) {
+	jsonErrorWithFields(w, message, status, nil)
+}
+
+func jsonErrorWithFields(w http.ResponseWriter, message string, status int, fields map[string]string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = errorCodes[500]
+	}
+
+	jsonResponse(w, status, map[string]apiError{"error": {Code: code, Message: message, Fields: fields}})
+}
+
+// internalError logs an unexpected error and reports it without details, which could expose the
+// database or the file system
+func internalError(w http.ResponseWriter, err error) {
+	log.Error().Err(err).Msg("Internal server error")
+	jsonError(w, "Internal server error", 500)
+}
+
+// decodeError reports an invalid request body, pointing at the offending field when possible
+func decodeError(w http.ResponseWriter, err error) {
+	var sizeError *http.MaxBytesError
+	if errors.As(err, &sizeError) {
+		jsonError(w, "Request body too large", 413)
+		return
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) && typeError.Field != "" {
+		jsonErrorWithFields(w, "Invalid request body", 422, map[string]string{typeError.Field: "must be of type " + typeError.Type.String()})
+		return
+	}
+
+	jsonError(w, "Invalid request body: "+err.Error(), 400)
+}
+
+// storeError translates an error returned by the store to the matching status code
+func storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNoBookmarkURL), errors.Is(err, storage.ErrNoFeedURL):
+		jsonErrorWithFields(w, err.Error(), 422, map[string]string{"URL": "is required"})
+	case errors.Is(err, storage.ErrInvalidBookmarkURL):
+		jsonErrorWithFields(w, err.Error(), 422, map[string]string{"URL": "must be an absolute http or https url"})
+	case errors.Is(err, storage.ErrInvalidFeedFilter):
+		jsonErrorWithFields(w, err.Error(), 422, map[string]string{"Filters": "must match the title, content or url with a valid regular expression and drop or keep items"})
+	case errors.Is(err, storage.ErrInvalidRefreshInterval):
+		jsonErrorWithFields(w, err.Error(), 422, map[string]string{"RefreshInterval": "must not be negative"})
+	case errors.Is(err, storage.ErrNoFeedFound):
+		jsonErrorWithFields(w, err.Error(), 422, map[string]string{"URL": "is not a feed and does not link to one"})
+	case errors.Is(err, storage.ErrNoBookmarkKey), errors.Is(err, storage.ErrNoFeedKey), errors.Is(err, storage.ErrNoThoughtID), errors.Is(err, storage.ErrNoTagName):
+		jsonError(w, err.Error(), 422)
+	case errors.Is(err, storage.ErrInvalidBackup):
+		jsonError(w, err.Error(), 422)
+	case errors.Is(err, storage.ErrNotExistingFeedItem), errors.Is(err, storage.ErrNotExistingFeedFilter), errors.Is(err, storage.ErrNotExistingTag), errors.Is(err, storage.ErrNoFeedIcon):
+		jsonError(w, err.Error(), 404)
+	case errors.Is(err, storage.ErrNotDeletedBookmark), errors.Is(err, storage.ErrNotDeletedFeed), errors.Is(err, storage.ErrNotDeletedThought):
+		jsonError(w, err.Error(), 404)
+	case errors.Is(err, storage.ErrInvalidCursor), errors.Is(err, storage.ErrInvalidImportStrategy):
+		jsonError(w, err.Error(), 400)
+	case errors.Is(err, storage.ErrFetchFailed):
+		jsonError(w, err.Error(), 502)
+	case errors.Is(err, storage.ErrUnsupported):
+		jsonError(w, err.Error(), 501)
+	default:
+		internalError(w, err)
+	}
+}
+
+// queueError translates an error returned by the job queue to the matching status code
+func queueError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, queue.ErrNotExistingJob):
+		jsonError(w, err.Error(), 404)
+	case errors.Is(err, queue.ErrNotDeadJob), errors.Is(err, queue.ErrJobFinished):
+		jsonError(w, err.Error(), 409)
+	case errors.Is(err, queue.ErrStopping):
+		jsonError(w, err.Error(), 503)
+	default:
+		internalError(w, err)
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// eventsBuffer is the number of events kept for a slow client before they are dropped
+	eventsBuffer = 16
+
+	// eventsKeepAlive is how often an idle stream sends a comment, so proxies keep it open
+	eventsKeepAlive = 30 * time.Second
+)
+
+// event is a single server sent event
+type event struct {
+	name string
+	data interface{}
+}
+
+// events streams server sent events to every client that listens
+type events struct {
+	mutex       sync.Mutex
+	subscribers map[chan event]struct{}
+}
+
+func newEvents() *events {
+	return &events{subscribers: map[chan event]struct{}{}}
+}
+
+// publish sends an event to every client that listens, clients that cannot keep up miss it
+func (events *events) publish(name string, data interface{}) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	for subscriber := range events.subscribers {
+		select {
+		case subscriber <- event{name, data}:
+		default:
+		}
+	}
+}
+
+func (events *events) subscribe() chan event {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	subscriber := make(chan event, eventsBuffer)
+	events.subscribers[subscriber] = struct{}{}
+
+	return subscriber
+}
+
+func (events *events) unsubscribe(subscriber chan event) {
+	events.mutex.Lock()
+	defer events.mutex.Unlock()
+
+	delete(events.subscribers, subscriber)
+}
+
+// stream sends the events as text/event-stream until the client goes away
+func (events *events) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonError(w, "Streaming is not supported", 500)
+		return
+	}
+
+	subscriber := events.subscribe()
+	defer events.unsubscribe(subscriber)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(200)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event := <-subscriber:
+			data, err := json.Marshal(event.data)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.name, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+)
+
+type exports struct {
+	store    *storage.Store
+	settings settings
+}
+
+// Routes for exporting all records, the export streams and therefore has no timeout
+func (api exports) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", api.export)
+
+	return r
+}
+
+// export writes all records and the settings as json, or only the bookmarks as a Netscape bookmark file when the
+// format query parameter is netscape
+func (api *exports) export(w http.ResponseWriter, r *http.Request) {
+	exportTo := func(ctx context.Context, w io.Writer) (int64, error) {
+		if settings := api.settings.current(); settings != nil {
+			return api.store.ExportTo(ctx, w, settings)
+		}
+
+		return api.store.ExportTo(ctx, w, nil)
+	}
+	contentType, extension := "application/json", "json"
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+	case "netscape":
+		exportTo = api.store.ExportNetscapeTo
+		contentType, extension = "text/html; charset=utf-8", "html"
+	default:
+		jsonError(w, "Unknown export format, use json or netscape", 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\"bookmarks-"+time.Now().UTC().Format("20060102T150405Z")+"."+extension+"\"")
+
+	written, err := exportTo(r.Context(), w)
+	if err != nil && written == 0 {
+		w.Header().Del("Content-Disposition")
+		storeError(w, err)
+	} else if err != nil {
+		// Once the export is streaming the status code can no longer change
+		hlog.FromRequest(r).Error().Err(err).Int64("written", written).Msg("Error streaming export")
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 
 	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/scheduler"
 	"github.com/nrocco/bookmarks/storage"
 )
 
@@ -16,22 +18,38 @@ var (
 )
 
 type feeds struct {
-	store *storage.Store
+	store storage.Storer
+	queue *queue.Queue
 }
 
-func (api feeds) Routes() chi.Router {
+func (api feeds) Routes(timeouts Timeouts) chi.Router {
 	r := chi.NewRouter()
 
-	r.Get("/", api.listFeed)
-	r.Post("/", api.createFeed)
+	r.With(timeout(timeouts.Read)).Get("/", api.listFeed)
+	r.With(timeout(timeouts.Fetch)).Post("/", api.createFeed)
+	r.With(timeout(timeouts.Read)).Get("/export", api.exportFeeds)
+	r.With(timeout(timeouts.Fetch)).Get("/discover", api.discoverFeeds)
+	r.With(timeout(timeouts.Write)).Post("/{id}/restore", api.restoreFeed)
 	r.Route("/{id}", func(r chi.Router) {
 		r.Use(api.middleware)
-		r.Get("/", api.getFeed)
-		r.Patch("/", api.updateFeed)
-		r.Delete("/", api.deleteFeed)
-		r.Post("/refresh", api.refreshFeed)
+		r.With(timeout(timeouts.Read)).Get("/", api.getFeed)
+		r.With(timeout(timeouts.Write)).Patch("/", api.updateFeed)
+		r.With(timeout(timeouts.Write)).Delete("/", api.deleteFeed)
+		r.With(timeout(timeouts.Read)).Get("/icon", api.getFeedIcon)
+		r.With(timeout(timeouts.Write)).Post("/refresh", api.refreshFeed)
+		r.With(timeout(timeouts.Write)).Post("/pause", api.pauseFeed(true))
+		r.With(timeout(timeouts.Write)).Post("/resume", api.pauseFeed(false))
+		r.With(timeout(timeouts.Write)).Post("/read", api.readFeed)
 		r.Route("/items/{id}", func(r chi.Router) {
-			r.Delete("/", api.deleteFeedItem)
+			r.With(timeout(timeouts.Write)).Patch("/", api.updateFeedItem)
+			r.With(timeout(timeouts.Write)).Delete("/", api.deleteFeedItem)
+		})
+		r.With(timeout(timeouts.Read)).Get("/filters", api.listFeedFilters)
+		r.With(timeout(timeouts.Write)).Post("/filters", api.createFeedFilter)
+		r.Route("/filters/{id}", func(r chi.Router) {
+			r.With(timeout(timeouts.Read)).Get("/", api.getFeedFilter)
+			r.With(timeout(timeouts.Write)).Patch("/", api.updateFeedFilter)
+			r.With(timeout(timeouts.Write)).Delete("/", api.deleteFeedFilter)
 		})
 	})
 
@@ -39,16 +57,25 @@ func (api feeds) Routes() chi.Router {
 }
 
 func (api *feeds) listFeed(w http.ResponseWriter, r *http.Request) {
+	sort, err := storage.ParseSort(r.URL.Query().Get("_sort"), storage.FeedSortFields)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
 	feeds, totalCount := api.store.FeedList(r.Context(), &storage.FeedListOptions{
-		Search: r.URL.Query().Get("q"),
-		Tags:   strings.Split(r.URL.Query().Get("tags"), ","),
-		Limit:  asInt(r.URL.Query().Get("_limit"), 50),
-		Offset: asInt(r.URL.Query().Get("_offset"), 0),
+		Search:         r.URL.Query().Get("q"),
+		Tags:           strings.Split(r.URL.Query().Get("tags"), ","),
+		Broken:         r.URL.Query().Get("broken") == "true",
+		IncludeDeleted: r.URL.Query().Get("include_deleted") == "true",
+		Sort:           sort,
+		Limit:          asInt(r.URL.Query().Get("_limit"), 50),
+		Offset:         asInt(r.URL.Query().Get("_offset"), 0),
 	})
 
 	w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
 
-	jsonResponse(w, 200, feeds)
+	jsonList(w, r, feeds)
 }
 
 func (api *feeds) createFeed(w http.ResponseWriter, r *http.Request) {
@@ -58,23 +85,49 @@ func (api *feeds) createFeed(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	if err := decoder.Decode(&feed); err != nil {
-		jsonError(w, err.Error(), 400)
+		decodeError(w, err)
 		return
 	}
 
+	// The URL of a website is replaced by the first feed it links to
+	if feed.URL != "" {
+		discovered, err := storage.DiscoverFeeds(r.Context(), feed.URL)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+
+		feed.URL = discovered[0].URL
+		if feed.Title == "" {
+			feed.Title = discovered[0].Title
+		}
+	}
+
 	if err := api.store.FeedPersist(r.Context(), &feed); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
 	if err := api.store.FeedRefresh(r.Context(), &feed); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
 	jsonResponse(w, 200, &feed)
 }
 
+// discoverFeeds lists the feeds the page at the url query parameter links to, so the user can pick
+// one before creating it
+func (api *feeds) discoverFeeds(w http.ResponseWriter, r *http.Request) {
+	discovered, err := storage.DiscoverFeeds(r.Context(), r.URL.Query().Get("url"))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, discovered)
+}
+
 func (api *feeds) middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		feed := storage.Feed{ID: chi.URLParam(r, "id")}
@@ -89,15 +142,51 @@ func (api *feeds) middleware(next http.Handler) http.Handler {
 	})
 }
 
+// getFeedIcon serves the favicon of the site of the feed, it is fetched when the feed is refreshed
+func (api *feeds) getFeedIcon(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	icon := &storage.FeedIcon{FeedID: feed.ID}
+	if err := api.store.FeedIconGet(r.Context(), icon); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	// Icons come from remote sites and are served from this origin, so an svg icon must not be
+	// able to run scripts or be sniffed as html
+	w.Header().Set("Content-Type", icon.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	w.Write(icon.Data)
+}
+
 func (api *feeds) refreshFeed(w http.ResponseWriter, r *http.Request) {
 	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
 
-	if err := api.store.FeedRefresh(r.Context(), feed); err != nil {
-		jsonError(w, err.Error(), 500)
+	// Refreshing is done by a job that jumps ahead of the feeds refreshed in the background
+	job, err := scheduler.EnqueueRefreshFeed(api.queue, feed.ID, queue.PriorityHigh)
+	if err != nil {
+		queueError(w, err)
 		return
 	}
 
-	jsonResponse(w, 204, nil)
+	jsonResponse(w, 202, job)
+}
+
+// pauseFeed pauses or resumes refreshing a feed in the background, it can still be refreshed by hand
+func (api *feeds) pauseFeed(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+		feed.Paused = paused
+
+		if err := api.store.FeedPersist(r.Context(), feed); err != nil {
+			storeError(w, err)
+			return
+		}
+
+		jsonResponse(w, 200, feed)
+	}
 }
 
 func (api *feeds) getFeed(w http.ResponseWriter, r *http.Request) {
@@ -108,17 +197,19 @@ func (api *feeds) getFeed(w http.ResponseWriter, r *http.Request) {
 
 func (api *feeds) updateFeed(w http.ResponseWriter, r *http.Request) {
 	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+	id := feed.ID
 
-	decoder := json.NewDecoder(r.Body)
 	defer r.Body.Close()
 
-	if err := decoder.Decode(feed); err != nil {
-		jsonError(w, err.Error(), 400)
+	if err := mergePatch(feed, r.Body); err != nil {
+		decodeError(w, err)
 		return
 	}
 
+	feed.ID = id
+
 	if err := api.store.FeedPersist(r.Context(), feed); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
@@ -129,23 +220,165 @@ func (api *feeds) deleteFeed(w http.ResponseWriter, r *http.Request) {
 	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
 
 	if err := api.store.FeedDelete(r.Context(), feed); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
 	jsonResponse(w, 204, nil)
 }
 
+func (api *feeds) restoreFeed(w http.ResponseWriter, r *http.Request) {
+	feed := storage.Feed{ID: chi.URLParam(r, "id")}
+
+	if err := api.store.FeedRestore(r.Context(), &feed); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, &feed)
+}
+
+// readFeed marks the items of a feed as read, optionally only those dated before the before
+// query parameter
+func (api *feeds) readFeed(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	options, err := feedReadOptions(r)
+	if err != nil {
+		jsonError(w, "Invalid before: "+err.Error(), 400)
+		return
+	}
+
+	options.ID = feed.ID
+
+	markRead(w, r, api.store, options)
+}
+
+// updateFeedItem changes an item of a feed, like starring it with {"Starred": true}
+func (api *feeds) updateFeedItem(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	item := feed.GetItem(chi.URLParam(r, "id"))
+	if item == nil {
+		storeError(w, storage.ErrNotExistingFeedItem)
+		return
+	}
+
+	id := item.ID
+
+	defer r.Body.Close()
+
+	if err := mergePatch(item, r.Body); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	item.ID = id
+
+	if err := api.store.FeedPersist(r.Context(), feed); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, item)
+}
+
 func (api *feeds) deleteFeedItem(w http.ResponseWriter, r *http.Request) {
 	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
 
 	if err := feed.DeleteItem(chi.URLParam(r, "id")); err != nil {
-		jsonError(w, err.Error(), 404)
+		storeError(w, err)
+		return
+	}
+
+	if err := api.store.FeedPersist(r.Context(), feed); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 204, nil)
+}
+
+func (api *feeds) listFeedFilters(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	jsonResponse(w, 200, feed.Filters)
+}
+
+// createFeedFilter adds a filter to a feed, it applies to the items of the next refreshes
+func (api *feeds) createFeedFilter(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	var filter storage.FeedFilter
+
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	filter.ID = ""
+	feed.Filters = append(feed.Filters, &filter)
+
+	if err := api.store.FeedPersist(r.Context(), feed); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, &filter)
+}
+
+func (api *feeds) getFeedFilter(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	filter := feed.GetFilter(chi.URLParam(r, "id"))
+	if filter == nil {
+		storeError(w, storage.ErrNotExistingFeedFilter)
+		return
+	}
+
+	jsonResponse(w, 200, filter)
+}
+
+func (api *feeds) updateFeedFilter(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	filter := feed.GetFilter(chi.URLParam(r, "id"))
+	if filter == nil {
+		storeError(w, storage.ErrNotExistingFeedFilter)
+		return
+	}
+
+	id := filter.ID
+
+	defer r.Body.Close()
+
+	if err := mergePatch(filter, r.Body); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	filter.ID = id
+
+	if err := api.store.FeedPersist(r.Context(), feed); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, filter)
+}
+
+func (api *feeds) deleteFeedFilter(w http.ResponseWriter, r *http.Request) {
+	feed := r.Context().Value(contextKeyFeed).(*storage.Feed)
+
+	if err := feed.DeleteFilter(chi.URLParam(r, "id")); err != nil {
+		storeError(w, err)
 		return
 	}
 
 	if err := api.store.FeedPersist(r.Context(), feed); err != nil {
-		jsonError(w, err.Error(), 500)
+		storeError(w, err)
 		return
 	}
 
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+const (
+	minDiskFree = 64 << 20
+)
+
+// HealthCheck verifies a single component of the application is healthy
+type HealthCheck func(ctx context.Context) error
+
+type componentHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type health struct {
+	Status     string                     `json:"status"`
+	Components map[string]componentHealth `json:"components"`
+}
+
+// healthHandler runs all checks concurrently and reports the status of every component
+func healthHandler(store *storage.Store, checks map[string]HealthCheck) http.HandlerFunc {
+	all := map[string]HealthCheck{
+		"database": store.Ping,
+		"disk": func(ctx context.Context) error {
+			free, err := store.DiskFree()
+			if errors.Is(err, storage.ErrUnsupported) {
+				// A PostgreSQL database is not on a disk of the process
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if free < minDiskFree {
+				return fmt.Errorf("Only %d bytes available for %s", free, store.Path())
+			}
+			return nil
+		},
+	}
+
+	for name, check := range checks {
+		all[name] = check
+	}
+
+	return checksHandler(all)
+}
+
+// livenessHandler reports the process is up and serving requests, it checks nothing else so a slow
+// database does not get the process restarted
+func livenessHandler(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, 200, health{Status: "ok", Components: map[string]componentHealth{}})
+}
+
+// readinessHandler reports if requests can be routed to the process: the database is reachable
+// and migrated, and the checks pass
+func readinessHandler(store *storage.Store, checks map[string]HealthCheck) http.HandlerFunc {
+	all := map[string]HealthCheck{
+		"database":   store.Ping,
+		"migrations": store.MigrationsApplied,
+	}
+
+	for name, check := range checks {
+		all[name] = check
+	}
+
+	return checksHandler(all)
+}
+
+// checksHandler runs all checks concurrently and reports the status of every component, with a 503
+// if any of them failed
+func checksHandler(all map[string]HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		result := health{Status: "ok", Components: map[string]componentHealth{}}
+		mutex := sync.Mutex{}
+		wg := sync.WaitGroup{}
+
+		for name, check := range all {
+			wg.Add(1)
+			go func(name string, check HealthCheck) {
+				defer wg.Done()
+
+				component := componentHealth{Status: "ok"}
+				if err := check(ctx); err != nil {
+					component = componentHealth{Status: "error", Error: err.Error()}
+				}
+
+				mutex.Lock()
+				defer mutex.Unlock()
+
+				result.Components[name] = component
+				if component.Status != "ok" {
+					result.Status = "error"
+				}
+			}(name, check)
+		}
+
+		wg.Wait()
+
+		if result.Status != "ok" {
+			jsonResponse(w, 503, result)
+			return
+		}
+
+		jsonResponse(w, 200, result)
+	}
+}
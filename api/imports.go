@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/importer"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/scheduler"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+)
+
+type imports struct {
+	store    *storage.Store
+	queue    *queue.Queue
+	settings settings
+
+	// username is the configured admin, only admins can import settings
+	username string
+}
+
+func (api imports) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Fetch)).Post("/", api.create)
+	r.With(timeout(timeouts.Fetch)).Post("/hypothesis", api.hypothesis)
+	r.With(timeout(timeouts.Fetch)).Post("/miniflux", api.miniflux)
+
+	return r
+}
+
+// importStrategy reads the import strategy from the query string, skipping existing records by default
+func importStrategy(r *http.Request) (storage.ImportStrategy, error) {
+	strategy := storage.ImportStrategy(r.URL.Query().Get("strategy"))
+	if strategy == "" {
+		return storage.ImportSkip, nil
+	} else if !strategy.Valid() {
+		return "", storage.ErrInvalidImportStrategy
+	}
+
+	return strategy, nil
+}
+
+// create imports a document in the format of the format query parameter, an export by default
+func (api *imports) create(w http.ResponseWriter, r *http.Request) {
+	strategy, err := importStrategy(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	defer r.Body.Close()
+
+	document, err := importer.Parse(r.URL.Query().Get("format"), r.Body)
+	if errors.Is(err, importer.ErrUnknownFormat) {
+		jsonError(w, err.Error(), 400)
+		return
+	} else if err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	api.importDocument(w, r, document, strategy)
+}
+
+// hypothesis imports the annotations of a Hypothes.is user
+func (api *imports) hypothesis(w http.ResponseWriter, r *http.Request) {
+	strategy, err := importStrategy(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	account := struct {
+		User  string
+		Token string
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if account.User == "" {
+		jsonErrorWithFields(w, "Missing User", 422, map[string]string{"User": "is required"})
+		return
+	}
+
+	document, err := importer.NewHypothesis(account.User, account.Token).Document(r.Context())
+	if err != nil {
+		jsonError(w, err.Error(), 502)
+		return
+	}
+
+	api.importDocument(w, r, document, strategy)
+}
+
+// miniflux imports the feeds, unread entries and starred entries of a Miniflux instance
+func (api *imports) miniflux(w http.ResponseWriter, r *http.Request) {
+	strategy, err := importStrategy(r)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	instance := struct {
+		URL   string
+		Token string
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&instance); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if instance.URL == "" || instance.Token == "" {
+		jsonErrorWithFields(w, "Missing URL or Token", 422, map[string]string{"URL": "is required", "Token": "is required"})
+		return
+	}
+
+	document, err := importer.NewMiniflux(instance.URL, instance.Token).Document(r.Context())
+	if err != nil {
+		jsonError(w, err.Error(), 502)
+		return
+	}
+
+	api.importDocument(w, r, document, strategy)
+}
+
+// importDocument imports the document and fetches its bookmarks, or only reports what would be
+// imported without writing anything if the dry_run query parameter is true. The settings of the
+// document replace the current ones if an admin imports it with the overwrite or merge strategy.
+func (api *imports) importDocument(w http.ResponseWriter, r *http.Request, document *storage.Document, strategy storage.ImportStrategy) {
+	var imported *instanceSettings
+	if len(document.Settings) != 0 && strategy != storage.ImportSkip && isAdmin(r, api.username) {
+		imported = &instanceSettings{}
+		if err := json.Unmarshal(document.Settings, imported); err != nil {
+			decodeError(w, err)
+			return
+		}
+	}
+
+	if r.URL.Query().Get("dry_run") == "true" {
+		result, err := api.store.ImportDryRun(r.Context(), document, strategy)
+		if err != nil {
+			storeError(w, err)
+			return
+		}
+
+		jsonResponse(w, 200, result)
+		return
+	}
+
+	result, err := api.store.Import(r.Context(), document, strategy)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	if imported != nil {
+		if err := api.settings.update(imported); err != nil {
+			jsonError(w, err.Error(), 422)
+			return
+		}
+
+		hlog.FromRequest(r).Warn().Msg("Imported the settings")
+	}
+
+	api.fetch(r, document)
+
+	jsonResponse(w, 200, result)
+}
+
+// fetch enqueues a job to fetch the content of every imported bookmark that has none, unless the
+// fetch query parameter is false
+func (api *imports) fetch(r *http.Request, document *storage.Document) {
+	if r.URL.Query().Get("fetch") == "false" {
+		return
+	}
+
+	for _, bookmark := range document.Bookmarks {
+		if bookmark.ID == "" || bookmark.Content != "" {
+			continue
+		}
+
+		if _, err := scheduler.EnqueueFetchBookmark(api.queue, bookmark.ID, queue.PriorityLow); err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Str("id", bookmark.ID).Msg("Error enqueueing bookmark fetch")
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// inboundFields are the fields of a bookmark an inbound webhook sets, every field is read from the
+// json path of the same name unless the mapping of the token says otherwise
+var inboundFields = []string{"url", "title", "tags", "note"}
+
+// InboundMapping maps the fields of a bookmark to dotted paths in the json payload of an inbound
+// webhook, for example "url" to "data.link" or "tags" to "labels"
+type InboundMapping map[string]string
+
+// ParseInboundMapping parses a mapping like "url=data.link title=data.name", an empty mapping reads
+// every field from the path of the same name
+func ParseInboundMapping(spec string) (InboundMapping, error) {
+	mapping := InboundMapping{}
+
+	for _, pair := range strings.Fields(spec) {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid inbound mapping %s, use field=path", pair)
+		}
+
+		known := false
+		for _, field := range inboundFields {
+			known = known || field == parts[0]
+		}
+		if !known {
+			return nil, fmt.Errorf("Unknown inbound field %s, use one of %s", parts[0], strings.Join(inboundFields, ", "))
+		}
+
+		mapping[parts[0]] = parts[1]
+	}
+
+	return mapping, nil
+}
+
+// path returns the json path a field is read from
+func (mapping InboundMapping) path(field string) string {
+	if path, ok := mapping[field]; ok {
+		return path
+	}
+
+	return field
+}
+
+// inbound saves the links that services like IFTTT, Zapier and n8n push as json, the token in the
+// url authenticates the request and decides how the payload is read
+type inbound struct {
+	store  storage.Storer
+	tokens map[string]InboundMapping
+}
+
+func (api inbound) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Fetch)).Post("/{token}", api.receive)
+
+	return r
+}
+
+// mapping finds the mapping of a token, comparing every token in constant time
+func (api *inbound) mapping(token string) (InboundMapping, bool) {
+	var found InboundMapping
+	ok := false
+
+	for candidate, mapping := range api.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			found, ok = mapping, true
+		}
+	}
+
+	return found, ok
+}
+
+func (api *inbound) receive(w http.ResponseWriter, r *http.Request) {
+	mapping, ok := api.mapping(chi.URLParam(r, "token"))
+	if !ok {
+		time.Sleep(2 * time.Second)
+		jsonError(w, "Unauthorized", 401)
+		return
+	}
+
+	var payload interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&payload); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	pageURL := strings.TrimSpace(inboundString(inboundLookup(payload, mapping.path("url"))))
+	if parsed, err := url.ParseRequestURI(pageURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		jsonErrorWithFields(w, "Missing or invalid url", 422, map[string]string{"url": "must be an http or https url at " + mapping.path("url")})
+		return
+	}
+
+	bookmark, err := capture.Save(r.Context(), api.store, pageURL, inboundTags(inboundLookup(payload, mapping.path("tags"))))
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	// The title and note were chosen by whoever pushed the link, which beats the ones of the page
+	title := strings.TrimSpace(inboundString(inboundLookup(payload, mapping.path("title"))))
+	note := strings.TrimSpace(inboundString(inboundLookup(payload, mapping.path("note"))))
+	if title != "" || note != "" {
+		if title != "" {
+			bookmark.Title = title
+		}
+		if note != "" {
+			bookmark.Excerpt = note
+		}
+
+		if err := api.store.BookmarkPersist(r.Context(), bookmark); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+
+	jsonResponse(w, 201, bookmark)
+}
+
+// inboundLookup follows a dotted path through the objects and arrays of a json payload, numbers
+// index arrays, nil is returned if the path does not exist
+func inboundLookup(payload interface{}, path string) interface{} {
+	for _, key := range strings.Split(path, ".") {
+		switch value := payload.(type) {
+		case map[string]interface{}:
+			payload = value[key]
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(value) {
+				return nil
+			}
+			payload = value[index]
+		default:
+			return nil
+		}
+	}
+
+	return payload
+}
+
+// inboundString turns a json value into a string, objects and arrays become an empty string
+func inboundString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case json.Number, bool:
+		return fmt.Sprint(value)
+	default:
+		return ""
+	}
+}
+
+// inboundTags reads tags from an array of strings or a string of tags separated by commas or spaces,
+// like "go, web" or "#go #web"
+func inboundTags(value interface{}) storage.Tags {
+	words := []string{}
+
+	switch value := value.(type) {
+	case string:
+		words = strings.FieldsFunc(value, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\n'
+		})
+	case []interface{}:
+		for _, item := range value {
+			words = append(words, inboundString(item))
+		}
+	}
+
+	tags := storage.Tags{}
+	for _, word := range words {
+		if tag := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(word), "#")); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
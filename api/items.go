@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+type items struct {
+	store storage.Storer
+}
+
+func (api items) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/", api.list)
+	r.With(timeout(timeouts.Write)).Post("/read", api.read)
+	r.With(timeout(timeouts.Fetch)).Post("/{id}/bookmark", api.bookmark)
+
+	return r
+}
+
+// list lists the items of all feeds, the newest first or the best matches of q first, only the
+// starred ones with starred=true
+func (api *items) list(w http.ResponseWriter, r *http.Request) {
+	sort, err := storage.ParseSort(r.URL.Query().Get("_sort"), storage.FeedItemSortFields)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
+	if len(sort) != 0 && r.URL.Query().Get("_cursor") != "" {
+		jsonError(w, "Cannot combine _cursor with _sort", 400)
+		return
+	}
+
+	if r.URL.Query().Get("q") != "" && r.URL.Query().Get("_cursor") != "" {
+		jsonError(w, "Cannot combine _cursor with q", 400)
+		return
+	}
+
+	if cursor := r.URL.Query().Get("_cursor"); cursor != "" {
+		if _, err := storage.ParseCursor(cursor); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+
+	limit := asInt(r.URL.Query().Get("_limit"), 50)
+
+	options := &storage.FeedItemListOptions{
+		Search:  r.URL.Query().Get("q"),
+		Starred: r.URL.Query().Get("starred") == "true",
+		Sort:    sort,
+		Cursor:  r.URL.Query().Get("_cursor"),
+		Limit:   limit,
+		Offset:  asInt(r.URL.Query().Get("_offset"), 0),
+	}
+
+	if limit < 0 || limit > listStreamSize {
+		// A page of no items only counts them
+		counted := *options
+		counted.Limit = 0
+		_, totalCount := api.store.FeedItemList(r.Context(), &counted)
+
+		w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
+		jsonStream(w, r, func(write func(item interface{}) error) error {
+			return api.store.FeedItemEach(r.Context(), options, func(item *storage.ListedFeedItem) error { return write(item) })
+		})
+		return
+	}
+
+	items, totalCount := api.store.FeedItemList(r.Context(), options)
+
+	w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
+
+	// Search results are ranked and other sorts are not by date, so only pages in the default order
+	// can continue after the last one
+	if listed := *items; len(listed) != 0 && len(listed) == limit && len(sort) == 0 && r.URL.Query().Get("q") == "" {
+		last := listed[len(listed)-1]
+		w.Header().Set("X-Pagination-Next-Cursor", storage.NewCursor(last.Item.Date, last.Item.ID))
+	}
+
+	jsonList(w, r, items)
+}
+
+// read marks the items of all feeds as read, optionally only those dated before the before query
+// parameter or of feeds with the tags query parameter
+func (api *items) read(w http.ResponseWriter, r *http.Request) {
+	options, err := feedReadOptions(r)
+	if err != nil {
+		jsonError(w, "Invalid before: "+err.Error(), 400)
+		return
+	}
+
+	options.Tags = strings.Split(r.URL.Query().Get("tags"), ",")
+
+	markRead(w, r, api.store, options)
+}
+
+// bookmark saves an item as a bookmark to read later with the full content of its page, or the
+// content of the item if the page cannot be fetched. The item is marked as read with read=true.
+func (api *items) bookmark(w http.ResponseWriter, r *http.Request) {
+	items, _ := api.store.FeedItemList(r.Context(), &storage.FeedItemListOptions{ID: chi.URLParam(r, "id"), Limit: 1})
+	if len(*items) == 0 {
+		storeError(w, storage.ErrNotExistingFeedItem)
+		return
+	}
+
+	item := (*items)[0].Item
+
+	bookmark := storage.Bookmark{URL: item.URL, Tags: storage.Tags{"read-it-later"}}
+
+	if err := bookmark.Fetch(r.Context()); err != nil {
+		bookmark.Content = item.Content
+		bookmark.Excerpt = ""
+	}
+
+	if item.Title != "" {
+		bookmark.Title = item.Title
+	}
+
+	if err := api.store.BookmarkPersist(r.Context(), &bookmark); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("read") == "true" {
+		feed := storage.Feed{ID: (*items)[0].FeedID}
+		if err := api.store.FeedGet(r.Context(), &feed); err != nil {
+			storeError(w, err)
+			return
+		}
+
+		if err := feed.DeleteItem(item.ID); err != nil {
+			storeError(w, err)
+			return
+		}
+
+		if err := api.store.FeedPersist(r.Context(), &feed); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+
+	jsonResponse(w, 200, &bookmark)
+}
+
+// feedReadOptions parses the before query parameter, a RFC 3339 date, of r
+func feedReadOptions(r *http.Request) (*storage.FeedReadOptions, error) {
+	options := &storage.FeedReadOptions{}
+
+	if value := r.URL.Query().Get("before"); value != "" {
+		before, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, err
+		}
+		options.Before = before
+	}
+
+	return options, nil
+}
+
+func markRead(w http.ResponseWriter, r *http.Request, store storage.Storer, options *storage.FeedReadOptions) {
+	feeds, err := store.FeedRead(r.Context(), options)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, map[string]interface{}{"Feeds": feeds})
+}
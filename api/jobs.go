@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/queue"
+)
+
+var (
+	contextKeyJob = contextKey("job")
+)
+
+type jobs struct {
+	queue *queue.Queue
+}
+
+func (api jobs) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/", api.list)
+	r.With(timeout(timeouts.Read)).Get("/_workers", api.workers)
+	r.Route("/{id}", func(r chi.Router) {
+		r.Use(api.middleware)
+		r.With(timeout(timeouts.Read)).Get("/", api.get)
+		r.With(timeout(timeouts.Write)).Delete("/", api.cancel)
+	})
+
+	return r
+}
+
+func (api *jobs) list(w http.ResponseWriter, r *http.Request) {
+	state := queue.State(r.URL.Query().Get("state"))
+	if state != "" && !state.Valid() {
+		jsonError(w, "Invalid state: "+string(state), 400)
+		return
+	}
+
+	jobs, totalCount := api.queue.List(&queue.ListOptions{
+		Kind:   r.URL.Query().Get("kind"),
+		State:  state,
+		Limit:  asInt(r.URL.Query().Get("_limit"), 50),
+		Offset: asInt(r.URL.Query().Get("_offset"), 0),
+	})
+
+	w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
+
+	jsonList(w, r, jobs)
+}
+
+func (api *jobs) workers(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, 200, api.queue.Pools())
+}
+
+func (api *jobs) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		job, err := api.queue.Get(chi.URLParam(r, "id"))
+		if err != nil {
+			jsonError(w, "Job Not Found", 404)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyJob, job)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (api *jobs) get(w http.ResponseWriter, r *http.Request) {
+	job := r.Context().Value(contextKeyJob).(*queue.Job)
+
+	jsonResponse(w, 200, job)
+}
+
+func (api *jobs) cancel(w http.ResponseWriter, r *http.Request) {
+	job, err := api.queue.Cancel(r.Context().Value(contextKeyJob).(*queue.Job).ID)
+	if err != nil {
+		queueError(w, err)
+		return
+	}
+
+	// A running job stops once its handler notices that its context is cancelled
+	if job.State == queue.StateRunning {
+		jsonResponse(w, 202, job)
+		return
+	}
+
+	jsonResponse(w, 200, job)
+}
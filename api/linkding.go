@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+)
+
+var (
+	contextKeyLinkdingNumber = contextKey("linkding number")
+)
+
+// linkding implements the bookmarks api of linkding, so its mobile apps and browser extensions can
+// save bookmarks. Archived and unread bookmarks are the ones tagged archived and read-it-later.
+type linkding struct {
+	store *storage.Store
+	token string
+}
+
+func (api linkding) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.Use(api.authenticate)
+	r.Route("/bookmarks", func(r chi.Router) {
+		r.With(timeout(timeouts.Read)).Get("/", api.list(false))
+		r.With(timeout(timeouts.Fetch)).Post("/", api.create)
+		r.With(timeout(timeouts.Read)).Get("/archived/", api.list(true))
+		r.With(timeout(timeouts.Fetch)).Get("/check/", api.check)
+		r.Route("/{id}", func(r chi.Router) {
+			r.Use(api.middleware)
+			r.With(timeout(timeouts.Read)).Get("/", api.get)
+			r.With(timeout(timeouts.Write)).Put("/", api.update)
+			r.With(timeout(timeouts.Write)).Patch("/", api.update)
+			r.With(timeout(timeouts.Write)).Delete("/", api.delete)
+			r.With(timeout(timeouts.Write)).Post("/archive/", api.archive(true))
+			r.With(timeout(timeouts.Write)).Post("/unarchive/", api.archive(false))
+		})
+	})
+
+	return r
+}
+
+// linkdingBookmark is a bookmark as linkding represents it, without the archived, read-it-later
+// and shared tags that make up IsArchived, Unread and Shared
+type linkdingBookmark struct {
+	ID                    int64        `json:"id"`
+	URL                   string       `json:"url"`
+	Title                 string       `json:"title"`
+	Description           string       `json:"description"`
+	Notes                 string       `json:"notes"`
+	WebsiteTitle          *string      `json:"website_title"`
+	WebsiteDescription    *string      `json:"website_description"`
+	WebArchiveSnapshotURL string       `json:"web_archive_snapshot_url"`
+	FaviconURL            *string      `json:"favicon_url"`
+	PreviewImageURL       *string      `json:"preview_image_url"`
+	IsArchived            bool         `json:"is_archived"`
+	Unread                bool         `json:"unread"`
+	Shared                bool         `json:"shared"`
+	TagNames              storage.Tags `json:"tag_names"`
+	DateAdded             string       `json:"date_added"`
+	DateModified          string       `json:"date_modified"`
+}
+
+type linkdingPage struct {
+	Count    int                 `json:"count"`
+	Next     *string             `json:"next"`
+	Previous *string             `json:"previous"`
+	Results  []*linkdingBookmark `json:"results"`
+}
+
+func linkdingError(w http.ResponseWriter, message string, status int) {
+	jsonResponse(w, status, map[string]string{"detail": message})
+}
+
+// bookmark converts a bookmark to a linkding bookmark with the given number as id
+func (api *linkding) bookmark(bookmark *storage.Bookmark, number int64) *linkdingBookmark {
+	result := &linkdingBookmark{
+		ID:           number,
+		URL:          bookmark.URL,
+		Title:        bookmark.Title,
+		Description:  bookmark.Excerpt,
+		TagNames:     storage.Tags{},
+		DateAdded:    bookmark.Created.Format(time.RFC3339),
+		DateModified: bookmark.Updated.Format(time.RFC3339),
+	}
+
+	for _, tag := range bookmark.Tags {
+		switch tag {
+		case capture.Archived:
+			result.IsArchived = true
+		case capture.ReadItLater:
+			result.Unread = true
+		case capture.Shared:
+			result.Shared = true
+		default:
+			result.TagNames = append(result.TagNames, tag)
+		}
+	}
+
+	return result
+}
+
+// apply copies the fields a client can change from result to bookmark
+func (api *linkding) apply(bookmark *storage.Bookmark, result *linkdingBookmark) {
+	bookmark.URL = result.URL
+
+	if result.Title != "" {
+		bookmark.Title = result.Title
+	}
+
+	if result.Description != "" {
+		bookmark.Excerpt = result.Description
+	}
+
+	tags := storage.Tags{}
+	if result.IsArchived {
+		tags = append(tags, capture.Archived)
+	}
+	if result.Unread {
+		tags = append(tags, capture.ReadItLater)
+	}
+	if result.Shared {
+		tags = append(tags, capture.Shared)
+	}
+
+	bookmark.Tags = tags.Merge(result.TagNames)
+}
+
+// authenticate requires the api token in an Authorization header, like Token abc or Bearer abc
+func (api *linkding) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("Authorization")
+		for _, scheme := range []string{"Token ", "Bearer "} {
+			token = strings.TrimPrefix(token, scheme)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) != 1 {
+			time.Sleep(2 * time.Second)
+			linkdingError(w, "Invalid token.", 401)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// query translates the search syntax of linkding, like "golang #web !unread", to list options
+func (api *linkding) query(q string, archived bool) *storage.BookmarkListOptions {
+	options := &storage.BookmarkListOptions{Tags: storage.Tags{"-" + capture.Archived}}
+	if archived {
+		options.Tags = storage.Tags{capture.Archived}
+	}
+
+	terms := []string{}
+
+	for _, word := range strings.Fields(q) {
+		switch {
+		case word == "!unread":
+			options.Tags = append(options.Tags, capture.ReadItLater)
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			options.Tags = append(options.Tags, strings.TrimPrefix(word, "#"))
+		default:
+			terms = append(terms, word)
+		}
+	}
+
+	options.Search = strings.Join(terms, " ")
+
+	return options
+}
+
+// list lists the bookmarks that are not archived, or only the archived ones
+func (api *linkding) list(archived bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		options := api.query(r.URL.Query().Get("q"), archived)
+		options.Limit = asInt(r.URL.Query().Get("limit"), 100)
+		options.Offset = asInt(r.URL.Query().Get("offset"), 0)
+
+		bookmarks, totalCount := api.store.BookmarkList(r.Context(), options)
+
+		page := linkdingPage{Count: totalCount, Results: []*linkdingBookmark{}}
+
+		numbers := api.store.BookmarkNumbers(r.Context(), *bookmarks)
+		for _, bookmark := range *bookmarks {
+			page.Results = append(page.Results, api.bookmark(bookmark, numbers[bookmark.ID]))
+		}
+
+		if options.Offset+options.Limit < totalCount {
+			page.Next = pageURL(r, options.Offset+options.Limit)
+		}
+
+		if options.Offset > 0 {
+			previous := options.Offset - options.Limit
+			if previous < 0 {
+				previous = 0
+			}
+			page.Previous = pageURL(r, previous)
+		}
+
+		jsonResponse(w, 200, page)
+	}
+}
+
+// pageURL links to the page of the requested list that starts at offset
+func pageURL(r *http.Request, offset int) *string {
+	link, _ := url.Parse(r.RequestURI)
+
+	query := link.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	link.RawQuery = query.Encode()
+
+	link.Host = r.Host
+	link.Scheme = "http"
+	if r.TLS != nil {
+		link.Scheme = "https"
+	}
+
+	result := link.String()
+
+	return &result
+}
+
+// check reports if a url is bookmarked, along with the title and description of the page
+func (api *linkding) check(w http.ResponseWriter, r *http.Request) {
+	bookmark := storage.Bookmark{URL: r.URL.Query().Get("url")}
+	if bookmark.URL == "" {
+		linkdingError(w, "Missing url.", 400)
+		return
+	}
+
+	result := map[string]interface{}{"bookmark": nil, "auto_tags": []string{}}
+
+	if err := api.store.BookmarkGet(r.Context(), &bookmark); err == nil {
+		result["bookmark"] = api.bookmark(&bookmark, api.store.BookmarkNumbers(r.Context(), []*storage.Bookmark{&bookmark})[bookmark.ID])
+	} else if err := bookmark.Fetch(r.Context()); err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Str("url", bookmark.URL).Msg("Error fetching bookmark for linkding")
+	}
+
+	result["metadata"] = map[string]string{"url": bookmark.URL, "title": bookmark.Title, "description": bookmark.Excerpt}
+
+	jsonResponse(w, 200, result)
+}
+
+// create saves a bookmark, or updates the bookmark with the same url like linkding does
+func (api *linkding) create(w http.ResponseWriter, r *http.Request) {
+	result := linkdingBookmark{}
+	if err := json.NewDecoder(r.Body).Decode(&result); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if result.URL == "" {
+		linkdingError(w, "Missing url.", 400)
+		return
+	}
+
+	bookmark := storage.Bookmark{URL: result.URL}
+
+	if err := api.store.BookmarkGet(r.Context(), &bookmark); err != nil {
+		// Pages that cannot be fetched are saved anyway, with their url as title
+		if err := bookmark.Fetch(r.Context()); err != nil {
+			hlog.FromRequest(r).Warn().Err(err).Str("url", bookmark.URL).Msg("Error fetching bookmark for linkding")
+		}
+	}
+
+	api.apply(&bookmark, &result)
+
+	if err := api.store.BookmarkPersist(r.Context(), &bookmark); err != nil {
+		linkdingError(w, err.Error(), 500)
+		return
+	}
+
+	jsonResponse(w, 201, api.bookmark(&bookmark, api.store.BookmarkNumbers(r.Context(), []*storage.Bookmark{&bookmark})[bookmark.ID]))
+}
+
+func (api *linkding) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			linkdingError(w, "Not found.", 404)
+			return
+		}
+
+		bookmark := storage.Bookmark{}
+		if err := api.store.BookmarkGetNumber(r.Context(), number, &bookmark); err != nil {
+			linkdingError(w, "Not found.", 404)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyBookmark, &bookmark)
+		ctx = context.WithValue(ctx, contextKeyLinkdingNumber, number)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (api *linkding) get(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	jsonResponse(w, 200, api.bookmark(bookmark, r.Context().Value(contextKeyLinkdingNumber).(int64)))
+}
+
+// update changes the fields sent by the client, both for PUT and PATCH
+func (api *linkding) update(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+	number := r.Context().Value(contextKeyLinkdingNumber).(int64)
+
+	result := api.bookmark(bookmark, number)
+	if err := json.NewDecoder(r.Body).Decode(result); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	// Another bookmark with the same url would be overwritten
+	if result.URL != bookmark.URL {
+		existing := storage.Bookmark{URL: result.URL}
+		if err := api.store.BookmarkGet(r.Context(), &existing); err == nil || result.URL == "" {
+			linkdingError(w, "A bookmark with this url already exists.", 400)
+			return
+		}
+	}
+
+	api.apply(bookmark, result)
+
+	if err := api.store.BookmarkPersist(r.Context(), bookmark); err != nil {
+		linkdingError(w, err.Error(), 500)
+		return
+	}
+
+	jsonResponse(w, 200, api.bookmark(bookmark, number))
+}
+
+func (api *linkding) delete(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	if err := api.store.BookmarkDelete(r.Context(), bookmark); err != nil {
+		linkdingError(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// archive adds or removes the archived tag
+func (api *linkding) archive(archived bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+		result := api.bookmark(bookmark, 0)
+		result.IsArchived = archived
+		api.apply(bookmark, result)
+
+		if err := api.store.BookmarkPersist(r.Context(), bookmark); err != nil {
+			linkdingError(w, err.Error(), 500)
+			return
+		}
+
+		w.WriteHeader(204)
+	}
+}
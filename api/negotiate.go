@@ -0,0 +1,46 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// negotiate returns the offer that best matches the Accept header of the request,
+// defaulting to the first offer if the header is missing or nothing matches
+func negotiate(r *http.Request, offers ...string) string {
+	best := offers[0]
+	bestQuality := -1.0
+
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		for _, offer := range offers {
+			if quality > bestQuality && matchesMediaType(mediaType, offer) {
+				best = offer
+				bestQuality = quality
+			}
+		}
+	}
+
+	return best
+}
+
+func matchesMediaType(accepted, offer string) bool {
+	if accepted == "*/*" || accepted == offer {
+		return true
+	}
+
+	return strings.HasSuffix(accepted, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(accepted, "*"))
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+const (
+	// opmlBatchSize is the number of feeds read at once while exporting them
+	opmlBatchSize = 500
+)
+
+// opmlDocument is an OPML 2.0 subscription list, see http://opml.org/spec2.opml
+type opmlDocument struct {
+	XMLName  xml.Name       `xml:"opml"`
+	Version  string         `xml:"version,attr"`
+	Title    string         `xml:"head>title"`
+	Created  string         `xml:"head>dateCreated"`
+	Outlines []*opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is a single feed, or a folder of feeds when it has outlines itself
+type opmlOutline struct {
+	Text     string         `xml:"text,attr"`
+	Title    string         `xml:"title,attr,omitempty"`
+	Type     string         `xml:"type,attr,omitempty"`
+	XMLURL   string         `xml:"xmlUrl,attr,omitempty"`
+	Category string         `xml:"category,attr,omitempty"`
+	Outlines []*opmlOutline `xml:"outline"`
+}
+
+// exportFeeds writes all feeds as OPML, which every feed reader imports. Feeds are grouped in a
+// folder named after their first tag, since that is how most readers import categories, and all
+// their tags are listed in the category attribute.
+func (api *feeds) exportFeeds(w http.ResponseWriter, r *http.Request) {
+	document := opmlDocument{
+		Version: "2.0",
+		Title:   "Feeds",
+		Created: time.Now().UTC().Format(time.RFC1123Z),
+	}
+
+	folders := map[string]*opmlOutline{}
+
+	for offset := 0; ; offset += opmlBatchSize {
+		feeds, _ := api.store.FeedList(r.Context(), &storage.FeedListOptions{
+			Sort:   storage.Sort{{Field: "title"}},
+			Limit:  opmlBatchSize,
+			Offset: offset,
+		})
+
+		for _, feed := range *feeds {
+			outline := &opmlOutline{Text: feed.Title, Title: feed.Title, Type: "rss", XMLURL: feed.URL}
+
+			if len(feed.Tags) == 0 {
+				document.Outlines = append(document.Outlines, outline)
+				continue
+			}
+
+			categories := []string{}
+			for _, tag := range feed.Tags {
+				categories = append(categories, "/"+tag)
+			}
+			outline.Category = strings.Join(categories, ",")
+
+			folder, ok := folders[feed.Tags[0]]
+			if !ok {
+				folder = &opmlOutline{Text: feed.Tags[0], Title: feed.Tags[0]}
+				folders[feed.Tags[0]] = folder
+			}
+			folder.Outlines = append(folder.Outlines, outline)
+		}
+
+		if len(*feeds) < opmlBatchSize {
+			break
+		}
+	}
+
+	names := []string{}
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	outlines := []*opmlOutline{}
+	for _, name := range names {
+		outlines = append(outlines, folders[name])
+	}
+	document.Outlines = append(outlines, document.Outlines...)
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\"feeds-"+time.Now().UTC().Format("20060102T150405Z")+".opml\"")
+	w.WriteHeader(200)
+
+	io.WriteString(w, xml.Header)
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	encoder.Encode(document)
+	io.WriteString(w, "\n")
+}
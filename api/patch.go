@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// mergePatch applies the RFC 7396 JSON merge patch read from body to target. Members
+// set to null are reset to their zero value and members that are absent are left untouched,
+// as are the fields of target that are hidden from JSON.
+func mergePatch(target interface{}, body io.Reader) error {
+	var patch interface{}
+	if err := json.NewDecoder(body).Decode(&patch); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	var document interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return err
+	}
+
+	if data, err = json.Marshal(mergeValue(document, patch)); err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(target).Elem()
+	hidden := hiddenFields(value)
+	value.Set(reflect.Zero(value.Type()))
+
+	if err := json.Unmarshal(data, target); err != nil {
+		return err
+	}
+
+	for index, field := range hidden {
+		value.Field(index).Set(field)
+	}
+
+	return nil
+}
+
+// hiddenFields returns copies of the exported fields of a struct tagged with json:"-" by their
+// index, the document of the struct does not have them so the patch cannot restore them
+func hiddenFields(value reflect.Value) map[int]reflect.Value {
+	hidden := map[int]reflect.Value{}
+
+	if value.Kind() != reflect.Struct {
+		return hidden
+	}
+
+	for index := 0; index < value.NumField(); index++ {
+		if field := value.Type().Field(index); field.PkgPath == "" && field.Tag.Get("json") == "-" {
+			saved := reflect.New(field.Type).Elem()
+			saved.Set(value.Field(index))
+			hidden[index] = saved
+		}
+	}
+
+	return hidden
+}
+
+func mergeValue(document, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	documentObject, ok := document.(map[string]interface{})
+	if !ok {
+		documentObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		key = matchKey(documentObject, key)
+
+		if value == nil {
+			delete(documentObject, key)
+		} else {
+			documentObject[key] = mergeValue(documentObject[key], value)
+		}
+	}
+
+	return documentObject
+}
+
+// matchKey finds the member of object matching key case insensitively, the same way encoding/json does
+func matchKey(object map[string]interface{}, key string) string {
+	if _, ok := object[key]; ok {
+		return key
+	}
+
+	for existing := range object {
+		if strings.EqualFold(existing, key) {
+			return existing
+		}
+	}
+
+	return key
+}
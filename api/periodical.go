@@ -0,0 +1,42 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/scheduler"
+)
+
+// periodical serves the EPUB of unread feed items and bookmarks last compiled by the scheduler
+type periodical struct {
+	path string
+}
+
+func (api periodical) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/", api.download)
+
+	return r
+}
+
+func (api *periodical) download(w http.ResponseWriter, r *http.Request) {
+	file, err := os.Open(api.path)
+	if err != nil {
+		jsonError(w, "Periodical Not Found", 404)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		jsonError(w, "Periodical Not Found", 404)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": scheduler.PeriodicalName(info.ModTime())}))
+
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
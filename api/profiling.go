@@ -0,0 +1,28 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/go-chi/chi"
+)
+
+// profiling serves the runtime profiles of net/http/pprof and the variables of expvar, like the
+// memory statistics, so operators can find out why refreshing feeds or searching is slow. The
+// handlers of pprof expect to be served under /debug/pprof/, so named profiles are looked up here.
+func profiling() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/pprof/", pprof.Index)
+	r.Get("/pprof/cmdline", pprof.Cmdline)
+	r.Get("/pprof/profile", pprof.Profile)
+	r.Get("/pprof/symbol", pprof.Symbol)
+	r.Post("/pprof/symbol", pprof.Symbol)
+	r.Get("/pprof/trace", pprof.Trace)
+	r.Get("/pprof/{profile}", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Handler(chi.URLParam(r, "profile")).ServeHTTP(w, r)
+	})
+	r.Get("/vars", expvar.Handler().ServeHTTP)
+
+	return r
+}
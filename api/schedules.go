@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/queue"
+)
+
+type schedules struct {
+	queue *queue.Queue
+}
+
+func (api schedules) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/", api.list)
+
+	return r
+}
+
+func (api *schedules) list(w http.ResponseWriter, r *http.Request) {
+	jsonList(w, r, api.queue.Schedules())
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/systemd"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ListenAndServe listens on the given address:port, or unix:/path/to/socket, and serves the Bookmarks
+// rest API until ctx is done, after which in-flight requests get drainTimeout to finish
+func (api *API) ListenAndServe(ctx context.Context, address string, drainTimeout time.Duration) error {
+	listener, err := api.listen(address)
+	if err != nil {
+		return err
+	}
+
+	return api.Serve(ctx, []net.Listener{listener}, drainTimeout)
+}
+
+// Serve serves the Bookmarks rest API on listeners, like the sockets passed by systemd, until ctx is
+// done, after which in-flight requests get drainTimeout to finish. The service manager is notified
+// once the api is ready and when it stops.
+func (api *API) Serve(ctx context.Context, listeners []net.Listener, drainTimeout time.Duration) error {
+	server := &http.Server{
+		Handler: otelhttp.NewHandler(api.router, "bookmarks", otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		})),
+	}
+
+	if len(api.options.AutocertHosts) != 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(api.options.AutocertHosts...),
+			Cache:      autocert.DirCache(api.options.AutocertCache),
+		}
+		server.TLSConfig = manager.TLSConfig()
+	}
+
+	errs := make(chan error, len(listeners))
+
+	for _, listener := range listeners {
+		go func(listener net.Listener) {
+			if server.TLSConfig != nil {
+				errs <- server.ServeTLS(listener, "", "")
+			} else if api.options.TLSCert != "" && api.options.TLSKey != "" {
+				errs <- server.ServeTLS(listener, api.options.TLSCert, api.options.TLSKey)
+			} else {
+				errs <- server.Serve(listener)
+			}
+		}(listener)
+	}
+
+	systemd.Notify("READY=1")
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	systemd.Notify("STOPPING=1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+
+	return server.Shutdown(ctx)
+}
+
+func (api *API) listen(address string) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix:") {
+		return net.Listen("tcp", address)
+	}
+
+	path := strings.TrimPrefix(address, "unix:")
+
+	// Remove a stale socket left behind by a previous run
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if api.options.SocketMode != 0 {
+		if err := os.Chmod(path, api.options.SocketMode); err != nil {
+			listener.Close()
+			return nil, err
+		}
+	}
+
+	return listener, nil
+}
@@ -0,0 +1,435 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+)
+
+const (
+	// shaarliMaxAge is how long ago a token may be issued, the same as Shaarli allows
+	shaarliMaxAge = 9 * time.Minute
+
+	// shaarliMaxSkew is how far in the future a token may be issued, for clients with a clock that runs ahead
+	shaarliMaxSkew = time.Minute
+)
+
+var (
+	contextKeyShaarliNumber = contextKey("shaarli number")
+)
+
+// shaarli implements the rest api of Shaarli, so its mobile apps and browser extensions can save
+// bookmarks. Clients sign a token with the api secret on every request instead of logging in.
+type shaarli struct {
+	store  *storage.Store
+	secret string
+}
+
+func (api shaarli) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.Use(api.authenticate)
+	r.With(timeout(timeouts.Read)).Get("/info", api.info)
+	r.With(timeout(timeouts.Read)).Get("/links", api.list)
+	r.With(timeout(timeouts.Fetch)).Post("/links", api.create)
+	r.Route("/links/{id}", func(r chi.Router) {
+		r.Use(api.middleware)
+		r.With(timeout(timeouts.Read)).Get("/", api.get)
+		r.With(timeout(timeouts.Write)).Put("/", api.update)
+		r.With(timeout(timeouts.Write)).Delete("/", api.delete)
+	})
+	r.With(timeout(timeouts.Read)).Get("/tags", api.tags)
+	r.With(timeout(timeouts.Read)).Get("/tags/{name}", api.tag)
+	r.With(timeout(timeouts.Write)).Put("/tags/{name}", api.renameTag)
+	r.With(timeout(timeouts.Write)).Delete("/tags/{name}", api.deleteTag)
+
+	return r
+}
+
+// shaarliLink is a bookmark as Shaarli represents it, bookmarks cannot be private
+type shaarliLink struct {
+	ID          int64        `json:"id"`
+	URL         string       `json:"url"`
+	ShortURL    string       `json:"shorturl"`
+	Title       string       `json:"title"`
+	Description string       `json:"description"`
+	Tags        storage.Tags `json:"tags"`
+	Private     bool         `json:"private"`
+	Created     string       `json:"created"`
+	Updated     string       `json:"updated"`
+}
+
+type shaarliTag struct {
+	Name        string `json:"name"`
+	Occurrences int    `json:"occurrences"`
+}
+
+func shaarliError(w http.ResponseWriter, message string, status int) {
+	jsonResponse(w, status, map[string]interface{}{"code": status, "message": message})
+}
+
+// link converts a bookmark to a Shaarli link with the given number as id
+func (api *shaarli) link(bookmark *storage.Bookmark, number int64) *shaarliLink {
+	tags := bookmark.Tags
+	if tags == nil {
+		tags = storage.Tags{}
+	}
+
+	shortURL := bookmark.ID
+	if len(shortURL) > 6 {
+		shortURL = shortURL[:6]
+	}
+
+	return &shaarliLink{
+		ID:          number,
+		URL:         bookmark.URL,
+		ShortURL:    shortURL,
+		Title:       bookmark.Title,
+		Description: bookmark.Excerpt,
+		Tags:        tags,
+		Created:     bookmark.Created.Format(time.RFC3339),
+		Updated:     bookmark.Updated.Format(time.RFC3339),
+	}
+}
+
+// authenticate requires a JWT signed with HS512 and the api secret, issued less than shaarliMaxAge ago
+func (api *shaarli) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !api.verify(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")) {
+			time.Sleep(2 * time.Second)
+			shaarliError(w, "Not authorized", 401)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (api *shaarli) verify(token string) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	hash := hmac.New(sha512.New, []byte(api.secret))
+	hash.Write([]byte(parts[0] + "." + parts[1]))
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, hash.Sum(nil)) {
+		return false
+	}
+
+	header := struct{ Alg string }{}
+	payload := struct{ Iat int64 }{}
+
+	for i, claims := range []interface{}{&header, &payload} {
+		decoded, err := base64.RawURLEncoding.DecodeString(parts[i])
+		if err != nil || json.Unmarshal(decoded, claims) != nil {
+			return false
+		}
+	}
+
+	issued := time.Unix(payload.Iat, 0)
+
+	return header.Alg == "HS512" && payload.Iat != 0 && time.Since(issued) <= shaarliMaxAge && time.Until(issued) <= shaarliMaxSkew
+}
+
+func (api *shaarli) info(w http.ResponseWriter, r *http.Request) {
+	_, totalCount := api.store.BookmarkList(r.Context(), &storage.BookmarkListOptions{Limit: 1})
+
+	jsonResponse(w, 200, map[string]interface{}{
+		"global_counter":  totalCount,
+		"private_counter": 0,
+		"settings": map[string]interface{}{
+			"title":                 "Bookmarks",
+			"header_link":           "?",
+			"timezone":              time.Now().Location().String(),
+			"enabled_plugins":       []string{},
+			"default_private_links": false,
+		},
+	})
+}
+
+func (api *shaarli) list(w http.ResponseWriter, r *http.Request) {
+	links := []*shaarliLink{}
+
+	// Bookmarks cannot be private
+	if r.URL.Query().Get("visibility") == "private" {
+		jsonResponse(w, 200, links)
+		return
+	}
+
+	limit := asInt(r.URL.Query().Get("limit"), 20)
+	if r.URL.Query().Get("limit") == "all" {
+		limit = -1
+	}
+
+	bookmarks, _ := api.store.BookmarkList(r.Context(), &storage.BookmarkListOptions{
+		Search: r.URL.Query().Get("searchterm"),
+		Tags:   strings.Fields(r.URL.Query().Get("searchtags")),
+		Limit:  limit,
+		Offset: asInt(r.URL.Query().Get("offset"), 0),
+	})
+
+	numbers := api.store.BookmarkNumbers(r.Context(), *bookmarks)
+	for _, bookmark := range *bookmarks {
+		links = append(links, api.link(bookmark, numbers[bookmark.ID]))
+	}
+
+	jsonResponse(w, 200, links)
+}
+
+func (api *shaarli) create(w http.ResponseWriter, r *http.Request) {
+	link := shaarliLink{}
+	if err := json.NewDecoder(r.Body).Decode(&link); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if link.URL == "" {
+		shaarliError(w, "Missing url", 400)
+		return
+	}
+
+	bookmark := storage.Bookmark{URL: link.URL}
+
+	if err := api.store.BookmarkGet(r.Context(), &bookmark); err == nil {
+		jsonResponse(w, 409, api.link(&bookmark, api.store.BookmarkNumbers(r.Context(), []*storage.Bookmark{&bookmark})[bookmark.ID]))
+		return
+	}
+
+	// Pages that cannot be fetched are saved anyway, clients send the title they want to see
+	if err := bookmark.Fetch(r.Context()); err != nil {
+		hlog.FromRequest(r).Warn().Err(err).Str("url", bookmark.URL).Msg("Error fetching bookmark for Shaarli")
+	}
+
+	api.apply(&bookmark, &link)
+
+	if err := api.store.BookmarkPersist(r.Context(), &bookmark); err != nil {
+		shaarliError(w, err.Error(), 500)
+		return
+	}
+
+	jsonResponse(w, 201, api.link(&bookmark, api.store.BookmarkNumbers(r.Context(), []*storage.Bookmark{&bookmark})[bookmark.ID]))
+}
+
+// apply copies the fields a client can change from link to bookmark
+func (api *shaarli) apply(bookmark *storage.Bookmark, link *shaarliLink) {
+	bookmark.URL = link.URL
+
+	if link.Title != "" {
+		bookmark.Title = link.Title
+	}
+
+	if link.Description != "" {
+		bookmark.Excerpt = link.Description
+	}
+
+	bookmark.Tags = storage.Tags{}.Merge(link.Tags)
+}
+
+func (api *shaarli) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		number, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			shaarliError(w, "Link not found", 404)
+			return
+		}
+
+		bookmark := storage.Bookmark{}
+		if err := api.store.BookmarkGetNumber(r.Context(), number, &bookmark); err != nil {
+			shaarliError(w, "Link not found", 404)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyBookmark, &bookmark)
+		ctx = context.WithValue(ctx, contextKeyShaarliNumber, number)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (api *shaarli) get(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	jsonResponse(w, 200, api.link(bookmark, r.Context().Value(contextKeyShaarliNumber).(int64)))
+}
+
+func (api *shaarli) update(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	link := shaarliLink{URL: bookmark.URL}
+	if err := json.NewDecoder(r.Body).Decode(&link); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if link.URL == "" {
+		link.URL = bookmark.URL
+	}
+
+	// Another bookmark with the same url would be overwritten
+	if link.URL != bookmark.URL {
+		existing := storage.Bookmark{URL: link.URL}
+		if err := api.store.BookmarkGet(r.Context(), &existing); err == nil {
+			shaarliError(w, "Link with this url already exists", 409)
+			return
+		}
+	}
+
+	api.apply(bookmark, &link)
+
+	if err := api.store.BookmarkPersist(r.Context(), bookmark); err != nil {
+		shaarliError(w, err.Error(), 500)
+		return
+	}
+
+	jsonResponse(w, 200, api.link(bookmark, r.Context().Value(contextKeyShaarliNumber).(int64)))
+}
+
+func (api *shaarli) delete(w http.ResponseWriter, r *http.Request) {
+	bookmark := r.Context().Value(contextKeyBookmark).(*storage.Bookmark)
+
+	if err := api.store.BookmarkDelete(r.Context(), bookmark); err != nil {
+		shaarliError(w, err.Error(), 500)
+		return
+	}
+
+	w.WriteHeader(204)
+}
+
+// bookmarkTags lists the tags of bookmarks, the most used first
+func (api *shaarli) bookmarkTags(ctx context.Context) []*shaarliTag {
+	tags := []*shaarliTag{}
+
+	for _, tag := range *api.store.TagList(ctx) {
+		if tag.Bookmarks != 0 {
+			tags = append(tags, &shaarliTag{tag.Name, tag.Bookmarks})
+		}
+	}
+
+	return tags
+}
+
+func (api *shaarli) tags(w http.ResponseWriter, r *http.Request) {
+	tags := []*shaarliTag{}
+
+	if r.URL.Query().Get("visibility") != "private" {
+		tags = api.bookmarkTags(r.Context())
+	}
+
+	offset := asInt(r.URL.Query().Get("offset"), 0)
+	if offset > len(tags) {
+		offset = len(tags)
+	}
+	tags = tags[offset:]
+
+	if limit := asInt(r.URL.Query().Get("limit"), 100); r.URL.Query().Get("limit") != "all" && limit < len(tags) {
+		tags = tags[:limit]
+	}
+
+	jsonResponse(w, 200, tags)
+}
+
+// findTag finds the tag named by the url, unless no bookmark has it
+func (api *shaarli) findTag(r *http.Request) *shaarliTag {
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil {
+		return nil
+	}
+
+	for _, tag := range api.bookmarkTags(r.Context()) {
+		if tag.Name == name {
+			return tag
+		}
+	}
+
+	return nil
+}
+
+func (api *shaarli) tag(w http.ResponseWriter, r *http.Request) {
+	tag := api.findTag(r)
+	if tag == nil {
+		shaarliError(w, "Tag not found", 404)
+		return
+	}
+
+	jsonResponse(w, 200, tag)
+}
+
+// renameTag renames the tag everywhere, including on feeds and thoughts
+func (api *shaarli) renameTag(w http.ResponseWriter, r *http.Request) {
+	tag := api.findTag(r)
+	if tag == nil {
+		shaarliError(w, "Tag not found", 404)
+		return
+	}
+
+	renamed := shaarliTag{}
+	if err := json.NewDecoder(r.Body).Decode(&renamed); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	if renamed.Name == "" {
+		shaarliError(w, "Missing name", 400)
+		return
+	}
+
+	if _, err := api.store.TagRename(r.Context(), tag.Name, renamed.Name); err != nil {
+		shaarliError(w, err.Error(), 500)
+		return
+	}
+
+	renamed.Occurrences = tag.Occurrences
+	for _, tag := range api.bookmarkTags(r.Context()) {
+		if tag.Name == renamed.Name {
+			renamed.Occurrences = tag.Occurrences
+		}
+	}
+
+	jsonResponse(w, 200, renamed)
+}
+
+// deleteTag removes the tag from all bookmarks
+func (api *shaarli) deleteTag(w http.ResponseWriter, r *http.Request) {
+	tag := api.findTag(r)
+	if tag == nil {
+		shaarliError(w, "Tag not found", 404)
+		return
+	}
+
+	bookmarks, _ := api.store.BookmarkList(r.Context(), &storage.BookmarkListOptions{Tags: storage.Tags{tag.Name}, Limit: -1})
+
+	for _, listed := range *bookmarks {
+		// Listed bookmarks lack their content, which would be lost when persisting them
+		bookmark := storage.Bookmark{ID: listed.ID}
+		if err := api.store.BookmarkGet(r.Context(), &bookmark); err != nil {
+			continue
+		}
+
+		tags := storage.Tags{}
+		for _, name := range bookmark.Tags {
+			if name != tag.Name {
+				tags = append(tags, name)
+			}
+		}
+		bookmark.Tags = tags
+
+		if err := api.store.BookmarkPersist(r.Context(), &bookmark); err != nil {
+			shaarliError(w, err.Error(), 500)
+			return
+		}
+	}
+
+	w.WriteHeader(204)
+}
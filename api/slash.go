@@ -0,0 +1,151 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/hlog"
+	"github.com/rs/zerolog/log"
+)
+
+// slashMaxAge is how old the timestamp of a signed Slack request may be, older requests are replayed
+const slashMaxAge = 5 * time.Minute
+
+// slash implements the /bookmark <url> #tag slash command of Slack and Mattermost, requests are
+// verified with the signing secret of the Slack app or the token of the Mattermost command
+type slash struct {
+	store         storage.Storer
+	signingSecret string
+	token         string
+}
+
+func (api slash) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Fetch)).Post("/", api.command)
+
+	return r
+}
+
+type slashResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+// verify checks the signature of a Slack request or, for requests without a signature, the token of
+// a Mattermost request
+func (api *slash) verify(r *http.Request, body []byte, form url.Values) bool {
+	if signature := r.Header.Get("X-Slack-Signature"); signature != "" {
+		if api.signingSecret == "" {
+			return false
+		}
+
+		timestamp, err := strconv.ParseInt(r.Header.Get("X-Slack-Request-Timestamp"), 10, 64)
+		if err != nil || time.Since(time.Unix(timestamp, 0)) > slashMaxAge {
+			return false
+		}
+
+		hash := hmac.New(sha256.New, []byte(api.signingSecret))
+		hash.Write([]byte("v0:" + strconv.FormatInt(timestamp, 10) + ":"))
+		hash.Write(body)
+
+		return hmac.Equal([]byte("v0="+hex.EncodeToString(hash.Sum(nil))), []byte(signature))
+	}
+
+	token := form.Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Token ") {
+		token = strings.TrimPrefix(header, "Token ")
+	}
+
+	return api.token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) == 1
+}
+
+func (api *slash) command(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		jsonError(w, "Invalid slash command: "+err.Error(), 400)
+		return
+	}
+
+	if !api.verify(r, body, form) {
+		time.Sleep(2 * time.Second)
+		jsonError(w, "Unauthorized", 401)
+		return
+	}
+
+	urls, tags := capture.Parse(form.Get("text"))
+	if len(urls) == 0 {
+		jsonResponse(w, 200, slashResponse{"ephemeral", "Usage: " + form.Get("command") + " <url> #tag"})
+		return
+	}
+
+	// Slack only waits 3 seconds for a reply, fetching the page can take longer so the title is
+	// sent to the response url once the bookmark is saved
+	if responseURL := form.Get("response_url"); responseURL != "" {
+		logger := *hlog.FromRequest(r)
+		go func() {
+			api.respond(logger.WithContext(context.Background()), responseURL, api.save(logger.WithContext(context.Background()), urls, tags))
+		}()
+
+		jsonResponse(w, 200, slashResponse{"ephemeral", "Saving " + strings.Join(urls, ", ")})
+		return
+	}
+
+	jsonResponse(w, 200, slashResponse{"ephemeral", api.save(r.Context(), urls, tags)})
+}
+
+// save saves every url as a bookmark and describes the result
+func (api *slash) save(ctx context.Context, urls []string, tags storage.Tags) string {
+	lines := []string{}
+
+	for _, pageURL := range urls {
+		bookmark, err := capture.Save(ctx, api.store, pageURL, tags)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("url", pageURL).Msg("Error saving bookmark from slash command")
+			lines = append(lines, "Could not save "+pageURL+": "+err.Error())
+			continue
+		}
+
+		lines = append(lines, "Saved "+bookmark.Title)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// respond sends a delayed reply to the response url of a slash command
+func (api *slash) respond(ctx context.Context, responseURL, text string) {
+	body, _ := json.Marshal(slashResponse{"ephemeral", text})
+
+	request, err := http.NewRequestWithContext(ctx, "POST", responseURL, bytes.NewReader(body))
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error replying to slash command")
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := storage.FetchClient().Do(request)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error replying to slash command")
+		return
+	}
+	response.Body.Close()
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+type tags struct {
+	store storage.Storer
+}
+
+func (api tags) Routes(timeouts Timeouts) chi.Router {
+	r := chi.NewRouter()
+	r.With(timeout(timeouts.Read)).Get("/", api.list)
+	r.With(timeout(timeouts.Write)).Patch("/{name}", api.rename)
+
+	return r
+}
+
+func (api *tags) list(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, 200, api.store.TagList(r.Context()))
+}
+
+func (api *tags) rename(w http.ResponseWriter, r *http.Request) {
+	name, err := url.PathUnescape(chi.URLParam(r, "name"))
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
+	tag := storage.Tag{}
+	if err := json.NewDecoder(r.Body).Decode(&tag); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	renamed, err := api.store.TagRename(r.Context(), name, tag.Name)
+	if err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, map[string]interface{}{"Name": tag.Name, "Renamed": renamed})
+}
@@ -16,35 +16,87 @@ var (
 )
 
 type thoughts struct {
-	store *storage.Store
+	store storage.Storer
 }
 
-func (api thoughts) Routes() chi.Router {
+func (api thoughts) Routes(timeouts Timeouts) chi.Router {
 	r := chi.NewRouter()
-	r.Get("/", api.list)
-	r.Get("/_tags", api.taglist)
-	r.Post("/", api.create)
+	r.With(timeout(timeouts.Read)).Get("/", api.list)
+	r.With(timeout(timeouts.Read)).Get("/_tags", api.taglist)
+	r.With(timeout(timeouts.Write)).Post("/", api.create)
+	r.With(timeout(timeouts.Write)).Post("/{id}/restore", api.restore)
 	r.Route("/{id}", func(r chi.Router) {
 		r.Use(api.middleware)
-		r.Get("/", api.get)
-		r.Put("/", api.update)
-		r.Delete("/", api.delete)
+		r.With(timeout(timeouts.Read)).Get("/", api.get)
+		r.With(timeout(timeouts.Write)).Put("/", api.update)
+		r.With(timeout(timeouts.Write)).Patch("/", api.patch)
+		r.With(timeout(timeouts.Write)).Delete("/", api.delete)
 	})
 
 	return r
 }
 
 func (api *thoughts) list(w http.ResponseWriter, r *http.Request) {
-	thoughts, totalCount := api.store.ThoughtList(r.Context(), &storage.ThoughtListOptions{
-		Search: r.URL.Query().Get("q"),
-		Tags:   strings.Split(r.URL.Query().Get("tags"), ","),
-		Limit:  asInt(r.URL.Query().Get("_limit"), 50),
-		Offset: asInt(r.URL.Query().Get("_offset"), 0),
-	})
+	sort, err := storage.ParseSort(r.URL.Query().Get("_sort"), storage.ThoughtSortFields)
+	if err != nil {
+		jsonError(w, err.Error(), 400)
+		return
+	}
+
+	if len(sort) != 0 && r.URL.Query().Get("_cursor") != "" {
+		jsonError(w, "Cannot combine _cursor with _sort", 400)
+		return
+	}
+
+	if r.URL.Query().Get("q") != "" && r.URL.Query().Get("_cursor") != "" {
+		jsonError(w, "Cannot combine _cursor with q", 400)
+		return
+	}
+
+	if cursor := r.URL.Query().Get("_cursor"); cursor != "" {
+		if _, err := storage.ParseCursor(cursor); err != nil {
+			storeError(w, err)
+			return
+		}
+	}
+
+	limit := asInt(r.URL.Query().Get("_limit"), 50)
+
+	options := &storage.ThoughtListOptions{
+		Search:         r.URL.Query().Get("q"),
+		Tags:           strings.Split(r.URL.Query().Get("tags"), ","),
+		IncludeDeleted: r.URL.Query().Get("include_deleted") == "true",
+		Sort:           sort,
+		Cursor:         r.URL.Query().Get("_cursor"),
+		Limit:          limit,
+		Offset:         asInt(r.URL.Query().Get("_offset"), 0),
+	}
+
+	if limit < 0 || limit > listStreamSize {
+		// A page of no thoughts only counts them
+		counted := *options
+		counted.Limit = 0
+		_, totalCount := api.store.ThoughtList(r.Context(), &counted)
+
+		w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
+		jsonStream(w, r, func(write func(item interface{}) error) error {
+			return api.store.ThoughtEach(r.Context(), options, func(thought *storage.Thought) error { return write(thought) })
+		})
+		return
+	}
+
+	thoughts, totalCount := api.store.ThoughtList(r.Context(), options)
 
 	w.Header().Set("X-Pagination-Total", strconv.Itoa(totalCount))
 
-	jsonResponse(w, 200, thoughts)
+	// Search results are ranked and other sorts are not by creation date, so only pages in the
+	// default order can continue after the last one
+	if items := *thoughts; len(items) != 0 && len(items) == limit && len(sort) == 0 && r.URL.Query().Get("q") == "" {
+		last := items[len(items)-1]
+		w.Header().Set("X-Pagination-Next-Cursor", storage.NewCursor(last.Created, last.ID))
+	}
+
+	jsonList(w, r, thoughts)
 }
 
 func (api *thoughts) taglist(w http.ResponseWriter, r *http.Request) {
@@ -63,7 +115,7 @@ func (api *thoughts) middleware(next http.Handler) http.Handler {
 		thought := storage.Thought{ID: chi.URLParam(r, "id")}
 
 		if err := api.store.ThoughtGet(r.Context(), &thought); err != nil {
-			w.WriteHeader(404)
+			jsonError(w, "Thought Not Found", 404)
 			return
 		}
 
@@ -95,8 +147,7 @@ func (api *thoughts) update(w http.ResponseWriter, r *http.Request) {
 
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
-			w.Header().Set("X-Error", err.Error())
-			w.WriteHeader(500)
+			decodeError(w, err)
 			return
 		}
 
@@ -104,8 +155,7 @@ func (api *thoughts) update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := api.store.ThoughtPersist(r.Context(), thought); err != nil {
-		w.Header().Set("X-Error", err.Error())
-		w.WriteHeader(500)
+		storeError(w, err)
 		return
 	}
 
@@ -118,14 +168,45 @@ func (api *thoughts) update(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(thought.Content))
 }
 
+func (api *thoughts) patch(w http.ResponseWriter, r *http.Request) {
+	thought := r.Context().Value(contextKeyThought).(*storage.Thought)
+	id := thought.ID
+
+	defer r.Body.Close()
+
+	if err := mergePatch(thought, r.Body); err != nil {
+		decodeError(w, err)
+		return
+	}
+
+	thought.ID = id
+
+	if err := api.store.ThoughtPersist(r.Context(), thought); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, thought)
+}
+
 func (api *thoughts) delete(w http.ResponseWriter, r *http.Request) {
 	thought := r.Context().Value(contextKeyThought).(*storage.Thought)
 
 	if err := api.store.ThoughtDelete(r.Context(), thought); err != nil {
-		w.Header().Set("X-Error", err.Error())
-		w.WriteHeader(500)
+		storeError(w, err)
 		return
 	}
 
 	w.WriteHeader(204)
 }
+
+func (api *thoughts) restore(w http.ResponseWriter, r *http.Request) {
+	thought := storage.Thought{ID: chi.URLParam(r, "id")}
+
+	if err := api.store.ThoughtRestore(r.Context(), &thought); err != nil {
+		storeError(w, err)
+		return
+	}
+
+	jsonResponse(w, 200, &thought)
+}
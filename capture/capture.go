@@ -0,0 +1,110 @@
+// Package capture saves bookmarks from short messages, like the ones sent to a chat bot
+package capture
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ReadItLater is the tag of bookmarks that were captured to be read later
+	ReadItLater = "read-it-later"
+
+	// Archived is the tag of bookmarks that were read and are kept for reference
+	Archived = "archived"
+
+	// Shared is the tag of bookmarks that are published to the followers of the ActivityPub actor
+	Shared = "shared"
+)
+
+// Parse finds the http and https URLs in a message and the hashtags that tag them, for example
+// "https://example.com #go #web"
+func Parse(message string) ([]string, storage.Tags) {
+	urls := []string{}
+	tags := storage.Tags{}
+
+	for _, word := range strings.Fields(message) {
+		if strings.HasPrefix(word, "#") && len(word) > 1 {
+			tags = append(tags, strings.ToLower(strings.TrimPrefix(word, "#")))
+			continue
+		}
+
+		// Chat clients often wrap links in angle brackets or end a sentence right after them
+		word = strings.TrimRight(strings.TrimLeft(word, "<("), ">).,;!?")
+
+		if parsed, err := url.ParseRequestURI(word); err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" {
+			urls = append(urls, word)
+		}
+	}
+
+	return urls, tags
+}
+
+// Save fetches the page at pageURL and persists it as a bookmark to read later with the given tags.
+// A page that cannot be fetched is still saved, with its URL as the title.
+func Save(ctx context.Context, store storage.Storer, pageURL string, tags storage.Tags) (*storage.Bookmark, error) {
+	bookmark := &storage.Bookmark{
+		URL:  pageURL,
+		Tags: storage.Tags{ReadItLater}.Merge(tags),
+	}
+
+	if err := bookmark.Fetch(ctx); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("url", pageURL).Msg("Saving bookmark without its content")
+	}
+
+	if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+		return nil, err
+	}
+
+	return bookmark, nil
+}
+
+// Unread lists the most recent bookmarks that were captured to be read later
+func Unread(ctx context.Context, store storage.Storer, limit int) []*storage.Bookmark {
+	bookmarks, _ := store.BookmarkList(ctx, &storage.BookmarkListOptions{
+		Tags:  storage.Tags{ReadItLater},
+		Limit: limit,
+	})
+
+	return *bookmarks
+}
+
+// Backlog lists the oldest bookmarks that were captured to be read later
+func Backlog(ctx context.Context, store storage.Storer, limit int) []*storage.Bookmark {
+	bookmarks, _ := store.BookmarkList(ctx, &storage.BookmarkListOptions{
+		Tags:  storage.Tags{ReadItLater},
+		Sort:  storage.Sort{{Field: "created"}},
+		Limit: limit,
+	})
+
+	return *bookmarks
+}
+
+// Archive marks a bookmark as read, it is no longer to be read later but kept for reference
+func Archive(ctx context.Context, store storage.Storer, bookmark *storage.Bookmark) error {
+	tags := storage.Tags{}
+	for _, tag := range bookmark.Tags {
+		if tag != ReadItLater {
+			tags = append(tags, tag)
+		}
+	}
+	bookmark.Tags = tags.Merge(storage.Tags{Archived})
+
+	return store.BookmarkPersist(ctx, bookmark)
+}
+
+// ArchiveSignature signs the ID of a bookmark with secret, so a link to archive it works without
+// logging in but only for that bookmark
+func ArchiveSignature(secret, ID string) string {
+	hash := hmac.New(sha256.New, []byte(secret))
+	hash.Write([]byte("archive:" + ID))
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
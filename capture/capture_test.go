@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestParse(t *testing.T) {
+	urls, tags := Parse("Read <https://example.com/a>, and https://example.org. #Go #web ftp://example.net #")
+
+	if !reflect.DeepEqual(urls, []string{"https://example.com/a", "https://example.org"}) {
+		t.Fatalf("Unexpected urls %v", urls)
+	}
+
+	if !reflect.DeepEqual(tags, storage.Tags{"go", "web"}) {
+		t.Fatalf("Unexpected tags %v", tags)
+	}
+}
+
+func TestSave(t *testing.T) {
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	bookmark, err := Save(ctx, store, "http://127.0.0.1:1/unreachable", storage.Tags{"go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bookmark.Title != bookmark.URL || !reflect.DeepEqual(bookmark.Tags, storage.Tags{ReadItLater, "go"}) {
+		t.Fatalf("Expected the bookmark to be saved without content, got %v", bookmark)
+	}
+
+	if unread := Unread(ctx, store, 10); len(unread) != 1 {
+		t.Fatalf("Expected 1 unread bookmark, got %d", len(unread))
+	}
+}
+
+func TestArchive(t *testing.T) {
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	older := &storage.Bookmark{URL: "https://example.com/a", Tags: storage.Tags{ReadItLater, "go"}, Created: time.Now().Add(-time.Hour)}
+	newer := &storage.Bookmark{URL: "https://example.com/b", Tags: storage.Tags{ReadItLater}}
+	store.BookmarkPersist(ctx, older)
+	store.BookmarkPersist(ctx, newer)
+
+	if backlog := Backlog(ctx, store, 1); len(backlog) != 1 || backlog[0].URL != older.URL {
+		t.Fatalf("Expected the oldest unread bookmark, got %v", backlog)
+	}
+
+	if err := Archive(ctx, store, older); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(older.Tags, storage.Tags{"go", Archived}) {
+		t.Fatalf("Expected the bookmark to be archived, got %v", older.Tags)
+	}
+
+	if ArchiveSignature("secret", older.ID) == ArchiveSignature("secret", newer.ID) || ArchiveSignature("secret", older.ID) == ArchiveSignature("other", older.ID) {
+		t.Fatal("Expected a different signature for every bookmark and secret")
+	}
+}
@@ -0,0 +1,247 @@
+// Package client talks to the rest api of a remote bookmarks instance, for the commands that manage
+// it from the shell
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// Client calls the rest api of an instance, logging in with the username and password on the first
+// call if they are set
+type Client struct {
+	baseURL  string
+	username string
+	password string
+	client   *http.Client
+	loggedIn bool
+
+	// pollInterval is how often jobs are checked while waiting for them
+	pollInterval time.Duration
+}
+
+// New creates a client for the instance at baseURL, like https://example.com/bookmarks
+func New(baseURL, username, password string) *Client {
+	jar, _ := cookiejar.New(nil)
+
+	return &Client{
+		baseURL:  strings.TrimSuffix(baseURL, "/"),
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 2 * time.Minute, Jar: jar},
+
+		pollInterval: time.Second,
+	}
+}
+
+// Error is returned when the rest api responds with an error
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (err *Error) Error() string {
+	return fmt.Sprintf("%s (%d %s)", err.Message, err.Status, err.Code)
+}
+
+// BookmarkList lists the bookmarks that match the search, tags and page of the options
+func (client *Client) BookmarkList(ctx context.Context, options *storage.BookmarkListOptions) ([]*storage.Bookmark, int, error) {
+	query := url.Values{}
+	if options.Search != "" {
+		query.Set("q", options.Search)
+	}
+	if len(options.Tags) != 0 {
+		query.Set("tags", strings.Join(options.Tags, ","))
+	}
+	if options.IncludeDeleted {
+		query.Set("include_deleted", "true")
+	}
+	if options.Limit != 0 {
+		query.Set("_limit", strconv.Itoa(options.Limit))
+	}
+	if options.Offset != 0 {
+		query.Set("_offset", strconv.Itoa(options.Offset))
+	}
+
+	bookmarks := []*storage.Bookmark{}
+
+	response, err := client.call(ctx, "GET", "/api/v1/bookmarks?"+query.Encode(), nil, &bookmarks)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	totalCount, _ := strconv.Atoi(response.Header.Get("X-Pagination-Total"))
+
+	return bookmarks, totalCount, nil
+}
+
+// BookmarkCreate creates a bookmark, the instance fetches its title and content
+func (client *Client) BookmarkCreate(ctx context.Context, bookmark *storage.Bookmark) error {
+	_, err := client.call(ctx, "POST", "/api/v1/bookmarks", bookmark, bookmark)
+
+	return err
+}
+
+// BookmarkDelete deletes the bookmark with ID
+func (client *Client) BookmarkDelete(ctx context.Context, ID string) error {
+	_, err := client.call(ctx, "DELETE", "/api/v1/bookmarks/"+url.PathEscape(ID), nil, nil)
+
+	return err
+}
+
+// FeedList lists the feeds that match the search, tags and page of the options
+func (client *Client) FeedList(ctx context.Context, options *storage.FeedListOptions) ([]*storage.Feed, int, error) {
+	query := url.Values{}
+	if options.Search != "" {
+		query.Set("q", options.Search)
+	}
+	if len(options.Tags) != 0 {
+		query.Set("tags", strings.Join(options.Tags, ","))
+	}
+	if options.Limit != 0 {
+		query.Set("_limit", strconv.Itoa(options.Limit))
+	}
+	if options.Offset != 0 {
+		query.Set("_offset", strconv.Itoa(options.Offset))
+	}
+
+	feeds := []*storage.Feed{}
+
+	response, err := client.call(ctx, "GET", "/api/v1/feeds?"+query.Encode(), nil, &feeds)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	totalCount, _ := strconv.Atoi(response.Header.Get("X-Pagination-Total"))
+
+	return feeds, totalCount, nil
+}
+
+// FeedCreate subscribes to a feed, the instance fetches its title and items
+func (client *Client) FeedCreate(ctx context.Context, feed *storage.Feed) error {
+	_, err := client.call(ctx, "POST", "/api/v1/feeds", feed, feed)
+
+	return err
+}
+
+// FeedRefresh refreshes a feed and waits for the job that refreshes it to finish, the items of the
+// feed are updated afterwards
+func (client *Client) FeedRefresh(ctx context.Context, feed *storage.Feed) error {
+	job := &queue.Job{}
+	if _, err := client.call(ctx, "POST", "/api/v1/feeds/"+url.PathEscape(feed.ID)+"/refresh", nil, job); err != nil {
+		return err
+	}
+
+	for job.State == queue.StatePending || job.State == queue.StateRunning {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(client.pollInterval):
+		}
+
+		if _, err := client.call(ctx, "GET", "/api/v1/jobs/"+url.PathEscape(job.ID), nil, job); err != nil {
+			return err
+		}
+	}
+
+	// A failed job is retried in the background, but the refresh did not succeed now
+	if job.State != queue.StateSucceeded {
+		return fmt.Errorf("Refresh %s: %s", job.State, job.Error)
+	}
+
+	_, err := client.call(ctx, "GET", "/api/v1/feeds/"+url.PathEscape(feed.ID), nil, feed)
+
+	return err
+}
+
+// login gets the token cookie that authenticates the following calls
+func (client *Client) login(ctx context.Context) error {
+	form := url.Values{"username": {client.username}, "password": {client.password}}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", client.baseURL+"/api/v1/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := client.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return responseError(response)
+	}
+
+	client.loggedIn = true
+
+	return nil
+}
+
+func (client *Client) call(ctx context.Context, method, path string, body, result interface{}) (*http.Response, error) {
+	if client.username != "" && !client.loggedIn {
+		if err := client.login(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, client.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+
+	response, err := client.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		return nil, responseError(response)
+	}
+
+	if result == nil || response.StatusCode == 204 {
+		return response, nil
+	}
+
+	return response, json.NewDecoder(response.Body).Decode(result)
+}
+
+// responseError reads the error envelope of the rest api, responses of proxies in front of it get
+// the status as message
+func responseError(response *http.Response) error {
+	envelope := struct{ Error Error }{}
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil || envelope.Error.Message == "" {
+		return &Error{Status: response.StatusCode, Code: "unknown", Message: http.StatusText(response.StatusCode)}
+	}
+
+	envelope.Error.Status = response.StatusCode
+
+	return &envelope.Error
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bookmarks/api/v1/token" {
+			if r.PostFormValue("username") != "alice" || r.PostFormValue("password") != "secret" {
+				t.Fatalf("Unexpected login %s", r.PostForm.Encode())
+			}
+			http.SetCookie(w, &http.Cookie{Name: "token", Value: "t0k3n", Path: "/bookmarks/"})
+			w.WriteHeader(204)
+			return
+		}
+
+		if cookie, err := r.Cookie("token"); err != nil || cookie.Value != "t0k3n" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"error":{"code":"unauthorized","message":"Unauthorized"}}`))
+			return
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /bookmarks/api/v1/bookmarks":
+			if r.URL.Query().Get("q") != "go" || r.URL.Query().Get("tags") != "a,b" || r.URL.Query().Get("_limit") != "10" {
+				t.Fatalf("Unexpected query %s", r.URL.RawQuery)
+			}
+			w.Header().Set("X-Pagination-Total", "12")
+			w.Write([]byte(`[{"ID":"1","URL":"https://example.com/a","Title":"A"}]`))
+		case "POST /bookmarks/api/v1/bookmarks":
+			w.Write([]byte(`{"ID":"2","URL":"https://example.com/b","Title":"B"}`))
+		case "DELETE /bookmarks/api/v1/bookmarks/2":
+			w.WriteHeader(204)
+		default:
+			w.WriteHeader(404)
+			w.Write([]byte(`{"error":{"code":"not_found","message":"Bookmark Not Found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	client := New(server.URL+"/bookmarks/", "alice", "secret")
+
+	bookmarks, totalCount, err := client.BookmarkList(ctx, &storage.BookmarkListOptions{Search: "go", Tags: storage.Tags{"a", "b"}, Limit: 10})
+	if err != nil || totalCount != 12 || len(bookmarks) != 1 || bookmarks[0].Title != "A" {
+		t.Fatalf("Expected a page of bookmarks, got %d %v", totalCount, err)
+	}
+
+	bookmark := &storage.Bookmark{URL: "https://example.com/b"}
+	if err := client.BookmarkCreate(ctx, bookmark); err != nil || bookmark.ID != "2" || bookmark.Title != "B" {
+		t.Fatalf("Expected the created bookmark, got %+v %v", bookmark, err)
+	}
+
+	if err := client.BookmarkDelete(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.BookmarkDelete(ctx, "3")
+	if apiError, ok := err.(*Error); !ok || apiError.Status != 404 || apiError.Message != "Bookmark Not Found" {
+		t.Fatalf("Expected the error of the api, got %v", err)
+	}
+
+	if _, _, err := New(server.URL+"/bookmarks", "", "").BookmarkList(ctx, &storage.BookmarkListOptions{}); err == nil {
+		t.Fatal("Expected an error without logging in")
+	}
+}
+
+func TestFeedRefresh(t *testing.T) {
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /api/v1/feeds/1/refresh", "POST /api/v1/feeds/2/refresh":
+			w.WriteHeader(202)
+			w.Write([]byte(`{"ID":"j` + strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/feeds/"), "/refresh") + `","State":"pending"}`))
+		case "GET /api/v1/jobs/j1":
+			if polls++; polls < 2 {
+				w.Write([]byte(`{"ID":"j1","State":"running"}`))
+			} else {
+				w.Write([]byte(`{"ID":"j1","State":"succeeded"}`))
+			}
+		case "GET /api/v1/jobs/j2":
+			w.Write([]byte(`{"ID":"j2","State":"failed","Error":"Error fetching remote content"}`))
+		case "GET /api/v1/feeds/1":
+			w.Write([]byte(`{"ID":"1","Title":"Feed","Items":[{"ID":"a"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	client := New(server.URL, "", "")
+	client.pollInterval = time.Millisecond
+
+	feed := &storage.Feed{ID: "1"}
+	if err := client.FeedRefresh(context.Background(), feed); err != nil || polls != 2 || feed.Title != "Feed" || len(feed.Items) != 1 {
+		t.Fatalf("Expected the refreshed feed after the job succeeded, got %d polls %v", polls, err)
+	}
+
+	if err := client.FeedRefresh(context.Background(), &storage.Feed{ID: "2"}); err == nil || !strings.Contains(err.Error(), "Error fetching remote content") {
+		t.Fatalf("Expected the error of the failed job, got %v", err)
+	}
+}
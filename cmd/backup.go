@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <file>",
+	Short: "Write a consistent snapshot of the database to a file, also while the server is running",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		store, err := openStore(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		return store.Backup(ctx, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(backupCmd)
+}
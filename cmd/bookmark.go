@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var bookmarkCmd = &cobra.Command{
+	Use:   "bookmark",
+	Short: "Add, list, search and delete bookmarks in the database or on a remote instance",
+}
+
+var bookmarkAddCmd = &cobra.Command{
+	Use:   "add <url>...",
+	Short: "Add bookmarks, fetching their title and content",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		manager, close, err := openManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer close()
+
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+
+		for _, url := range args {
+			bookmark := &storage.Bookmark{URL: url, Tags: storage.Tags(tags)}
+			if err := manager.BookmarkCreate(ctx, bookmark); err != nil {
+				return fmt.Errorf("Error adding %s: %w", url, err)
+			}
+
+			fmt.Printf("%s\t%s\n", bookmark.ID, bookmark.Title)
+		}
+
+		return nil
+	},
+}
+
+var bookmarkListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the most recent bookmarks",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listBookmarks(cmd, "")
+	},
+}
+
+var bookmarkSearchCmd = &cobra.Command{
+	Use:   "search <query>",
+	Short: "Search bookmarks by their title, url, content and tags",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return listBookmarks(cmd, strings.Join(args, " "))
+	},
+}
+
+var bookmarkDeleteCmd = &cobra.Command{
+	Use:   "delete <id>...",
+	Short: "Delete bookmarks, they can be restored until the retention period is over",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		manager, close, err := openManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer close()
+
+		for _, ID := range args {
+			if err := manager.BookmarkDelete(ctx, ID); err != nil {
+				return fmt.Errorf("Error deleting %s: %w", ID, err)
+			}
+
+			fmt.Printf("Deleted %s\n", ID)
+		}
+
+		return nil
+	},
+}
+
+func listBookmarks(cmd *cobra.Command, search string) error {
+	ctx := log.Logger.WithContext(cmd.Context())
+
+	manager, close, err := openManager(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	defer close()
+
+	tags, _ := cmd.Flags().GetStringSlice("tag")
+	limit, _ := cmd.Flags().GetInt("limit")
+	offset, _ := cmd.Flags().GetInt("offset")
+
+	bookmarks, totalCount, err := manager.BookmarkList(ctx, &storage.BookmarkListOptions{
+		Search: search,
+		Tags:   storage.Tags(tags),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return err
+	}
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(bookmarks)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tCREATED\tTITLE\tURL\tTAGS")
+	for _, bookmark := range bookmarks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", bookmark.ID, bookmark.Created.Format("2006-01-02"), bookmark.Title, bookmark.URL, strings.Join(bookmark.Tags, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(bookmarks) < totalCount {
+		fmt.Fprintf(os.Stderr, "Showing %d of %d bookmarks\n", len(bookmarks), totalCount)
+	}
+
+	return nil
+}
+
+func init() {
+	addRemoteFlags(bookmarkCmd)
+
+	bookmarkAddCmd.Flags().StringSliceP("tag", "t", []string{}, "Tag the bookmarks with these tags")
+
+	for _, cmd := range []*cobra.Command{bookmarkListCmd, bookmarkSearchCmd} {
+		cmd.Flags().StringSliceP("tag", "t", []string{}, "Only list bookmarks with all of these tags")
+		cmd.Flags().Int("limit", 50, "Maximum number of bookmarks to list")
+		cmd.Flags().Int("offset", 0, "Number of bookmarks to skip")
+		cmd.Flags().Bool("json", false, "Print the bookmarks as json instead of a table")
+	}
+
+	bookmarkCmd.AddCommand(bookmarkAddCmd, bookmarkListCmd, bookmarkSearchCmd, bookmarkDeleteCmd)
+	rootCmd.AddCommand(bookmarkCmd)
+}
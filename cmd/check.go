@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the integrity of the database, its full text search indexes, tags and the links of bookmarks, and clean up",
+	Long: `Check the integrity of the database, its full text search indexes, tags and the links of bookmarks,
+and clean up tags and purge the records deleted longer ago than the retention in one pass.
+
+Problems are reported on stdout and a summary on stderr, and the exit code is non zero if the database
+has problems, so it can run from cron.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		store, err := openStore(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		repair, _ := cmd.Flags().GetBool("repair")
+		links, _ := cmd.Flags().GetBool("links")
+		linkWorkers, _ := cmd.Flags().GetInt("link-workers")
+		cleanup, _ := cmd.Flags().GetBool("cleanup")
+
+		result, err := store.Check(ctx, repair)
+		if err != nil {
+			return err
+		}
+
+		// Cleaning up writes to the database, which is left alone once it is corrupt
+		cleaned, purged := int64(0), int64(0)
+		if cleanup && len(result.Integrity) == 0 {
+			if purged, err = store.Purge(ctx, time.Now().Add(-cfg.Retention)); err != nil {
+				return err
+			}
+
+			if cleaned, err = store.Cleanup(ctx); err != nil {
+				return err
+			}
+		}
+
+		checked, dead := 0, []*storage.DeadLink{}
+		if links {
+			if checked, dead, err = store.CheckLinks(ctx, linkWorkers); err != nil {
+				return err
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tPROBLEM")
+		for _, problem := range result.Integrity {
+			fmt.Fprintf(w, "integrity\t%s\n", problem)
+		}
+		for _, table := range result.FTS {
+			fmt.Fprintf(w, "fts\t%s is out of sync\n", table)
+		}
+		for name, count := range result.Orphans {
+			fmt.Fprintf(w, "orphans\t%d %s\n", count, name)
+		}
+		for _, link := range dead {
+			if link.Error != "" {
+				fmt.Fprintf(w, "link\t%s %s\n", link.URL, link.Error)
+			} else {
+				fmt.Fprintf(w, "link\t%s answered %d\n", link.URL, link.Status)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if result.Repaired {
+			fmt.Println("Repaired the full text search indexes and orphaned references")
+		}
+		if cleanup && len(result.Integrity) == 0 {
+			fmt.Fprintf(os.Stderr, "Purged %d records deleted longer than %s ago and cleaned up %d tags\n", purged, cfg.Retention, cleaned)
+		}
+		if links {
+			fmt.Fprintf(os.Stderr, "Checked %d links of bookmarks, %d are dead\n", checked, len(dead))
+		}
+
+		if len(result.Integrity) != 0 || (!result.Ok() && !result.Repaired) {
+			return errors.New("The database has problems")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	checkCmd.Flags().Bool("repair", false, "Rebuild full text search indexes that are out of sync and fix orphaned references")
+	checkCmd.Flags().Bool("links", true, "Request the url of every bookmark to find dead links")
+	checkCmd.Flags().Int("link-workers", 4, "The number of links to request at a time")
+	checkCmd.Flags().Bool("cleanup", true, "Clean up tags and purge the records deleted longer ago than the retention")
+
+	rootCmd.AddCommand(checkCmd)
+}
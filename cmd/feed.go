@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var feedCmd = &cobra.Command{
+	Use:   "feed",
+	Short: "Subscribe to, list and refresh feeds in the database or on a remote instance",
+}
+
+var feedAddCmd = &cobra.Command{
+	Use:   "add <url>...",
+	Short: "Subscribe to feeds, fetching their title and items",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		manager, close, err := openManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer close()
+
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		interval, _ := cmd.Flags().GetDuration("refresh-interval")
+		fullContent, _ := cmd.Flags().GetBool("full-content")
+
+		for _, url := range args {
+			feed := &storage.Feed{URL: url, Tags: storage.Tags(tags), RefreshInterval: storage.Duration(interval), FetchFullContent: fullContent}
+			if err := manager.FeedCreate(ctx, feed); err != nil {
+				return fmt.Errorf("Error adding %s: %w", url, err)
+			}
+
+			fmt.Printf("%s\t%s\t%d items\n", feed.ID, feed.Title, len(feed.Items))
+		}
+
+		return nil
+	},
+}
+
+var feedListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the feeds that were most recently authored",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		manager, close, err := openManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer close()
+
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		limit, _ := cmd.Flags().GetInt("limit")
+		offset, _ := cmd.Flags().GetInt("offset")
+
+		feeds, totalCount, err := manager.FeedList(ctx, &storage.FeedListOptions{
+			Tags:   storage.Tags(tags),
+			Limit:  limit,
+			Offset: offset,
+		})
+		if err != nil {
+			return err
+		}
+
+		if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(feeds)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tREFRESHED\tITEMS\tTITLE\tURL\tTAGS")
+		for _, feed := range feeds {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", feed.ID, feed.Refreshed.Format("2006-01-02 15:04"), len(feed.Items), feed.Title, feed.URL, strings.Join(feed.Tags, ","))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		if len(feeds) < totalCount {
+			fmt.Fprintf(os.Stderr, "Showing %d of %d feeds\n", len(feeds), totalCount)
+		}
+
+		return nil
+	},
+}
+
+var feedRefreshCmd = &cobra.Command{
+	Use:   "refresh [<id>...]",
+	Short: "Refresh feeds and report every feed, exits with 1 if any of them failed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		all, _ := cmd.Flags().GetBool("all")
+		if all == (len(args) != 0) {
+			return errors.New("Pass the ids of the feeds to refresh or --all")
+		}
+
+		manager, close, err := openManager(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		defer close()
+
+		feeds := []*storage.Feed{}
+		if all {
+			for offset := 0; ; offset += 100 {
+				page, _, err := manager.FeedList(ctx, &storage.FeedListOptions{Limit: 100, Offset: offset})
+				if err != nil {
+					return err
+				}
+
+				feeds = append(feeds, page...)
+
+				if len(page) < 100 {
+					break
+				}
+			}
+		} else {
+			for _, ID := range args {
+				feeds = append(feeds, &storage.Feed{ID: ID})
+			}
+		}
+
+		failed := 0
+		for i, feed := range feeds {
+			prefix := fmt.Sprintf("[%d/%d] %s", i+1, len(feeds), feed.ID)
+
+			if err := manager.FeedRefresh(ctx, feed); err != nil {
+				failed++
+				fmt.Printf("%s\tfailed\t%s\n", prefix, err)
+				continue
+			}
+
+			fmt.Printf("%s\tok\t%s\t%d items\n", prefix, feed.Title, len(feed.Items))
+		}
+
+		if failed != 0 {
+			return fmt.Errorf("%d of %d feeds failed to refresh", failed, len(feeds))
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	addRemoteFlags(feedCmd)
+
+	feedAddCmd.Flags().StringSliceP("tag", "t", []string{}, "Tag the feeds with these tags")
+	feedAddCmd.Flags().Duration("refresh-interval", 0, "How often the feeds are refreshed, as often as the refresh window allows if 0")
+	feedAddCmd.Flags().Bool("full-content", false, "Fetch the full content of the pages the items link to, for feeds that only have a summary")
+
+	feedListCmd.Flags().StringSliceP("tag", "t", []string{}, "Only list feeds with all of these tags")
+	feedListCmd.Flags().Int("limit", 50, "Maximum number of feeds to list")
+	feedListCmd.Flags().Int("offset", 0, "Number of feeds to skip")
+	feedListCmd.Flags().Bool("json", false, "Print the feeds as json instead of a table")
+
+	feedRefreshCmd.Flags().Bool("all", false, "Refresh all feeds")
+
+	feedCmd.AddCommand(feedAddCmd, feedListCmd, feedRefreshCmd)
+	rootCmd.AddCommand(feedCmd)
+}
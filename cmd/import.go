@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nrocco/bookmarks/importer"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import bookmarks, feeds and thoughts from a file into the database, or - for stdin",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		format, _ := cmd.Flags().GetString("format")
+		strategy, _ := cmd.Flags().GetString("strategy")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		fetch, _ := cmd.Flags().GetBool("fetch")
+		workers, _ := cmd.Flags().GetInt("fetch-workers")
+
+		if !storage.ImportStrategy(strategy).Valid() {
+			return storage.ErrInvalidImportStrategy
+		}
+
+		var reader io.Reader = os.Stdin
+		if args[0] != "-" {
+			file, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			reader = file
+		}
+
+		document, err := importer.Parse(format, reader)
+		if err != nil {
+			return err
+		}
+
+		store, err := openStore(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if !dryRun {
+			result, err := store.Import(ctx, document, storage.ImportStrategy(strategy))
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Created %d, updated %d and skipped %d records\n", result.Created, result.Updated, result.Skipped)
+
+			if fetch {
+				return fetchImported(ctx, store, document, workers)
+			}
+
+			return nil
+		}
+
+		result, err := store.ImportDryRun(ctx, document, storage.ImportStrategy(strategy))
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ACTION\tKIND\tKEY")
+		for _, record := range result.Records {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", record.Action, record.Kind, record.Key)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Dry run: would create %d, update %d and skip %d records, nothing was written\n", result.Created, result.Updated, result.Skipped)
+
+		return nil
+	},
+}
+
+// fetchImported fetches the content of the imported bookmarks that have none, with workers at a
+// time, and reports the progress on stderr
+func fetchImported(ctx context.Context, store *storage.Store, document *storage.Document, workers int) error {
+	bookmarks := []*storage.Bookmark{}
+	for _, bookmark := range document.Bookmarks {
+		if bookmark.ID != "" && bookmark.Content == "" {
+			bookmarks = append(bookmarks, bookmark)
+		}
+	}
+
+	// Pages that cannot be fetched are common in old bookmarks, they only show up in the progress
+	_, err := store.BookmarkFetchAll(ctx, bookmarks, workers, func(done, failed, total int) {
+		if done%100 == 0 || done == total {
+			fmt.Fprintf(os.Stderr, "Fetched %d of %d bookmarks, %d failed\n", done, total, failed)
+		}
+	})
+
+	return err
+}
+
+func init() {
+	importCmd.Flags().String("format", "json", "Format of the file: "+strings.Join(importer.Formats(), ", "))
+	importCmd.Flags().String("strategy", string(storage.ImportSkip), "What happens to records that already exist: skip, overwrite or merge")
+	importCmd.Flags().Bool("dry-run", false, "Only report what would be created, skipped or merged without writing anything")
+	importCmd.Flags().Bool("fetch", false, "Fetch the content of the imported bookmarks that have none")
+	importCmd.Flags().Int("fetch-workers", 8, "Number of bookmarks to fetch at the same time")
+
+	rootCmd.AddCommand(importCmd)
+}
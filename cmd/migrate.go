@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply or revert database migrations and show their status",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		// Opening the store applies all pending migrations
+		store, err := openStore(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		if steps, _ := cmd.Flags().GetInt("down"); steps > 0 {
+			if err := store.MigrateDown(ctx, steps); err != nil {
+				return err
+			}
+		}
+
+		migrations, err := store.Migrations(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, migration := range migrations {
+			applied := "pending"
+			if !migration.Applied.IsZero() {
+				applied = migration.Applied.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, applied)
+		}
+
+		return w.Flush()
+	},
+}
+
+func init() {
+	migrateCmd.Flags().Int("down", 0, "Revert this many of the most recently applied migrations")
+
+	rootCmd.AddCommand(migrateCmd)
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nrocco/bookmarks/readlater"
+	"github.com/spf13/cobra"
+)
+
+var pocketLoginCmd = &cobra.Command{
+	Use:   "pocket-login",
+	Short: "Connect a Pocket account and print the access token to push bookmarks to it with",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		consumerKey, _ := cmd.Flags().GetString("consumer-key")
+		if consumerKey == "" {
+			consumerKey = cfg.PocketConsumerKey
+		}
+		if consumerKey == "" {
+			return errors.New("Missing the consumer key of a Pocket app, create one at https://getpocket.com/developer/apps/new")
+		}
+
+		pocket := readlater.NewPocket(consumerKey, "")
+
+		code, authorizeURL, err := pocket.Authorize(cmd.Context(), "https://getpocket.com/")
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Grant access at %s and press enter\n", authorizeURL)
+		bufio.NewReader(os.Stdin).ReadString('\n')
+
+		token, err := pocket.Token(cmd.Context(), code)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Start the server with --pocket-consumer-key %s --pocket-access-token %s\n", consumerKey, token)
+
+		return nil
+	},
+}
+
+func init() {
+	pocketLoginCmd.Flags().String("consumer-key", "", "Consumer key of the Pocket app (defaults to pocket-consumer-key of the config file)")
+
+	rootCmd.AddCommand(pocketLoginCmd)
+}
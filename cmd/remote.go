@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nrocco/bookmarks/client"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// manager manages the bookmarks and feeds in the database, or those of a remote instance with --remote
+type manager interface {
+	BookmarkList(ctx context.Context, options *storage.BookmarkListOptions) ([]*storage.Bookmark, int, error)
+	BookmarkCreate(ctx context.Context, bookmark *storage.Bookmark) error
+	BookmarkDelete(ctx context.Context, ID string) error
+
+	FeedList(ctx context.Context, options *storage.FeedListOptions) ([]*storage.Feed, int, error)
+	FeedCreate(ctx context.Context, feed *storage.Feed) error
+	FeedRefresh(ctx context.Context, feed *storage.Feed) error
+}
+
+// localManager manages the bookmarks and feeds in the database
+type localManager struct {
+	store *storage.Store
+}
+
+func (local *localManager) BookmarkList(ctx context.Context, options *storage.BookmarkListOptions) ([]*storage.Bookmark, int, error) {
+	bookmarks, totalCount := local.store.BookmarkList(ctx, options)
+
+	return *bookmarks, totalCount, nil
+}
+
+func (local *localManager) BookmarkCreate(ctx context.Context, bookmark *storage.Bookmark) error {
+	if err := bookmark.Fetch(ctx); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("url", bookmark.URL).Msg("Saving bookmark without its content")
+	}
+
+	return local.store.BookmarkPersist(ctx, bookmark)
+}
+
+func (local *localManager) BookmarkDelete(ctx context.Context, ID string) error {
+	bookmark := &storage.Bookmark{ID: ID}
+	if err := local.store.BookmarkGet(ctx, bookmark); err != nil {
+		return fmt.Errorf("Bookmark %s not found", ID)
+	}
+
+	return local.store.BookmarkDelete(ctx, bookmark)
+}
+
+func (local *localManager) FeedList(ctx context.Context, options *storage.FeedListOptions) ([]*storage.Feed, int, error) {
+	feeds, totalCount := local.store.FeedList(ctx, options)
+
+	return *feeds, totalCount, nil
+}
+
+func (local *localManager) FeedCreate(ctx context.Context, feed *storage.Feed) error {
+	if err := local.store.FeedPersist(ctx, feed); err != nil {
+		return err
+	}
+
+	return local.store.FeedRefresh(ctx, feed)
+}
+
+func (local *localManager) FeedRefresh(ctx context.Context, feed *storage.Feed) error {
+	if err := local.store.FeedGet(ctx, feed); err != nil {
+		return fmt.Errorf("Feed %s not found", feed.ID)
+	}
+
+	return local.store.FeedRefresh(ctx, feed)
+}
+
+// openManager connects to the remote instance if --remote is set and opens the database
+// otherwise, the returned function closes the database again
+func openManager(ctx context.Context, cmd *cobra.Command) (manager, func(), error) {
+	if remote := flagOr(cmd, "remote", cfg.RemoteURL); remote != "" {
+		return client.New(remote, flagOr(cmd, "remote-username", cfg.RemoteUsername), flagOr(cmd, "remote-password", cfg.RemotePassword)), func() {}, nil
+	}
+
+	store, err := openStore(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &localManager{store}, func() { store.Close() }, nil
+}
+
+// addRemoteFlags adds the flags that point cmd and its sub commands at a remote instance
+func addRemoteFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("remote", "", "Address of a remote instance to manage instead of the database, like https://example.com/bookmarks (defaults to remote of the config file)")
+	cmd.PersistentFlags().String("remote-username", "", "Username of the remote instance")
+	cmd.PersistentFlags().String("remote-password", "", "Password of the remote instance")
+}
+
+// flagOr gets a string flag of cmd, or the value of the config file and environment if the flag is
+// not passed
+func flagOr(cmd *cobra.Command, name, fallback string) string {
+	if value, _ := cmd.Flags().GetString(name); value != "" {
+		return value
+	}
+
+	return fallback
+}
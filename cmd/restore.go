@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Replace all data in the database with the data in a backup",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		store, err := openStore(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		return store.Restore(ctx, args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
@@ -3,10 +3,23 @@ package cmd
 import (
 	"context"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
+	"github.com/nrocco/bookmarks/activitypub"
 	"github.com/nrocco/bookmarks/api"
+	"github.com/nrocco/bookmarks/config"
+	"github.com/nrocco/bookmarks/mailer"
+	"github.com/nrocco/bookmarks/matrix"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/readlater"
+	"github.com/nrocco/bookmarks/readwise"
 	"github.com/nrocco/bookmarks/scheduler"
 	"github.com/nrocco/bookmarks/storage"
+	"github.com/nrocco/bookmarks/systemd"
+	"github.com/nrocco/bookmarks/telegram"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -19,31 +32,220 @@ var serverCmd = &cobra.Command{
 		logger := log.With().Int("pid", os.Getpid()).Logger()
 
 		logger.Info().
-			Bool("debug", viper.GetBool("debug")).
-			Int("interval", viper.GetInt("interval")).
-			Str("listen", viper.GetString("listen")).
-			Str("storage", viper.GetString("storage")).
+			Bool("debug", cfg.Debug).
+			Str("listen", cfg.Listen).
+			Str("storage", storage.Redact(cfg.Storage)).
 			Msg("Starting bookmarks")
 
+		// Setup tracing
+		if endpoint := cfg.OTLPEndpoint; endpoint != "" {
+			shutdown, err := setupTracing(context.Background(), endpoint)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Could not setup tracing")
+			}
+			defer shutdown(context.Background())
+			logger.Info().Str("endpoint", endpoint).Msg("Tracing enabled")
+		}
+
 		// Setup the database
-		store, err := storage.New(context.Background(), viper.GetString("storage"))
+		store, err := storage.NewWithKey(logger.WithContext(context.Background()), cfg.Storage, cfg.DatabaseKey, cfg.Pragmas)
 		if err != nil {
 			logger.Fatal().Err(err).Msg("Could not open the database")
 		}
-		logger.Info().Str("storage", viper.GetString("storage")).Msg("Store ready")
+		store.SetCache(cfg.CacheSize, cfg.CacheTTL)
+		logger.Info().Str("storage", storage.Redact(cfg.Storage)).Msg("Store ready")
+
+		defer func() {
+			if err := store.Close(); err != nil {
+				logger.Warn().Err(err).Msg("Error closing the database")
+			}
+			logger.Info().Msg("Closed the database")
+		}()
+
+		// Setup the background job queue
+		jobs := queue.New(cfg.Workers)
+		refresher, err := scheduler.NewRefresher(jobs, cfg.RefreshBatchSize, cfg.RefreshWindow, cfg.RefreshMaxErrors)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Invalid refresh settings")
+		}
+		scheduler.RegisterJobs(jobs, store, cfg.Retention, refresher)
+
+		for kind, size := range cfg.JobWorkers {
+			if err := jobs.SetWorkers(kind, size); err != nil {
+				logger.Fatal().Err(err).Str("kind", kind).Msg("Could not set the number of workers")
+			}
+		}
+
+		for kind, timeout := range cfg.JobTimeouts {
+			if err := jobs.SetTimeout(kind, timeout); err != nil {
+				logger.Fatal().Err(err).Str("kind", kind).Msg("Could not set the job timeout")
+			}
+		}
+
+		if err := scheduler.RegisterSchedules(jobs, cfg.Schedules); err != nil {
+			logger.Fatal().Err(err).Msg("Could not schedule jobs")
+		}
+
+		var matrixBot *matrix.Bot
+		if homeserver := cfg.MatrixHomeserver; homeserver != "" {
+			matrixBot = matrix.New(homeserver, cfg.MatrixToken, cfg.MatrixRoom, store)
+			if err := scheduler.RegisterNotifier(jobs, store, matrixBot, cfg.MatrixEvents, cfg.MatrixDigest); err != nil {
+				logger.Fatal().Err(err).Msg("Could not setup Matrix notifications")
+			}
+		}
+
+		if token := cfg.ReadwiseToken; token != "" {
+			if err := scheduler.RegisterReadwise(jobs, store, readwise.New(token), cfg.ReadwiseSchedule); err != nil {
+				logger.Fatal().Err(err).Msg("Could not setup the Readwise export")
+			}
+		}
+
+		var emailer *mailer.Mailer
+		if addr := cfg.SMTPAddr; addr != "" {
+			emailer = mailer.New(addr, cfg.SMTPUsername, cfg.SMTPPassword, cfg.EmailFrom, cfg.EmailTo)
+			digest := scheduler.EmailDigest{
+				Size:      cfg.EmailDigestSize,
+				PublicURL: cfg.PublicURL,
+				Secret:    cfg.EmailSecret,
+			}
+			if err := scheduler.RegisterEmailDigest(jobs, store, emailer, digest, cfg.EmailDigest); err != nil {
+				logger.Fatal().Err(err).Msg("Could not schedule the email digest")
+			}
+		}
+
+		if path := cfg.Periodical; path != "" {
+			periodical := scheduler.Periodical{Path: path, Size: cfg.PeriodicalSize}
+			if emailer != nil && cfg.PeriodicalEmail {
+				periodical.Mailer = emailer
+			}
+			if err := scheduler.RegisterPeriodical(jobs, store, periodical, cfg.PeriodicalSchedule); err != nil {
+				logger.Fatal().Err(err).Msg("Could not schedule the periodical")
+			}
+		}
+
+		var actor *activitypub.Actor
+		if publicURL := cfg.PublicURL; cfg.ActivityPub && publicURL != "" {
+			key, err := activitypub.LoadKey(cfg.ActivityPubKey)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Could not load the ActivityPub key")
+			}
+			actor = activitypub.New(cfg.ActivityPubUser, strings.TrimSuffix(publicURL, "/")+"/api/activitypub", key)
+			if err := scheduler.RegisterActivityPub(jobs, store, actor, cfg.ActivityPubSchedule); err != nil {
+				logger.Fatal().Err(err).Msg("Could not schedule ActivityPub deliveries")
+			}
+			logger.Info().Str("account", actor.Account()).Msg("ActivityPub enabled")
+		}
+
+		prometheus.MustRegister(jobs.Collector())
+
+		jobs.SetPersistence(store)
+		jobs.Start()
+
+		// Running jobs get as long to finish as the in-flight requests, pending jobs are saved
+		// before the database is closed
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+
+			if err := jobs.Stop(ctx); err != nil {
+				logger.Warn().Err(err).Msg("Error stopping the job queue")
+			}
+		}()
+
+		inboundTokens := map[string]api.InboundMapping{}
+		for token, spec := range cfg.InboundTokens {
+			mapping, err := api.ParseInboundMapping(spec)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("Invalid inbound webhook token")
+			}
+			inboundTokens[token] = mapping
+		}
+
+		readLater := map[string]readlater.Service{}
+		if key, token := cfg.PocketConsumerKey, cfg.PocketAccessToken; key != "" && token != "" {
+			readLater["pocket"] = readlater.NewPocket(key, token)
+		}
+		if username := cfg.InstapaperUsername; username != "" {
+			readLater["instapaper"] = readlater.NewInstapaper(username, cfg.InstapaperPassword)
+		}
+
+		healthChecks := map[string]api.HealthCheck{
+			"scheduler": jobs.Check,
+		}
+
+		readinessChecks := map[string]api.HealthCheck{
+			"workers": jobs.Ready,
+		}
 
 		// Setup the http server
-		api := api.New(logger, store, viper.GetString("username"), viper.GetString("password"))
-		logger.Info().Str("address", "http://"+viper.GetString("listen")).Msg("API ready")
+		api := api.New(logger, store, jobs, api.Options{
+			Username:        cfg.Username,
+			Password:        cfg.Password,
+			Unauthenticated: cfg.AuthMode == config.AuthNone,
+			Timeouts: api.Timeouts{
+				Read:  cfg.ReadTimeout,
+				Write: cfg.WriteTimeout,
+				Fetch: cfg.FetchTimeout,
+			},
+			MaxBodySize:     cfg.MaxBodySize,
+			MaxImportSize:   cfg.MaxImportSize,
+			TLSCert:         cfg.TLSCert,
+			TLSKey:          cfg.TLSKey,
+			AutocertHosts:   cfg.AutocertHosts,
+			AutocertCache:   cfg.AutocertCache,
+			BasePath:        cfg.BasePath,
+			AssetsDir:       cfg.AssetsDir,
+			SocketMode:      os.FileMode(cfg.SocketMode),
+			HealthChecks:    healthChecks,
+			ReadinessChecks: readinessChecks,
+			Refresher:       refresher,
+			Logging:         logOutput,
 
-		if viper.GetInt("interval") != 0 {
-			scheduler.New(store, viper.GetInt("interval"))
-		} else {
-			logger.Info().Msg("Scheduler is disabled")
+			SlashSigningSecret: cfg.SlashSigningSecret,
+			SlashToken:         cfg.SlashToken,
+			ShaarliSecret:      cfg.ShaarliSecret,
+			LinkdingToken:      cfg.LinkdingToken,
+			InboundTokens:      inboundTokens,
+			ReadLater:          readLater,
+			ArchiveSecret:      cfg.EmailSecret,
+			PeriodicalPath:     cfg.Periodical,
+			ActivityPub:        actor,
+		})
+
+		// Sockets passed by systemd take precedence over the listen address
+		listeners, err := systemd.Listeners()
+		if err != nil {
+			return err
+		}
+
+		address := "http://" + cfg.Listen + cfg.BasePath
+		if len(listeners) != 0 {
+			address = "systemd:" + listeners[0].Addr().String()
+		} else if strings.HasPrefix(cfg.Listen, "unix:") {
+			address = cfg.Listen
+		} else if len(cfg.AutocertHosts) != 0 || cfg.TLSCert != "" {
+			address = "https://" + cfg.Listen + cfg.BasePath
+		}
+		logger.Info().Str("address", address).Msg("API ready")
+
+		// Run the http server until we receive a signal to stop
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		if token := cfg.TelegramToken; token != "" {
+			go telegram.New(token, cfg.TelegramChats, store).Run(logger.WithContext(ctx))
 		}
 
-		// Run the http server
-		if err := api.ListenAndServe(viper.GetString("listen")); err != nil {
+		if matrixBot != nil {
+			go matrixBot.Run(logger.WithContext(ctx))
+		}
+
+		if len(listeners) != 0 {
+			err = api.Serve(ctx, listeners, cfg.ShutdownTimeout)
+		} else {
+			err = api.ListenAndServe(ctx, cfg.Listen, cfg.ShutdownTimeout)
+		}
+		if err != nil {
 			logger.Warn().Err(err).Msg("Stopped the api server")
 		}
 		logger.Info().Msg("Stopping bookmarks")
@@ -53,15 +255,138 @@ var serverCmd = &cobra.Command{
 }
 
 func init() {
-	serverCmd.PersistentFlags().StringP("listen", "l", "0.0.0.0:3000", "Address to listen for HTTP requests on")
+	defaults := config.Default()
+
+	serverCmd.PersistentFlags().StringP("listen", "l", defaults.Listen, "Address to listen for HTTP requests on, or unix:/path/to/socket")
+	serverCmd.PersistentFlags().String("base-path", defaults.BasePath, "Serve the application under this sub path, for example /bookmarks")
+	serverCmd.PersistentFlags().String("assets-dir", defaults.AssetsDir, "Serve the frontend from this directory instead of the embedded assets")
+	serverCmd.PersistentFlags().Uint32("socket-mode", defaults.SocketMode, "Permissions of the unix socket")
 	serverCmd.PersistentFlags().IntP("interval", "i", 15, "Fetch new feeds with this interval in minutes (0 to disable)")
+	serverCmd.PersistentFlags().MarkDeprecated("interval", "use --schedules feeds=\"*/15 * * * *\" instead")
+	serverCmd.PersistentFlags().StringToString("schedules", defaults.Schedules, "Cron expressions of recurring jobs by name (empty to disable)")
+	serverCmd.PersistentFlags().Duration("retention", defaults.Retention, "Time deleted bookmarks, feeds and thoughts can be restored before they are purged")
+	serverCmd.PersistentFlags().Int("refresh-batch-size", defaults.RefreshBatchSize, "Maximum number of feeds refreshed by every run of the feeds schedule")
+	serverCmd.PersistentFlags().Duration("refresh-window", defaults.RefreshWindow, "Only refresh feeds that were refreshed longer ago than this")
+	serverCmd.PersistentFlags().Int("refresh-max-errors", defaults.RefreshMaxErrors, "Stop refreshing feeds that could not be refreshed this many times in a row, 0 never stops")
+	serverCmd.PersistentFlags().Int("workers", defaults.Workers, "Number of background jobs of the same kind to run at the same time")
+	serverCmd.PersistentFlags().StringToString("job-timeouts", map[string]string{}, "Maximum duration of background jobs by kind, for example feed.refresh=2m (0 to disable)")
+	serverCmd.PersistentFlags().StringToString("job-workers", map[string]string{}, "Number of background jobs to run at the same time by kind, for example feed.refresh=10")
 	serverCmd.PersistentFlags().StringP("username", "u", "", "Username for authentication")
 	serverCmd.PersistentFlags().StringP("password", "p", "", "Password for authentication")
+	serverCmd.PersistentFlags().String("auth-mode", defaults.AuthMode, "Authentication of the rest api: auto to require it once a username and password or a user is configured, or none when a reverse proxy authenticates")
+	serverCmd.PersistentFlags().String("tls-cert", defaults.TLSCert, "Path to a certificate to serve https with")
+	serverCmd.PersistentFlags().String("tls-key", defaults.TLSKey, "Path to the private key of the certificate")
+	serverCmd.PersistentFlags().StringSlice("autocert-hosts", []string{}, "Serve https with certificates from Let's Encrypt for these hosts")
+	serverCmd.PersistentFlags().String("autocert-cache", defaults.AutocertCache, "Directory to cache certificates from Let's Encrypt in")
+	serverCmd.PersistentFlags().Duration("read-timeout", defaults.ReadTimeout, "Maximum duration of requests that read data (0 to disable)")
+	serverCmd.PersistentFlags().Duration("write-timeout", defaults.WriteTimeout, "Maximum duration of requests that write data (0 to disable)")
+	serverCmd.PersistentFlags().Duration("fetch-timeout", defaults.FetchTimeout, "Maximum duration of requests that fetch remote content (0 to disable)")
+	serverCmd.PersistentFlags().Duration("shutdown-timeout", defaults.ShutdownTimeout, "Time to wait for in-flight requests to finish when stopping")
+	serverCmd.PersistentFlags().String("otlp-endpoint", "", "Export traces to the OTLP/HTTP collector at this host:port (empty to disable)")
+	serverCmd.PersistentFlags().Int64("max-body-size", defaults.MaxBodySize, "Maximum size in bytes of request bodies (0 to disable)")
+	serverCmd.PersistentFlags().Int64("max-import-size", defaults.MaxImportSize, "Maximum size in bytes of documents sent to the import endpoint (0 to disable)")
+	serverCmd.PersistentFlags().Int("cache-size", defaults.CacheSize, "Number of list and tag count results to keep in memory (0 to disable)")
+	serverCmd.PersistentFlags().Duration("cache-ttl", defaults.CacheTTL, "Maximum time a cached result is served, which bounds how long changes by other processes go unnoticed")
+	serverCmd.PersistentFlags().String("telegram-token", "", "Token of a Telegram bot that saves the links sent to it as bookmarks (empty to disable)")
+	serverCmd.PersistentFlags().IntSlice("telegram-chats", []int{}, "IDs of the Telegram chats that are allowed to save bookmarks")
+	serverCmd.PersistentFlags().String("matrix-homeserver", "", "URL of the Matrix homeserver of a bot that saves the links posted in a room as bookmarks (empty to disable)")
+	serverCmd.PersistentFlags().String("matrix-token", "", "Access token of the Matrix bot")
+	serverCmd.PersistentFlags().String("matrix-room", "", "ID or alias of the Matrix room the bot listens and posts notifications in")
+	serverCmd.PersistentFlags().StringSlice("matrix-events", defaults.MatrixEvents, "Events the Matrix bot posts notifications about")
+	serverCmd.PersistentFlags().String("matrix-digest", defaults.MatrixDigest, "Cron expression of when the Matrix bot posts the bookmarks still to read (empty to disable)")
+	serverCmd.PersistentFlags().String("readwise-token", "", "Access token of Readwise to push thoughts to (empty to disable)")
+	serverCmd.PersistentFlags().String("readwise-schedule", defaults.ReadwiseSchedule, "Cron expression of when thoughts are pushed to Readwise (empty to disable)")
+	serverCmd.PersistentFlags().String("slash-signing-secret", "", "Signing secret of the Slack app that sends /bookmark slash commands")
+	serverCmd.PersistentFlags().String("slash-token", "", "Token of the Mattermost /bookmark slash command")
+	serverCmd.PersistentFlags().String("shaarli-secret", "", "Secret Shaarli apps sign their requests with (empty to disable the Shaarli api)")
+	serverCmd.PersistentFlags().String("linkding-token", "", "Token linkding apps authenticate with (empty to disable the linkding api)")
+	serverCmd.PersistentFlags().String("pocket-consumer-key", "", "Consumer key of the Pocket app bookmarks are pushed to Pocket with")
+	serverCmd.PersistentFlags().String("pocket-access-token", "", "Access token of the Pocket account to push bookmarks to, see the pocket-login command (empty to disable)")
+	serverCmd.PersistentFlags().String("instapaper-username", "", "Username or email of the Instapaper account to push bookmarks to (empty to disable)")
+	serverCmd.PersistentFlags().String("instapaper-password", "", "Password of the Instapaper account, if it has one")
+	serverCmd.PersistentFlags().String("public-url", "", "Public address of the application, like https://example.com/bookmarks, for links in emails and ActivityPub")
+	serverCmd.PersistentFlags().String("smtp-addr", "", "Address of the smtp server to send emails with, like smtp.example.com:587 (empty to disable)")
+	serverCmd.PersistentFlags().String("smtp-username", "", "Username of the smtp server, if it requires authentication")
+	serverCmd.PersistentFlags().String("smtp-password", "", "Password of the smtp server")
+	serverCmd.PersistentFlags().String("email-from", "", "Address emails are sent from")
+	serverCmd.PersistentFlags().StringSlice("email-to", []string{}, "Addresses emails are sent to")
+	serverCmd.PersistentFlags().String("email-digest", defaults.EmailDigest, "Cron expression of when the oldest bookmarks still to read are emailed (empty to disable)")
+	serverCmd.PersistentFlags().Int("email-digest-size", defaults.EmailDigestSize, "Number of bookmarks in the email digest")
+	serverCmd.PersistentFlags().String("email-secret", "", "Secret that signs the links in the email digest that archive a bookmark (empty to leave them out)")
+	serverCmd.PersistentFlags().String("periodical", "", "Path to the EPUB of unread feed items and bookmarks, served at /api/v1/periodical (empty to disable)")
+	serverCmd.PersistentFlags().String("periodical-schedule", defaults.PeriodicalSchedule, "Cron expression of when the periodical is compiled (empty to disable)")
+	serverCmd.PersistentFlags().Int("periodical-size", defaults.PeriodicalSize, "Maximum number of articles in the periodical")
+	serverCmd.PersistentFlags().Bool("periodical-email", false, "Email the periodical as an attachment, requires --smtp-addr")
+	serverCmd.PersistentFlags().Bool("activitypub", false, "Publish shared bookmarks with ActivityPub, requires --public-url")
+	serverCmd.PersistentFlags().String("activitypub-user", defaults.ActivityPubUser, "Username of the ActivityPub actor that publishes shared bookmarks")
+	serverCmd.PersistentFlags().String("activitypub-key", defaults.ActivityPubKey, "Path to the private key of the ActivityPub actor, generated if it does not exist")
+	serverCmd.PersistentFlags().String("activitypub-schedule", defaults.ActivityPubSchedule, "Cron expression of when shared bookmarks are delivered to followers (empty to disable)")
+	serverCmd.PersistentFlags().StringToString("inbound-tokens", map[string]string{}, "Tokens of inbound webhooks with the json paths their fields are read from, for example s3cret=\"url=data.link tags=labels\"")
 
 	viper.BindPFlag("listen", serverCmd.PersistentFlags().Lookup("listen"))
+	viper.BindPFlag("base-path", serverCmd.PersistentFlags().Lookup("base-path"))
+	viper.BindPFlag("assets-dir", serverCmd.PersistentFlags().Lookup("assets-dir"))
+	viper.BindPFlag("socket-mode", serverCmd.PersistentFlags().Lookup("socket-mode"))
 	viper.BindPFlag("interval", serverCmd.PersistentFlags().Lookup("interval"))
+	viper.BindPFlag("schedules", serverCmd.PersistentFlags().Lookup("schedules"))
+	viper.BindPFlag("retention", serverCmd.PersistentFlags().Lookup("retention"))
+	viper.BindPFlag("refresh-batch-size", serverCmd.PersistentFlags().Lookup("refresh-batch-size"))
+	viper.BindPFlag("refresh-window", serverCmd.PersistentFlags().Lookup("refresh-window"))
+	viper.BindPFlag("refresh-max-errors", serverCmd.PersistentFlags().Lookup("refresh-max-errors"))
+	viper.BindPFlag("workers", serverCmd.PersistentFlags().Lookup("workers"))
+	viper.BindPFlag("job-workers", serverCmd.PersistentFlags().Lookup("job-workers"))
+	viper.BindPFlag("job-timeouts", serverCmd.PersistentFlags().Lookup("job-timeouts"))
 	viper.BindPFlag("username", serverCmd.PersistentFlags().Lookup("username"))
 	viper.BindPFlag("password", serverCmd.PersistentFlags().Lookup("password"))
+	viper.BindPFlag("auth-mode", serverCmd.PersistentFlags().Lookup("auth-mode"))
+	viper.BindPFlag("tls-cert", serverCmd.PersistentFlags().Lookup("tls-cert"))
+	viper.BindPFlag("tls-key", serverCmd.PersistentFlags().Lookup("tls-key"))
+	viper.BindPFlag("autocert-hosts", serverCmd.PersistentFlags().Lookup("autocert-hosts"))
+	viper.BindPFlag("autocert-cache", serverCmd.PersistentFlags().Lookup("autocert-cache"))
+	viper.BindPFlag("read-timeout", serverCmd.PersistentFlags().Lookup("read-timeout"))
+	viper.BindPFlag("write-timeout", serverCmd.PersistentFlags().Lookup("write-timeout"))
+	viper.BindPFlag("fetch-timeout", serverCmd.PersistentFlags().Lookup("fetch-timeout"))
+	viper.BindPFlag("shutdown-timeout", serverCmd.PersistentFlags().Lookup("shutdown-timeout"))
+	viper.BindPFlag("otlp-endpoint", serverCmd.PersistentFlags().Lookup("otlp-endpoint"))
+	viper.BindPFlag("max-body-size", serverCmd.PersistentFlags().Lookup("max-body-size"))
+	viper.BindPFlag("max-import-size", serverCmd.PersistentFlags().Lookup("max-import-size"))
+	viper.BindPFlag("cache-size", serverCmd.PersistentFlags().Lookup("cache-size"))
+	viper.BindPFlag("cache-ttl", serverCmd.PersistentFlags().Lookup("cache-ttl"))
+	viper.BindPFlag("telegram-token", serverCmd.PersistentFlags().Lookup("telegram-token"))
+	viper.BindPFlag("telegram-chats", serverCmd.PersistentFlags().Lookup("telegram-chats"))
+	viper.BindPFlag("matrix-homeserver", serverCmd.PersistentFlags().Lookup("matrix-homeserver"))
+	viper.BindPFlag("matrix-token", serverCmd.PersistentFlags().Lookup("matrix-token"))
+	viper.BindPFlag("matrix-room", serverCmd.PersistentFlags().Lookup("matrix-room"))
+	viper.BindPFlag("matrix-events", serverCmd.PersistentFlags().Lookup("matrix-events"))
+	viper.BindPFlag("matrix-digest", serverCmd.PersistentFlags().Lookup("matrix-digest"))
+	viper.BindPFlag("readwise-token", serverCmd.PersistentFlags().Lookup("readwise-token"))
+	viper.BindPFlag("readwise-schedule", serverCmd.PersistentFlags().Lookup("readwise-schedule"))
+	viper.BindPFlag("slash-signing-secret", serverCmd.PersistentFlags().Lookup("slash-signing-secret"))
+	viper.BindPFlag("slash-token", serverCmd.PersistentFlags().Lookup("slash-token"))
+	viper.BindPFlag("shaarli-secret", serverCmd.PersistentFlags().Lookup("shaarli-secret"))
+	viper.BindPFlag("linkding-token", serverCmd.PersistentFlags().Lookup("linkding-token"))
+	viper.BindPFlag("pocket-consumer-key", serverCmd.PersistentFlags().Lookup("pocket-consumer-key"))
+	viper.BindPFlag("pocket-access-token", serverCmd.PersistentFlags().Lookup("pocket-access-token"))
+	viper.BindPFlag("instapaper-username", serverCmd.PersistentFlags().Lookup("instapaper-username"))
+	viper.BindPFlag("instapaper-password", serverCmd.PersistentFlags().Lookup("instapaper-password"))
+	viper.BindPFlag("public-url", serverCmd.PersistentFlags().Lookup("public-url"))
+	viper.BindPFlag("smtp-addr", serverCmd.PersistentFlags().Lookup("smtp-addr"))
+	viper.BindPFlag("smtp-username", serverCmd.PersistentFlags().Lookup("smtp-username"))
+	viper.BindPFlag("smtp-password", serverCmd.PersistentFlags().Lookup("smtp-password"))
+	viper.BindPFlag("email-from", serverCmd.PersistentFlags().Lookup("email-from"))
+	viper.BindPFlag("email-to", serverCmd.PersistentFlags().Lookup("email-to"))
+	viper.BindPFlag("email-digest", serverCmd.PersistentFlags().Lookup("email-digest"))
+	viper.BindPFlag("email-digest-size", serverCmd.PersistentFlags().Lookup("email-digest-size"))
+	viper.BindPFlag("email-secret", serverCmd.PersistentFlags().Lookup("email-secret"))
+	viper.BindPFlag("periodical", serverCmd.PersistentFlags().Lookup("periodical"))
+	viper.BindPFlag("periodical-schedule", serverCmd.PersistentFlags().Lookup("periodical-schedule"))
+	viper.BindPFlag("periodical-size", serverCmd.PersistentFlags().Lookup("periodical-size"))
+	viper.BindPFlag("periodical-email", serverCmd.PersistentFlags().Lookup("periodical-email"))
+	viper.BindPFlag("activitypub", serverCmd.PersistentFlags().Lookup("activitypub"))
+	viper.BindPFlag("activitypub-user", serverCmd.PersistentFlags().Lookup("activitypub-user"))
+	viper.BindPFlag("activitypub-key", serverCmd.PersistentFlags().Lookup("activitypub-key"))
+	viper.BindPFlag("activitypub-schedule", serverCmd.PersistentFlags().Lookup("activitypub-schedule"))
+	viper.BindPFlag("inbound-tokens", serverCmd.PersistentFlags().Lookup("inbound-tokens"))
 
 	rootCmd.AddCommand(serverCmd)
 }
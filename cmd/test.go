@@ -3,9 +3,9 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
 
@@ -17,8 +17,8 @@ var testFetchBookmarkCmd = &cobra.Command{
 			URL: args[0],
 		}
 
-		if err := bookmark.Fetch(context.TODO()); err != nil {
-			log.Fatalf("Oh no!")
+		if err := bookmark.Fetch(log.Logger.WithContext(context.Background())); err != nil {
+			return err
 		}
 
 		fmt.Printf("Title: %s\n", bookmark.Title)
@@ -41,7 +41,7 @@ var testFetchFeedCmd = &cobra.Command{
 			// Etag:      os.Args[2],
 		}
 
-		if err := feed.Fetch(context.TODO()); err != nil {
+		if err := feed.Fetch(log.Logger.WithContext(context.Background())); err != nil {
 			return err
 		}
 
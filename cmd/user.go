@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Create users, change their password, rotate their api token and disable them",
+}
+
+var userCreateCmd = &cobra.Command{
+	Use:   "create <username>",
+	Short: "Create a user that logs in with a password",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if strings.TrimSpace(args[0]) != args[0] || strings.ContainsAny(args[0], " \t\n;\",\\") {
+			return fmt.Errorf("Username %q contains whitespace or invalid characters", args[0])
+		}
+
+		return withUser(cmd, args[0], true, func(user *storage.User) error {
+			if user.ID != "" {
+				return fmt.Errorf("User %s already exists", user.Username)
+			}
+
+			user.Admin, _ = cmd.Flags().GetBool("admin")
+
+			return setPassword(cmd, user)
+		})
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <username>",
+	Short: "Change the password of a user, logging out its sessions",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withUser(cmd, args[0], false, func(user *storage.User) error {
+			return setPassword(cmd, user)
+		})
+	},
+}
+
+var userTokenCmd = &cobra.Command{
+	Use:   "token <username>",
+	Short: "Generate a new api token for a user, replacing the previous one",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		token := ""
+		if err := withUser(cmd, args[0], false, func(user *storage.User) error {
+			token = user.NewToken()
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		// The token is only stored hashed, so this is the only time it is shown
+		fmt.Println(token)
+
+		return nil
+	},
+}
+
+var userDisableCmd = &cobra.Command{
+	Use:   "disable <username>",
+	Short: "Disable a user, its sessions and api token stop working",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		enable, _ := cmd.Flags().GetBool("enable")
+
+		return withUser(cmd, args[0], false, func(user *storage.User) error {
+			user.Disabled = !enable
+			return nil
+		})
+	},
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the users",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := log.Logger.WithContext(cmd.Context())
+
+		store, err := openStore(ctx)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "USERNAME\tCREATED\tTOKEN\tADMIN\tDISABLED")
+		for _, user := range *store.UserList(ctx) {
+			fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%t\n", user.Username, user.Created.Format("2006-01-02 15:04"), user.TokenHash != "", user.Admin, user.Disabled)
+		}
+
+		return w.Flush()
+	},
+}
+
+// withUser opens the database, gets the user with username and persists it after change is done
+// with it, only create accepts a user that does not exist yet
+func withUser(cmd *cobra.Command, username string, create bool, change func(user *storage.User) error) error {
+	ctx := log.Logger.WithContext(cmd.Context())
+
+	store, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	user := &storage.User{Username: username}
+	if err := store.UserGet(ctx, user); err != nil && !create {
+		return fmt.Errorf("User %s not found", username)
+	}
+
+	if err := change(user); err != nil {
+		return err
+	}
+
+	return store.UserPersist(ctx, user)
+}
+
+// setPassword sets the password of the --password flag, or reads it from the first line of stdin
+func setPassword(cmd *cobra.Command, user *storage.User) error {
+	password, _ := cmd.Flags().GetString("password")
+
+	if password == "" {
+		fmt.Fprintf(os.Stderr, "Password for %s: ", user.Username)
+
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return errors.New("No password given")
+		}
+
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return errors.New("The password cannot be empty")
+	}
+
+	return user.SetPassword(password)
+}
+
+func init() {
+	userCreateCmd.Flags().String("password", "", "Password of the user (read from stdin if not set)")
+	userCreateCmd.Flags().Bool("admin", false, "Allow the user to use the admin endpoints")
+	userPasswdCmd.Flags().String("password", "", "New password of the user (read from stdin if not set)")
+	userDisableCmd.Flags().Bool("enable", false, "Enable the user again instead")
+
+	userCmd.AddCommand(userCreateCmd, userPasswdCmd, userTokenCmd, userDisableCmd, userListCmd)
+	rootCmd.AddCommand(userCmd)
+}
@@ -0,0 +1,383 @@
+// Package config loads the settings of bookmarks from a yaml or toml config file, BOOKMARKS_*
+// environment variables and command line flags, in increasing order of precedence
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/nrocco/bookmarks/scheduler"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog"
+	"github.com/spf13/viper"
+)
+
+const (
+	// AuthAuto protects the app once a username and password are configured or a user exists
+	AuthAuto = "auto"
+
+	// AuthNone leaves the app unprotected, for when a reverse proxy in front of it authenticates
+	AuthNone = "none"
+
+	// EnvPrefix is the prefix of the environment variables that override the config file
+	EnvPrefix = "BOOKMARKS_"
+)
+
+// Config holds every setting, the keys of the config file are the names of the command line flags
+type Config struct {
+	Log      `mapstructure:",squash"`
+	Server   `mapstructure:",squash"`
+	Timeouts `mapstructure:",squash"`
+	Jobs     `mapstructure:",squash"`
+	Auth     `mapstructure:",squash"`
+	Fetch    `mapstructure:",squash"`
+	SMTP     `mapstructure:",squash"`
+	Features `mapstructure:",squash"`
+	Remote   `mapstructure:",squash"`
+
+	Storage     string            `mapstructure:"storage"`
+	DatabaseKey string            `mapstructure:"database-key"`
+	Pragmas     map[string]string `mapstructure:"pragmas"`
+}
+
+// Log configures the logger
+type Log struct {
+	Debug     bool   `mapstructure:"debug"`
+	LogLevel  string `mapstructure:"log-level"`
+	LogFormat string `mapstructure:"log-format"`
+
+	// LogFile is rotated once it grows larger than LogMaxSize megabytes, logs go to stderr if it is empty
+	LogFile       string `mapstructure:"log-file"`
+	LogMaxSize    int    `mapstructure:"log-max-size"`
+	LogMaxBackups int    `mapstructure:"log-max-backups"`
+}
+
+// Server configures the http server
+type Server struct {
+	Listen        string   `mapstructure:"listen"`
+	BasePath      string   `mapstructure:"base-path"`
+	PublicURL     string   `mapstructure:"public-url"`
+	AssetsDir     string   `mapstructure:"assets-dir"`
+	SocketMode    uint32   `mapstructure:"socket-mode"`
+	TLSCert       string   `mapstructure:"tls-cert"`
+	TLSKey        string   `mapstructure:"tls-key"`
+	AutocertHosts []string `mapstructure:"autocert-hosts"`
+	AutocertCache string   `mapstructure:"autocert-cache"`
+	MaxBodySize   int64    `mapstructure:"max-body-size"`
+	MaxImportSize int64    `mapstructure:"max-import-size"`
+	OTLPEndpoint  string   `mapstructure:"otlp-endpoint"`
+
+	CacheSize int           `mapstructure:"cache-size"`
+	CacheTTL  time.Duration `mapstructure:"cache-ttl"`
+}
+
+// Timeouts limit the duration of requests, 0 disables a timeout
+type Timeouts struct {
+	ReadTimeout     time.Duration `mapstructure:"read-timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write-timeout"`
+	FetchTimeout    time.Duration `mapstructure:"fetch-timeout"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown-timeout"`
+}
+
+// Jobs configures the background job queue and the schedules of recurring jobs
+type Jobs struct {
+	Workers     int                      `mapstructure:"workers"`
+	JobWorkers  map[string]int           `mapstructure:"job-workers"`
+	JobTimeouts map[string]time.Duration `mapstructure:"job-timeouts"`
+	Schedules   map[string]string        `mapstructure:"schedules"`
+	Retention   time.Duration            `mapstructure:"retention"`
+
+	// RefreshBatchSize and RefreshWindow tune the sweeps of the feeds schedule, which refresh at
+	// most RefreshBatchSize feeds that were refreshed longer than RefreshWindow ago and suspend
+	// feeds that could not be refreshed RefreshMaxErrors times in a row
+	RefreshBatchSize int           `mapstructure:"refresh-batch-size"`
+	RefreshWindow    time.Duration `mapstructure:"refresh-window"`
+	RefreshMaxErrors int           `mapstructure:"refresh-max-errors"`
+}
+
+// Auth configures who can use the web application and rest api
+type Auth struct {
+	AuthMode string `mapstructure:"auth-mode"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+}
+
+// Fetch configures how bookmarks and feeds are fetched
+type Fetch struct {
+	Proxy        string        `mapstructure:"proxy"`
+	UserAgent    string        `mapstructure:"user-agent"`
+	DNSCache     time.Duration `mapstructure:"dns-cache"`
+	FetchMaxSize int64         `mapstructure:"fetch-max-size"`
+}
+
+// SMTP configures the emails that are sent
+type SMTP struct {
+	SMTPAddr        string   `mapstructure:"smtp-addr"`
+	SMTPUsername    string   `mapstructure:"smtp-username"`
+	SMTPPassword    string   `mapstructure:"smtp-password"`
+	EmailFrom       string   `mapstructure:"email-from"`
+	EmailTo         []string `mapstructure:"email-to"`
+	EmailDigest     string   `mapstructure:"email-digest"`
+	EmailDigestSize int      `mapstructure:"email-digest-size"`
+	EmailSecret     string   `mapstructure:"email-secret"`
+}
+
+// Features configures the optional integrations, most of them are disabled while their token or
+// address is empty
+type Features struct {
+	TelegramToken       string            `mapstructure:"telegram-token"`
+	TelegramChats       []int64           `mapstructure:"telegram-chats"`
+	MatrixHomeserver    string            `mapstructure:"matrix-homeserver"`
+	MatrixToken         string            `mapstructure:"matrix-token"`
+	MatrixRoom          string            `mapstructure:"matrix-room"`
+	MatrixEvents        []string          `mapstructure:"matrix-events"`
+	MatrixDigest        string            `mapstructure:"matrix-digest"`
+	ReadwiseToken       string            `mapstructure:"readwise-token"`
+	ReadwiseSchedule    string            `mapstructure:"readwise-schedule"`
+	SlashSigningSecret  string            `mapstructure:"slash-signing-secret"`
+	SlashToken          string            `mapstructure:"slash-token"`
+	ShaarliSecret       string            `mapstructure:"shaarli-secret"`
+	LinkdingToken       string            `mapstructure:"linkding-token"`
+	PocketConsumerKey   string            `mapstructure:"pocket-consumer-key"`
+	PocketAccessToken   string            `mapstructure:"pocket-access-token"`
+	InstapaperUsername  string            `mapstructure:"instapaper-username"`
+	InstapaperPassword  string            `mapstructure:"instapaper-password"`
+	Periodical          string            `mapstructure:"periodical"`
+	PeriodicalSchedule  string            `mapstructure:"periodical-schedule"`
+	PeriodicalSize      int               `mapstructure:"periodical-size"`
+	PeriodicalEmail     bool              `mapstructure:"periodical-email"`
+	ActivityPub         bool              `mapstructure:"activitypub"`
+	ActivityPubUser     string            `mapstructure:"activitypub-user"`
+	ActivityPubKey      string            `mapstructure:"activitypub-key"`
+	ActivityPubSchedule string            `mapstructure:"activitypub-schedule"`
+	InboundTokens       map[string]string `mapstructure:"inbound-tokens"`
+}
+
+// Remote points the bookmark and feed commands at a remote instance instead of the database
+type Remote struct {
+	RemoteURL      string `mapstructure:"remote"`
+	RemoteUsername string `mapstructure:"remote-username"`
+	RemotePassword string `mapstructure:"remote-password"`
+}
+
+// Default returns the settings that apply when neither the config file, the environment nor a
+// flag sets them
+func Default() Config {
+	schedules := map[string]string{}
+	for name, spec := range scheduler.DefaultSchedules {
+		schedules[name] = spec
+	}
+
+	return Config{
+		Log: Log{
+			LogLevel:      "info",
+			LogFormat:     "json",
+			LogMaxSize:    100,
+			LogMaxBackups: 3,
+		},
+		Server: Server{
+			Listen:        "0.0.0.0:3000",
+			SocketMode:    0660,
+			AutocertCache: "autocert",
+			MaxBodySize:   1 << 20,
+			MaxImportSize: 32 << 20,
+			CacheSize:     256,
+			CacheTTL:      time.Minute,
+		},
+		Timeouts: Timeouts{
+			ReadTimeout:     5 * time.Second,
+			WriteTimeout:    10 * time.Second,
+			FetchTimeout:    60 * time.Second,
+			ShutdownTimeout: 15 * time.Second,
+		},
+		Jobs: Jobs{
+			Workers:     4,
+			JobWorkers:  map[string]int{},
+			JobTimeouts: map[string]time.Duration{},
+			Schedules:   schedules,
+			Retention:   scheduler.DefaultRetention,
+
+			RefreshBatchSize: scheduler.DefaultRefreshBatchSize,
+			RefreshWindow:    scheduler.DefaultRefreshWindow,
+			RefreshMaxErrors: scheduler.DefaultRefreshMaxErrors,
+		},
+		Auth: Auth{
+			AuthMode: AuthAuto,
+		},
+		Fetch: Fetch{
+			FetchMaxSize: storage.DefaultFetchMaxSize,
+		},
+		SMTP: SMTP{
+			EmailDigest:     scheduler.DefaultEmailDigestSchedule,
+			EmailDigestSize: scheduler.DefaultEmailDigestSize,
+		},
+		Features: Features{
+			MatrixEvents:        []string{scheduler.EventFeedBroken, scheduler.EventDigest},
+			MatrixDigest:        scheduler.DefaultDigestSchedule,
+			ReadwiseSchedule:    scheduler.DefaultReadwiseSchedule,
+			PeriodicalSchedule:  scheduler.DefaultPeriodicalSchedule,
+			PeriodicalSize:      scheduler.DefaultPeriodicalSize,
+			ActivityPubUser:     "bookmarks",
+			ActivityPubKey:      "activitypub.pem",
+			ActivityPubSchedule: scheduler.DefaultActivityPubSchedule,
+			InboundTokens:       map[string]string{},
+		},
+		Storage: "data.db",
+		Pragmas: map[string]string{},
+	}
+}
+
+// Load reads the config file, .bookmarks.yaml or .bookmarks.toml in $PWD, $HOME or /etc if file is
+// empty, and returns the settings of v on top of the defaults. A config file that does not exist is
+// only an error if file is set.
+func Load(v *viper.Viper, file string) (*Config, error) {
+	if file != "" {
+		v.SetConfigFile(file)
+	} else {
+		v.SetConfigName(".bookmarks")
+		v.AddConfigPath(".")
+		v.AddConfigPath("$HOME")
+		v.AddConfigPath("/etc/")
+	}
+
+	if err := v.ReadInConfig(); err != nil && !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+		return nil, fmt.Errorf("Error reading config file: %w", err)
+	}
+
+	config := Default()
+
+	// Environment variables only apply to keys viper knows, so bind every setting explicitly
+	bindEnv(v, reflect.TypeOf(config))
+	v.BindEnv("interval", EnvPrefix+"INTERVAL")
+
+	hooks := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		stringToMapHook,
+		mapstructure.StringToSliceHookFunc(","),
+	))
+
+	if err := v.Unmarshal(&config, hooks); err != nil {
+		return nil, fmt.Errorf("Invalid config: %w", err)
+	}
+
+	// The interval in minutes predates the schedules and still overrides the schedule of feeds
+	if v.IsSet("interval") {
+		config.Schedules["feeds"] = ""
+		if interval := v.GetInt("interval"); interval != 0 {
+			config.Schedules["feeds"] = fmt.Sprintf("@every %dm", interval)
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// Validate checks the settings that would otherwise only fail once they are used
+func (config *Config) Validate() error {
+	if _, err := zerolog.ParseLevel(config.LogLevel); err != nil {
+		return fmt.Errorf("Unknown log level %s, use debug, info, warn or error", config.LogLevel)
+	}
+
+	if config.LogFormat != "json" && config.LogFormat != "console" {
+		return fmt.Errorf("Unknown log format %s, use json or console", config.LogFormat)
+	}
+
+	if config.LogMaxSize < 0 || config.LogMaxBackups < 0 {
+		return errors.New("The log-max-size and log-max-backups must not be negative")
+	}
+
+	if config.CacheSize < 0 || config.CacheTTL < 0 {
+		return errors.New("The cache-size and cache-ttl must not be negative")
+	}
+
+	if config.AuthMode != AuthAuto && config.AuthMode != AuthNone {
+		return fmt.Errorf("Unknown auth mode %s, use %s or %s", config.AuthMode, AuthAuto, AuthNone)
+	}
+
+	if config.Proxy != "" {
+		if _, err := config.ProxyURL(); err != nil {
+			return err
+		}
+	}
+
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		return errors.New("Set both tls-cert and tls-key to serve https")
+	}
+
+	if config.RefreshBatchSize < 1 || config.RefreshWindow <= 0 {
+		return errors.New("The refresh-batch-size and refresh-window must be larger than 0")
+	}
+
+	if config.RefreshMaxErrors < 0 {
+		return fmt.Errorf("The refresh-max-errors cannot be negative, got %d", config.RefreshMaxErrors)
+	}
+
+	if config.Workers < 1 {
+		return fmt.Errorf("The number of workers must be at least 1, got %d", config.Workers)
+	}
+
+	return nil
+}
+
+// ProxyURL parses the proxy bookmarks and feeds are fetched through, nil means no proxy
+func (config *Config) ProxyURL() (*url.URL, error) {
+	if config.Proxy == "" {
+		return nil, nil
+	}
+
+	proxy, err := url.Parse(config.Proxy)
+	if err != nil || proxy.Scheme == "" || proxy.Host == "" {
+		return nil, fmt.Errorf("Invalid proxy %s, use a URL like http://proxy.example.com:3128", config.Proxy)
+	}
+
+	return proxy, nil
+}
+
+// bindEnv binds every key of the settings in t to its environment variable, for example
+// BOOKMARKS_READ_TIMEOUT for read-timeout
+func bindEnv(v *viper.Viper, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("mapstructure")
+
+		if tag == ",squash" {
+			bindEnv(v, field.Type)
+			continue
+		}
+
+		v.BindEnv(tag, EnvPrefix+strings.ToUpper(strings.ReplaceAll(tag, "-", "_")))
+	}
+}
+
+// stringToMapHook decodes environment variables like feed.refresh=10,cleanup=1 into maps, the
+// same format as the flags of maps
+func stringToMapHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if from.Kind() != reflect.String || to.Kind() != reflect.Map {
+		return data, nil
+	}
+
+	result := map[string]string{}
+
+	for _, pair := range strings.Split(data.(string), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Expected key=value, got %s", pair)
+		}
+
+		result[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return result, nil
+}
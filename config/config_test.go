@@ -0,0 +1,109 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	file := filepath.Join(tmpDir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func setenv(t *testing.T, key, value string) {
+	os.Setenv(key, value)
+	t.Cleanup(func() { os.Unsetenv(key) })
+}
+
+func TestLoad(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "listen: 127.0.0.1:4000\nread-timeout: 2s\nschedules:\n  cleanup: \"@weekly\"\nemail-to:\n  - alice@example.com\n",
+		"config.toml": "listen = \"127.0.0.1:4000\"\nread-timeout = \"2s\"\nemail-to = [\"alice@example.com\"]\n[schedules]\ncleanup = \"@weekly\"\n",
+	}
+
+	for name, content := range files {
+		config, err := Load(viper.New(), writeConfig(t, name, content))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		if config.Listen != "127.0.0.1:4000" || config.ReadTimeout != 2*time.Second || len(config.EmailTo) != 1 {
+			t.Fatalf("%s: Expected the settings of the file, got %+v", name, config)
+		}
+
+		if config.Schedules["cleanup"] != "@weekly" || config.Schedules["feeds"] != "*/15 * * * *" {
+			t.Fatalf("%s: Expected the schedules of the file on top of the defaults, got %v", name, config.Schedules)
+		}
+
+		if config.WriteTimeout != 10*time.Second || config.Storage != "data.db" || config.AuthMode != AuthAuto {
+			t.Fatalf("%s: Expected defaults for the other settings, got %+v", name, config)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	file := writeConfig(t, "config.yaml", "listen: 127.0.0.1:4000\nworkers: 2\n")
+
+	setenv(t, "BOOKMARKS_LISTEN", "127.0.0.1:5000")
+	setenv(t, "BOOKMARKS_JOB_WORKERS", "feed.refresh=10,cleanup=1")
+	setenv(t, "BOOKMARKS_TELEGRAM_CHATS", "1,2")
+	setenv(t, "BOOKMARKS_AUTH_MODE", "none")
+	setenv(t, "BOOKMARKS_INTERVAL", "0")
+
+	config, err := Load(viper.New(), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Listen != "127.0.0.1:5000" || config.Workers != 2 || config.AuthMode != AuthNone {
+		t.Fatalf("Expected the environment to override the file, got %+v", config)
+	}
+
+	if config.JobWorkers["feed.refresh"] != 10 || config.JobWorkers["cleanup"] != 1 || len(config.TelegramChats) != 2 {
+		t.Fatalf("Expected maps and lists from the environment, got %v and %v", config.JobWorkers, config.TelegramChats)
+	}
+
+	if config.Schedules["feeds"] != "" {
+		t.Fatalf("Expected an interval of 0 to disable the feeds schedule, got %s", config.Schedules["feeds"])
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"auth-mode: basic\n":       "auth mode",
+		"proxy: proxy:3128\n":      "proxy",
+		"log-format: xml\n":        "log format",
+		"log-max-size: -1\n":       "log max size",
+		"cache-size: -1\n":         "cache size",
+		"refresh-max-errors: -1\n": "refresh max errors",
+		"tls-cert: cert.pem\n":     "tls",
+		"read-timeout: tomorrow\n": "duration",
+		"listen: [\n":              "syntax",
+	}
+
+	for content, name := range invalid {
+		if _, err := Load(viper.New(), writeConfig(t, "config.yaml", content)); err == nil {
+			t.Fatalf("Expected an error for an invalid %s", name)
+		}
+	}
+
+	if _, err := Load(viper.New(), "/does/not/exist.yaml"); err == nil {
+		t.Fatal("Expected an error for a missing config file")
+	}
+}
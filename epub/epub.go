@@ -0,0 +1,218 @@
+// Package epub writes articles into an EPUB book, which e-readers open like a newspaper with a
+// section per source
+package epub
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// Article is a single text in the book, content is plain text with paragraphs separated by empty lines
+type Article struct {
+	Title   string
+	URL     string
+	Content string
+}
+
+// Section groups the articles of a single source, like a feed
+type Section struct {
+	Title    string
+	Articles []*Article
+}
+
+// Book is an EPUB 3 book, with a table of contents for older EPUB 2 readers as well. ID is a
+// unique identifier like a urn
+type Book struct {
+	ID       string
+	Title    string
+	Date     time.Time
+	Sections []*Section
+}
+
+var containerXML = `<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// xmlDeclaration starts every xml file, html/template would escape it inside a template
+const xmlDeclaration = `<?xml version="1.0" encoding="UTF-8"?>
+`
+
+var templates = template.Must(template.New("content.opf").Parse(`<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">{{ .Book.ID }}</dc:identifier>
+    <dc:title>{{ .Book.Title }}</dc:title>
+    <dc:language>en</dc:language>
+    <dc:date>{{ .Book.Date.UTC.Format "2006-01-02" }}</dc:date>
+    <meta property="dcterms:modified">{{ .Book.Date.UTC.Format "2006-01-02T15:04:05Z" }}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    {{ range .Chapters }}<item id="{{ .ID }}" href="{{ .ID }}.xhtml" media-type="application/xhtml+xml"/>
+    {{ end }}
+  </manifest>
+  <spine toc="ncx">
+    {{ range .Chapters }}<itemref idref="{{ .ID }}"/>
+    {{ end }}
+  </spine>
+</package>
+`))
+
+func init() {
+	template.Must(templates.New("nav.xhtml").Parse(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+  <head><title>{{ .Book.Title }}</title></head>
+  <body>
+    <nav epub:type="toc">
+      <h1>{{ .Book.Title }}</h1>
+      <ol>
+        {{ range .Sections }}<li><a href="{{ (index .Chapters 0).ID }}.xhtml">{{ .Title }}</a>
+          <ol>
+            {{ range .Chapters }}<li><a href="{{ .ID }}.xhtml">{{ .Title }}</a></li>
+            {{ end }}
+          </ol>
+        </li>
+        {{ end }}
+      </ol>
+    </nav>
+  </body>
+</html>
+`))
+
+	template.Must(templates.New("toc.ncx").Parse(`<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="{{ .Book.ID }}"/></head>
+  <docTitle><text>{{ .Book.Title }}</text></docTitle>
+  <navMap>
+    {{ range .Chapters }}<navPoint id="point-{{ .ID }}" playOrder="{{ .Order }}">
+      <navLabel><text>{{ .Title }}</text></navLabel>
+      <content src="{{ .ID }}.xhtml"/>
+    </navPoint>
+    {{ end }}
+  </navMap>
+</ncx>
+`))
+
+	template.Must(templates.New("chapter.xhtml").Parse(`<html xmlns="http://www.w3.org/1999/xhtml">
+  <head><title>{{ .Title }}</title></head>
+  <body>
+    <p><small>{{ .Section }}</small></p>
+    <h1>{{ .Title }}</h1>
+    <p><a href="{{ .URL }}">{{ .URL }}</a></p>
+    {{ range .Paragraphs }}<p>{{ . }}</p>
+    {{ end }}
+  </body>
+</html>
+`))
+}
+
+type chapter struct {
+	ID         string
+	Order      int
+	Section    string
+	Title      string
+	URL        string
+	Paragraphs []string
+}
+
+type section struct {
+	Title    string
+	Chapters []*chapter
+}
+
+// Write writes the book as an EPUB file, sections without articles are left out
+func (book *Book) Write(w io.Writer) error {
+	chapters := []*chapter{}
+	sections := []*section{}
+
+	for _, bookSection := range book.Sections {
+		if len(bookSection.Articles) == 0 {
+			continue
+		}
+
+		current := &section{Title: bookSection.Title}
+		for _, article := range bookSection.Articles {
+			chapter := &chapter{
+				ID:         fmt.Sprintf("chapter-%d", len(chapters)+1),
+				Order:      len(chapters) + 1,
+				Section:    bookSection.Title,
+				Title:      article.Title,
+				URL:        article.URL,
+				Paragraphs: paragraphs(article.Content),
+			}
+			chapters = append(chapters, chapter)
+			current.Chapters = append(current.Chapters, chapter)
+		}
+		sections = append(sections, current)
+	}
+
+	archive := zip.NewWriter(w)
+
+	// The mimetype must be the first file and must not be compressed
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(mimetype, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	if err := writeFile(archive, "META-INF/container.xml", func(w io.Writer) error {
+		_, err := io.WriteString(w, containerXML)
+		return err
+	}); err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{"Book": book, "Chapters": chapters, "Sections": sections}
+	for _, name := range []string{"content.opf", "nav.xhtml", "toc.ncx"} {
+		name := name
+		if err := writeFile(archive, "OEBPS/"+name, func(w io.Writer) error {
+			return templates.ExecuteTemplate(w, name, data)
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, chapter := range chapters {
+		chapter := chapter
+		if err := writeFile(archive, "OEBPS/"+chapter.ID+".xhtml", func(w io.Writer) error {
+			return templates.ExecuteTemplate(w, "chapter.xhtml", chapter)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeFile(archive *zip.Writer, name string, write func(w io.Writer) error) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(file, xmlDeclaration); err != nil {
+		return err
+	}
+
+	return write(file)
+}
+
+// paragraphs splits plain text content into paragraphs on empty lines
+func paragraphs(content string) []string {
+	result := []string{}
+
+	for _, paragraph := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n") {
+		if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+			result = append(result, paragraph)
+		}
+	}
+
+	return result
+}
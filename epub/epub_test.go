@@ -0,0 +1,73 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWrite(t *testing.T) {
+	book := &Book{
+		ID:    "urn:bookmarks:periodical:2020-01-02",
+		Title: "Bookmarks of January 2",
+		Date:  time.Date(2020, 1, 2, 6, 0, 0, 0, time.UTC),
+		Sections: []*Section{
+			{Title: "Empty"},
+			{Title: "Read it later", Articles: []*Article{
+				{Title: "Tom & Jerry", URL: "https://example.com/tom", Content: "First paragraph.\n\n\n<b>Second</b> paragraph."},
+			}},
+		},
+	}
+
+	buffer := &bytes.Buffer{}
+	if err := book.Write(buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if archive.File[0].Name != "mimetype" || archive.File[0].Method != zip.Store {
+		t.Fatalf("Expected an uncompressed mimetype first, got %s", archive.File[0].Name)
+	}
+
+	files := map[string]string{}
+	for _, file := range archive.File {
+		reader, _ := file.Open()
+		content, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(content)
+	}
+
+	expected := map[string][]string{
+		"mimetype":               {"application/epub+zip"},
+		"META-INF/container.xml": {`full-path="OEBPS/content.opf"`},
+		"OEBPS/content.opf":      {"<dc:identifier id=\"id\">urn:bookmarks:periodical:2020-01-02</dc:identifier>", "<dc:date>2020-01-02</dc:date>", `<itemref idref="chapter-1"/>`},
+		"OEBPS/nav.xhtml":        {`<a href="chapter-1.xhtml">Read it later</a>`, `<a href="chapter-1.xhtml">Tom &amp; Jerry</a>`},
+		"OEBPS/toc.ncx":          {`<navPoint id="point-chapter-1" playOrder="1">`},
+		"OEBPS/chapter-1.xhtml":  {"<h1>Tom &amp; Jerry</h1>", "<p>First paragraph.</p>", "<p>&lt;b&gt;Second&lt;/b&gt; paragraph.</p>"},
+	}
+
+	for name, content := range files {
+		if name != "mimetype" && !strings.HasPrefix(content, `<?xml version="1.0" encoding="UTF-8"?>`) {
+			t.Fatalf("Expected an xml declaration in %s, got %s", name, content)
+		}
+	}
+
+	for name, contents := range expected {
+		for _, content := range contents {
+			if !strings.Contains(files[name], content) {
+				t.Fatalf("Expected %q in %s, got %s", content, name, files[name])
+			}
+		}
+	}
+
+	if strings.Contains(files["OEBPS/nav.xhtml"], "Empty") {
+		t.Fatal("Expected sections without articles to be left out")
+	}
+}
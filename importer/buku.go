@@ -0,0 +1,46 @@
+package importer
+
+import (
+	"io"
+	"strings"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// parseBuku reads the sqlite database of buku, usually bookmarks.db. Buku keeps no dates, so the
+// bookmarks are created at the time of the import.
+func parseBuku(r io.Reader) (*storage.Document, error) {
+	db, close, err := openSqlite(r)
+	if err != nil {
+		return nil, err
+	}
+	defer close()
+
+	rows, err := db.Query(`SELECT URL, COALESCE(metadata, ''), COALESCE(tags, ''), COALESCE("desc", '') FROM bookmarks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := newBookmarkSet()
+
+	for rows.Next() {
+		bookmark := &storage.Bookmark{Tags: storage.Tags{}}
+		tags := ""
+
+		if err := rows.Scan(&bookmark.URL, &bookmark.Title, &tags, &bookmark.Excerpt); err != nil {
+			return nil, err
+		}
+
+		// Tags are stored between commas, like ,go,web,
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = folderTag(tag); tag != "" {
+				bookmark.Tags = append(bookmark.Tags, tag)
+			}
+		}
+
+		set.add(bookmark)
+	}
+
+	return set.document, rows.Err()
+}
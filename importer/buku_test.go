@@ -0,0 +1,53 @@
+package importer
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestBuku(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		"CREATE TABLE bookmarks (id integer PRIMARY KEY, URL text NOT NULL UNIQUE, metadata text default '', tags text default ',', desc text default '', flags integer default 0)",
+		"INSERT INTO bookmarks (URL, metadata, tags, desc) VALUES ('https://example.com/a', 'A', ',go,web dev,', 'About a'), ('https://example.com/b', '', ',', ''), ('file:///tmp/c', 'C', ',', '')",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	database, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := Parse("buku", bytes.NewReader(database))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 2 {
+		t.Fatalf("Expected 2 bookmarks, got %d", len(document.Bookmarks))
+	}
+
+	if first := document.Bookmarks[0]; first.Title != "A" || first.Excerpt != "About a" || !reflect.DeepEqual(first.Tags, storage.Tags{"go", "web dev"}) {
+		t.Fatalf("Unexpected bookmark %#v", first)
+	}
+
+	if second := document.Bookmarks[1]; second.Title != "" || len(second.Tags) != 0 {
+		t.Fatalf("Unexpected bookmark %#v", second)
+	}
+}
@@ -0,0 +1,78 @@
+package importer
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// chromeEpoch is the number of seconds between 1601-01-01, where the timestamps of Chrome start,
+// and the unix epoch
+const chromeEpoch = 11644473600
+
+// chromeNode is a bookmark or folder in the Bookmarks file of Chrome
+type chromeNode struct {
+	Name      string
+	Type      string
+	URL       string
+	DateAdded string `json:"date_added"`
+	Children  []*chromeNode
+}
+
+// parseChrome reads the Bookmarks file of Chrome and Chromium, every folder, including the
+// bookmarks bar and other bookmarks, becomes a tag
+func parseChrome(r io.Reader) (*storage.Document, error) {
+	file := struct {
+		Roots map[string]json.RawMessage
+	}{}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, err
+	}
+
+	set := newBookmarkSet()
+
+	// Roots also holds other values than folders, like sync_transaction_version
+	for _, name := range []string{"bookmark_bar", "other", "synced"} {
+		root := &chromeNode{}
+		if raw, ok := file.Roots[name]; !ok || json.Unmarshal(raw, root) != nil {
+			continue
+		}
+
+		walkChrome(set, root, storage.Tags{})
+	}
+
+	return set.document, nil
+}
+
+func walkChrome(set *bookmarkSet, node *chromeNode, folders storage.Tags) {
+	switch node.Type {
+	case "folder":
+		if node.Name != "" {
+			folders = append(folders[:len(folders):len(folders)], folderTag(node.Name))
+		}
+
+		for _, child := range node.Children {
+			walkChrome(set, child, folders)
+		}
+	case "url":
+		set.add(&storage.Bookmark{
+			URL:     node.URL,
+			Title:   node.Name,
+			Tags:    folders.Merge(nil),
+			Created: chromeTime(node.DateAdded),
+		})
+	}
+}
+
+// chromeTime converts the microseconds since 1601-01-01 that Chrome stores to a time, 0 is no time
+func chromeTime(value string) time.Time {
+	microseconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || microseconds == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(microseconds/1000000-chromeEpoch, microseconds%1000000*1000)
+}
@@ -0,0 +1,44 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestChrome(t *testing.T) {
+	file := `{"checksum": "abc", "version": 1, "roots": {
+		"bookmark_bar": {"name": "Bookmarks bar", "type": "folder", "children": [
+			{"name": "Dev", "type": "folder", "children": [
+				{"name": "A", "type": "url", "url": "https://example.com/a", "date_added": "13244947200000000"}
+			]},
+			{"name": "Script", "type": "url", "url": "javascript:alert(1)"}
+		]},
+		"other": {"name": "Other bookmarks", "type": "folder", "children": [
+			{"name": "A again", "type": "url", "url": "https://example.com/a"},
+			{"name": "B", "type": "url", "url": "https://example.com/b"}
+		]},
+		"synced": {"name": "Mobile bookmarks", "type": "folder", "children": []},
+		"sync_transaction_version": "1"
+	}}`
+
+	document, err := Parse("chrome", strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 2 {
+		t.Fatalf("Expected 2 bookmarks, got %d", len(document.Bookmarks))
+	}
+
+	first := document.Bookmarks[0]
+	if first.Title != "A" || first.Created.Unix() != 1600473600 || !reflect.DeepEqual(first.Tags, storage.Tags{"bookmarks bar", "dev", "other bookmarks"}) {
+		t.Fatalf("Unexpected bookmark %v", first)
+	}
+
+	if !reflect.DeepEqual(document.Bookmarks[1].Tags, storage.Tags{"other bookmarks"}) || !document.Bookmarks[1].Created.IsZero() {
+		t.Fatalf("Unexpected bookmark %v", document.Bookmarks[1])
+	}
+}
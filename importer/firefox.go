@@ -0,0 +1,189 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// firefoxTagsRoot is the guid of the folder in places.sqlite that holds a folder for every tag
+const firefoxTagsRoot = "tags________"
+
+// firefoxRoots are the guids of the built in folders of Firefox, like the bookmarks toolbar, which
+// do not become tags
+var firefoxRoots = map[string]bool{
+	"root________":  true,
+	"menu________":  true,
+	"toolbar_____":  true,
+	"unfiled_____":  true,
+	"mobile______":  true,
+	firefoxTagsRoot: true,
+}
+
+// firefoxNode is a bookmark or folder in the json backup of Firefox
+type firefoxNode struct {
+	GUID      string
+	Title     string
+	Type      string
+	URI       string
+	Keyword   string
+	Tags      string
+	DateAdded int64
+	Children  []*firefoxNode
+}
+
+// parseFirefox reads a json backup of the bookmarks of Firefox or its places.sqlite database.
+// Folders, tags and keywords become tags.
+func parseFirefox(r io.Reader) (*storage.Document, error) {
+	buffered := bufio.NewReader(r)
+	if isSqlite(buffered) {
+		return parseFirefoxPlaces(buffered)
+	}
+
+	root := &firefoxNode{}
+	if err := json.NewDecoder(buffered).Decode(root); err != nil {
+		return nil, err
+	}
+
+	set := newBookmarkSet()
+	walkFirefox(set, root, storage.Tags{})
+
+	return set.document, nil
+}
+
+func walkFirefox(set *bookmarkSet, node *firefoxNode, folders storage.Tags) {
+	switch node.Type {
+	case "text/x-moz-place-container":
+		if !firefoxRoots[node.GUID] && node.Title != "" {
+			folders = append(folders[:len(folders):len(folders)], folderTag(node.Title))
+		}
+
+		for _, child := range node.Children {
+			walkFirefox(set, child, folders)
+		}
+	case "text/x-moz-place":
+		tags := folders.Merge(nil)
+		for _, tag := range strings.Split(node.Tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = tags.Merge(storage.Tags{tag})
+			}
+		}
+		if node.Keyword != "" {
+			tags = tags.Merge(storage.Tags{node.Keyword})
+		}
+
+		set.add(&storage.Bookmark{
+			URL:     node.URI,
+			Title:   node.Title,
+			Tags:    tags,
+			Created: firefoxTime(node.DateAdded),
+		})
+	}
+}
+
+type firefoxPlace struct {
+	parent    int64
+	kind      int
+	title     string
+	guid      string
+	url       string
+	keyword   string
+	dateAdded int64
+}
+
+func parseFirefoxPlaces(r io.Reader) (*storage.Document, error) {
+	db, close, err := openSqlite(r)
+	if err != nil {
+		return nil, err
+	}
+	defer close()
+
+	rows, err := db.Query(`SELECT b.id, b.parent, b.type, COALESCE(b.title, ''), b.guid, COALESCE(p.url, ''), COALESCE(k.keyword, ''), COALESCE(b.dateAdded, 0)
+		FROM moz_bookmarks b
+		LEFT JOIN moz_places p ON p.id = b.fk
+		LEFT JOIN moz_keywords k ON k.place_id = b.fk
+		ORDER BY b.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	places := map[int64]*firefoxPlace{}
+	ids := []int64{}
+
+	for rows.Next() {
+		id := int64(0)
+		place := &firefoxPlace{}
+		if err := rows.Scan(&id, &place.parent, &place.kind, &place.title, &place.guid, &place.url, &place.keyword, &place.dateAdded); err != nil {
+			return nil, err
+		}
+
+		// A url with several keywords is joined once for every keyword
+		if existing, ok := places[id]; ok {
+			existing.keyword += "," + place.keyword
+			continue
+		}
+
+		places[id] = place
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	set := newBookmarkSet()
+	tags := map[string]storage.Tags{}
+
+	for _, id := range ids {
+		place := places[id]
+		if place.kind != 1 {
+			continue
+		}
+
+		// Tags are folders in the tags root, with an entry for every tagged url
+		if parent := places[place.parent]; parent != nil && places[parent.parent] != nil && places[parent.parent].guid == firefoxTagsRoot {
+			tags[place.url] = tags[place.url].Merge(storage.Tags{parent.title})
+			continue
+		}
+
+		folders := storage.Tags{}
+		// A broken database could have folders that contain each other
+		for depth, parent := 0, places[place.parent]; parent != nil && !firefoxRoots[parent.guid] && depth < 100; depth, parent = depth+1, places[parent.parent] {
+			if parent.title != "" {
+				folders = append(storage.Tags{folderTag(parent.title)}, folders...)
+			}
+		}
+
+		for _, keyword := range strings.Split(place.keyword, ",") {
+			if keyword != "" {
+				folders = folders.Merge(storage.Tags{keyword})
+			}
+		}
+
+		set.add(&storage.Bookmark{
+			URL:     place.url,
+			Title:   place.title,
+			Tags:    folders,
+			Created: firefoxTime(place.dateAdded),
+		})
+	}
+
+	for url, bookmark := range set.urls {
+		bookmark.Tags = bookmark.Tags.Merge(tags[url])
+	}
+
+	return set.document, nil
+}
+
+// firefoxTime converts the microseconds since the epoch that Firefox stores to a time, 0 is no time
+func firefoxTime(microseconds int64) time.Time {
+	if microseconds == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, microseconds*int64(time.Microsecond))
+}
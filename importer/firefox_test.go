@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestFirefoxJSON(t *testing.T) {
+	backup := `{"guid": "root________", "type": "text/x-moz-place-container", "children": [
+		{"guid": "toolbar_____", "title": "toolbar", "type": "text/x-moz-place-container", "children": [
+			{"guid": "f1", "title": "Dev Tools", "type": "text/x-moz-place-container", "children": [
+				{"title": "A", "type": "text/x-moz-place", "uri": "https://example.com/a", "tags": "go,web", "keyword": "ex", "dateAdded": 1600000000000000}
+			]},
+			{"title": "Smart", "type": "text/x-moz-place", "uri": "place:sort=8"},
+			{"type": "text/x-moz-place-separator"}
+		]},
+		{"guid": "menu________", "title": "menu", "type": "text/x-moz-place-container", "children": [
+			{"title": "A again", "type": "text/x-moz-place", "uri": "https://example.com/a"}
+		]}
+	]}`
+
+	document, err := Parse("firefox", strings.NewReader(backup))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 1 {
+		t.Fatalf("Expected 1 bookmark, got %d", len(document.Bookmarks))
+	}
+
+	bookmark := document.Bookmarks[0]
+	if bookmark.Title != "A" || bookmark.Created.Unix() != 1600000000 || !reflect.DeepEqual(bookmark.Tags, storage.Tags{"dev tools", "go", "web", "ex"}) {
+		t.Fatalf("Unexpected bookmark %v", bookmark)
+	}
+}
+
+func TestFirefoxPlaces(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "places.sqlite")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		"CREATE TABLE moz_places (id INTEGER PRIMARY KEY, url TEXT)",
+		"CREATE TABLE moz_keywords (id INTEGER PRIMARY KEY, keyword TEXT, place_id INTEGER)",
+		"CREATE TABLE moz_bookmarks (id INTEGER PRIMARY KEY, type INTEGER, fk INTEGER, parent INTEGER, title TEXT, dateAdded INTEGER, guid TEXT)",
+		"INSERT INTO moz_places VALUES (1, 'https://example.com/a'), (2, 'place:sort=8')",
+		"INSERT INTO moz_keywords VALUES (1, 'ex', 1)",
+		`INSERT INTO moz_bookmarks VALUES
+			(1, 2, NULL, 0, '', 0, 'root________'),
+			(2, 2, NULL, 1, 'toolbar', 0, 'toolbar_____'),
+			(3, 2, NULL, 1, 'tags', 0, 'tags________'),
+			(4, 2, NULL, 2, 'Dev Tools', 0, 'folder000001'),
+			(5, 1, 1, 4, 'A', 1600000000000000, 'bookmark0001'),
+			(6, 2, NULL, 3, 'go', 0, 'tagfolder001'),
+			(7, 1, 1, 6, NULL, 0, 'tagentry0001'),
+			(8, 1, 2, 2, 'Smart', 0, 'smart0000001')`,
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	places, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := Parse("firefox", bytes.NewReader(places))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 1 {
+		t.Fatalf("Expected 1 bookmark, got %d", len(document.Bookmarks))
+	}
+
+	bookmark := document.Bookmarks[0]
+	if bookmark.Title != "A" || bookmark.Created.Unix() != 1600000000 || !reflect.DeepEqual(bookmark.Tags, storage.Tags{"dev tools", "ex", "go"}) {
+		t.Fatalf("Unexpected bookmark %v", bookmark)
+	}
+}
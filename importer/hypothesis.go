@@ -0,0 +1,177 @@
+// Package importer turns the exports and apis of other applications into documents that can be
+// imported into the store
+package importer
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+const (
+	// HypothesisTag tags the bookmarks and thoughts imported from Hypothes.is
+	HypothesisTag = "hypothesis"
+
+	// hypothesisPageSize is the maximum number of annotations the search api returns at once
+	hypothesisPageSize = 200
+)
+
+// Hypothesis imports the annotations of a Hypothes.is user, every annotated page becomes a bookmark
+// and every annotation a thought with the highlighted text, the note and the url of the page
+type Hypothesis struct {
+	user    string
+	token   string
+	client  *http.Client
+	baseURL string
+}
+
+// NewHypothesis creates an importer for user, like acct:alice@hypothes.is or just alice. The
+// developer token of the user gives access to private annotations and may be empty.
+func NewHypothesis(user, token string) *Hypothesis {
+	if !strings.HasPrefix(user, "acct:") {
+		user = "acct:" + user + "@hypothes.is"
+	}
+
+	return &Hypothesis{
+		user:    user,
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: "https://api.hypothes.is",
+	}
+}
+
+type annotation struct {
+	ID       string
+	Created  time.Time
+	URI      string
+	Text     string
+	Tags     storage.Tags
+	Document struct {
+		Title []string
+	}
+	Target []struct {
+		Selector []struct {
+			Type  string
+			Exact string
+		}
+	}
+}
+
+// quote returns the highlighted text of the annotation, page notes have none
+func (annotation *annotation) quote() string {
+	for _, target := range annotation.Target {
+		for _, selector := range target.Selector {
+			if selector.Type == "TextQuoteSelector" {
+				return selector.Exact
+			}
+		}
+	}
+
+	return ""
+}
+
+// Document fetches all annotations of the user, oldest first
+func (importer *Hypothesis) Document(ctx context.Context) (*storage.Document, error) {
+	document := &storage.Document{}
+	bookmarks := map[string]*storage.Bookmark{}
+	after := ""
+
+	for {
+		annotations, err := importer.search(ctx, after)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, annotation := range annotations {
+			after = annotation.Created.Format(time.RFC3339Nano)
+
+			parsed, err := url.Parse(annotation.URI)
+			if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+				// Annotations on local files and pdfs cannot be bookmarked
+				continue
+			}
+
+			tags := storage.Tags{HypothesisTag}.Merge(annotation.Tags)
+
+			bookmark, ok := bookmarks[annotation.URI]
+			if !ok {
+				bookmark = &storage.Bookmark{URL: annotation.URI, Title: annotation.URI, Created: annotation.Created}
+				if len(annotation.Document.Title) != 0 {
+					bookmark.Title = annotation.Document.Title[0]
+				}
+				bookmarks[annotation.URI] = bookmark
+				document.Bookmarks = append(document.Bookmarks, bookmark)
+			}
+			bookmark.Tags = bookmark.Tags.Merge(tags)
+
+			content := []string{}
+			if quote := annotation.quote(); quote != "" {
+				content = append(content, "> "+strings.ReplaceAll(quote, "\n", "\n> "))
+			}
+			if annotation.Text != "" {
+				content = append(content, annotation.Text)
+			}
+			content = append(content, annotation.URI)
+
+			document.Thoughts = append(document.Thoughts, &storage.Thought{
+				// The same annotation always gets the same ID, so importing again finds it
+				ID:      fmt.Sprintf("%x", sha1.Sum([]byte(HypothesisTag+":"+annotation.ID)))[:16],
+				Created: annotation.Created,
+				Content: strings.Join(content, "\n\n"),
+				Tags:    tags,
+			})
+		}
+
+		if len(annotations) < hypothesisPageSize {
+			return document, nil
+		}
+	}
+}
+
+// search fetches a page of annotations created after the given time
+func (importer *Hypothesis) search(ctx context.Context, after string) ([]*annotation, error) {
+	query := url.Values{
+		"user":  {importer.user},
+		"limit": {fmt.Sprint(hypothesisPageSize)},
+		"sort":  {"created"},
+		"order": {"asc"},
+	}
+	if after != "" {
+		query.Set("search_after", after)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", importer.baseURL+"/api/search?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if importer.token != "" {
+		request.Header.Set("Authorization", "Bearer "+importer.token)
+	}
+
+	response, err := importer.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return nil, fmt.Errorf("Error searching Hypothes.is annotations: %s", response.Status)
+	}
+
+	result := struct {
+		Rows []*annotation
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result.Rows, nil
+}
@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestHypothesis(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("user") != "acct:alice@hypothes.is" || r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(401)
+			return
+		}
+
+		w.Write([]byte(`{"total": 3, "rows": [
+			{"id": "a1", "created": "2021-01-01T10:00:00+00:00", "uri": "https://example.com/a", "text": "Agreed", "tags": ["Go"],
+			 "document": {"title": ["Example"]}, "target": [{"selector": [{"type": "TextQuoteSelector", "exact": "Hello\nworld"}]}]},
+			{"id": "a2", "created": "2021-01-02T10:00:00+00:00", "uri": "https://example.com/a", "text": "Page note", "tags": ["web"], "target": [{}]},
+			{"id": "a3", "created": "2021-01-03T10:00:00+00:00", "uri": "urn:x-pdf:abc", "text": "In a pdf"}
+		]}`))
+	}))
+	defer server.Close()
+
+	importer := NewHypothesis("alice", "token")
+	importer.baseURL = server.URL
+
+	document, err := importer.Document(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 1 || document.Bookmarks[0].Title != "Example" || !reflect.DeepEqual(document.Bookmarks[0].Tags, storage.Tags{HypothesisTag, "Go", "web"}) {
+		t.Fatalf("Expected a single bookmark for the annotated page, got %v", document.Bookmarks)
+	}
+
+	if len(document.Thoughts) != 2 || document.Thoughts[0].Content != "> Hello\n> world\n\nAgreed\n\nhttps://example.com/a" || len(document.Thoughts[0].ID) != 16 {
+		t.Fatalf("Expected a thought for every annotation, got %v", document.Thoughts)
+	}
+
+	again, _ := importer.Document(context.Background())
+	if again.Thoughts[0].ID != document.Thoughts[0].ID {
+		t.Fatal("Expected the same annotation to get the same ID")
+	}
+
+	importer.token = ""
+	if _, err := importer.Document(context.Background()); err == nil {
+		t.Fatal("Expected an error when Hypothes.is refuses the request")
+	}
+}
@@ -0,0 +1,143 @@
+package importer
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nrocco/bookmarks/storage"
+
+	// Some applications store their bookmarks in a sqlite database
+	_ "modernc.org/sqlite"
+)
+
+// ErrUnknownFormat is returned if a document is parsed in a format that is not supported
+var ErrUnknownFormat = errors.New("Unknown import format")
+
+// parsers maps the name of every supported format to the function that parses it
+var parsers = map[string]func(r io.Reader) (*storage.Document, error){
+	"json":       parseJSON,
+	"instapaper": parseInstapaper,
+	"firefox":    parseFirefox,
+	"chrome":     parseChrome,
+	"netscape":   parseNetscape,
+	"shiori":     parseShiori,
+	"buku":       parseBuku,
+	"omnivore":   parseOmnivore,
+}
+
+// Formats lists the names of the supported formats
+func Formats() []string {
+	formats := []string{}
+	for format := range parsers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// Parse reads a document in the given format, an empty format is the json of an export
+func Parse(format string, r io.Reader) (*storage.Document, error) {
+	if format == "" {
+		format = "json"
+	}
+
+	parser, ok := parsers[format]
+	if !ok {
+		return nil, fmt.Errorf("%w %s, use one of %s", ErrUnknownFormat, format, strings.Join(Formats(), ", "))
+	}
+
+	return parser(r)
+}
+
+func parseJSON(r io.Reader) (*storage.Document, error) {
+	document := &storage.Document{}
+	if err := json.NewDecoder(r).Decode(document); err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// bookmarkSet collects the bookmarks of a document by url, so a url that appears in several folders
+// becomes a single bookmark with the tags of all of them
+type bookmarkSet struct {
+	document *storage.Document
+	urls     map[string]*storage.Bookmark
+}
+
+func newBookmarkSet() *bookmarkSet {
+	return &bookmarkSet{&storage.Document{}, map[string]*storage.Bookmark{}}
+}
+
+// add adds a bookmark or merges its tags with the bookmark of the same url, only http and https
+// urls are added
+func (set *bookmarkSet) add(bookmark *storage.Bookmark) {
+	if parsed, err := url.Parse(bookmark.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return
+	}
+
+	if existing, ok := set.urls[bookmark.URL]; ok {
+		existing.Tags = existing.Tags.Merge(bookmark.Tags)
+		return
+	}
+
+	if bookmark.Tags == nil {
+		bookmark.Tags = storage.Tags{}
+	}
+
+	set.urls[bookmark.URL] = bookmark
+	set.document.Bookmarks = append(set.document.Bookmarks, bookmark)
+}
+
+// folderTag turns the name of a folder into a tag
+func folderTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// isSqlite checks if r starts like a sqlite database, without consuming it
+func isSqlite(r *bufio.Reader) bool {
+	header, _ := r.Peek(16)
+
+	return string(header) == "SQLite format 3\x00"
+}
+
+// openSqlite copies the sqlite database in r to a temporary file and opens it read only, the
+// returned function closes the database and removes the file again
+func openSqlite(r io.Reader) (*sql.DB, func(), error) {
+	file, err := ioutil.TempFile("", "import-*.sqlite")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+file.Name()+"?mode=ro")
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, nil, err
+	}
+
+	return db, func() {
+		db.Close()
+		os.Remove(file.Name())
+	}, nil
+}
@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// instapaperFolders maps the built in folders of Instapaper to tags, other folders become a tag
+// with their name
+var instapaperFolders = map[string]string{
+	"Unread":  capture.ReadItLater,
+	"Archive": capture.Archived,
+	"Starred": "starred",
+}
+
+// parseInstapaper reads the csv export of Instapaper, which has the columns URL, Title, Selection,
+// Folder, Timestamp and in newer exports Tags
+func parseInstapaper(r io.Reader) (*storage.Document, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	if _, ok := columns["URL"]; !ok {
+		return nil, errors.New("Missing URL column in Instapaper export")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	document := &storage.Document{}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return document, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		bookmark := &storage.Bookmark{
+			URL:     field(record, "URL"),
+			Title:   field(record, "Title"),
+			Excerpt: field(record, "Selection"),
+			Tags:    storage.Tags{},
+		}
+
+		if bookmark.URL == "" {
+			continue
+		}
+
+		if folder := field(record, "Folder"); instapaperFolders[folder] != "" {
+			bookmark.Tags = append(bookmark.Tags, instapaperFolders[folder])
+		} else if folder != "" {
+			bookmark.Tags = append(bookmark.Tags, strings.ToLower(folder))
+		}
+
+		// Tags are exported as a json list, like ["go","web"]
+		tags := storage.Tags{}
+		if err := json.Unmarshal([]byte(field(record, "Tags")), &tags); err == nil {
+			bookmark.Tags = bookmark.Tags.Merge(tags)
+		}
+
+		if timestamp, err := strconv.ParseInt(field(record, "Timestamp"), 10, 64); err == nil {
+			bookmark.Created = time.Unix(timestamp, 0)
+		}
+
+		document.Bookmarks = append(document.Bookmarks, bookmark)
+	}
+}
@@ -0,0 +1,46 @@
+package importer
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestInstapaper(t *testing.T) {
+	export := `URL,Title,Selection,Folder,Timestamp,Tags
+https://example.com/a,A,"Quoted, text",Unread,1600000000,"[""go""]"
+https://example.com/b,B,,Archive,1600000001,[]
+https://example.com/c,C,,Tech News,1600000002
+,Empty,,Unread,1600000003
+`
+
+	document, err := Parse("instapaper", strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 3 {
+		t.Fatalf("Expected 3 bookmarks, got %d", len(document.Bookmarks))
+	}
+
+	first := document.Bookmarks[0]
+	if first.Excerpt != "Quoted, text" || first.Created.Unix() != 1600000000 || !reflect.DeepEqual(first.Tags, storage.Tags{capture.ReadItLater, "go"}) {
+		t.Fatalf("Unexpected bookmark %v", first)
+	}
+
+	if !reflect.DeepEqual(document.Bookmarks[1].Tags, storage.Tags{capture.Archived}) || !reflect.DeepEqual(document.Bookmarks[2].Tags, storage.Tags{"tech news"}) {
+		t.Fatalf("Expected folders to become tags, got %v and %v", document.Bookmarks[1].Tags, document.Bookmarks[2].Tags)
+	}
+
+	if _, err := Parse("instapaper", strings.NewReader("Title\nA\n")); err == nil {
+		t.Fatal("Expected an error for an export without urls")
+	}
+
+	if _, err := Parse("unknown", strings.NewReader("")); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
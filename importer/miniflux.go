@@ -0,0 +1,188 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+const (
+	// minifluxPageSize is the number of entries requested from Miniflux at once
+	minifluxPageSize = 100
+
+	// minifluxDefaultCategory is the category Miniflux puts feeds in that were not categorized
+	minifluxDefaultCategory = "All"
+)
+
+// Miniflux imports the feeds of a Miniflux instance with their reading history. Every feed keeps its
+// unread entries as items, read entries are left out like items that were read here, and starred
+// entries become bookmarks tagged starred.
+type Miniflux struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewMiniflux creates an importer for the Miniflux instance at baseURL, token is an api key created
+// in its settings
+func NewMiniflux(baseURL, token string) *Miniflux {
+	return &Miniflux{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type minifluxFeed struct {
+	ID       int64
+	Title    string
+	FeedURL  string `json:"feed_url"`
+	Category struct {
+		Title string
+	}
+}
+
+type minifluxEntry struct {
+	ID          int64
+	FeedID      int64 `json:"feed_id"`
+	Title       string
+	URL         string
+	Content     string
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Document fetches all feeds, their unread entries and the starred entries
+func (importer *Miniflux) Document(ctx context.Context) (*storage.Document, error) {
+	minifluxFeeds := []*minifluxFeed{}
+	if err := importer.get(ctx, "/v1/feeds", &minifluxFeeds); err != nil {
+		return nil, err
+	}
+
+	// Entries that were published before the import were read or are kept as items already, so
+	// refreshing the feed must only add newer entries
+	refreshed := time.Now()
+
+	document := &storage.Document{}
+	feeds := map[int64]*storage.Feed{}
+
+	for _, minifluxFeed := range minifluxFeeds {
+		feed := &storage.Feed{
+			Title:     minifluxFeed.Title,
+			URL:       minifluxFeed.FeedURL,
+			Refreshed: refreshed,
+			Tags:      storage.Tags{},
+			Items:     storage.FeedItems{},
+		}
+		if category := minifluxFeed.Category.Title; category != "" && category != minifluxDefaultCategory {
+			feed.Tags = storage.Tags{folderTag(category)}
+		}
+
+		feeds[minifluxFeed.ID] = feed
+		document.Feeds = append(document.Feeds, feed)
+	}
+
+	textCleaner := bluemonday.StrictPolicy()
+
+	unread, err := importer.entries(ctx, url.Values{"status": {"unread"}})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range unread {
+		feed, ok := feeds[entry.FeedID]
+		if !ok {
+			continue
+		}
+
+		feed.Items = append(feed.Items, &storage.FeedItem{
+			// The same entry always gets the same ID, so importing again with the merge strategy finds it
+			ID:      fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("miniflux:%s:%d", feed.URL, entry.ID))))[:16],
+			Created: refreshed,
+			Updated: refreshed,
+			Title:   entry.Title,
+			Date:    entry.PublishedAt,
+			URL:     entry.URL,
+			Content: textCleaner.Sanitize(entry.Content),
+		})
+	}
+
+	starred, err := importer.entries(ctx, url.Values{"starred": {"true"}})
+	if err != nil {
+		return nil, err
+	}
+
+	set := newBookmarkSet()
+	for _, entry := range starred {
+		tags := storage.Tags{"starred"}
+		if feed, ok := feeds[entry.FeedID]; ok {
+			tags = tags.Merge(feed.Tags)
+		}
+
+		set.add(&storage.Bookmark{
+			URL:     entry.URL,
+			Title:   entry.Title,
+			Created: entry.PublishedAt,
+			Tags:    tags,
+		})
+	}
+	document.Bookmarks = set.document.Bookmarks
+
+	return document, nil
+}
+
+// entries fetches all entries matching the query, newest first
+func (importer *Miniflux) entries(ctx context.Context, query url.Values) ([]*minifluxEntry, error) {
+	entries := []*minifluxEntry{}
+
+	query.Set("order", "published_at")
+	query.Set("direction", "desc")
+	query.Set("limit", fmt.Sprint(minifluxPageSize))
+
+	for {
+		query.Set("offset", fmt.Sprint(len(entries)))
+
+		page := struct {
+			Total   int
+			Entries []*minifluxEntry
+		}{}
+		if err := importer.get(ctx, "/v1/entries?"+query.Encode(), &page); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, page.Entries...)
+
+		if len(page.Entries) < minifluxPageSize || len(entries) >= page.Total {
+			return entries, nil
+		}
+	}
+}
+
+// get decodes the json response of the api at path into v
+func (importer *Miniflux) get(ctx context.Context, path string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", importer.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	request.Header.Set("X-Auth-Token", importer.token)
+
+	response, err := importer.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		return fmt.Errorf("Error calling Miniflux %s: %s", strings.SplitN(path, "?", 2)[0], response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
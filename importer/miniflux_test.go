@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestMiniflux(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Auth-Token") != "token" {
+			w.WriteHeader(401)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v1/feeds":
+			w.Write([]byte(`[
+				{"id": 1, "title": "Go blog", "feed_url": "https://go.dev/blog/feed.atom", "category": {"title": "Programming"}},
+				{"id": 2, "title": "News", "feed_url": "https://example.com/rss", "category": {"title": "All"}}
+			]`))
+		case r.URL.Query().Get("status") == "unread":
+			w.Write([]byte(`{"total": 1, "entries": [
+				{"id": 10, "feed_id": 1, "title": "Generics", "url": "https://go.dev/blog/generics", "content": "<p>Hello</p>", "published_at": "2021-01-01T10:00:00Z"}
+			]}`))
+		case r.URL.Query().Get("starred") == "true":
+			w.Write([]byte(`{"total": 2, "entries": [
+				{"id": 11, "feed_id": 1, "title": "Modules", "url": "https://go.dev/blog/modules", "published_at": "2020-01-01T10:00:00Z"},
+				{"id": 12, "feed_id": 2, "title": "Local", "url": "file:///tmp/x", "published_at": "2020-01-01T10:00:00Z"}
+			]}`))
+		default:
+			w.WriteHeader(400)
+		}
+	}))
+	defer server.Close()
+
+	document, err := NewMiniflux(server.URL+"/", "token").Document(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Feeds) != 2 || !reflect.DeepEqual(document.Feeds[0].Tags, storage.Tags{"programming"}) || len(document.Feeds[1].Tags) != 0 {
+		t.Fatalf("Expected 2 feeds tagged with their category, got %v", document.Feeds)
+	}
+
+	if document.Feeds[0].Refreshed.Before(time.Now().Add(-time.Minute)) {
+		t.Fatal("Expected the feeds to be refreshed, so entries that were read are not fetched again")
+	}
+
+	if items := document.Feeds[0].Items; len(items) != 1 || items[0].Content != "Hello" || len(items[0].ID) != 16 || len(document.Feeds[1].Items) != 0 {
+		t.Fatalf("Expected the unread entry as an item, got %v", items)
+	}
+
+	if len(document.Bookmarks) != 1 || document.Bookmarks[0].Title != "Modules" || !reflect.DeepEqual(document.Bookmarks[0].Tags, storage.Tags{"starred", "programming"}) {
+		t.Fatalf("Expected the starred entry as a bookmark, got %v", document.Bookmarks)
+	}
+
+	if _, err := NewMiniflux(server.URL, "wrong").Document(context.Background()); err == nil {
+		t.Fatal("Expected an error when Miniflux refuses the request")
+	}
+}
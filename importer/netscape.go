@@ -0,0 +1,54 @@
+package importer
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// parseNetscape reads a Netscape bookmark file, the html format that browsers and most bookmark
+// managers export, like Shiori does. Folders and the TAGS attribute become tags.
+func parseNetscape(r io.Reader) (*storage.Document, error) {
+	document, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	set := newBookmarkSet()
+
+	document.Find("a[href]").Each(func(_ int, link *goquery.Selection) {
+		tags := storage.Tags{}
+
+		// A folder is a H3 with its name followed by a DL with its bookmarks, the closest folder comes first
+		link.ParentsFiltered("dl").Each(func(_ int, list *goquery.Selection) {
+			if name := list.PrevFiltered("h3"); name.Length() != 0 {
+				tags = append(storage.Tags{folderTag(name.Text())}, tags...)
+			}
+		})
+
+		for _, tag := range strings.Split(link.AttrOr("tags", ""), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = tags.Merge(storage.Tags{tag})
+			}
+		}
+
+		bookmark := &storage.Bookmark{
+			URL:     link.AttrOr("href", ""),
+			Title:   strings.TrimSpace(link.Text()),
+			Excerpt: strings.TrimSpace(link.Parent().NextFiltered("dd").Text()),
+			Tags:    tags,
+		}
+
+		if added, err := strconv.ParseInt(link.AttrOr("add_date", ""), 10, 64); err == nil && added > 0 {
+			bookmark.Created = time.Unix(added, 0)
+		}
+
+		set.add(bookmark)
+	})
+
+	return set.document, nil
+}
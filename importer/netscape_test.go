@@ -0,0 +1,48 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestNetscape(t *testing.T) {
+	file := `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3 ADD_DATE="1600000000">Dev</H3>
+    <DL><p>
+        <DT><H3>Go</H3>
+        <DL><p>
+            <DT><A HREF="https://example.com/a" ADD_DATE="1600000000" TAGS="web,Lang">A &amp; B</A>
+            <DD>About a
+        </DL><p>
+    </DL><p>
+    <DT><A HREF="https://example.com/b">B</A>
+    <DT><A HREF="javascript:void(0)">Script</A>
+</DL><p>
+`
+
+	document, err := Parse("netscape", strings.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 2 {
+		t.Fatalf("Expected 2 bookmarks, got %d", len(document.Bookmarks))
+	}
+
+	first := document.Bookmarks[0]
+	if first.Title != "A & B" || first.Excerpt != "About a" || first.Created.Unix() != 1600000000 || !reflect.DeepEqual(first.Tags, storage.Tags{"dev", "go", "web", "Lang"}) {
+		t.Fatalf("Unexpected bookmark %#v", first)
+	}
+
+	second := document.Bookmarks[1]
+	if second.Excerpt != "" || len(second.Tags) != 0 || !second.Created.IsZero() {
+		t.Fatalf("Unexpected bookmark %#v", second)
+	}
+}
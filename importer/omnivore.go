@@ -0,0 +1,170 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-shiori/go-readability"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// OmnivoreStartedTag tags the bookmarks that were partly read in Omnivore
+const OmnivoreStartedTag = "started"
+
+type omnivoreItem struct {
+	ID              string
+	Slug            string
+	Title           string
+	Description     string
+	URL             string
+	State           string
+	ReadingProgress float64
+	Labels          []string
+	SavedAt         time.Time
+}
+
+// omnivoreLink is the link back to a highlight in Omnivore that ends every quote in the export
+var omnivoreLink = regexp.MustCompile(`\s*\[⤴️\]\([^)]*\)\s*$`)
+
+// parseOmnivore reads the zip archive Omnivore exports, with the items in metadata_*.json files,
+// their content in content/<slug>.html and their highlights in highlights/<slug>.md. Archived and
+// fully read items are tagged archived, the others read-it-later and started if they were partly
+// read. Every highlight becomes a thought with its note and the url of the item.
+func parseOmnivore(r io.Reader) (*storage.Document, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*zip.File{}
+	items := []*omnivoreItem{}
+
+	for _, file := range archive.File {
+		files[file.Name] = file
+
+		if matched, _ := path.Match("metadata_*.json", path.Base(file.Name)); !matched {
+			continue
+		}
+
+		metadata := []*omnivoreItem{}
+		if err := readZipFile(file, func(r io.Reader) error { return json.NewDecoder(r).Decode(&metadata) }); err != nil {
+			return nil, fmt.Errorf("Error reading %s: %w", file.Name, err)
+		}
+
+		items = append(items, metadata...)
+	}
+
+	set := newBookmarkSet()
+
+	for _, item := range items {
+		if item.State == "Deleted" {
+			continue
+		}
+
+		labels := storage.Tags{}
+		for _, label := range item.Labels {
+			labels = append(labels, folderTag(label))
+		}
+
+		bookmark := &storage.Bookmark{
+			URL:     item.URL,
+			Title:   item.Title,
+			Excerpt: item.Description,
+			Created: item.SavedAt,
+			Tags:    append(storage.Tags{}, labels...),
+		}
+
+		if item.State == "Archived" || item.ReadingProgress >= 100 {
+			bookmark.Tags = append(bookmark.Tags, capture.Archived)
+		} else {
+			bookmark.Tags = append(bookmark.Tags, capture.ReadItLater)
+			if item.ReadingProgress > 0 {
+				bookmark.Tags = append(bookmark.Tags, OmnivoreStartedTag)
+			}
+		}
+
+		if file, ok := files["content/"+item.Slug+".html"]; ok {
+			pageURL, _ := url.Parse(item.URL)
+			readZipFile(file, func(r io.Reader) error {
+				article, err := readability.FromReader(r, pageURL)
+				if err == nil {
+					bookmark.Content = article.TextContent
+				}
+				return err
+			})
+		}
+
+		set.add(bookmark)
+
+		file, ok := files["highlights/"+item.Slug+".md"]
+		if !ok {
+			continue
+		}
+
+		highlights := ""
+		readZipFile(file, func(r io.Reader) error {
+			content, err := ioutil.ReadAll(r)
+			highlights = string(content)
+			return err
+		})
+
+		for i, highlight := range omnivoreHighlights(highlights) {
+			set.document.Thoughts = append(set.document.Thoughts, &storage.Thought{
+				// The same highlight always gets the same ID, so importing again finds it
+				ID:      fmt.Sprintf("%x", sha1.Sum([]byte(fmt.Sprintf("omnivore:%s:%d", item.ID, i))))[:16],
+				Created: item.SavedAt,
+				Content: highlight + "\n\n" + item.URL,
+				Tags:    labels,
+			})
+		}
+	}
+
+	return set.document, nil
+}
+
+// omnivoreHighlights splits the markdown of the highlights of an item into quotes, each followed by
+// its note
+func omnivoreHighlights(markdown string) []string {
+	highlights := []string{}
+
+	for _, block := range strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n\n") {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+
+		if strings.HasPrefix(block, ">") {
+			highlights = append(highlights, omnivoreLink.ReplaceAllString(block, ""))
+		} else if len(highlights) != 0 {
+			highlights[len(highlights)-1] += "\n\n" + block
+		}
+	}
+
+	return highlights
+}
+
+func readZipFile(file *zip.File, read func(r io.Reader) error) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return read(reader)
+}
@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestOmnivore(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	archive := zip.NewWriter(buffer)
+
+	for name, content := range map[string]string{
+		"metadata_0_to_2.json": `[
+			{"id": "1", "slug": "a", "title": "A", "description": "About a", "url": "https://example.com/a", "state": "Succeeded", "readingProgress": 40, "labels": ["Go", "Web Dev"], "savedAt": "2024-01-02T03:04:05.000Z"},
+			{"id": "2", "slug": "b", "title": "B", "url": "https://example.com/b", "state": "Archived", "readingProgress": 0, "labels": [], "savedAt": "2024-01-03T03:04:05.000Z"},
+			{"id": "3", "slug": "c", "title": "C", "url": "https://example.com/c", "state": "Deleted", "labels": [], "savedAt": "2024-01-04T03:04:05.000Z"}
+		]`,
+		"content/a.html":  `<html><head><title>A</title></head><body><article><p>The content of a, which is long enough to be the article of the page.</p></article></body></html>`,
+		"highlights/a.md": "> First quote\n> on two lines [⤴️](https://omnivore.app/me/a#1)\n\nMy note\n\n> Second quote [⤴️](https://omnivore.app/me/a#2)",
+	} {
+		file, _ := archive.Create(name)
+		file.Write([]byte(content))
+	}
+	archive.Close()
+
+	document, err := Parse("omnivore", buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 2 {
+		t.Fatalf("Expected 2 bookmarks without the deleted one, got %d", len(document.Bookmarks))
+	}
+
+	a, b := document.Bookmarks[0], document.Bookmarks[1]
+
+	if a.Title != "A" || a.Excerpt != "About a" || a.Created.Format("2006-01-02") != "2024-01-02" || !strings.Contains(a.Content, "The content of a") {
+		t.Fatalf("Unexpected bookmark %+v", a)
+	}
+
+	if !reflect.DeepEqual(a.Tags, storage.Tags{"go", "web dev", "read-it-later", "started"}) {
+		t.Fatalf("Expected the labels and reading progress as tags, got %v", a.Tags)
+	}
+
+	if !reflect.DeepEqual(b.Tags, storage.Tags{"archived"}) {
+		t.Fatalf("Expected the archived bookmark to be tagged archived, got %v", b.Tags)
+	}
+
+	if len(document.Thoughts) != 2 {
+		t.Fatalf("Expected 2 thoughts, got %d", len(document.Thoughts))
+	}
+
+	if content := document.Thoughts[0].Content; content != "> First quote\n> on two lines\n\nMy note\n\nhttps://example.com/a" {
+		t.Fatalf("Unexpected thought %q", content)
+	}
+
+	if !reflect.DeepEqual(document.Thoughts[1].Tags, storage.Tags{"go", "web dev"}) || document.Thoughts[0].ID == document.Thoughts[1].ID {
+		t.Fatalf("Expected thoughts with their own ID tagged with the labels, got %v", document.Thoughts[1].Tags)
+	}
+}
@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// parseShiori reads the sqlite database of Shiori, usually shiori.db, including the content Shiori
+// archived. Shiori databases in MySQL or PostgreSQL can be moved with its Netscape export instead.
+func parseShiori(r io.Reader) (*storage.Document, error) {
+	db, close, err := openSqlite(r)
+	if err != nil {
+		return nil, err
+	}
+	defer close()
+
+	// Tag names are joined with the unit separator, which cannot be part of a name
+	rows, err := db.Query(`SELECT b.url, COALESCE(b.title, ''), COALESCE(b.excerpt, ''), COALESCE(b.content, ''), COALESCE(b.modified, ''), COALESCE(group_concat(t.name, char(31)), '')
+		FROM bookmark b
+		LEFT JOIN bookmark_tag bt ON bt.bookmark_id = b.id
+		LEFT JOIN tag t ON t.id = bt.tag_id
+		GROUP BY b.id
+		ORDER BY b.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	set := newBookmarkSet()
+
+	for rows.Next() {
+		bookmark := &storage.Bookmark{Tags: storage.Tags{}}
+		modified, tags := "", ""
+
+		if err := rows.Scan(&bookmark.URL, &bookmark.Title, &bookmark.Excerpt, &bookmark.Content, &modified, &tags); err != nil {
+			return nil, err
+		}
+
+		for _, tag := range strings.Split(tags, "\x1f") {
+			if tag != "" {
+				bookmark.Tags = append(bookmark.Tags, tag)
+			}
+		}
+
+		// Shiori only keeps the time a bookmark was last modified
+		if created, err := time.Parse("2006-01-02 15:04:05", modified); err == nil {
+			bookmark.Created = created
+		}
+
+		set.add(bookmark)
+	}
+
+	return set.document, rows.Err()
+}
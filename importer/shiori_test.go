@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestShiori(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	path := filepath.Join(tmpDir, "shiori.db")
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, statement := range []string{
+		"CREATE TABLE bookmark (id INTEGER PRIMARY KEY, url TEXT, title TEXT, excerpt TEXT, author TEXT, public INTEGER, content TEXT, html TEXT, modified TEXT)",
+		"CREATE TABLE tag (id INTEGER PRIMARY KEY, name TEXT)",
+		"CREATE TABLE bookmark_tag (bookmark_id INTEGER, tag_id INTEGER)",
+		"INSERT INTO bookmark VALUES (1, 'https://example.com/a', 'A', 'About a', '', 0, 'Everything', '', '2020-09-13 12:26:40'), (2, 'https://example.com/b', 'B', NULL, NULL, 0, NULL, NULL, NULL)",
+		"INSERT INTO tag VALUES (1, 'go'), (2, 'web, and more')",
+		"INSERT INTO bookmark_tag VALUES (1, 1), (1, 2)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	database, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document, err := Parse("shiori", bytes.NewReader(database))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 2 {
+		t.Fatalf("Expected 2 bookmarks, got %d", len(document.Bookmarks))
+	}
+
+	first := document.Bookmarks[0]
+	if first.Content != "Everything" || first.Excerpt != "About a" || first.Created.Unix() != 1600000000 || !reflect.DeepEqual(first.Tags, storage.Tags{"go", "web, and more"}) {
+		t.Fatalf("Unexpected bookmark %#v", first)
+	}
+
+	if second := document.Bookmarks[1]; second.Content != "" || len(second.Tags) != 0 {
+		t.Fatalf("Unexpected bookmark %#v", second)
+	}
+}
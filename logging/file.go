@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File is a log file that is rotated once it grows larger than its maximum size. The rotated files
+// are kept next to it with the suffix .1 for the most recent one up to .N for the oldest one.
+type File struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+// OpenFile opens the log file at path for appending, a maxSize of 0 disables rotation and backups
+// is the number of rotated files to keep
+func OpenFile(path string, maxSize int64, backups int) (*File, error) {
+	file := &File{path: path, maxSize: maxSize, backups: backups}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (file *File) open() error {
+	f, err := os.OpenFile(file.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	file.file = f
+	file.size = info.Size()
+
+	return nil
+}
+
+// Write appends p to the log file, after rotating it if p would make it too large
+func (file *File) Write(p []byte) (int, error) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	if file.maxSize > 0 && file.size > 0 && file.size+int64(len(p)) > file.maxSize {
+		if err := file.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := file.file.Write(p)
+	file.size += int64(n)
+
+	return n, err
+}
+
+// rotate moves every rotated file one suffix up, dropping the oldest one, and starts a new log file
+func (file *File) rotate() error {
+	if err := file.file.Close(); err != nil {
+		return err
+	}
+
+	if file.backups == 0 {
+		os.Remove(file.path)
+	}
+
+	for i := file.backups; i > 0; i-- {
+		from := file.path
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", file.path, i-1)
+		}
+
+		if err := os.Rename(from, fmt.Sprintf("%s.%d", file.path, i)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return file.open()
+}
+
+// Close closes the log file
+func (file *File) Close() error {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	return file.file.Close()
+}
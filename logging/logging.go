@@ -0,0 +1,103 @@
+// Package logging switches the level and format of the logs while bookmarks runs, and writes them
+// to a file that is rotated once it grows too large
+package logging
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// FormatJSON logs a json object per line
+	FormatJSON = "json"
+
+	// FormatConsole logs a human readable line per message
+	FormatConsole = "console"
+)
+
+var (
+	// ErrInvalidLevel is returned for a level that is not debug, info, warn or error
+	ErrInvalidLevel = errors.New("Unknown log level, use debug, info, warn or error")
+
+	// ErrInvalidFormat is returned for a format that is not json or console
+	ErrInvalidFormat = errors.New("Unknown log format, use json or console")
+)
+
+// Settings control which messages are logged and how
+type Settings struct {
+	// Level is the minimum level to log: debug, info, warn or error
+	Level string
+
+	// Format is json or console
+	Format string
+}
+
+// Output writes the json logged by zerolog to out in the current format, the format and level can
+// be changed while it is in use
+type Output struct {
+	mutex   sync.Mutex
+	out     io.Writer
+	format  string
+	console zerolog.ConsoleWriter
+}
+
+// New creates an Output that writes to out and applies settings
+func New(out io.Writer, settings Settings) (*Output, error) {
+	output := &Output{
+		out: out,
+
+		// Colors only help in a terminal, not in a log file
+		console: zerolog.ConsoleWriter{Out: out, NoColor: out != os.Stderr},
+	}
+
+	if err := output.Update(settings); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
+
+// Write writes a single json log message
+func (output *Output) Write(p []byte) (int, error) {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	if output.format == FormatConsole {
+		return output.console.Write(p)
+	}
+
+	return output.out.Write(p)
+}
+
+// Settings returns the current settings
+func (output *Output) Settings() Settings {
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	return Settings{Level: zerolog.GlobalLevel().String(), Format: output.format}
+}
+
+// Update replaces the settings, the next message uses them. They are not persisted, so a restart
+// restores the configured settings.
+func (output *Output) Update(settings Settings) error {
+	level, err := zerolog.ParseLevel(settings.Level)
+	if err != nil || level < zerolog.TraceLevel || level > zerolog.PanicLevel {
+		return ErrInvalidLevel
+	}
+
+	if settings.Format != FormatJSON && settings.Format != FormatConsole {
+		return ErrInvalidFormat
+	}
+
+	output.mutex.Lock()
+	defer output.mutex.Unlock()
+
+	zerolog.SetGlobalLevel(level)
+	output.format = settings.Format
+
+	return nil
+}
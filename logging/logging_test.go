@@ -0,0 +1,79 @@
+package logging
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestOutput(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+
+	buf := &bytes.Buffer{}
+	output, err := New(buf, Settings{Level: "info", Format: FormatJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := zerolog.New(output)
+	logger.Debug().Msg("hidden")
+	logger.Info().Msg("first")
+	if buf.String() != `{"level":"info","message":"first"}`+"\n" {
+		t.Fatalf("Expected a single json message, got %q", buf.String())
+	}
+
+	if err := output.Update(Settings{Level: "debug", Format: FormatConsole}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	logger.Debug().Msg("second")
+	if !strings.Contains(buf.String(), "DBG second") {
+		t.Fatalf("Expected a console debug message, got %q", buf.String())
+	}
+
+	for _, settings := range []Settings{{Level: "loud", Format: FormatJSON}, {Level: "", Format: FormatJSON}, {Level: "info", Format: "xml"}} {
+		if err := output.Update(settings); err == nil {
+			t.Fatalf("Expected %+v to be invalid", settings)
+		}
+	}
+
+	if settings := output.Settings(); settings.Level != "debug" || settings.Format != FormatConsole {
+		t.Fatalf("Expected invalid settings to be ignored, got %+v", settings)
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bookmarks.log")
+
+	file, err := OpenFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for suffix, expected := range map[string]string{"": "fourth\n", ".1": "third\n", ".2": "second\n", ".3": ""} {
+		data, err := ioutil.ReadFile(path + suffix)
+		if expected == "" {
+			if !os.IsNotExist(err) {
+				t.Fatalf("Expected no %s, got %v", path+suffix, err)
+			}
+			continue
+		}
+
+		if string(data) != expected {
+			t.Fatalf("Expected %q in %s, got %q", expected, path+suffix, data)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package mailer sends emails through an smtp server, like the digest of bookmarks still to read
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends emails from one address to a fixed list of recipients, the connection is upgraded
+// with STARTTLS when the server supports it
+type Mailer struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	to       []string
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// New creates a mailer for the smtp server at addr, like smtp.example.com:587. Without username
+// the server is used without authentication.
+func New(addr, username, password, from string, to []string) *Mailer {
+	mailer := &Mailer{addr: addr, from: from, to: to, sendMail: smtp.SendMail}
+
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		mailer.auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return mailer
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Send sends an email with a plain text and an html version of the body and optionally files
+// attached to it
+func (mailer *Mailer) Send(subject, text, html string, attachments ...Attachment) error {
+	alternative := boundary()
+
+	message := &bytes.Buffer{}
+	fmt.Fprintf(message, "From: %s\r\n", mailer.from)
+	fmt.Fprintf(message, "To: %s\r\n", strings.Join(mailer.to, ", "))
+	fmt.Fprintf(message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(message, "MIME-Version: 1.0\r\n")
+
+	if len(attachments) == 0 {
+		fmt.Fprintf(message, "Content-Type: multipart/alternative; boundary=%s\r\n", alternative)
+		writeAlternative(message, alternative, text, html)
+
+		return mailer.sendMail(mailer.addr, mailer.auth, mailer.from, mailer.to, message.Bytes())
+	}
+
+	// The text and html versions of the body are the first part of the mixed message, the
+	// attachments follow
+	mixed := boundary()
+	fmt.Fprintf(message, "Content-Type: multipart/mixed; boundary=%s\r\n", mixed)
+	fmt.Fprintf(message, "\r\n--%s\r\n", mixed)
+	fmt.Fprintf(message, "Content-Type: multipart/alternative; boundary=%s\r\n", alternative)
+	writeAlternative(message, alternative, text, html)
+
+	for _, attachment := range attachments {
+		fmt.Fprintf(message, "\r\n--%s\r\n", mixed)
+		fmt.Fprintf(message, "Content-Type: %s\r\n", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Name}))
+		fmt.Fprintf(message, "Content-Disposition: %s\r\n", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+		fmt.Fprintf(message, "Content-Transfer-Encoding: base64\r\n\r\n")
+
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(message, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(message, "%s\r\n", encoded)
+	}
+
+	fmt.Fprintf(message, "\r\n--%s--\r\n", mixed)
+
+	return mailer.sendMail(mailer.addr, mailer.auth, mailer.from, mailer.to, message.Bytes())
+}
+
+func writeAlternative(message *bytes.Buffer, boundary, text, html string) {
+	for _, part := range []struct{ contentType, body string }{{"text/plain", text}, {"text/html", html}} {
+		fmt.Fprintf(message, "\r\n--%s\r\n", boundary)
+		fmt.Fprintf(message, "Content-Type: %s; charset=utf-8\r\n", part.contentType)
+		fmt.Fprintf(message, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+		writer := quotedprintable.NewWriter(message)
+		writer.Write([]byte(part.body))
+		writer.Close()
+	}
+
+	fmt.Fprintf(message, "\r\n--%s--\r\n", boundary)
+}
+
+func boundary() string {
+	random := make([]byte, 16)
+	rand.Read(random)
+
+	return hex.EncodeToString(random)
+}
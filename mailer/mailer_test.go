@@ -0,0 +1,64 @@
+package mailer
+
+import (
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestSend(t *testing.T) {
+	mailer := New("smtp.example.com:587", "alice", "secret", "bookmarks@example.com", []string{"alice@example.com", "bob@example.com"})
+
+	var message string
+	mailer.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		if addr != "smtp.example.com:587" || a == nil || from != "bookmarks@example.com" || len(to) != 2 {
+			t.Fatalf("Unexpected envelope %s %s %v", addr, from, to)
+		}
+		message = string(msg)
+		return nil
+	}
+
+	if err := mailer.Send("3 bookmarks to read — now", "Plain", "<p>Html</p>"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"To: alice@example.com, bob@example.com\r\n",
+		"Subject: =?utf-8?q?3_bookmarks_to_read_=E2=80=94_now?=\r\n",
+		"Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nPlain",
+		"Content-Type: text/html; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n<p>Html</p>",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Fatalf("Expected %q in the message, got %s", expected, message)
+		}
+	}
+
+	if mailer := New("localhost:25", "", "", "a@example.com", nil); mailer.auth != nil {
+		t.Fatal("Expected no authentication without username")
+	}
+}
+
+func TestSendAttachment(t *testing.T) {
+	mailer := New("localhost:25", "", "", "bookmarks@example.com", []string{"alice@example.com"})
+
+	var message string
+	mailer.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		message = string(msg)
+		return nil
+	}
+
+	if err := mailer.Send("Periodical", "Plain", "<p>Html</p>", Attachment{"periodical.epub", "application/epub+zip", []byte("epub")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"Content-Type: multipart/mixed; boundary=",
+		"Content-Type: multipart/alternative; boundary=",
+		"Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nPlain",
+		"Content-Type: application/epub+zip; name=periodical.epub\r\nContent-Disposition: attachment; filename=periodical.epub\r\nContent-Transfer-Encoding: base64\r\n\r\nZXB1Yg==\r\n",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Fatalf("Expected %q in the message, got %s", expected, message)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package matrix runs a Matrix bot that saves the links posted in a room as bookmarks and posts
+// notifications to that room
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pollTimeout is how long a sync request waits for new events
+	pollTimeout = 30 * time.Second
+
+	// retryDelay is how long the bot waits after failing to sync
+	retryDelay = 5 * time.Second
+)
+
+// Bot saves the links posted in a single room as bookmarks and posts notifications to it
+type Bot struct {
+	homeserver string
+	token      string
+	room       string
+	roomID     string
+	userID     string
+	store      storage.Storer
+	client     *http.Client
+	txn        int64
+	mutex      sync.RWMutex
+}
+
+// New creates a bot that logs in to homeserver with an access token and listens in room, which can
+// be a room ID like !abc:example.com or an alias like #bookmarks:example.com
+func New(homeserver, token, room string, store storage.Storer) *Bot {
+	return &Bot{
+		homeserver: homeserver,
+		token:      token,
+		room:       room,
+		store:      store,
+		client:     &http.Client{Timeout: pollTimeout + 10*time.Second},
+		txn:        time.Now().UnixNano(),
+	}
+}
+
+type event struct {
+	Type    string
+	Sender  string
+	Content struct {
+		MsgType string
+		Body    string
+	}
+}
+
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []event
+			}
+		}
+	}
+}
+
+// join joins the room of the bot and finds out who the bot is
+func (bot *Bot) join(ctx context.Context) error {
+	whoami := struct {
+		UserID string `json:"user_id"`
+	}{}
+	if err := bot.call(ctx, "GET", "/account/whoami", nil, &whoami); err != nil {
+		return err
+	}
+
+	joined := struct {
+		RoomID string `json:"room_id"`
+	}{}
+	if err := bot.call(ctx, "POST", "/join/"+url.PathEscape(bot.room), map[string]interface{}{}, &joined); err != nil {
+		return err
+	}
+
+	bot.mutex.Lock()
+	bot.userID = whoami.UserID
+	bot.roomID = joined.RoomID
+	bot.mutex.Unlock()
+
+	log.Ctx(ctx).Info().Str("user", bot.userID).Str("room", bot.roomID).Msg("Matrix bot ready")
+
+	return nil
+}
+
+// Run joins the room and saves the links posted in it until the context is cancelled, messages
+// posted before the bot started are ignored. Notifications can only be posted once the room is joined.
+func (bot *Bot) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := bot.join(ctx); err == nil {
+			break
+		} else if ctx.Err() == nil {
+			log.Ctx(ctx).Warn().Err(err).Str("room", bot.room).Msg("Error joining Matrix room")
+			sleep(ctx, retryDelay)
+		}
+	}
+
+	filter, _ := json.Marshal(map[string]interface{}{
+		"room": map[string]interface{}{
+			"rooms":    []string{bot.roomID},
+			"timeline": map[string]interface{}{"types": []string{"m.room.message"}},
+		},
+		"presence":     map[string]interface{}{"types": []string{}},
+		"account_data": map[string]interface{}{"types": []string{}},
+	})
+
+	since := ""
+
+	for ctx.Err() == nil {
+		query := url.Values{"filter": {string(filter)}}
+		if since != "" {
+			query.Set("since", since)
+			query.Set("timeout", strconv.Itoa(int(pollTimeout/time.Millisecond)))
+		}
+
+		response := syncResponse{}
+		if err := bot.call(ctx, "GET", "/sync?"+query.Encode(), nil, &response); err != nil {
+			if ctx.Err() == nil {
+				log.Ctx(ctx).Warn().Err(err).Msg("Error syncing with Matrix")
+				sleep(ctx, retryDelay)
+			}
+			continue
+		}
+
+		if since != "" {
+			for _, event := range response.Rooms.Join[bot.roomID].Timeline.Events {
+				bot.handle(ctx, event)
+			}
+		}
+
+		since = response.NextBatch
+	}
+}
+
+// handle saves the links in a message posted by someone else than the bot
+func (bot *Bot) handle(ctx context.Context, event event) {
+	if event.Type != "m.room.message" || event.Sender == bot.userID || event.Content.MsgType != "m.text" {
+		return
+	}
+
+	logger := log.Ctx(ctx).With().Str("sender", event.Sender).Logger()
+
+	urls, tags := capture.Parse(event.Content.Body)
+
+	for _, pageURL := range urls {
+		bookmark, err := capture.Save(logger.WithContext(ctx), bot.store, pageURL, tags)
+		if err != nil {
+			logger.Error().Err(err).Str("url", pageURL).Msg("Error saving bookmark from Matrix")
+			bot.Notify(ctx, "Could not save "+pageURL+": "+err.Error())
+			continue
+		}
+
+		bot.Notify(ctx, "Saved "+bookmark.Title)
+	}
+}
+
+// Notify posts a notice to the room of the bot
+func (bot *Bot) Notify(ctx context.Context, text string) error {
+	bot.mutex.RLock()
+	roomID := bot.roomID
+	bot.mutex.RUnlock()
+
+	if roomID == "" {
+		return errors.New("Matrix room is not joined yet")
+	}
+
+	txn := strconv.FormatInt(atomic.AddInt64(&bot.txn, 1), 10)
+	path := "/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + txn
+
+	if err := bot.call(ctx, "PUT", path, map[string]interface{}{"msgtype": "m.notice", "body": text}, nil); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("room", roomID).Msg("Error posting to Matrix")
+		return err
+	}
+
+	return nil
+}
+
+// call invokes an endpoint of the Matrix client server api and decodes the response into result,
+// if not nil
+func (bot *Bot) call(ctx context.Context, method, path string, params interface{}, result interface{}) error {
+	var body *bytes.Reader
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, bot.homeserver+"/_matrix/client/v3"+path, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+bot.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := bot.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		failure := struct {
+			ErrCode string
+			Error   string
+		}{}
+		json.NewDecoder(response.Body).Decode(&failure)
+		return fmt.Errorf("Error calling %s: %d %s %s", strings.SplitN(path, "?", 2)[0], response.StatusCode, failure.ErrCode, failure.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+func sleep(ctx context.Context, duration time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+}
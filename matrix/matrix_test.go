@@ -0,0 +1,83 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mutex := sync.Mutex{}
+	notices := []string{}
+	syncs := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(401)
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch {
+		case r.URL.Path == "/_matrix/client/v3/account/whoami":
+			w.Write([]byte(`{"user_id": "@bot:example.com"}`))
+		case r.URL.Path == "/_matrix/client/v3/join/#bookmarks:example.com":
+			w.Write([]byte(`{"room_id": "!room:example.com"}`))
+		case r.URL.Path == "/_matrix/client/v3/sync":
+			syncs++
+			switch syncs {
+			case 1:
+				// The initial sync returns history, which is ignored
+				w.Write([]byte(`{"next_batch": "1", "rooms": {"join": {"!room:example.com": {"timeline": {"events": [
+					{"type": "m.room.message", "sender": "@user:example.com", "content": {"msgtype": "m.text", "body": "http://127.0.0.1:1/old"}}
+				]}}}}}`))
+			case 2:
+				w.Write([]byte(`{"next_batch": "2", "rooms": {"join": {"!room:example.com": {"timeline": {"events": [
+					{"type": "m.room.message", "sender": "@bot:example.com", "content": {"msgtype": "m.text", "body": "http://127.0.0.1:1/own"}},
+					{"type": "m.room.message", "sender": "@user:example.com", "content": {"msgtype": "m.text", "body": "Look http://127.0.0.1:1/new #go"}}
+				]}}}}}`))
+			default:
+				cancel()
+				w.Write([]byte(`{"next_batch": "3"}`))
+			}
+		case strings.HasPrefix(r.URL.Path, "/_matrix/client/v3/rooms/!room:example.com/send/m.room.message/"):
+			notice := struct{ Body string }{}
+			json.NewDecoder(r.Body).Decode(&notice)
+			notices = append(notices, notice.Body)
+			w.Write([]byte(`{"event_id": "$1"}`))
+		default:
+			t.Errorf("Unexpected call to %s", r.URL.Path)
+			w.WriteHeader(404)
+		}
+	}))
+	defer server.Close()
+
+	store := storage.NewMemory()
+
+	bot := New(server.URL, "token", "#bookmarks:example.com", store)
+	bot.Run(ctx)
+
+	bookmarks, totalCount := store.BookmarkList(context.Background(), &storage.BookmarkListOptions{Limit: 10})
+	if totalCount != 1 || (*bookmarks)[0].URL != "http://127.0.0.1:1/new" || len((*bookmarks)[0].Tags) != 2 {
+		t.Fatalf("Expected only the new link to be saved, got %d bookmarks", totalCount)
+	}
+
+	if err := bot.Notify(context.Background(), "Hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(notices) != 2 || notices[0] != "Saved http://127.0.0.1:1/new" || notices[1] != "Hello" {
+		t.Fatalf("Unexpected notices %v", notices)
+	}
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// State of a job
+type State string
+
+const (
+	// StatePending means the job waits for a worker
+	StatePending = State("pending")
+
+	// StateRunning means a worker is performing the job
+	StateRunning = State("running")
+
+	// StateSucceeded means the job finished without error
+	StateSucceeded = State("succeeded")
+
+	// StateFailed means the last attempt of the job failed and it waits to be retried
+	StateFailed = State("failed")
+
+	// StateCancelled means the job was cancelled before it finished
+	StateCancelled = State("cancelled")
+
+	// StateDead means the job failed permanently or ran out of attempts, it is kept until it is retried or purged
+	StateDead = State("dead")
+)
+
+// Valid checks if state is one of the known states
+func (state State) Valid() bool {
+	switch state {
+	case StatePending, StateRunning, StateSucceeded, StateFailed, StateCancelled, StateDead:
+		return true
+	}
+
+	return false
+}
+
+// Priority determines the order in which pending jobs of the same kind run
+type Priority int
+
+const (
+	// PriorityLow is for background work like periodic sweeps
+	PriorityLow = Priority(-1)
+
+	// PriorityNormal is the default priority
+	PriorityNormal = Priority(0)
+
+	// PriorityHigh is for work a user is waiting for
+	PriorityHigh = Priority(1)
+)
+
+// Job is a unit of work performed in the background
+type Job struct {
+	ID       string
+	Key      string `json:",omitempty"`
+	Kind     string
+	Payload  string
+	Priority Priority
+	State    State
+	Attempts int
+	Error    string `json:",omitempty"`
+	Created  time.Time
+	RunAt    time.Time
+	Started  time.Time
+	Finished time.Time
+	Duration time.Duration
+
+	cancel    context.CancelFunc
+	cancelled bool
+}
+
+func (job *Job) copy() *Job {
+	duplicate := *job
+	return &duplicate
+}
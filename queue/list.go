@@ -0,0 +1,102 @@
+package queue
+
+import (
+	"sort"
+)
+
+// ListOptions is used to pass filters to List
+type ListOptions struct {
+	Kind   string
+	State  State
+	Limit  int
+	Offset int
+}
+
+// List returns the pending, running and recently finished jobs, newest first
+func (queue *Queue) List(options *ListOptions) ([]*Job, int) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	jobs := []*Job{}
+
+	for _, job := range queue.jobs {
+		if options.Kind != "" && job.Kind != options.Kind {
+			continue
+		}
+
+		if options.State != "" && job.State != options.State {
+			continue
+		}
+
+		jobs = append(jobs, job.copy())
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].ID > jobs[j].ID
+		}
+		return jobs[i].Created.After(jobs[j].Created)
+	})
+
+	totalCount := len(jobs)
+
+	if options.Offset > 0 {
+		if options.Offset >= len(jobs) {
+			return []*Job{}, totalCount
+		}
+		jobs = jobs[options.Offset:]
+	}
+
+	if options.Limit > 0 && options.Limit < len(jobs) {
+		jobs = jobs[:options.Limit]
+	}
+
+	return jobs, totalCount
+}
+
+// Get returns a single job by ID
+func (queue *Queue) Get(ID string) (*Job, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	job, ok := queue.jobs[ID]
+	if !ok {
+		return nil, ErrNotExistingJob
+	}
+
+	return job.copy(), nil
+}
+
+// Pool reports the workers of a kind of job
+type Pool struct {
+	Kind    string
+	Workers int
+	Active  int
+	Pending int
+}
+
+// Pools returns the number of workers, busy workers and pending jobs for every kind of job
+func (queue *Queue) Pools() []*Pool {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	pools := []*Pool{}
+
+	for kind, registration := range queue.handlers {
+		pool := &Pool{Kind: kind, Workers: registration.workers, Active: registration.active}
+
+		for _, job := range queue.pending {
+			if job.Kind == kind {
+				pool.Pending++
+			}
+		}
+
+		pools = append(pools, pool)
+	}
+
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].Kind < pools[j].Kind
+	})
+
+	return pools
+}
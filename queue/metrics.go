@@ -0,0 +1,95 @@
+package queue
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics instruments the queue, it is exposed to prometheus by Collector
+type metrics struct {
+	enqueued *prometheus.CounterVec
+	started  *prometheus.CounterVec
+	finished *prometheus.CounterVec
+	waiting  *prometheus.HistogramVec
+	duration *prometheus.HistogramVec
+	pending  *prometheus.Desc
+	active   *prometheus.Desc
+	workers  *prometheus.Desc
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		enqueued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "bookmarks",
+			Subsystem: "jobs",
+			Name:      "enqueued_total",
+			Help:      "Number of jobs enqueued, including retries.",
+		}, []string{"kind"}),
+		started: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "bookmarks",
+			Subsystem: "jobs",
+			Name:      "started_total",
+			Help:      "Number of jobs taken from the queue by a worker.",
+		}, []string{"kind"}),
+		finished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "bookmarks",
+			Subsystem: "jobs",
+			Name:      "finished_total",
+			Help:      "Number of job attempts that finished, by the state of the job afterwards.",
+		}, []string{"kind", "state"}),
+		waiting: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "bookmarks",
+			Subsystem: "jobs",
+			Name:      "wait_seconds",
+			Help:      "Time jobs were due before a worker took them from the queue.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"kind"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "bookmarks",
+			Subsystem: "jobs",
+			Name:      "duration_seconds",
+			Help:      "Time it took to run a job attempt.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"kind"}),
+		pending: prometheus.NewDesc("bookmarks_jobs_pending", "Number of jobs waiting in the queue.", []string{"kind"}, nil),
+		active:  prometheus.NewDesc("bookmarks_jobs_active", "Number of workers running a job.", []string{"kind"}, nil),
+		workers: prometheus.NewDesc("bookmarks_jobs_workers", "Number of workers.", []string{"kind"}, nil),
+	}
+}
+
+type collector struct {
+	queue *Queue
+}
+
+// Collector exposes the metrics of the queue to prometheus
+func (queue *Queue) Collector() prometheus.Collector {
+	return &collector{queue}
+}
+
+func (collector *collector) Describe(ch chan<- *prometheus.Desc) {
+	metrics := collector.queue.metrics
+
+	metrics.enqueued.Describe(ch)
+	metrics.started.Describe(ch)
+	metrics.finished.Describe(ch)
+	metrics.waiting.Describe(ch)
+	metrics.duration.Describe(ch)
+	ch <- metrics.pending
+	ch <- metrics.active
+	ch <- metrics.workers
+}
+
+func (collector *collector) Collect(ch chan<- prometheus.Metric) {
+	metrics := collector.queue.metrics
+
+	metrics.enqueued.Collect(ch)
+	metrics.started.Collect(ch)
+	metrics.finished.Collect(ch)
+	metrics.waiting.Collect(ch)
+	metrics.duration.Collect(ch)
+
+	for _, pool := range collector.queue.Pools() {
+		ch <- prometheus.MustNewConstMetric(metrics.pending, prometheus.GaugeValue, float64(pool.Pending), pool.Kind)
+		ch <- prometheus.MustNewConstMetric(metrics.active, prometheus.GaugeValue, float64(pool.Active), pool.Kind)
+		ch <- prometheus.MustNewConstMetric(metrics.workers, prometheus.GaugeValue, float64(pool.Workers), pool.Kind)
+	}
+}
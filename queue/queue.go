@@ -0,0 +1,722 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrUnknownKind is returned when enqueueing a job for which no handler is registered
+	ErrUnknownKind = errors.New("No handler registered for this kind of job")
+
+	// ErrNotExistingJob is returned if a job does not exist or was removed from the history
+	ErrNotExistingJob = errors.New("Job does not exist")
+
+	// ErrNotDeadJob is returned when retrying or purging a job that is not dead
+	ErrNotDeadJob = errors.New("Job is not dead")
+
+	// ErrJobFinished is returned when cancelling a job that already finished
+	ErrJobFinished = errors.New("Job already finished")
+
+	// ErrStopping is returned when enqueueing a job once the queue is stopping
+	ErrStopping = errors.New("The queue is stopping")
+
+	// ErrJobTimeout is recorded as the error of a job that did not finish within the timeout of its kind
+	ErrJobTimeout = errors.New("Job timed out")
+)
+
+// historySize is the number of succeeded and cancelled jobs kept for inspection, dead jobs are kept until they are purged
+const historySize = 1000
+
+// Handler performs a single job
+type Handler func(ctx context.Context, job *Job) error
+
+// Persistence keeps jobs across restarts of the queue, see SetPersistence
+type Persistence interface {
+	// JobList returns all saved jobs
+	JobList(ctx context.Context) ([]*Job, error)
+
+	// JobSave saves job, replacing a saved job with the same ID
+	JobSave(ctx context.Context, job *Job) error
+
+	// JobDelete removes the saved job with the given ID
+	JobDelete(ctx context.Context, ID string) error
+}
+
+type registration struct {
+	handler Handler
+	policy  RetryPolicy
+	workers int
+	active  int
+	timeout time.Duration
+	wakeup  chan struct{}
+}
+
+// Queue runs jobs in the background, every kind of job on its own pool of workers
+type Queue struct {
+	mutex       sync.Mutex
+	handlers    map[string]*registration
+	pending     []*Job
+	jobs        map[string]*Job
+	unique      map[string]*Job
+	history     []*Job
+	schedules   map[string]*scheduleEntry
+	onDead      []func(job *Job)
+	onSucceeded []func(job *Job)
+	cron        *cron.Cron
+	metrics     *metrics
+	persistence Persistence
+	concurrency int
+	started     bool
+	stopping    bool
+	stop        chan struct{}
+	stopOnce    sync.Once
+	stopErr     error
+	workers     sync.WaitGroup
+
+	// ctx is the parent of the contexts of running jobs, Stop cancels it once its deadline passes
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// New creates a queue that runs at most concurrency jobs of the same kind at the same time
+func New(concurrency int) *Queue {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Queue{
+		handlers:    map[string]*registration{},
+		jobs:        map[string]*Job{},
+		unique:      map[string]*Job{},
+		schedules:   map[string]*scheduleEntry{},
+		cron:        cron.New(),
+		metrics:     newMetrics(),
+		concurrency: concurrency,
+		stop:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+// Register sets the handler and retry policy for a kind of job, it must be called before Start
+func (queue *Queue) Register(kind string, handler Handler, policy RetryPolicy) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.handlers[kind] = &registration{
+		handler: handler,
+		policy:  policy,
+		workers: queue.concurrency,
+		wakeup:  make(chan struct{}, 1),
+	}
+}
+
+// OnDead calls listener with a copy of every job that fails permanently or runs out of attempts,
+// listeners run in their own goroutine
+func (queue *Queue) OnDead(listener func(job *Job)) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.onDead = append(queue.onDead, listener)
+}
+
+// OnSucceeded calls listener with a copy of every job that succeeds, listeners run in their own
+// goroutine
+func (queue *Queue) OnSucceeded(listener func(job *Job)) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.onSucceeded = append(queue.onSucceeded, listener)
+}
+
+// SetWorkers changes the number of jobs of a kind that run at the same time, it must be called before Start
+func (queue *Queue) SetWorkers(kind string, workers int) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	registration, ok := queue.handlers[kind]
+	if !ok {
+		return ErrUnknownKind
+	}
+
+	if workers < 1 {
+		return fmt.Errorf("Invalid number of workers for %s: %d", kind, workers)
+	}
+
+	registration.workers = workers
+
+	return nil
+}
+
+// SetPersistence saves the pending jobs to persistence when the queue stops, so they run after the
+// next start, and keeps dead jobs there until they are retried or purged. It must be called before
+// Start.
+func (queue *Queue) SetPersistence(persistence Persistence) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.persistence = persistence
+}
+
+// Enqueue schedules a job of the given kind to run as soon as a worker is available, jobs with a
+// higher priority run before jobs with a lower priority
+func (queue *Queue) Enqueue(kind string, payload string, priority Priority) (*Job, error) {
+	return queue.EnqueueUnique("", kind, payload, priority)
+}
+
+// SetTimeout limits how long a job of a kind may run, after which its context is cancelled and the
+// attempt fails. A timeout of 0 disables the limit.
+func (queue *Queue) SetTimeout(kind string, timeout time.Duration) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	registration, ok := queue.handlers[kind]
+	if !ok {
+		return ErrUnknownKind
+	}
+
+	registration.timeout = timeout
+
+	return nil
+}
+
+// EnqueueUnique works like Enqueue, but if a job with the same key is already pending or running
+// it returns that job instead, raising its priority if needed. An empty key disables this check.
+// Jobs can no longer be enqueued once the queue is stopping.
+func (queue *Queue) EnqueueUnique(key string, kind string, payload string, priority Priority) (*Job, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.stopping {
+		return nil, ErrStopping
+	}
+
+	registration, ok := queue.handlers[kind]
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+
+	if existing, ok := queue.unique[key]; ok && key != "" {
+		if priority > existing.Priority {
+			existing.Priority = priority
+		}
+
+		log.Debug().Str("job", existing.ID).Str("key", key).Msg("Job with the same key is already enqueued")
+
+		return existing.copy(), nil
+	}
+
+	job := &Job{
+		ID:       generateID(),
+		Key:      key,
+		Kind:     kind,
+		Payload:  payload,
+		Priority: priority,
+		State:    StatePending,
+		Created:  time.Now(),
+		RunAt:    time.Now(),
+	}
+
+	queue.pending = append(queue.pending, job)
+	queue.jobs[job.ID] = job
+	if key != "" {
+		queue.unique[key] = job
+	}
+	queue.metrics.enqueued.WithLabelValues(kind).Inc()
+	registration.notify()
+
+	log.Debug().Str("job", job.ID).Str("kind", kind).Msg("Enqueued job")
+
+	return job.copy(), nil
+}
+
+// Start restores the jobs saved by the last Stop, and starts the workers and the schedules
+func (queue *Queue) Start() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	queue.restore()
+
+	for kind, registration := range queue.handlers {
+		log.Info().Str("kind", kind).Int("workers", registration.workers).Msg("Starting workers")
+
+		for i := 0; i < registration.workers; i++ {
+			queue.workers.Add(1)
+			go queue.work(kind, registration)
+		}
+	}
+
+	queue.cron.Start()
+	queue.started = true
+}
+
+// Ready returns an error unless the workers were started and are not stopping
+func (queue *Queue) Ready(ctx context.Context) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if !queue.started {
+		return errors.New("The workers are not running")
+	}
+
+	return nil
+}
+
+// Stop stops the schedules and waits for the workers to finish their current job. Running jobs
+// are cancelled once ctx is done and go back to the pending jobs, which are saved if the queue has
+// persistence and discarded otherwise. Calling Stop again waits for the first call to finish and
+// returns its error.
+func (queue *Queue) Stop(ctx context.Context) error {
+	queue.stopOnce.Do(func() {
+		queue.stopErr = queue.shutdown(ctx)
+	})
+
+	return queue.stopErr
+}
+
+func (queue *Queue) shutdown(ctx context.Context) error {
+	queue.mutex.Lock()
+	queue.started = false
+	queue.stopping = true
+	queue.mutex.Unlock()
+
+	<-queue.cron.Stop().Done()
+
+	close(queue.stop)
+
+	done := make(chan struct{})
+	go func() {
+		queue.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn().Msg("Cancelling the running jobs")
+		queue.cancel()
+		<-done
+	}
+
+	queue.cancel()
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.persistence == nil {
+		log.Info().Int("discarded", len(queue.pending)).Msg("Stopped the queue")
+		return ctx.Err()
+	}
+
+	// Saving the pending jobs must not be cut short by the deadline that passed
+	saveCtx := context.Background()
+	for _, job := range queue.pending {
+		if err := queue.persistence.JobSave(saveCtx, job); err != nil {
+			log.Error().Err(err).Str("job", job.ID).Str("kind", job.Kind).Msg("Error saving pending job")
+			return err
+		}
+	}
+
+	log.Info().Int("saved", len(queue.pending)).Msg("Stopped the queue")
+
+	return ctx.Err()
+}
+
+// restore enqueues the pending jobs saved by the last Stop again, they are removed from the
+// persistence since they only live in the queue from now on. Dead jobs stay saved until they are
+// retried or purged.
+func (queue *Queue) restore() {
+	if queue.persistence == nil {
+		return
+	}
+
+	ctx := context.Background()
+
+	jobs, err := queue.persistence.JobList(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Error restoring saved jobs")
+		return
+	}
+
+	restored := 0
+
+	for _, job := range jobs {
+		if _, ok := queue.handlers[job.Kind]; !ok {
+			log.Warn().Str("job", job.ID).Str("kind", job.Kind).Msg("Not restoring job without a handler")
+			continue
+		}
+
+		if job.State == StateDead {
+			queue.jobs[job.ID] = job
+			restored++
+			continue
+		} else if job.State != StatePending && job.State != StateFailed {
+			continue
+		}
+
+		if err := queue.persistence.JobDelete(ctx, job.ID); err != nil {
+			log.Error().Err(err).Str("job", job.ID).Msg("Error removing restored job")
+			continue
+		}
+
+		queue.pending = append(queue.pending, job)
+		queue.jobs[job.ID] = job
+		if _, ok := queue.unique[job.Key]; !ok && job.Key != "" {
+			queue.unique[job.Key] = job
+		}
+		queue.metrics.enqueued.WithLabelValues(job.Kind).Inc()
+		restored++
+	}
+
+	log.Info().Int("restored", restored).Msg("Restored saved jobs")
+}
+
+// notify wakes up one of the idle workers of this kind of job
+func (registration *registration) notify() {
+	select {
+	case registration.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (queue *Queue) work(kind string, registration *registration) {
+	defer queue.workers.Done()
+
+	for {
+		select {
+		case <-queue.stop:
+			return
+		default:
+		}
+
+		job, ctx, wait := queue.next(kind, registration)
+		if job == nil {
+			timer := time.NewTimer(wait)
+			select {
+			case <-queue.stop:
+				timer.Stop()
+				return
+			case <-registration.wakeup:
+			case <-timer.C:
+			}
+			timer.Stop()
+			continue
+		}
+
+		queue.run(ctx, job, registration)
+	}
+}
+
+// next takes the due job of a kind with the highest priority from the pending list, or returns how
+// long to wait for one. Jobs with the same priority run in the order they became due.
+func (queue *Queue) next(kind string, registration *registration) (*Job, context.Context, time.Duration) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	now := time.Now()
+	wait := time.Minute
+	index := -1
+
+	for i, job := range queue.pending {
+		if job.Kind != kind {
+			continue
+		}
+
+		if job.RunAt.After(now) {
+			if until := job.RunAt.Sub(now); until < wait {
+				wait = until
+			}
+			continue
+		}
+
+		if index == -1 || job.Priority > queue.pending[index].Priority {
+			index = i
+		}
+	}
+
+	if index == -1 {
+		return nil, nil, wait
+	}
+
+	job := queue.pending[index]
+	queue.pending = append(queue.pending[:index], queue.pending[index+1:]...)
+
+	job.State = StateRunning
+	job.Started = now
+	job.Attempts++
+
+	ctx, cancel := context.WithCancel(queue.ctx)
+	if registration.timeout > 0 {
+		ctx, cancel = context.WithTimeout(queue.ctx, registration.timeout)
+	}
+	job.cancel = cancel
+
+	registration.active++
+
+	queue.metrics.started.WithLabelValues(kind).Inc()
+	queue.metrics.waiting.WithLabelValues(kind).Observe(now.Sub(job.RunAt).Seconds())
+
+	// Pass the baton, another idle worker might pick up the next job
+	registration.notify()
+
+	return job, ctx, 0
+}
+
+func (queue *Queue) run(ctx context.Context, job *Job, registration *registration) {
+	logger := log.With().Str("job", job.ID).Str("kind", job.Kind).Int("attempt", job.Attempts).Logger()
+	ctx = logger.WithContext(ctx)
+
+	err := runHandler(ctx, registration.handler, job)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %s: %s", ErrJobTimeout, registration.timeout, err)
+	}
+
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	registration.active--
+
+	job.cancel()
+	job.cancel = nil
+
+	job.Finished = time.Now()
+	job.Duration = job.Finished.Sub(job.Started)
+
+	queue.metrics.duration.WithLabelValues(job.Kind).Observe(job.Duration.Seconds())
+	defer func() {
+		queue.metrics.finished.WithLabelValues(job.Kind, string(job.State)).Inc()
+	}()
+
+	if err == nil {
+		job.State = StateSucceeded
+		job.Error = ""
+		queue.archive(job)
+		logger.Info().Dur("duration", job.Duration).Msg("Job succeeded")
+		for _, listener := range queue.onSucceeded {
+			go listener(job.copy())
+		}
+		return
+	}
+
+	job.Error = err.Error()
+
+	// A job interrupted because the queue stops goes back to the pending jobs without using up an
+	// attempt, so it is saved and runs again after the next start
+	if queue.ctx.Err() != nil && !job.cancelled {
+		job.State = StatePending
+		job.Attempts--
+		job.RunAt = time.Now()
+		queue.pending = append(queue.pending, job)
+		logger.Warn().Err(err).Msg("Job interrupted because the queue stops")
+		return
+	}
+
+	if job.cancelled {
+		job.State = StateCancelled
+		queue.archive(job)
+		logger.Info().Err(err).Msg("Job cancelled")
+		return
+	}
+
+	if IsPermanent(err) || job.Attempts >= registration.policy.MaxAttempts {
+		job.State = StateDead
+		queue.release(job)
+		queue.save(job)
+		logger.Error().Err(err).Msg("Job failed permanently, moved to the dead letter queue")
+		for _, listener := range queue.onDead {
+			go listener(job.copy())
+		}
+		return
+	}
+
+	job.State = StateFailed
+	job.RunAt = time.Now().Add(registration.policy.Backoff(job.Attempts))
+	queue.pending = append(queue.pending, job)
+	queue.metrics.enqueued.WithLabelValues(job.Kind).Inc()
+	registration.notify()
+
+	logger.Warn().Err(err).Time("retry_at", job.RunAt).Msg("Job failed, retrying")
+}
+
+// save keeps a dead job in the persistence of the queue, if it has any
+func (queue *Queue) save(job *Job) {
+	if queue.persistence == nil {
+		return
+	}
+
+	if err := queue.persistence.JobSave(context.Background(), job); err != nil {
+		log.Error().Err(err).Str("job", job.ID).Str("kind", job.Kind).Msg("Error saving dead job")
+	}
+}
+
+// forget removes a job that is no longer dead from the persistence of the queue, if it has any
+func (queue *Queue) forget(job *Job) {
+	if queue.persistence == nil {
+		return
+	}
+
+	if err := queue.persistence.JobDelete(context.Background(), job.ID); err != nil {
+		log.Error().Err(err).Str("job", job.ID).Str("kind", job.Kind).Msg("Error removing saved job")
+	}
+}
+
+// release frees the key of a job that finished, so a new job with the same key can be enqueued
+func (queue *Queue) release(job *Job) {
+	if job.Key != "" && queue.unique[job.Key] == job {
+		delete(queue.unique, job.Key)
+	}
+}
+
+// archive adds a finished job to the history, forgetting the oldest finished job when the history is full
+func (queue *Queue) archive(job *Job) {
+	queue.release(job)
+
+	queue.history = append(queue.history, job)
+
+	if len(queue.history) > historySize {
+		delete(queue.jobs, queue.history[0].ID)
+		queue.history = queue.history[1:]
+	}
+}
+
+// Cancel removes a pending job from the queue or cancels the context of a running job
+func (queue *Queue) Cancel(ID string) (*Job, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	job, ok := queue.jobs[ID]
+	if !ok {
+		return nil, ErrNotExistingJob
+	}
+
+	switch job.State {
+	case StateRunning:
+		job.cancelled = true
+		job.cancel()
+
+		log.Info().Str("job", job.ID).Str("kind", job.Kind).Msg("Cancelling running job")
+	case StatePending, StateFailed:
+		for i, pending := range queue.pending {
+			if pending == job {
+				queue.pending = append(queue.pending[:i], queue.pending[i+1:]...)
+				break
+			}
+		}
+
+		job.State = StateCancelled
+		job.Finished = time.Now()
+		queue.archive(job)
+
+		log.Info().Str("job", job.ID).Str("kind", job.Kind).Msg("Cancelled pending job")
+	default:
+		return nil, ErrJobFinished
+	}
+
+	return job.copy(), nil
+}
+
+// Retry enqueues a dead job again, starting over with its first attempt
+func (queue *Queue) Retry(ID string) (*Job, error) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	job, ok := queue.jobs[ID]
+	if !ok {
+		return nil, ErrNotExistingJob
+	} else if job.State != StateDead {
+		return nil, ErrNotDeadJob
+	}
+
+	registration, ok := queue.handlers[job.Kind]
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+
+	queue.forget(job)
+
+	job.State = StatePending
+	job.Attempts = 0
+	job.RunAt = time.Now()
+
+	if _, ok := queue.unique[job.Key]; !ok && job.Key != "" {
+		queue.unique[job.Key] = job
+	}
+
+	queue.pending = append(queue.pending, job)
+	queue.metrics.enqueued.WithLabelValues(job.Kind).Inc()
+	registration.notify()
+
+	log.Info().Str("job", job.ID).Str("kind", job.Kind).Msg("Retrying dead job")
+
+	return job.copy(), nil
+}
+
+// Purge removes a dead job
+func (queue *Queue) Purge(ID string) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	job, ok := queue.jobs[ID]
+	if !ok {
+		return ErrNotExistingJob
+	} else if job.State != StateDead {
+		return ErrNotDeadJob
+	}
+
+	delete(queue.jobs, ID)
+	queue.forget(job)
+
+	log.Info().Str("job", job.ID).Str("kind", job.Kind).Msg("Purged dead job")
+
+	return nil
+}
+
+// PurgeAll removes all dead jobs and returns how many were removed
+func (queue *Queue) PurgeAll() int {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	purged := 0
+
+	for ID, job := range queue.jobs {
+		if job.State == StateDead {
+			delete(queue.jobs, ID)
+			queue.forget(job)
+			purged++
+		}
+	}
+
+	log.Info().Int("purged", purged).Msg("Purged dead jobs")
+
+	return purged
+}
+
+// runHandler runs the handler, turning a panic into a permanent error
+func runHandler(ctx context.Context, handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("Job panicked: %v", r))
+		}
+	}()
+
+	return handler(ctx, job)
+}
+
+func generateID() string {
+	b := make([]byte, 8)
+
+	rand.Read(b)
+
+	return strings.ToLower(fmt.Sprintf("%X", b))
+}
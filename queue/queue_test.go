@@ -0,0 +1,520 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 4 * time.Second}
+
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		for i := 0; i < 100; i++ {
+			if backoff := policy.Backoff(attempt + 1); backoff <= 0 || backoff > max {
+				t.Fatalf("Expected backoff of attempt %d between 0 and %s, got %s", attempt+1, max, backoff)
+			}
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	q := New(1)
+
+	attempts := make(chan int, 10)
+	q.Register("flaky", func(ctx context.Context, job *Job) error {
+		attempts <- job.Attempts
+		if job.Attempts < 3 {
+			return errors.New("Transient error")
+		}
+		return nil
+	}, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		attempts <- job.Attempts
+		return Permanent(errors.New("Permanent error"))
+	}, RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	if _, err := q.Enqueue("unknown", "", PriorityNormal); err != ErrUnknownKind {
+		t.Fatalf("Expected ErrUnknownKind, got %v", err)
+	}
+
+	q.Enqueue("flaky", "", PriorityNormal)
+	for expected := 1; expected <= 3; expected++ {
+		select {
+		case attempt := <-attempts:
+			if attempt != expected {
+				t.Fatalf("Expected attempt %d, got %d", expected, attempt)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected attempt %d to run", expected)
+		}
+	}
+
+	q.Enqueue("broken", "", PriorityNormal)
+	<-attempts
+	select {
+	case attempt := <-attempts:
+		t.Fatalf("Expected a permanent error not to be retried, got attempt %d", attempt)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestList(t *testing.T) {
+	q := New(1)
+	q.Register("noop", func(ctx context.Context, job *Job) error {
+		return nil
+	}, DefaultRetryPolicy)
+
+	first, _ := q.Enqueue("noop", "first", PriorityNormal)
+	second, _ := q.Enqueue("noop", "second", PriorityNormal)
+
+	jobs, totalCount := q.List(&ListOptions{State: StatePending})
+	if totalCount != 2 || jobs[0].ID != second.ID || jobs[1].ID != first.ID {
+		t.Fatalf("Expected 2 pending jobs newest first, got %d", totalCount)
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	waitForState(t, q, second.ID, StateSucceeded)
+}
+
+func TestDeadLetter(t *testing.T) {
+	q := New(1)
+	q.Register("broken", func(ctx context.Context, job *Job) error {
+		return errors.New("Still broken")
+	}, RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+
+	died := make(chan *Job, 2)
+	q.OnDead(func(job *Job) { died <- job })
+
+	job, _ := q.Enqueue("broken", "", PriorityNormal)
+
+	if err := q.Purge(job.ID); err != ErrNotDeadJob {
+		t.Fatalf("Expected ErrNotDeadJob, got %v", err)
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	waitForState(t, q, job.ID, StateDead)
+
+	select {
+	case dead := <-died:
+		if dead.ID != job.ID || dead.Error != "Still broken" {
+			t.Fatalf("Expected the listener to get the dead job, got %s", dead.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the listener to be called")
+	}
+
+	if job, _ = q.Retry(job.ID); job.State != StatePending || job.Attempts != 0 {
+		t.Fatalf("Expected a retried job to start over, got %s with %d attempts", job.State, job.Attempts)
+	}
+
+	waitForState(t, q, job.ID, StateDead)
+
+	if purged := q.PurgeAll(); purged != 1 {
+		t.Fatalf("Expected 1 purged job, got %d", purged)
+	}
+
+	if _, err := q.Get(job.ID); err != ErrNotExistingJob {
+		t.Fatalf("Expected ErrNotExistingJob, got %v", err)
+	}
+}
+
+func waitForState(t *testing.T, q *Queue, ID string, state State) {
+	t.Helper()
+
+	for i := 0; i < 100; i++ {
+		if job, _ := q.Get(ID); job != nil && job.State == state {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected job %s to become %s", ID, state)
+}
+
+func TestSchedule(t *testing.T) {
+	q := New(1)
+	q.Register("noop", func(ctx context.Context, job *Job) error {
+		return nil
+	}, DefaultRetryPolicy)
+
+	if err := q.Schedule("unknown", "@daily", "unknown", ""); err != ErrUnknownKind {
+		t.Fatalf("Expected ErrUnknownKind, got %v", err)
+	}
+
+	if err := q.Schedule("invalid", "every day", "noop", ""); err == nil {
+		t.Fatal("Expected an error for an invalid cron expression")
+	}
+
+	if err := q.Schedule("hourly", "@hourly", "noop", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	schedules := q.Schedules()
+	if len(schedules) != 1 || schedules[0].Name != "hourly" {
+		t.Fatalf("Expected 1 schedule, got %d", len(schedules))
+	}
+
+	if next := schedules[0].Next; next.IsZero() || next.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("Expected the next run within an hour, got %s", next)
+	}
+
+	if err := q.Check(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReschedule(t *testing.T) {
+	q := New(1)
+	q.Register("noop", func(ctx context.Context, job *Job) error {
+		return nil
+	}, DefaultRetryPolicy)
+
+	if err := q.Schedule("sweep", "@hourly", "noop", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Reschedule("sweep", "every minute", "noop", ""); err == nil {
+		t.Fatal("Expected an error for an invalid cron expression")
+	}
+
+	if err := q.Reschedule("sweep", "*/5 * * * *", "noop", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if schedules := q.Schedules(); len(schedules) != 1 || schedules[0].Spec != "*/5 * * * *" {
+		t.Fatalf("Expected the schedule to run every 5 minutes, got %v", schedules)
+	}
+
+	if err := q.Reschedule("sweep", "", "noop", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if schedules := q.Schedules(); len(schedules) != 0 {
+		t.Fatalf("Expected the schedule to be removed, got %d", len(schedules))
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	q := New(1)
+
+	release := make(chan struct{})
+	q.Register("slow", func(ctx context.Context, job *Job) error {
+		<-release
+		return nil
+	}, DefaultRetryPolicy)
+
+	if err := q.SetWorkers("unknown", 2); err != ErrUnknownKind {
+		t.Fatalf("Expected ErrUnknownKind, got %v", err)
+	}
+
+	if err := q.SetWorkers("slow", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		q.Enqueue("slow", "", PriorityNormal)
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+	defer close(release)
+
+	for i := 0; i < 100; i++ {
+		if pools := q.Pools(); pools[0].Active == 2 && pools[0].Pending == 1 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected 2 active workers and 1 pending job, got %+v", q.Pools()[0])
+}
+
+func TestPriority(t *testing.T) {
+	q := New(1)
+
+	order := make(chan string, 3)
+	q.Register("record", func(ctx context.Context, job *Job) error {
+		order <- job.Payload
+		return nil
+	}, DefaultRetryPolicy)
+
+	q.Enqueue("record", "low", PriorityLow)
+	q.Enqueue("record", "normal", PriorityNormal)
+	q.Enqueue("record", "high", PriorityHigh)
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	for _, expected := range []string{"high", "normal", "low"} {
+		select {
+		case payload := <-order:
+			if payload != expected {
+				t.Fatalf("Expected %s, got %s", expected, payload)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s to run", expected)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	q := New(1)
+	q.Register("wait", func(ctx context.Context, job *Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, DefaultRetryPolicy)
+
+	running, _ := q.Enqueue("wait", "", PriorityHigh)
+	pending, _ := q.Enqueue("wait", "", PriorityNormal)
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	waitForState(t, q, running.ID, StateRunning)
+
+	if job, err := q.Cancel(pending.ID); err != nil || job.State != StateCancelled {
+		t.Fatalf("Expected the pending job to be cancelled, got %v", err)
+	}
+
+	if _, err := q.Cancel(running.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForState(t, q, running.ID, StateCancelled)
+
+	if _, err := q.Cancel(running.ID); err != ErrJobFinished {
+		t.Fatalf("Expected ErrJobFinished, got %v", err)
+	}
+}
+
+func TestEnqueueUnique(t *testing.T) {
+	q := New(1)
+	q.Register("noop", func(ctx context.Context, job *Job) error {
+		return nil
+	}, DefaultRetryPolicy)
+
+	first, _ := q.EnqueueUnique("key", "noop", "", PriorityLow)
+	second, _ := q.EnqueueUnique("key", "noop", "", PriorityHigh)
+
+	if first.ID != second.ID || second.Priority != PriorityHigh {
+		t.Fatalf("Expected the existing job with a raised priority, got %s with priority %d", second.ID, second.Priority)
+	}
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	waitForState(t, q, first.ID, StateSucceeded)
+
+	if third, _ := q.EnqueueUnique("key", "noop", "", PriorityLow); third.ID == first.ID {
+		t.Fatal("Expected a new job once the existing job finished")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	q := New(1)
+	q.Register("hang", func(ctx context.Context, job *Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, RetryPolicy{MaxAttempts: 1})
+
+	if err := q.SetTimeout("hang", 10*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	job, _ := q.Enqueue("hang", "", PriorityNormal)
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	waitForState(t, q, job.ID, StateDead)
+
+	if job, _ = q.Get(job.ID); !strings.HasPrefix(job.Error, ErrJobTimeout.Error()) {
+		t.Fatalf("Expected a timeout error, got %s", job.Error)
+	}
+}
+
+func TestOnSucceeded(t *testing.T) {
+	q := New(1)
+	q.Register("noop", func(ctx context.Context, job *Job) error { return nil }, DefaultRetryPolicy)
+
+	q.Start()
+	defer q.Stop(context.Background())
+
+	succeeded := make(chan *Job, 1)
+	q.OnSucceeded(func(job *Job) { succeeded <- job })
+
+	job, _ := q.Enqueue("noop", "payload", PriorityNormal)
+
+	select {
+	case done := <-succeeded:
+		if done.ID != job.ID || done.Payload != "payload" || done.State != StateSucceeded {
+			t.Fatalf("Expected the listener to get the succeeded job, got %s %s", done.ID, done.State)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the listener to be called")
+	}
+}
+
+// memoryPersistence keeps saved jobs in a map
+type memoryPersistence struct {
+	mutex sync.Mutex
+	jobs  map[string]*Job
+}
+
+func (persistence *memoryPersistence) JobList(ctx context.Context) ([]*Job, error) {
+	persistence.mutex.Lock()
+	defer persistence.mutex.Unlock()
+
+	jobs := []*Job{}
+	for _, job := range persistence.jobs {
+		jobs = append(jobs, job.copy())
+	}
+
+	return jobs, nil
+}
+
+func (persistence *memoryPersistence) JobSave(ctx context.Context, job *Job) error {
+	persistence.mutex.Lock()
+	defer persistence.mutex.Unlock()
+
+	persistence.jobs[job.ID] = job.copy()
+
+	return nil
+}
+
+func (persistence *memoryPersistence) JobDelete(ctx context.Context, ID string) error {
+	persistence.mutex.Lock()
+	defer persistence.mutex.Unlock()
+
+	delete(persistence.jobs, ID)
+
+	return nil
+}
+
+func TestStopSavesPendingJobs(t *testing.T) {
+	persistence := &memoryPersistence{jobs: map[string]*Job{}}
+	started := make(chan struct{}, 1)
+
+	q := New(1)
+	q.Register("hang", func(ctx context.Context, job *Job) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}, DefaultRetryPolicy)
+	q.SetPersistence(persistence)
+	q.Start()
+
+	running, _ := q.Enqueue("hang", "running", PriorityNormal)
+	<-started
+	pending, _ := q.Enqueue("hang", "pending", PriorityNormal)
+
+	// The running job ignores the stop until its context is cancelled at the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := q.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to pass, got %v", err)
+	}
+
+	if len(persistence.jobs) != 2 || persistence.jobs[running.ID] == nil || persistence.jobs[running.ID].Attempts != 0 || persistence.jobs[pending.ID] == nil {
+		t.Fatalf("Expected the interrupted and the pending job to be saved, got %v", persistence.jobs)
+	}
+
+	// The saved jobs run after the next start
+	payloads := make(chan string, 2)
+	q = New(1)
+	q.Register("hang", func(ctx context.Context, job *Job) error {
+		payloads <- job.Payload
+		return nil
+	}, DefaultRetryPolicy)
+	q.SetPersistence(persistence)
+	q.Start()
+	defer q.Stop(context.Background())
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-payloads:
+		case <-time.After(time.Second):
+			t.Fatal("Expected the saved jobs to run after the restart")
+		}
+	}
+
+	if len(persistence.jobs) != 0 {
+		t.Fatalf("Expected the restored jobs to be removed, got %d", len(persistence.jobs))
+	}
+}
+
+func TestStopTwice(t *testing.T) {
+	q := New(1)
+	q.Register("noop", func(ctx context.Context, job *Job) error {
+		return nil
+	}, DefaultRetryPolicy)
+	q.Start()
+
+	for i := 0; i < 2; i++ {
+		if err := q.Stop(context.Background()); err != nil {
+			t.Fatalf("Expected the queue to stop, got %v", err)
+		}
+	}
+
+	if _, err := q.Enqueue("noop", "", PriorityNormal); !errors.Is(err, ErrStopping) {
+		t.Fatalf("Expected ErrStopping after the queue stopped, got %v", err)
+	}
+}
+
+func TestDeadJobsSurviveRestart(t *testing.T) {
+	persistence := &memoryPersistence{jobs: map[string]*Job{}}
+	broken := func(ctx context.Context, job *Job) error {
+		return Permanent(errors.New("Permanent error"))
+	}
+
+	q := New(1)
+	q.Register("broken", broken, DefaultRetryPolicy)
+	q.SetPersistence(persistence)
+	q.Start()
+
+	first, _ := q.Enqueue("broken", "first", PriorityNormal)
+	second, _ := q.Enqueue("broken", "second", PriorityNormal)
+	waitForState(t, q, first.ID, StateDead)
+	waitForState(t, q, second.ID, StateDead)
+	q.Stop(context.Background())
+
+	q = New(1)
+	q.Register("broken", broken, DefaultRetryPolicy)
+	q.SetPersistence(persistence)
+	q.Start()
+	defer q.Stop(context.Background())
+
+	if job, err := q.Get(first.ID); err != nil || job.State != StateDead || job.Error != "Permanent error" {
+		t.Fatalf("Expected the dead job to be restored, got %v (%v)", job, err)
+	}
+
+	if err := q.Purge(first.ID); err != nil || persistence.jobs[first.ID] != nil {
+		t.Fatalf("Expected the purged job to be removed from the persistence (%v)", err)
+	}
+
+	if _, err := q.Retry(second.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	waitForState(t, q, second.ID, StateDead)
+
+	if q.PurgeAll() != 1 || len(persistence.jobs) != 0 {
+		t.Fatalf("Expected all dead jobs to be removed from the persistence, got %d", len(persistence.jobs))
+	}
+}
@@ -0,0 +1,72 @@
+package queue
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy determines how often and when a failed job is retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a job is tried, including the first attempt
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, it doubles for every next retry
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy tries a job 5 times, waiting up to 10 seconds, 20 seconds, 40 seconds and so on in between
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Second,
+	MaxBackoff:     time.Hour,
+}
+
+// Backoff returns how long to wait before retrying after the given attempt. It uses exponential
+// backoff with full jitter so that jobs failing at the same time do not retry at the same time.
+func (policy RetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := policy.InitialBackoff
+	for i := 1; i < attempt && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (err *permanentError) Error() string {
+	return err.err.Error()
+}
+
+func (err *permanentError) Unwrap() error {
+	return err.err
+}
+
+// Permanent marks err as permanent, the job that returned it will not be retried
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err}
+}
+
+// IsPermanent checks if err was marked as permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
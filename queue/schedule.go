@@ -0,0 +1,113 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/rs/zerolog/log"
+)
+
+// Schedule enqueues a job at every time that matches a cron expression
+type Schedule struct {
+	Name     string
+	Spec     string
+	Kind     string
+	Payload  string
+	Next     time.Time
+	Previous time.Time
+}
+
+type scheduleEntry struct {
+	schedule *Schedule
+	entry    cron.EntryID
+}
+
+// Schedule enqueues a job of the given kind with a low priority at every time matching spec, a standard
+// cron expression like "*/15 * * * *" or a descriptor like "@daily" or "@every 1h"
+func (queue *Queue) Schedule(name, spec, kind, payload string) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if _, ok := queue.handlers[kind]; !ok {
+		return ErrUnknownKind
+	}
+
+	if _, ok := queue.schedules[name]; ok {
+		return fmt.Errorf("Schedule %s already exists", name)
+	}
+
+	entry, err := queue.cron.AddFunc(spec, func() {
+		if _, err := queue.Enqueue(kind, payload, PriorityLow); err != nil {
+			log.Warn().Err(err).Str("schedule", name).Msg("Error enqueueing scheduled job")
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("Invalid schedule %s: %w", name, err)
+	}
+
+	queue.schedules[name] = &scheduleEntry{&Schedule{Name: name, Spec: spec, Kind: kind, Payload: payload}, entry}
+
+	log.Info().Str("schedule", name).Str("spec", spec).Str("kind", kind).Msg("Scheduled job")
+
+	return nil
+}
+
+// Reschedule replaces the cron expression of the schedule name, or creates it if it does not exist
+// yet. An empty spec removes the schedule. The schedule is left untouched if spec is invalid.
+func (queue *Queue) Reschedule(name, spec, kind, payload string) error {
+	if spec != "" {
+		if _, err := cron.ParseStandard(spec); err != nil {
+			return fmt.Errorf("Invalid schedule %s: %w", name, err)
+		}
+	}
+
+	queue.mutex.Lock()
+	if existing, ok := queue.schedules[name]; ok {
+		queue.cron.Remove(existing.entry)
+		delete(queue.schedules, name)
+	}
+	queue.mutex.Unlock()
+
+	if spec == "" {
+		log.Info().Str("schedule", name).Msg("Removed schedule")
+		return nil
+	}
+
+	return queue.Schedule(name, spec, kind, payload)
+}
+
+// Schedules returns all schedules with their next and previous run times
+func (queue *Queue) Schedules() []*Schedule {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	schedules := []*Schedule{}
+
+	for _, entry := range queue.schedules {
+		schedule := *entry.schedule
+		cronEntry := queue.cron.Entry(entry.entry)
+		schedule.Next = cronEntry.Next
+		schedule.Previous = cronEntry.Prev
+		schedules = append(schedules, &schedule)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	return schedules
+}
+
+// Check returns an error if a schedule is more than a minute late, which means the scheduler got stuck
+func (queue *Queue) Check(ctx context.Context) error {
+	for _, schedule := range queue.Schedules() {
+		if !schedule.Next.IsZero() && time.Since(schedule.Next) > time.Minute {
+			return fmt.Errorf("Schedule %s should have run at %s", schedule.Name, schedule.Next.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package readlater pushes bookmarks to read it later services like Pocket and Instapaper, which
+// sync them to e-readers
+package readlater
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+// pocketBatchSize is the number of bookmarks sent to Pocket in a single request
+const pocketBatchSize = 100
+
+// Service is a read it later service that bookmarks can be pushed to
+type Service interface {
+	Push(ctx context.Context, bookmarks []*storage.Bookmark) error
+}
+
+// Pocket pushes bookmarks to a Pocket account with the consumer key of an app and the access token
+// the user granted it
+type Pocket struct {
+	consumerKey string
+	accessToken string
+	client      *http.Client
+	baseURL     string
+}
+
+// NewPocket creates a client for Pocket, see https://getpocket.com/developer/
+func NewPocket(consumerKey, accessToken string) *Pocket {
+	return &Pocket{
+		consumerKey: consumerKey,
+		accessToken: accessToken,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		baseURL:     "https://getpocket.com",
+	}
+}
+
+// Push adds the bookmarks to the list of Pocket with their title and tags, Pocket keeps a url that
+// is already in the list once
+func (pocket *Pocket) Push(ctx context.Context, bookmarks []*storage.Bookmark) error {
+	for start := 0; start < len(bookmarks); start += pocketBatchSize {
+		end := start + pocketBatchSize
+		if end > len(bookmarks) {
+			end = len(bookmarks)
+		}
+
+		actions := []map[string]string{}
+		for _, bookmark := range bookmarks[start:end] {
+			actions = append(actions, map[string]string{
+				"action": "add",
+				"url":    bookmark.URL,
+				"title":  bookmark.Title,
+				"tags":   strings.Join(bookmark.Tags, ","),
+			})
+		}
+
+		if err := pocket.call(ctx, "/v3/send", map[string]interface{}{"actions": actions}, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Authorize runs the first half of the OAuth flow of Pocket, the user grants access at the returned
+// url after which Token exchanges the code for an access token
+func (pocket *Pocket) Authorize(ctx context.Context, redirectURL string) (string, string, error) {
+	result := struct{ Code string }{}
+	if err := pocket.call(ctx, "/v3/oauth/request", map[string]interface{}{"redirect_uri": redirectURL}, &result); err != nil {
+		return "", "", err
+	}
+
+	query := url.Values{"request_token": {result.Code}, "redirect_uri": {redirectURL}}
+
+	return result.Code, pocket.baseURL + "/auth/authorize?" + query.Encode(), nil
+}
+
+// Token exchanges the code of an authorized request for an access token
+func (pocket *Pocket) Token(ctx context.Context, code string) (string, error) {
+	result := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := pocket.call(ctx, "/v3/oauth/authorize", map[string]interface{}{"code": code}, &result); err != nil {
+		return "", err
+	}
+
+	return result.AccessToken, nil
+}
+
+func (pocket *Pocket) call(ctx context.Context, path string, params map[string]interface{}, result interface{}) error {
+	params["consumer_key"] = pocket.consumerKey
+	if pocket.accessToken != "" {
+		params["access_token"] = pocket.accessToken
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", pocket.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	request.Header.Set("X-Accept", "application/json")
+
+	response, err := pocket.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		// Pocket explains what went wrong in a header instead of the body
+		return fmt.Errorf("Error calling Pocket %s: %d %s", path, response.StatusCode, response.Header.Get("X-Error"))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Instapaper pushes bookmarks to an Instapaper account with its username and password, an account
+// without password has an empty password
+type Instapaper struct {
+	username string
+	password string
+	client   *http.Client
+	baseURL  string
+}
+
+// NewInstapaper creates a client for the simple api of Instapaper, see https://www.instapaper.com/api/simple
+func NewInstapaper(username, password string) *Instapaper {
+	return &Instapaper{
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		baseURL:  "https://www.instapaper.com",
+	}
+}
+
+// Push adds the bookmarks one by one with their title and excerpt, the simple api has no way to add
+// several at once
+func (instapaper *Instapaper) Push(ctx context.Context, bookmarks []*storage.Bookmark) error {
+	for _, bookmark := range bookmarks {
+		form := url.Values{"url": {bookmark.URL}, "title": {bookmark.Title}, "selection": {bookmark.Excerpt}}
+
+		request, err := http.NewRequestWithContext(ctx, "POST", instapaper.baseURL+"/api/add", strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.SetBasicAuth(instapaper.username, instapaper.password)
+
+		response, err := instapaper.client.Do(request)
+		if err != nil {
+			return err
+		}
+
+		message, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+
+		if response.StatusCode != 201 {
+			return fmt.Errorf("Error adding %s to Instapaper: %d %s", bookmark.URL, response.StatusCode, strings.TrimSpace(string(message)))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package readlater
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestPocket(t *testing.T) {
+	batches := []int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := struct {
+			ConsumerKey string `json:"consumer_key"`
+			AccessToken string `json:"access_token"`
+			Actions     []map[string]string
+		}{}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		if r.URL.Path != "/v3/send" || params.ConsumerKey != "key" || params.AccessToken != "token" {
+			w.Header().Set("X-Error", "Invalid consumer key.")
+			w.WriteHeader(401)
+			return
+		}
+
+		if params.Actions[0]["tags"] != "go,web" {
+			w.WriteHeader(400)
+			return
+		}
+
+		batches = append(batches, len(params.Actions))
+		w.Write([]byte(`{"status": 1}`))
+	}))
+	defer server.Close()
+
+	pocket := NewPocket("key", "token")
+	pocket.baseURL = server.URL
+
+	bookmarks := []*storage.Bookmark{}
+	for i := 0; i <= pocketBatchSize; i++ {
+		bookmarks = append(bookmarks, &storage.Bookmark{URL: "https://example.com", Tags: storage.Tags{"go", "web"}})
+	}
+
+	if err := pocket.Push(context.Background(), bookmarks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 2 || batches[0] != pocketBatchSize || batches[1] != 1 {
+		t.Fatalf("Expected 2 batches, got %v", batches)
+	}
+
+	pocket.consumerKey = "wrong"
+	if err := pocket.Push(context.Background(), bookmarks); err == nil || err.Error() != "Error calling Pocket /v3/send: 401 Invalid consumer key." {
+		t.Fatalf("Expected the error of Pocket, got %v", err)
+	}
+}
+
+func TestInstapaper(t *testing.T) {
+	added := []string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, _ := r.BasicAuth(); username != "alice" || password != "" {
+			w.WriteHeader(403)
+			return
+		}
+
+		added = append(added, r.FormValue("url")+" "+r.FormValue("title"))
+		w.WriteHeader(201)
+	}))
+	defer server.Close()
+
+	instapaper := NewInstapaper("alice", "")
+	instapaper.baseURL = server.URL
+
+	bookmarks := []*storage.Bookmark{{URL: "https://example.com/a", Title: "A"}, {URL: "https://example.com/b", Title: "B"}}
+	if err := instapaper.Push(context.Background(), bookmarks); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(added) != 2 || added[1] != "https://example.com/b B" {
+		t.Fatalf("Expected every bookmark to be added, got %v", added)
+	}
+
+	instapaper.username = "bob"
+	if err := instapaper.Push(context.Background(), bookmarks); err == nil {
+		t.Fatal("Expected an error when Instapaper refuses the credentials")
+	}
+}
@@ -0,0 +1,97 @@
+// Package readwise pushes highlights to Readwise, which resurfaces them for review
+package readwise
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// batchSize is the number of highlights sent in a single request
+	batchSize = 100
+
+	// maxTextLength is the longest text Readwise accepts for a highlight
+	maxTextLength = 8191
+)
+
+// Highlight is a single highlight or note as Readwise represents it
+type Highlight struct {
+	Text          string `json:"text"`
+	Title         string `json:"title,omitempty"`
+	SourceURL     string `json:"source_url,omitempty"`
+	SourceType    string `json:"source_type,omitempty"`
+	Note          string `json:"note,omitempty"`
+	HighlightedAt string `json:"highlighted_at,omitempty"`
+}
+
+// Client pushes highlights to the Readwise api with an access token
+type Client struct {
+	token   string
+	client  *http.Client
+	baseURL string
+}
+
+// New creates a client for the given access token, see https://readwise.io/access_token
+func New(token string) *Client {
+	return &Client{
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: "https://readwise.io",
+	}
+}
+
+// Push creates the highlights, Readwise updates a highlight with the same text, title and source
+// url instead of creating it twice
+func (client *Client) Push(ctx context.Context, highlights []*Highlight) error {
+	for _, highlight := range highlights {
+		if text := []rune(highlight.Text); len(text) > maxTextLength {
+			highlight.Text = string(text[:maxTextLength])
+		}
+	}
+
+	for start := 0; start < len(highlights); start += batchSize {
+		end := start + batchSize
+		if end > len(highlights) {
+			end = len(highlights)
+		}
+
+		if err := client.call(ctx, "/api/v2/highlights/", map[string]interface{}{"highlights": highlights[start:end]}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (client *Client) call(ctx context.Context, path string, params interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", client.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Token "+client.token)
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := client.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 300 {
+		failure, _ := ioutil.ReadAll(response.Body)
+		return fmt.Errorf("Error calling %s: %d %s", path, response.StatusCode, strings.TrimSpace(string(failure)))
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package readwise
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPush(t *testing.T) {
+	batches := []int{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/highlights/" || r.Header.Get("Authorization") != "Token token" {
+			w.WriteHeader(401)
+			w.Write([]byte(`{"detail": "Invalid token."}`))
+			return
+		}
+
+		params := struct {
+			Highlights []*Highlight
+		}{}
+		json.NewDecoder(r.Body).Decode(&params)
+		batches = append(batches, len(params.Highlights))
+	}))
+	defer server.Close()
+
+	client := New("token")
+	client.baseURL = server.URL
+
+	highlights := []*Highlight{{Text: strings.Repeat("é", maxTextLength+1)}}
+	for i := 0; i < batchSize; i++ {
+		highlights = append(highlights, &Highlight{Text: "Hello world"})
+	}
+
+	if err := client.Push(context.Background(), highlights); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(batches) != 2 || batches[0] != batchSize || batches[1] != 1 {
+		t.Fatalf("Expected 2 batches, got %v", batches)
+	}
+
+	if len([]rune(highlights[0].Text)) != maxTextLength {
+		t.Fatalf("Expected long texts to be truncated, got %d characters", len([]rune(highlights[0].Text)))
+	}
+
+	client.token = "wrong"
+	if err := client.Push(context.Background(), highlights); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("Expected an error for an invalid token, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nrocco/bookmarks/activitypub"
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JobActivityPub delivers the bookmarks that were shared since the previous delivery to the followers
+	JobActivityPub = "activitypub.deliver"
+
+	// DefaultActivityPubSchedule delivers shared bookmarks every 5 minutes
+	DefaultActivityPubSchedule = "*/5 * * * *"
+)
+
+// RegisterActivityPub delivers shared bookmarks to the followers of the actor at every time that
+// matches the cron expression schedule. Bookmarks that changed before the start are not delivered
+// again. It must be called before the queue is started.
+func RegisterActivityPub(q *queue.Queue, store *storage.Store, actor *activitypub.Actor, schedule string) error {
+	q.Register(JobActivityPub, deliverActivityPub(store, actor), queue.RetryPolicy{MaxAttempts: 1})
+
+	if schedule == "" {
+		log.Info().Str("schedule", "activitypub").Msg("Schedule is disabled")
+		return nil
+	}
+
+	return q.Schedule("activitypub", schedule, JobActivityPub, "")
+}
+
+func deliverActivityPub(store *storage.Store, actor *activitypub.Actor) queue.Handler {
+	since := time.Now()
+	mutex := sync.Mutex{}
+
+	return func(ctx context.Context, job *queue.Job) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		started := time.Now()
+		activities := []*activitypub.Activity{}
+
+		// Shared bookmarks are listed by the time they changed, newest first, until one did not change since the previous delivery
+		for offset, done := 0, false; !done; offset += 100 {
+			bookmarks, _ := store.BookmarkList(ctx, &storage.BookmarkListOptions{
+				Tags:   storage.Tags{capture.Shared},
+				Sort:   storage.Sort{{Field: "updated", Descending: true}},
+				Limit:  100,
+				Offset: offset,
+			})
+
+			for _, bookmark := range *bookmarks {
+				if !bookmark.Updated.After(since) {
+					done = true
+					break
+				}
+
+				activities = append(activities, actor.Create(bookmark))
+			}
+
+			done = done || len(*bookmarks) < 100
+		}
+
+		since = started
+
+		if len(activities) == 0 {
+			return nil
+		}
+
+		// Followers on the same server share an inbox, which only needs every activity once
+		inboxes := map[string]bool{}
+		for _, follower := range *store.FollowerList(ctx) {
+			inboxes[follower.Inbox] = true
+		}
+
+		// Servers recognize a note they already have, so a bookmark that changed is delivered again
+		// without showing up twice. An unreachable server misses the activities instead of holding up the others.
+		for inbox := range inboxes {
+			for _, activity := range activities {
+				if err := actor.Deliver(ctx, inbox, activity); err != nil {
+					log.Ctx(ctx).Warn().Err(err).Str("inbox", inbox).Msg("Error delivering activity")
+					break
+				}
+			}
+		}
+
+		log.Ctx(ctx).Info().Int("bookmarks", len(activities)).Int("inboxes", len(inboxes)).Msg("Delivered shared bookmarks")
+
+		return nil
+	}
+}
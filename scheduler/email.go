@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/mailer"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JobEmailDigest emails the oldest bookmarks that are still to be read
+	JobEmailDigest = "email.digest"
+
+	// DefaultEmailDigestSchedule emails the digest every Sunday morning
+	DefaultEmailDigestSchedule = "0 8 * * 0"
+
+	// DefaultEmailDigestSize is the number of bookmarks in the email digest
+	DefaultEmailDigestSize = 10
+
+	// emailExcerptLength is the number of characters of the excerpt of a bookmark shown in the email
+	emailExcerptLength = 300
+)
+
+// Mailer sends emails, like the mailer package does through an smtp server
+type Mailer interface {
+	Send(subject, text, html string, attachments ...mailer.Attachment) error
+}
+
+// EmailDigest configures the email of the oldest bookmarks that are still to be read
+type EmailDigest struct {
+	// Size is the number of bookmarks in the digest
+	Size int
+
+	// PublicURL and Secret make a link to archive every bookmark without logging in, there are no
+	// links if either is empty
+	PublicURL string
+	Secret    string
+}
+
+var emailDigestTemplate = template.Must(template.New("digest").Parse(`<!DOCTYPE html>
+<html>
+  <body style="max-width: 40em; font-family: Georgia, serif; line-height: 1.6;">
+    <p>The oldest of the {{ .Total }} bookmarks still to read:</p>
+    {{ range .Bookmarks }}<h3><a href="{{ .URL }}">{{ .Title }}</a></h3>
+    {{ if .Excerpt }}<p>{{ .Excerpt }}</p>
+    {{ end }}{{ if .ArchiveURL }}<p><a href="{{ .ArchiveURL }}">Archive</a></p>
+    {{ end }}{{ end }}
+  </body>
+</html>
+`))
+
+type emailBookmark struct {
+	Title      string
+	URL        string
+	Excerpt    string
+	ArchiveURL string
+}
+
+// RegisterEmailDigest emails the oldest bookmarks that are still to be read at every time that matches
+// the cron expression schedule. It must be called before the queue is started.
+func RegisterEmailDigest(q *queue.Queue, store storage.Storer, emailer Mailer, digest EmailDigest, schedule string) error {
+	q.Register(JobEmailDigest, sendEmailDigest(store, emailer, digest), queue.DefaultRetryPolicy)
+
+	if schedule == "" {
+		log.Info().Str("schedule", "email").Msg("Schedule is disabled")
+		return nil
+	}
+
+	return q.Schedule("email", schedule, JobEmailDigest, "")
+}
+
+func sendEmailDigest(store storage.Storer, emailer Mailer, digest EmailDigest) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		backlog := capture.Backlog(ctx, store, digest.Size)
+		if len(backlog) == 0 {
+			return nil
+		}
+
+		_, total := store.BookmarkList(ctx, &storage.BookmarkListOptions{Tags: storage.Tags{capture.ReadItLater}, Limit: 1})
+
+		bookmarks := []*emailBookmark{}
+		lines := []string{fmt.Sprintf("The oldest of the %d bookmarks still to read:", total)}
+
+		for _, bookmark := range backlog {
+			item := &emailBookmark{Title: bookmark.Title, URL: bookmark.URL, Excerpt: bookmark.Excerpt}
+
+			if excerpt := []rune(item.Excerpt); len(excerpt) > emailExcerptLength {
+				item.Excerpt = string(excerpt[:emailExcerptLength]) + "…"
+			}
+
+			if digest.PublicURL != "" && digest.Secret != "" {
+				item.ArchiveURL = strings.TrimSuffix(digest.PublicURL, "/") + "/api/archive/" + bookmark.ID + "?" + url.Values{"signature": {capture.ArchiveSignature(digest.Secret, bookmark.ID)}}.Encode()
+			}
+
+			bookmarks = append(bookmarks, item)
+			lines = append(lines, "", item.Title, item.URL)
+			if item.Excerpt != "" {
+				lines = append(lines, item.Excerpt)
+			}
+			if item.ArchiveURL != "" {
+				lines = append(lines, "Archive: "+item.ArchiveURL)
+			}
+		}
+
+		html := &bytes.Buffer{}
+		if err := emailDigestTemplate.Execute(html, map[string]interface{}{"Total": total, "Bookmarks": bookmarks}); err != nil {
+			return queue.Permanent(err)
+		}
+
+		if err := emailer.Send(fmt.Sprintf("%d bookmarks to read", total), strings.Join(lines, "\n"), html.String()); err != nil {
+			return err
+		}
+
+		log.Ctx(ctx).Info().Int("bookmarks", len(bookmarks)).Msg("Emailed digest")
+
+		return nil
+	}
+}
@@ -0,0 +1,237 @@
+// Package scheduler defines the background jobs of bookmarks and when they run
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JobRefreshFeed refreshes a single feed, its payload is the ID of the feed
+	JobRefreshFeed = "feed.refresh"
+
+	// JobRefreshFeeds enqueues a JobRefreshFeed for the feeds that were not refreshed recently, see Refresher
+	JobRefreshFeeds = "feed.sweep"
+
+	// JobFetchBookmark fetches the content of a single bookmark, its payload is the ID of the bookmark
+	JobFetchBookmark = "bookmark.fetch"
+
+	// JobCleanup removes empty and duplicate tags
+	JobCleanup = "maintenance.cleanup"
+
+	// JobOptimize keeps the database fast by updating statistics, reclaiming free pages and merging full text search indexes
+	JobOptimize = "maintenance.optimize"
+
+	// JobPurge permanently removes bookmarks, feeds and thoughts that were deleted longer ago than the retention
+	JobPurge = "maintenance.purge"
+
+	// DefaultRetention is how long deleted bookmarks, feeds and thoughts can be restored before they are purged
+	DefaultRetention = 30 * 24 * time.Hour
+)
+
+// DefaultSchedules maps the name of every schedule to its default cron expression
+var DefaultSchedules = map[string]string{
+	"feeds":    "*/15 * * * *",
+	"cleanup":  "@daily",
+	"purge":    "@daily",
+	"optimize": "@daily",
+}
+
+// scheduledJobs maps the name of every schedule to the kind of job it enqueues
+var scheduledJobs = map[string]string{
+	"feeds":    JobRefreshFeeds,
+	"cleanup":  JobCleanup,
+	"purge":    JobPurge,
+	"optimize": JobOptimize,
+}
+
+// DefaultTimeouts maps every kind of job to how long it may run by default
+var DefaultTimeouts = map[string]time.Duration{
+	JobRefreshFeed:   5 * time.Minute,
+	JobRefreshFeeds:  time.Minute,
+	JobFetchBookmark: time.Minute,
+	JobCleanup:       30 * time.Minute,
+	JobPurge:         30 * time.Minute,
+	JobOptimize:      30 * time.Minute,
+}
+
+// RegisterJobs registers the handlers of all background jobs with the queue, deleted records
+// are purged once they were deleted longer ago than retention and refresher decides which feeds
+// are refreshed
+func RegisterJobs(q *queue.Queue, store *storage.Store, retention time.Duration, refresher *Refresher) {
+	q.Register(JobRefreshFeed, refreshFeed(store), queue.DefaultRetryPolicy)
+	q.Register(JobRefreshFeeds, refreshFeeds(store, q, refresher), queue.RetryPolicy{MaxAttempts: 1})
+	q.Register(JobFetchBookmark, fetchBookmark(store), queue.DefaultRetryPolicy)
+	q.Register(JobCleanup, cleanup(store), queue.DefaultRetryPolicy)
+	q.Register(JobPurge, purge(store, retention), queue.DefaultRetryPolicy)
+	q.Register(JobOptimize, optimize(store), queue.DefaultRetryPolicy)
+
+	q.OnDead(func(job *queue.Job) {
+		if job.Kind == JobFetchBookmark {
+			fetchBookmarkFailed(log.Logger.WithContext(context.Background()), store, job)
+		} else if job.Kind == JobRefreshFeed {
+			refreshFeedFailed(log.Logger.WithContext(context.Background()), store, job)
+		}
+	})
+
+	for kind, timeout := range DefaultTimeouts {
+		q.SetTimeout(kind, timeout)
+	}
+}
+
+// RegisterSchedules schedules the background jobs, schedules is a map of schedule name to cron expression
+// where an empty expression disables the schedule
+func RegisterSchedules(q *queue.Queue, schedules map[string]string) error {
+	for name, spec := range schedules {
+		kind, ok := scheduledJobs[name]
+		if !ok {
+			return errors.New("Unknown schedule " + name)
+		}
+
+		if spec == "" {
+			log.Info().Str("schedule", name).Msg("Schedule is disabled")
+			continue
+		}
+
+		if err := q.Schedule(name, spec, kind, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnqueueRefreshFeed enqueues a job to refresh a feed, unless the feed is already being refreshed
+func EnqueueRefreshFeed(q *queue.Queue, ID string, priority queue.Priority) (*queue.Job, error) {
+	return q.EnqueueUnique(JobRefreshFeed+":"+ID, JobRefreshFeed, ID, priority)
+}
+
+// EnqueueFetchBookmark enqueues a job to fetch the content of a bookmark, unless it is already being fetched
+func EnqueueFetchBookmark(q *queue.Queue, ID string, priority queue.Priority) (*queue.Job, error) {
+	return q.EnqueueUnique(JobFetchBookmark+":"+ID, JobFetchBookmark, ID, priority)
+}
+
+func refreshFeed(store *storage.Store) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		feed := &storage.Feed{ID: job.Payload}
+		if err := store.FeedGet(ctx, feed); err != nil {
+			return queue.Permanent(err)
+		}
+
+		if err := store.FeedRefresh(ctx, feed); err != nil {
+			return retryable(err, storage.ErrFetchFailed)
+		}
+
+		return nil
+	}
+}
+
+func refreshFeeds(store *storage.Store, q *queue.Queue, refresher *Refresher) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		settings := refresher.Settings()
+		notRefreshedSince := time.Now().Add(-settings.Window)
+
+		feeds, totalCount := store.FeedList(ctx, &storage.FeedListOptions{
+			NotRefreshedSince: notRefreshedSince,
+			MaxErrors:         settings.MaxErrors,
+			Limit:             settings.BatchSize,
+		})
+
+		log.Ctx(ctx).Info().Int("feeds", totalCount).Time("not_refreshed_since", notRefreshedSince).Msg("Unfresh feeds found")
+
+		for _, feed := range *feeds {
+			if _, err := EnqueueRefreshFeed(q, feed.ID, queue.PriorityLow); err != nil {
+				log.Ctx(ctx).Warn().Err(err).Str("feed_title", feed.Title).Msg("Error enqueueing feed refresh")
+			}
+		}
+
+		return nil
+	}
+}
+
+// refreshFeedFailed records that a feed could not be refreshed after all attempts, so sweeps back
+// off from it and eventually suspend it
+func refreshFeedFailed(ctx context.Context, store *storage.Store, job *queue.Job) {
+	feed := &storage.Feed{ID: job.Payload}
+	if err := store.FeedFailed(ctx, feed, job.Error); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("feed", feed.ID).Msg("Error recording that the feed could not be refreshed")
+	}
+}
+
+func fetchBookmark(store *storage.Store) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		bookmark := &storage.Bookmark{ID: job.Payload}
+		if err := store.BookmarkGet(ctx, bookmark); err != nil {
+			return queue.Permanent(err)
+		}
+
+		err := store.BookmarkFetch(ctx, bookmark)
+		if errors.Is(err, storage.ErrNoBookmarkURL) {
+			return queue.Permanent(err)
+		}
+
+		return err
+	}
+}
+
+// fetchBookmarkFailed marks a bookmark that is still pending as failed once its content could not
+// be fetched after all attempts
+func fetchBookmarkFailed(ctx context.Context, store *storage.Store, job *queue.Job) {
+	bookmark := &storage.Bookmark{ID: job.Payload}
+	if err := store.BookmarkGet(ctx, bookmark); err != nil || bookmark.Status != storage.BookmarkPending {
+		return
+	}
+
+	bookmark.Status = storage.BookmarkFailed
+	if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("bookmark", bookmark.ID).Msg("Error marking bookmark as failed")
+	}
+}
+
+func cleanup(store *storage.Store) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		cleaned, err := store.Cleanup(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Ctx(ctx).Info().Int64("cleaned", cleaned).Msg("Cleaned up tags")
+
+		return nil
+	}
+}
+
+func purge(store *storage.Store, retention time.Duration) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		purged, err := store.Purge(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+
+		log.Ctx(ctx).Info().Int64("purged", purged).Dur("retention", retention).Msg("Purged deleted records")
+
+		return nil
+	}
+}
+
+func optimize(store *storage.Store) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		return store.Optimize(ctx)
+	}
+}
+
+// retryable marks err as permanent unless it is one of the given transient errors
+func retryable(err error, transient ...error) error {
+	for _, target := range transient {
+		if errors.Is(err, target) {
+			return err
+		}
+	}
+
+	return queue.Permanent(err)
+}
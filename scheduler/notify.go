@@ -0,0 +1,93 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JobDigest sends a digest of the bookmarks that are still to be read to the notifier
+	JobDigest = "notify.digest"
+
+	// EventFeedBroken is sent when a feed could not be refreshed after all attempts
+	EventFeedBroken = "feed.broken"
+
+	// EventDigest is sent on a schedule and lists the bookmarks that are still to be read
+	EventDigest = "digest"
+
+	// DefaultDigestSchedule sends the digest every morning
+	DefaultDigestSchedule = "0 8 * * *"
+
+	// digestLimit is the number of bookmarks listed in the digest
+	digestLimit = 10
+)
+
+// Notifier posts messages to users, like the Matrix bot does in its room
+type Notifier interface {
+	Notify(ctx context.Context, text string) error
+}
+
+// RegisterNotifier sends the given events to the notifier, the digest is sent at every time that
+// matches the cron expression digest. It must be called before the queue is started.
+func RegisterNotifier(q *queue.Queue, store storage.Storer, notifier Notifier, events []string, digest string) error {
+	for _, event := range events {
+		switch event {
+		case EventFeedBroken:
+			q.OnDead(func(job *queue.Job) {
+				if job.Kind == JobRefreshFeed {
+					feedBroken(log.Logger.WithContext(context.Background()), store, notifier, job)
+				}
+			})
+		case EventDigest:
+			q.Register(JobDigest, sendDigest(store, notifier), queue.DefaultRetryPolicy)
+
+			if digest == "" {
+				log.Info().Str("schedule", EventDigest).Msg("Schedule is disabled")
+				continue
+			}
+
+			if err := q.Schedule(EventDigest, digest, JobDigest, ""); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("Unknown event %s, use %s or %s", event, EventFeedBroken, EventDigest)
+		}
+	}
+
+	return nil
+}
+
+func feedBroken(ctx context.Context, store storage.Storer, notifier Notifier, job *queue.Job) {
+	feed := &storage.Feed{ID: job.Payload}
+	if err := store.FeedGet(ctx, feed); err != nil {
+		// Deleted feeds are not worth a notification
+		return
+	}
+
+	text := fmt.Sprintf("Feed %s (%s) could not be refreshed: %s", feed.Title, feed.URL, job.Error)
+	if err := notifier.Notify(ctx, text); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("feed", feed.ID).Msg("Error sending notification")
+	}
+}
+
+func sendDigest(store storage.Storer, notifier Notifier) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		unread := capture.Unread(ctx, store, digestLimit)
+		if len(unread) == 0 {
+			return nil
+		}
+
+		lines := []string{"Still to read:"}
+		for _, bookmark := range unread {
+			lines = append(lines, "- "+bookmark.Title+" "+bookmark.URL)
+		}
+
+		return notifier.Notify(ctx, strings.Join(lines, "\n"))
+	}
+}
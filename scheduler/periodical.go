@@ -0,0 +1,189 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/epub"
+	"github.com/nrocco/bookmarks/mailer"
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JobPeriodical compiles the unread feed items and bookmarks into an EPUB
+	JobPeriodical = "periodical.compile"
+
+	// DefaultPeriodicalSchedule compiles the periodical every morning
+	DefaultPeriodicalSchedule = "0 6 * * *"
+
+	// DefaultPeriodicalSize is the maximum number of articles in the periodical
+	DefaultPeriodicalSize = 100
+)
+
+// Periodical configures the EPUB of unread feed items and bookmarks, for reading on an e-reader
+type Periodical struct {
+	// Path is where the EPUB is written, replacing the previous one
+	Path string
+
+	// Size is the maximum number of articles, the bookmarks to read later go first and the newest
+	// feed items fill up the rest
+	Size int
+
+	// Mailer emails the EPUB as an attachment, it is not emailed if it is nil
+	Mailer Mailer
+}
+
+type periodicalItem struct {
+	feed *storage.Feed
+	item *storage.FeedItem
+}
+
+// RegisterPeriodical compiles the periodical at every time that matches the cron expression
+// schedule. It must be called before the queue is started.
+func RegisterPeriodical(q *queue.Queue, store storage.Storer, periodical Periodical, schedule string) error {
+	q.Register(JobPeriodical, compilePeriodical(store, periodical), queue.DefaultRetryPolicy)
+
+	if schedule == "" {
+		log.Info().Str("schedule", "periodical").Msg("Schedule is disabled")
+		return nil
+	}
+
+	return q.Schedule("periodical", schedule, JobPeriodical, "")
+}
+
+func compilePeriodical(store storage.Storer, periodical Periodical) queue.Handler {
+	return func(ctx context.Context, job *queue.Job) error {
+		now := time.Now()
+
+		book := &epub.Book{
+			ID:    "urn:bookmarks:periodical:" + now.Format("2006-01-02T15:04:05"),
+			Title: "Bookmarks of " + now.Format("Monday January 2, 2006"),
+			Date:  now,
+		}
+
+		section := &epub.Section{Title: "Read it later"}
+		for _, bookmark := range capture.Unread(ctx, store, periodical.Size) {
+			// Listed bookmarks come without their content
+			if err := store.BookmarkGet(ctx, bookmark); err != nil {
+				log.Ctx(ctx).Warn().Err(err).Str("id", bookmark.ID).Msg("Error getting bookmark")
+				continue
+			}
+
+			section.Articles = append(section.Articles, &epub.Article{Title: bookmark.Title, URL: bookmark.URL, Content: bookmark.Content})
+		}
+		book.Sections = append(book.Sections, section)
+
+		articles := len(section.Articles)
+
+		// Feed items are unread until they are read, they go newest first into a section per feed
+		items := []*periodicalItem{}
+		for offset := 0; ; offset += 100 {
+			feeds, _ := store.FeedList(ctx, &storage.FeedListOptions{Limit: 100, Offset: offset})
+
+			for _, feed := range *feeds {
+				for _, item := range feed.Items {
+					items = append(items, &periodicalItem{feed, item})
+				}
+			}
+
+			if len(*feeds) < 100 {
+				break
+			}
+		}
+
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].item.Date.After(items[j].item.Date)
+		})
+
+		sections := map[string]*epub.Section{}
+		for _, item := range items {
+			if articles >= periodical.Size {
+				break
+			}
+
+			if _, ok := sections[item.feed.ID]; !ok {
+				sections[item.feed.ID] = &epub.Section{Title: item.feed.Title}
+				book.Sections = append(book.Sections, sections[item.feed.ID])
+			}
+
+			// The content of feed items is stripped of html but keeps its entities
+			sections[item.feed.ID].Articles = append(sections[item.feed.ID].Articles, &epub.Article{
+				Title:   html.UnescapeString(item.item.Title),
+				URL:     item.item.URL,
+				Content: html.UnescapeString(item.item.Content),
+			})
+			articles++
+		}
+
+		if articles == 0 {
+			log.Ctx(ctx).Info().Msg("Nothing to read for the periodical")
+			return nil
+		}
+
+		data := &bytes.Buffer{}
+		if err := book.Write(data); err != nil {
+			return queue.Permanent(err)
+		}
+
+		if err := writeAtomic(periodical.Path, data.Bytes()); err != nil {
+			return err
+		}
+
+		log.Ctx(ctx).Info().Int("articles", articles).Str("path", periodical.Path).Msg("Compiled periodical")
+
+		if periodical.Mailer == nil {
+			return nil
+		}
+
+		attachment := mailer.Attachment{
+			Name:        PeriodicalName(now),
+			ContentType: "application/epub+zip",
+			Data:        data.Bytes(),
+		}
+
+		text := fmt.Sprintf("%d articles to read are attached.", articles)
+		if err := periodical.Mailer.Send(book.Title, text, "<p>"+text+"</p>", attachment); err != nil {
+			return err
+		}
+
+		log.Ctx(ctx).Info().Int("articles", articles).Msg("Emailed periodical")
+
+		return nil
+	}
+}
+
+// PeriodicalName is the file name of the periodical compiled at date
+func PeriodicalName(date time.Time) string {
+	return "bookmarks-" + date.Format("2006-01-02") + ".epub"
+}
+
+// writeAtomic replaces the file at path with data, so the previous periodical can be downloaded
+// until the new one is complete
+func writeAtomic(path string, data []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), ".periodical-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/nrocco/bookmarks/readwise"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// JobReadwise pushes the thoughts that changed since the previous push to Readwise
+	JobReadwise = "readwise.export"
+
+	// DefaultReadwiseSchedule pushes thoughts to Readwise every hour
+	DefaultReadwiseSchedule = "@hourly"
+
+	// readwiseTitle groups all thoughts in a single source at Readwise
+	readwiseTitle = "Thoughts"
+)
+
+// RegisterReadwise pushes thoughts to Readwise at every time that matches the cron expression
+// schedule. The first push after a start sends all thoughts, Readwise skips the ones it already has.
+// It must be called before the queue is started.
+func RegisterReadwise(q *queue.Queue, store storage.Storer, client *readwise.Client, schedule string) error {
+	q.Register(JobReadwise, exportReadwise(store, client), queue.DefaultRetryPolicy)
+
+	if schedule == "" {
+		log.Info().Str("schedule", "readwise").Msg("Schedule is disabled")
+		return nil
+	}
+
+	return q.Schedule("readwise", schedule, JobReadwise, "")
+}
+
+func exportReadwise(store storage.Storer, client *readwise.Client) queue.Handler {
+	since := time.Time{}
+	mutex := sync.Mutex{}
+
+	return func(ctx context.Context, job *queue.Job) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		started := time.Now()
+		highlights := []*readwise.Highlight{}
+
+		// Thoughts are listed by the time they changed, newest first, until one did not change since the previous push
+		for offset := 0; ; offset += 100 {
+			thoughts, _ := store.ThoughtList(ctx, &storage.ThoughtListOptions{
+				Sort:   storage.Sort{{Field: "updated", Descending: true}},
+				Limit:  100,
+				Offset: offset,
+			})
+
+			for _, thought := range *thoughts {
+				if !thought.Updated.After(since) {
+					return pushReadwise(ctx, client, highlights, started, &since)
+				}
+
+				highlights = append(highlights, thoughtHighlight(thought))
+			}
+
+			if len(*thoughts) < 100 {
+				return pushReadwise(ctx, client, highlights, started, &since)
+			}
+		}
+	}
+}
+
+func pushReadwise(ctx context.Context, client *readwise.Client, highlights []*readwise.Highlight, started time.Time, since *time.Time) error {
+	if err := client.Push(ctx, highlights); err != nil {
+		return err
+	}
+
+	*since = started
+
+	log.Ctx(ctx).Info().Int("thoughts", len(highlights)).Msg("Pushed thoughts to Readwise")
+
+	return nil
+}
+
+// thoughtHighlight turns a thought into a highlight, tags are added with the inline tagging syntax
+// of Readwise in the note of the highlight
+func thoughtHighlight(thought *storage.Thought) *readwise.Highlight {
+	tags := []string{}
+	for _, tag := range thought.Tags {
+		tags = append(tags, "."+strings.ReplaceAll(tag, " ", "-"))
+	}
+
+	return &readwise.Highlight{
+		Text:          thought.Content,
+		Title:         readwiseTitle,
+		SourceType:    "bookmarks",
+		Note:          strings.Join(tags, " "),
+		HighlightedAt: thought.Created.Format(time.RFC3339),
+	}
+}
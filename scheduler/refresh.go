@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nrocco/bookmarks/queue"
+)
+
+const (
+	// DefaultRefreshBatchSize is the maximum number of feeds a sweep enqueues a refresh for
+	DefaultRefreshBatchSize = 100
+
+	// DefaultRefreshWindow is how long ago a feed must have been refreshed for a sweep to refresh it
+	DefaultRefreshWindow = time.Hour
+
+	// DefaultRefreshMaxErrors is the number of times in a row a feed can fail to refresh before
+	// sweeps suspend it
+	DefaultRefreshMaxErrors = 10
+)
+
+// ErrInvalidRefreshSettings is returned for a batch size or window that would never refresh a feed
+var ErrInvalidRefreshSettings = errors.New("The batch size and window must be larger than 0 and the maximum number of errors cannot be negative")
+
+// RefreshSettings tune how aggressively feeds are polled
+type RefreshSettings struct {
+	// Interval is the cron expression of the feeds schedule that sweeps for feeds to refresh, it is
+	// empty while the schedule is disabled
+	Interval string
+
+	// BatchSize is the maximum number of feeds a sweep refreshes
+	BatchSize int
+
+	// Window is how long ago a feed must have been refreshed for a sweep to refresh it
+	Window time.Duration
+
+	// MaxErrors is the number of times in a row a feed can fail to refresh before sweeps suspend
+	// it, feeds are never suspended if it is 0
+	MaxErrors int
+}
+
+// Refresher holds the settings of the sweeps that refresh feeds, they can be changed while the
+// queue runs
+type Refresher struct {
+	mutex     sync.Mutex
+	queue     *queue.Queue
+	batchSize int
+	window    time.Duration
+	maxErrors int
+}
+
+// NewRefresher creates the settings of the sweeps that refresh feeds, the interval is the feeds
+// schedule of RegisterSchedules
+func NewRefresher(q *queue.Queue, batchSize int, window time.Duration, maxErrors int) (*Refresher, error) {
+	if batchSize < 1 || window <= 0 || maxErrors < 0 {
+		return nil, ErrInvalidRefreshSettings
+	}
+
+	return &Refresher{queue: q, batchSize: batchSize, window: window, maxErrors: maxErrors}, nil
+}
+
+// Settings returns the current settings
+func (refresher *Refresher) Settings() RefreshSettings {
+	refresher.mutex.Lock()
+	settings := RefreshSettings{BatchSize: refresher.batchSize, Window: refresher.window, MaxErrors: refresher.maxErrors}
+	refresher.mutex.Unlock()
+
+	for _, schedule := range refresher.queue.Schedules() {
+		if schedule.Name == "feeds" {
+			settings.Interval = schedule.Spec
+		}
+	}
+
+	return settings
+}
+
+// Update replaces the settings, the next sweep uses them. They are not persisted, so a restart
+// restores the configured settings.
+func (refresher *Refresher) Update(settings RefreshSettings) error {
+	if settings.BatchSize < 1 || settings.Window <= 0 || settings.MaxErrors < 0 {
+		return ErrInvalidRefreshSettings
+	}
+
+	if settings.Interval != refresher.Settings().Interval {
+		if err := refresher.queue.Reschedule("feeds", settings.Interval, JobRefreshFeeds, ""); err != nil {
+			return err
+		}
+	}
+
+	refresher.mutex.Lock()
+	defer refresher.mutex.Unlock()
+
+	refresher.batchSize = settings.BatchSize
+	refresher.window = settings.Window
+	refresher.maxErrors = settings.MaxErrors
+
+	return nil
+}
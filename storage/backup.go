@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Backup writes a consistent snapshot of the database to path, which must not exist yet.
+// The database stays available for reads and writes while the snapshot is made. A PostgreSQL
+// database is backed up with its own tools instead.
+func (store *Store) Backup(ctx context.Context, path string) error {
+	ctx, span := store.start(ctx, "Store.Backup")
+	defer span.End()
+
+	if store.path == "" {
+		return ErrUnsupported
+	}
+
+	if _, err := store.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("path", path).Msg("Error backing up the database")
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str("path", path).Msg("Backed up the database")
+
+	return nil
+}
+
+// BackupTo writes a consistent snapshot of the database to w. The snapshot is made in a
+// temporary file next to the database first, which is removed afterwards.
+func (store *Store) BackupTo(ctx context.Context, w io.Writer) (int64, error) {
+	if store.path == "" {
+		return 0, ErrUnsupported
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(store.path), ".backup")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.Base(store.path))
+
+	if err := store.Backup(ctx, path); err != nil {
+		return 0, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return io.Copy(w, file)
+}
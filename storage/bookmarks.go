@@ -3,10 +3,14 @@ package storage
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/go-shiori/go-readability"
+	"github.com/nrocco/qb"
 	"github.com/rs/zerolog/log"
 )
 
@@ -14,24 +18,49 @@ var (
 	// ErrNoBookmarkURL is returned if the Bookmark does not have a URL
 	ErrNoBookmarkURL = errors.New("Missing Bookmark.URL")
 
+	// ErrInvalidBookmarkURL is returned if the URL of a Bookmark to save is not an absolute http
+	// or https url
+	ErrInvalidBookmarkURL = errors.New("Invalid Bookmark.URL")
+
 	// ErrNoBookmarkKey is returned if the Bookmark does not have a ID or URL
 	ErrNoBookmarkKey = errors.New("Missing Bookmark.ID or Bookmark.URL")
+
+	// ErrNotDeletedBookmark is returned when restoring a bookmark that is not deleted
+	ErrNotDeletedBookmark = errors.New("Bookmark is not deleted")
+)
+
+const (
+	// BookmarkPending is the status of a bookmark whose content is still to be fetched
+	BookmarkPending = "pending"
+
+	// BookmarkFetched is the status of a bookmark whose content was fetched
+	BookmarkFetched = "fetched"
+
+	// BookmarkFailed is the status of a bookmark whose content could not be fetched
+	BookmarkFailed = "failed"
 )
 
 // Bookmark represents a single bookmark
 type Bookmark struct {
-	ID      string
-	URL     string
-	Title   string
-	Created time.Time
-	Updated time.Time
-	Excerpt string
-	Content string `json:",omitempty"`
-	Tags    Tags
+	ID           string
+	URL          string
+	Title        string
+	Created      time.Time
+	Updated      time.Time
+	Excerpt      string
+	Content      string `json:",omitempty"`
+	Tags         Tags
+	Status       string
+	Etag         string `json:"-"`
+	LastModified string `json:"-"`
+	DeletedAt    qb.NullTime
 }
 
 // Fetch downloads the bookmark, reduces the result to a readable plain text format
 func (bookmark *Bookmark) Fetch(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Bookmark.Fetch")
+	defer span.End()
+
 	if bookmark.URL == "" {
 		return ErrNoBookmarkURL
 	}
@@ -40,17 +69,28 @@ func (bookmark *Bookmark) Fetch(ctx context.Context) error {
 
 	logger.Info().Msg("Fetching bookmark")
 
-	article, err := readability.FromURL(bookmark.URL, 5*time.Second)
+	article, err := bookmark.fetchArticle(ctx)
 	if err != nil {
 		bookmark.Title = bookmark.URL
 		bookmark.Content = "Error fetching bookmark"
 		bookmark.Excerpt = "Error fetching bookmark"
+		bookmark.Status = BookmarkFailed
+		bookmark.Etag = ""
+		bookmark.LastModified = ""
 		logger.Warn().Err(err).Msg("Error fetching bookmark")
-		return err
+		span.RecordError(err)
+		return fmt.Errorf("%w: %s", ErrFetchFailed, err)
+	}
+
+	if article == nil {
+		bookmark.Status = BookmarkFetched
+		logger.Info().Msg("Bookmark did not change since it was fetched")
+		return nil
 	}
 
 	bookmark.Title = article.Title
 	bookmark.Content = article.TextContent
+	bookmark.Status = BookmarkFetched
 
 	if article.Excerpt == "" {
 		size := 260
@@ -67,56 +107,213 @@ func (bookmark *Bookmark) Fetch(ctx context.Context) error {
 	return nil
 }
 
+// fetchArticle downloads the page of the bookmark and extracts the readable article from it. The
+// article is nil if the page did not change since the content of the bookmark was fetched.
+func (bookmark *Bookmark) fetchArticle(ctx context.Context) (*readability.Article, error) {
+	parsedURL, err := url.ParseRequestURI(bookmark.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := withFetchTimeout(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", bookmark.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", userAgent)
+
+	// Only a bookmark that has content can keep it when the page did not change
+	if bookmark.Content != "" {
+		bookmark.setValidators(request)
+	}
+
+	response, err := fetchClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == 304 && bookmark.Content != "" {
+		return nil, nil
+	}
+
+	if !strings.Contains(response.Header.Get("Content-Type"), "text/html") {
+		return nil, errors.New("URL is not a HTML document")
+	}
+
+	article, err := readability.FromReader(response.Body, parsedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmark.Etag = response.Header.Get("ETag")
+	bookmark.LastModified = response.Header.Get("Last-Modified")
+
+	return &article, nil
+}
+
+// setValidators makes request conditional on the page having changed since the bookmark was
+// fetched, if the server told how to tell
+func (bookmark *Bookmark) setValidators(request *http.Request) {
+	if bookmark.Etag != "" {
+		request.Header.Set("If-None-Match", bookmark.Etag)
+	}
+
+	if bookmark.LastModified != "" {
+		request.Header.Set("If-Modified-Since", bookmark.LastModified)
+	}
+}
+
 // BookmarkListOptions can be passed to BookmarkList to filter bookmarks
 type BookmarkListOptions struct {
-	Search string
-	Tags   Tags
-	Limit  int
-	Offset int
+	Search         string
+	Tags           Tags
+	IncludeDeleted bool
+	Sort           Sort
+	Cursor         string
+	Limit          int
+	Offset         int
 }
 
-// BookmarkList fetches multiple bookmarks from the database
-func (store *Store) BookmarkList(ctx context.Context, options *BookmarkListOptions) (*[]*Bookmark, int) {
+// bookmarkFilter selects the bookmarks that match the options, regardless of the page
+func (store *Store) bookmarkFilter(ctx context.Context, options *BookmarkListOptions) *qb.SelectQuery {
 	query := store.db.Select(ctx).From("bookmarks")
 
 	if options.Search != "" {
-		query.Where("rowid IN (SELECT rowid FROM bookmarks_fts(?))", options.Search)
+		store.dialect.search(query, "bookmarks", options.Search)
+	}
+
+	filterTags(query, "bookmarks", options.Tags)
+
+	if !options.IncludeDeleted {
+		query.Where("deleted_at IS NULL")
+	}
+
+	return query
+}
+
+// BookmarkList fetches multiple bookmarks from the database
+func (store *Store) BookmarkList(ctx context.Context, options *BookmarkListOptions) (*[]*Bookmark, int) {
+	ctx, span := store.start(ctx, "Store.BookmarkList")
+	defer span.End()
+
+	result := store.cached(ctx, "BookmarkList", *options, []string{"bookmarks"}, func() (interface{}, error) {
+		bookmarks, totalCount, err := store.bookmarkList(ctx, options)
+		return listResult{bookmarks, totalCount}, err
+	}).(listResult)
+
+	// Callers may change the bookmarks, so they get a copy of the cached ones
+	bookmarks := []*Bookmark{}
+	for _, bookmark := range result.list.([]*Bookmark) {
+		copied := *bookmark
+		copied.Tags = append(Tags{}, bookmark.Tags...)
+		bookmarks = append(bookmarks, &copied)
+	}
+
+	return &bookmarks, result.totalCount
+}
+
+// BookmarkEach calls fn with the bookmarks BookmarkList would return, reading them from the
+// database one at a time instead of loading the whole list, so a long list never has to fit in
+// memory. The bookmarks are not cached.
+func (store *Store) BookmarkEach(ctx context.Context, options *BookmarkListOptions, fn func(bookmark *Bookmark) error) error {
+	ctx, span := store.start(ctx, "Store.BookmarkEach")
+	defer span.End()
+
+	query, err := store.bookmarkPage(ctx, options)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmarks")
+		return err
+	}
+
+	rows, err := store.rows(ctx, query.Columns("id", "created", "updated", "title", "url", "excerpt", "tags", "status", "deleted_at"))
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmarks")
+		return err
 	}
+	defer rows.Close()
+
+	for rows.Next() {
+		bookmark := &Bookmark{}
+		if err := rows.Scan(&bookmark.ID, &bookmark.Created, &bookmark.Updated, &bookmark.Title, &bookmark.URL, &bookmark.Excerpt, &bookmark.Tags, &bookmark.Status, &bookmark.DeletedAt); err != nil {
+			return err
+		}
+
+		if err := fn(bookmark); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// bookmarkPage selects the page of bookmarks that options describe, without columns
+func (store *Store) bookmarkPage(ctx context.Context, options *BookmarkListOptions) (*qb.SelectQuery, error) {
+	query := store.bookmarkFilter(ctx, options)
 
-	for _, tag := range options.Tags {
-		if tag == "" {
-			continue
-		} else if strings.HasPrefix(tag, "-") {
-			query.Where("NOT EXISTS (SELECT 1 FROM json_each(bookmarks.tags) where json_each.value = ?)", strings.TrimPrefix(tag, "-"))
-		} else {
-			query.Where("EXISTS (SELECT 1 FROM json_each(bookmarks.tags) where json_each.value = ?)", tag)
+	if options.Cursor != "" {
+		cursor, err := ParseCursor(options.Cursor)
+		if err != nil {
+			return nil, err
 		}
+		query.Where("(created < ? OR (created = ? AND id < ?))", cursor.Created, cursor.Created, cursor.ID)
+	}
+
+	options.Sort.apply(query, ranked(options.Search, options.Cursor, Sort{{"created", true}}))
+	query.Limit(options.Limit)
+	if options.Cursor == "" {
+		query.Offset(options.Offset)
 	}
 
+	return query, nil
+}
+
+func (store *Store) bookmarkList(ctx context.Context, options *BookmarkListOptions) ([]*Bookmark, int, error) {
 	bookmarks := []*Bookmark{}
 	totalCount := 0
 
-	query.Columns("COUNT(id)")
-	if err := query.LoadValue(&totalCount); err != nil {
-		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmarks count")
-		return &bookmarks, 0
+	query, err := store.bookmarkPage(ctx, options)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmarks")
+		return bookmarks, 0, err
 	}
 
-	query.Columns("id", "created", "updated", "title", "url", "excerpt", "tags")
-	query.OrderBy("created", "DESC")
-	query.Limit(options.Limit)
-	query.Offset(options.Offset)
-	if _, err := query.Load(&bookmarks); err != nil {
+	rows := []struct {
+		Bookmark
+		TotalCount int
+	}{}
+
+	query.Columns("id", "created", "updated", "title", "url", "excerpt", "tags", "status", "deleted_at", totalCountColumn)
+	if _, err := query.Load(&rows); err != nil {
 		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmarks")
-		return &bookmarks, 0
+		return bookmarks, 0, err
+	}
+
+	for i := range rows {
+		bookmarks = append(bookmarks, &rows[i].Bookmark)
+		totalCount = rows[i].TotalCount
 	}
 
-	return &bookmarks, totalCount
+	if options.Cursor != "" || len(rows) == 0 {
+		if err := store.bookmarkFilter(ctx, options).Columns("COUNT(id)").LoadValue(&totalCount); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmarks count")
+			return bookmarks, 0, err
+		}
+	}
+
+	return bookmarks, totalCount, nil
 }
 
-// BookmarkGet finds a single bookmark by ID or URL
+// BookmarkGet finds a single bookmark by ID or URL, unless it is deleted
 func (store *Store) BookmarkGet(ctx context.Context, bookmark *Bookmark) error {
+	ctx, span := store.start(ctx, "Store.BookmarkGet")
+	defer span.End()
+
 	query := store.db.Select(ctx).From("bookmarks")
+	query.Where("deleted_at IS NULL")
 	query.Limit(1)
 
 	if bookmark.ID != "" {
@@ -134,8 +331,66 @@ func (store *Store) BookmarkGet(ctx context.Context, bookmark *Bookmark) error {
 	return nil
 }
 
+// BookmarkGetNumber finds a single bookmark by the number the database assigned to it, unless it
+// is deleted. Numbers serve clients that can only handle integer ids, see BookmarkNumbers.
+func (store *Store) BookmarkGetNumber(ctx context.Context, number int64, bookmark *Bookmark) error {
+	ctx, span := store.start(ctx, "Store.BookmarkGetNumber")
+	defer span.End()
+
+	query := store.db.Select(ctx).From("bookmarks")
+	query.Where("rowid = ?", number)
+	query.Where("deleted_at IS NULL")
+	query.Limit(1)
+
+	return query.LoadValue(&bookmark)
+}
+
+// BookmarkNumbers maps the IDs of bookmarks to the numbers the database assigned to them. Unlike
+// IDs, numbers of a sqlite database can change when it is compacted.
+func (store *Store) BookmarkNumbers(ctx context.Context, bookmarks []*Bookmark) map[string]int64 {
+	ctx, span := store.start(ctx, "Store.BookmarkNumbers")
+	defer span.End()
+
+	numbers := map[string]int64{}
+
+	for start := 0; start < len(bookmarks); start += 500 {
+		end := start + 500
+		if end > len(bookmarks) {
+			end = len(bookmarks)
+		}
+
+		ids := []interface{}{}
+		for _, bookmark := range bookmarks[start:end] {
+			ids = append(ids, bookmark.ID)
+		}
+
+		rows := []struct {
+			ID     string
+			Number int64
+		}{}
+
+		query := store.db.Select(ctx).From("bookmarks")
+		query.Columns("id", "rowid AS number")
+		query.Where("id IN (?"+strings.Repeat(", ?", len(ids)-1)+")", ids...)
+
+		if _, err := query.Load(&rows); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Error fetching bookmark numbers")
+			return numbers
+		}
+
+		for _, row := range rows {
+			numbers[row.ID] = row.Number
+		}
+	}
+
+	return numbers
+}
+
 // BookmarkPersist persists a bookmark to the database and schedules an async job to fetch the content
 func (store *Store) BookmarkPersist(ctx context.Context, bookmark *Bookmark) error {
+	ctx, span := store.start(ctx, "Store.BookmarkPersist")
+	defer span.End()
+
 	if bookmark.URL == "" {
 		return ErrNoBookmarkURL
 	}
@@ -152,16 +407,22 @@ func (store *Store) BookmarkPersist(ctx context.Context, bookmark *Bookmark) err
 		bookmark.Tags = Tags{}
 	}
 
+	if bookmark.Status == "" {
+		bookmark.Status = BookmarkFetched
+	}
+
 	bookmark.Updated = time.Now()
 
 	// Check if there is already a bookmark with the same URL in the database
 	store.db.Select(ctx).From("bookmarks").Columns("id", "created").Where("url = ?", bookmark.URL).Limit(1).LoadValue(&bookmark)
 
-	if bookmark.ID == "" {
-		bookmark.ID = generateUUID()
+	if !store.exists(ctx, "bookmarks", bookmark.ID) {
+		if bookmark.ID == "" {
+			bookmark.ID = generateUUID()
+		}
 
 		query := store.db.Insert(ctx).InTo("bookmarks")
-		query.Columns("id", "created", "content", "excerpt", "tags", "title", "updated", "url")
+		query.Columns("id", "created", "content", "excerpt", "tags", "title", "updated", "url", "status", "etag", "last_modified")
 		query.Record(bookmark)
 
 		if _, err := query.Exec(); err != nil {
@@ -176,6 +437,10 @@ func (store *Store) BookmarkPersist(ctx context.Context, bookmark *Bookmark) err
 		query.Set("title", bookmark.Title)
 		query.Set("updated", bookmark.Updated)
 		query.Set("url", bookmark.URL)
+		query.Set("status", bookmark.Status)
+		query.Set("etag", bookmark.Etag)
+		query.Set("last_modified", bookmark.LastModified)
+		query.Set("deleted_at", bookmark.DeletedAt)
 		query.Where("id = ?", bookmark.ID)
 
 		if _, err := query.Exec(); err != nil {
@@ -184,18 +449,50 @@ func (store *Store) BookmarkPersist(ctx context.Context, bookmark *Bookmark) err
 		}
 	}
 
+	store.invalidate("bookmarks")
+
 	log.Ctx(ctx).Info().Str("id", bookmark.ID).Str("url", bookmark.URL).Msg("Persisted bookmark")
 
 	return nil
 }
 
-// BookmarkDelete deletes the given bookmark from the database
+// BookmarkFetch fetches the content of the bookmark and persists it. The title and excerpt of an
+// imported bookmark were chosen by the user, which beats the ones of the page. A bookmark that
+// could not be fetched is left as it is.
+func (store *Store) BookmarkFetch(ctx context.Context, bookmark *Bookmark) error {
+	ctx, span := store.start(ctx, "Store.BookmarkFetch")
+	defer span.End()
+
+	title, excerpt := bookmark.Title, bookmark.Excerpt
+
+	if err := bookmark.Fetch(ctx); err != nil {
+		return err
+	}
+
+	if title != "" && title != bookmark.URL {
+		bookmark.Title = title
+	}
+	if excerpt != "" {
+		bookmark.Excerpt = excerpt
+	}
+
+	return store.BookmarkPersist(ctx, bookmark)
+}
+
+// BookmarkDelete marks the given bookmark as deleted, it can be restored until it is purged
 func (store *Store) BookmarkDelete(ctx context.Context, bookmark *Bookmark) error {
+	ctx, span := store.start(ctx, "Store.BookmarkDelete")
+	defer span.End()
+
 	if bookmark.ID == "" && bookmark.URL == "" {
 		return ErrNoBookmarkKey
 	}
 
-	query := store.db.Delete(ctx).From("bookmarks")
+	bookmark.DeletedAt = nullTimeNow()
+
+	query := store.db.Update(ctx).Table("bookmarks")
+	query.Set("deleted_at", bookmark.DeletedAt)
+	query.Where("deleted_at IS NULL")
 
 	if bookmark.ID != "" {
 		query.Where("id = ?", bookmark.ID)
@@ -210,7 +507,40 @@ func (store *Store) BookmarkDelete(ctx context.Context, bookmark *Bookmark) erro
 		return err
 	}
 
+	store.invalidate("bookmarks")
+
 	log.Ctx(ctx).Info().Str("id", bookmark.ID).Str("url", bookmark.URL).Msg("Bookmark deleted")
 
 	return nil
 }
+
+// BookmarkRestore restores the given deleted bookmark
+func (store *Store) BookmarkRestore(ctx context.Context, bookmark *Bookmark) error {
+	ctx, span := store.start(ctx, "Store.BookmarkRestore")
+	defer span.End()
+
+	if bookmark.ID == "" {
+		return ErrNoBookmarkKey
+	}
+
+	query := store.db.Update(ctx).Table("bookmarks")
+	query.Set("deleted_at", qb.NullTime{})
+	query.Where("id = ?", bookmark.ID)
+	query.Where("deleted_at IS NOT NULL")
+
+	result, err := query.Exec()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", bookmark.ID).Msg("Error restoring bookmark")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotDeletedBookmark
+	}
+
+	store.invalidate("bookmarks")
+
+	log.Ctx(ctx).Info().Str("id", bookmark.ID).Msg("Bookmark restored")
+
+	return store.BookmarkGet(ctx, bookmark)
+}
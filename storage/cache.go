@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// queryCache keeps the results of hot reads, like lists and tag counts, until a write to one of the
+// tables they read from invalidates them or they expire. Writes by other processes, like the
+// command line, are only noticed once the results expire.
+type queryCache struct {
+	mutex       sync.Mutex
+	size        int
+	ttl         time.Duration
+	entries     map[string]*list.Element
+	recent      *list.List
+	generations map[string]uint64
+	epoch       uint64
+}
+
+type cacheEntry struct {
+	key     string
+	tables  []string
+	value   interface{}
+	expires time.Time
+}
+
+// listResult is a cached page of a list together with the number of records that match
+type listResult struct {
+	list       interface{}
+	totalCount int
+}
+
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	return &queryCache{
+		size:        size,
+		ttl:         ttl,
+		entries:     map[string]*list.Element{},
+		recent:      list.New(),
+		generations: map[string]uint64{},
+	}
+}
+
+// generation changes whenever one of tables is written to
+func (cache *queryCache) generation(tables []string) uint64 {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return cache.current(tables)
+}
+
+func (cache *queryCache) current(tables []string) uint64 {
+	generation := cache.epoch
+	for _, table := range tables {
+		generation += cache.generations[table]
+	}
+
+	return generation
+}
+
+func (cache *queryCache) get(key string) (interface{}, bool) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	element, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		cache.remove(element)
+		return nil, false
+	}
+
+	cache.recent.MoveToFront(element)
+
+	return entry.value, true
+}
+
+// put caches value unless one of tables was written to since generation, the least recently used
+// result is forgotten once the cache is full
+func (cache *queryCache) put(key string, tables []string, generation uint64, value interface{}) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.current(tables) != generation {
+		return
+	}
+
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+
+	cache.entries[key] = cache.recent.PushFront(&cacheEntry{key, tables, value, time.Now().Add(cache.ttl)})
+
+	for cache.recent.Len() > cache.size {
+		cache.remove(cache.recent.Back())
+	}
+}
+
+// invalidate forgets the results that read from tables, or all results if there are no tables
+func (cache *queryCache) invalidate(tables ...string) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if len(tables) == 0 {
+		cache.epoch++
+	}
+
+	for _, table := range tables {
+		cache.generations[table]++
+	}
+
+	for element := cache.recent.Front(); element != nil; {
+		next := element.Next()
+		if len(tables) == 0 || readsFrom(element.Value.(*cacheEntry).tables, tables) {
+			cache.remove(element)
+		}
+		element = next
+	}
+}
+
+func (cache *queryCache) remove(element *list.Element) {
+	cache.recent.Remove(element)
+	delete(cache.entries, element.Value.(*cacheEntry).key)
+}
+
+func readsFrom(tables []string, written []string) bool {
+	for _, table := range tables {
+		for _, other := range written {
+			if table == other {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// SetCache keeps up to size results of lists and tag counts for at most ttl, writes through the
+// store invalidate them right away. A size of 0 disables the cache.
+func (store *Store) SetCache(size int, ttl time.Duration) {
+	store.cache = nil
+	if size > 0 && ttl > 0 {
+		store.cache = newQueryCache(size, ttl)
+	}
+}
+
+// cached returns the cached result of the read named name with options, or loads and caches it.
+// Results that failed to load are not cached.
+func (store *Store) cached(ctx context.Context, name string, options interface{}, tables []string, load func() (interface{}, error)) interface{} {
+	if store.cache == nil {
+		value, _ := load()
+		return value
+	}
+
+	key := fmt.Sprintf("%s:%+v", name, options)
+	if value, ok := store.cache.get(key); ok {
+		log.Ctx(ctx).Debug().Str("key", key).Msg("Served from the query cache")
+		return value
+	}
+
+	generation := store.cache.generation(tables)
+
+	value, err := load()
+	if err == nil {
+		store.cache.put(key, tables, generation, value)
+	}
+
+	return value
+}
+
+// invalidate forgets the cached results that read from tables, or all results if there are no
+// tables. Writes in a transaction invalidate the whole cache once it is committed.
+func (store *Store) invalidate(tables ...string) {
+	if store.cache != nil {
+		store.cache.invalidate(tables...)
+	}
+}
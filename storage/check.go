@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+// CheckResult reports the problems Check found in the database
+type CheckResult struct {
+	// Integrity lists the problems found by the sqlite integrity check, PostgreSQL has none
+	Integrity []string
+
+	// FTS lists the full text search indexes that are out of sync with their content tables
+	FTS []string
+
+	// Orphans counts the references that are out of sync, by what is wrong with them
+	Orphans map[string]int64
+
+	// Repaired is true if the full text search indexes and orphaned references were repaired
+	Repaired bool
+}
+
+// Ok is true if no problems were found
+func (result *CheckResult) Ok() bool {
+	return len(result.Integrity) == 0 && len(result.FTS) == 0 && len(result.Orphans) == 0
+}
+
+// orphanCheck counts references that are out of sync and repairs them
+type orphanCheck struct {
+	name   string
+	count  string
+	repair []string
+}
+
+// orphanChecks returns the checks for the tags of bookmarks, feeds and thoughts, which are kept in
+// sync with the tags columns by triggers
+func orphanChecks(d dialect) []orphanCheck {
+	checks := []orphanCheck{}
+
+	for _, table := range []string{"bookmarks", "feeds", "thoughts"} {
+		joins := table + "_tags"
+		column := tagColumns[table]
+
+		dangling := joins + "." + column + " NOT IN (SELECT id FROM " + table + ") OR " + joins + ".tag_id NOT IN (SELECT id FROM tags)"
+		checks = append(checks, orphanCheck{
+			name:   joins + " referencing a missing record or tag",
+			count:  "SELECT COUNT(*) FROM " + joins + " WHERE " + dangling,
+			repair: []string{"DELETE FROM " + joins + " WHERE " + dangling},
+		})
+
+		each := d.jsonEachText(table + ".tags")
+		missing := "FROM " + table + ", " + each + " WHERE value != '' AND NOT EXISTS (SELECT 1 FROM " + joins + " JOIN tags ON tags.id = " + joins + ".tag_id WHERE " + joins + "." + column + " = " + table + ".id AND tags.name = json_each.value)"
+		checks = append(checks, orphanCheck{
+			name:  table + " with tags missing from " + joins,
+			count: "SELECT COUNT(*) " + missing,
+			repair: []string{
+				d.insertOrIgnore("tags(name) SELECT value FROM " + table + ", " + each + " WHERE value != ''"),
+				d.insertOrIgnore(joins + "(" + column + ", tag_id) SELECT " + table + ".id, tags.id FROM " + table + ", " + each + " JOIN tags ON tags.name = json_each.value"),
+			},
+		})
+	}
+
+	unused := "id NOT IN (SELECT tag_id FROM bookmarks_tags UNION SELECT tag_id FROM feeds_tags UNION SELECT tag_id FROM thoughts_tags)"
+	checks = append(checks, orphanCheck{
+		name:   "tags not assigned to any record",
+		count:  "SELECT COUNT(*) FROM tags WHERE " + unused,
+		repair: []string{"DELETE FROM tags WHERE " + unused},
+	})
+
+	return checks
+}
+
+// Check runs the integrity check of the database, verifies that the full text search indexes are in
+// sync with their content tables and looks for orphaned references between tags and the records
+// they are assigned to. If repair is true the full text search indexes that drifted are rebuilt and the
+// orphaned references are fixed.
+func (store *Store) Check(ctx context.Context, repair bool) (*CheckResult, error) {
+	ctx, span := store.start(ctx, "Store.Check")
+	defer span.End()
+
+	result := &CheckResult{FTS: []string{}, Orphans: map[string]int64{}}
+
+	problems, err := store.IntegrityCheck(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result.Integrity = problems
+
+	err = store.WithTx(ctx, func(tx *Store) error {
+		drifted, err := tx.dialect.ftsCheck(ctx, tx, repair)
+		result.FTS = append(result.FTS, drifted...)
+		if err != nil {
+			return err
+		}
+
+		for _, check := range orphanChecks(tx.dialect) {
+			count := int64(0)
+			if err := tx.queryRow(ctx, check.count).Scan(&count); err != nil {
+				return err
+			}
+
+			if count == 0 {
+				continue
+			}
+
+			log.Ctx(ctx).Warn().Int64("count", count).Str("check", check.name).Msg("Found orphaned references")
+			result.Orphans[check.name] = count
+
+			if repair {
+				for _, statement := range check.repair {
+					if _, err := tx.exec(ctx, statement); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error checking the database")
+		return nil, err
+	}
+
+	result.Repaired = repair && (len(result.FTS) != 0 || len(result.Orphans) != 0)
+
+	log.Ctx(ctx).Info().Bool("ok", result.Ok()).Bool("repaired", result.Repaired).Msg("Checked the database")
+
+	return result, nil
+}
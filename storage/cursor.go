@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCursor is returned if a pagination cursor cannot be decoded
+	ErrInvalidCursor = errors.New("Invalid pagination cursor")
+)
+
+// Cursor points to a position in a list ordered by creation date and ID
+type Cursor struct {
+	Created time.Time
+	ID      string
+}
+
+// NewCursor returns an opaque cursor pointing just after the given position
+func NewCursor(created time.Time, ID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(created.Format(time.RFC3339Nano) + "," + ID))
+}
+
+// ParseCursor decodes an opaque cursor as returned by NewCursor
+func ParseCursor(value string) (*Cursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(decoded), ",", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{Created: created, ID: parts[1]}, nil
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/nrocco/qb"
+)
+
+// dialect holds what differs between the databases a Store can use: the sql that is not the
+// same for all of them and the maintenance of the database itself. The tags, items and seen
+// columns are JSON arrays in every dialect.
+type dialect interface {
+	// migrations is the directory with the embedded migrations of the dialect
+	migrations() string
+
+	// schemaMigrations creates the table that records which migrations were applied
+	schemaMigrations() string
+
+	// search limits query to the records of table that match the full text search, exposing how
+	// well they match as search.rank, the best match lowest. Its parameter is bound by the WHERE
+	// clause, so search must be applied before any other condition.
+	search(query *qb.SelectQuery, table string, text string)
+
+	// searchItems is search for the feed items of a query on feeds and the jsonEach of their items
+	searchItems(query *qb.SelectQuery, text string)
+
+	// feedsDue limits query to the feeds that were last refreshed, or failed, longer ago than
+	// their refresh interval or else window seconds, doubled for every error up to maxBackoff times
+	feedsDue(query *qb.SelectQuery, window int64, maxBackoff int, now time.Time)
+
+	// jsonEach is a table of the elements of a JSON array, as json_each.value
+	jsonEach(array string) string
+
+	// jsonEachText is a table of the elements of a JSON array of strings, as text in json_each.value
+	jsonEachText(array string) string
+
+	// jsonArray aggregates the JSON values of a jsonEach into a JSON array, empty without values
+	jsonArray(values string) string
+
+	// textArray aggregates text into a JSON array of strings, empty without values
+	textArray(values string) string
+
+	// jsonField extracts a field of a JSON object as text
+	jsonField(object string, field string) string
+
+	// jsonFlag is true if a field of a JSON object is true
+	jsonFlag(object string, field string) string
+
+	// jsonTime turns a time serialized as RFC 3339 text into a value that compares and sorts as
+	// a point in time, regardless of its time zone
+	jsonTime(value string) string
+
+	// insertOrIgnore inserts rows, skipping those that already exist
+	insertOrIgnore(insert string) string
+
+	// integrityCheck checks the database files and returns the problems found, if any
+	integrityCheck(ctx context.Context, store *Store) ([]string, error)
+
+	// ftsCheck returns the full text search indexes that are out of sync with their tables,
+	// rebuilding them if repair is true
+	ftsCheck(ctx context.Context, store *Store, repair bool) ([]string, error)
+
+	// ftsCommand runs optimize or rebuild on all full text search indexes
+	ftsCommand(ctx context.Context, store *Store, command string) error
+
+	// optimize is the cheap maintenance that keeps a long lived database fast
+	optimize(ctx context.Context, store *Store) error
+
+	// sizes measures the database, its write ahead log, free pages and full text search indexes
+	sizes(ctx context.Context, store *Store, stats *Stats) error
+}
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrNoFeedFound is returned if a page is not a feed and does not link to one
+	ErrNoFeedFound = errors.New("Page is not a feed and does not link to one")
+
+	// feedTypes are the types of the alternate links of a page that point to a feed
+	feedTypes = map[string]bool{
+		"application/rss+xml":   true,
+		"application/atom+xml":  true,
+		"application/feed+json": true,
+		"application/json":      true,
+	}
+)
+
+// DiscoveredFeed is a feed a page links to
+type DiscoveredFeed struct {
+	Title string
+	URL   string
+	Type  string
+}
+
+// DiscoverFeeds finds the RSS, Atom and JSON feeds a page links to with <link rel="alternate">, in
+// the order they appear. A pageURL that is not a html page is assumed to be a feed itself and
+// returned as the only feed.
+func DiscoverFeeds(ctx context.Context, pageURL string) ([]*DiscoveredFeed, error) {
+	ctx, span := tracer.Start(ctx, "DiscoverFeeds")
+	defer span.End()
+
+	if _, err := url.ParseRequestURI(pageURL); err != nil {
+		return nil, ErrNoFeedURL
+	}
+
+	ctx, cancel := withFetchTimeout(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err := fetchClient.Do(request)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %s", ErrFetchFailed, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return nil, fmt.Errorf("%w: %s", ErrFetchFailed, response.Status)
+	}
+
+	if !strings.Contains(response.Header.Get("Content-Type"), "html") {
+		return []*DiscoveredFeed{{URL: pageURL}}, nil
+	}
+
+	document, err := goquery.NewDocumentFromReader(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFetchFailed, err)
+	}
+
+	feeds := []*DiscoveredFeed{}
+	seen := map[string]bool{}
+
+	document.Find("link[rel~=alternate][href]").Each(func(_ int, link *goquery.Selection) {
+		feedType := strings.ToLower(strings.TrimSpace(link.AttrOr("type", "")))
+		if !feedTypes[feedType] {
+			return
+		}
+
+		// Links are relative to the page the request was redirected to
+		href, err := response.Request.URL.Parse(strings.TrimSpace(link.AttrOr("href", "")))
+		if err != nil || seen[href.String()] {
+			return
+		}
+		seen[href.String()] = true
+
+		feeds = append(feeds, &DiscoveredFeed{Title: strings.TrimSpace(link.AttrOr("title", "")), URL: href.String(), Type: feedType})
+	})
+
+	if len(feeds) == 0 {
+		return nil, ErrNoFeedFound
+	}
+
+	log.Ctx(ctx).Info().Str("url", pageURL).Int("feeds", len(feeds)).Msg("Discovered feeds")
+
+	return feeds, nil
+}
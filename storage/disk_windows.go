@@ -0,0 +1,10 @@
+//go:build windows
+// +build windows
+
+package storage
+
+import "errors"
+
+func diskFree(path string) (uint64, error) {
+	return 0, errors.New("Disk space reporting is not supported on windows")
+}
@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"github.com/nrocco/qb"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// exportBatchSize is the number of records Export reads from the database at once
+	exportBatchSize = 500
+)
+
+// countingWriter counts the bytes written to the underlying writer
+type countingWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// exportBatch loads the next batch of records of a table with an ID after the given one
+type exportBatch func(ctx context.Context, after string) ([]interface{}, string, error)
+
+// ExportTo writes all bookmarks, feeds with their items, thoughts and tags that are not deleted to w
+// as a single JSON Document, which can be imported again. The settings are written as they are, if
+// they are not nil. Records are read in batches from a single snapshot of the database, so large
+// instances do not have to fit in memory. It returns the number of bytes written.
+func (store *Store) ExportTo(ctx context.Context, w io.Writer, settings interface{}) (int64, error) {
+	ctx, span := store.start(ctx, "Store.ExportTo")
+	defer span.End()
+
+	out := &countingWriter{w: w}
+
+	sections := []struct {
+		name  string
+		batch exportBatch
+	}{
+		{"Bookmarks", store.exportBookmarks},
+		{"Feeds", store.exportFeeds},
+		{"Thoughts", store.exportThoughts},
+		{"Tags", store.exportTags},
+	}
+
+	err := store.WithTx(ctx, func(tx *Store) error {
+		ctx := qb.WitTx(ctx, tx.tx)
+		encoder := json.NewEncoder(out)
+
+		for i, section := range sections {
+			prefix := ",\"" + section.name + "\":["
+			if i == 0 {
+				prefix = "{\"" + section.name + "\":["
+			}
+
+			if _, err := io.WriteString(out, prefix); err != nil {
+				return err
+			}
+
+			first := true
+			after := ""
+
+			for {
+				records, last, err := section.batch(ctx, after)
+				if err != nil {
+					return err
+				}
+
+				for _, record := range records {
+					if !first {
+						if _, err := io.WriteString(out, ","); err != nil {
+							return err
+						}
+					}
+					first = false
+
+					if err := encoder.Encode(record); err != nil {
+						return err
+					}
+				}
+
+				if len(records) < exportBatchSize {
+					break
+				}
+				after = last
+			}
+
+			if _, err := io.WriteString(out, "]"); err != nil {
+				return err
+			}
+		}
+
+		if settings != nil {
+			if _, err := io.WriteString(out, ",\"Settings\":"); err != nil {
+				return err
+			}
+
+			if err := encoder.Encode(settings); err != nil {
+				return err
+			}
+		}
+
+		_, err := io.WriteString(out, "}\n")
+
+		return err
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Int64("written", out.written).Msg("Error exporting")
+		return out.written, err
+	}
+
+	log.Ctx(ctx).Info().Int64("written", out.written).Msg("Exported all records")
+
+	return out.written, nil
+}
+
+func (store *Store) exportBookmarks(ctx context.Context, after string) ([]interface{}, string, error) {
+	bookmarks := []*Bookmark{}
+
+	query := store.db.Select(ctx).From("bookmarks")
+	query.Columns("id", "created", "updated", "title", "url", "excerpt", "content", "tags")
+	query.Where("deleted_at IS NULL")
+	query.Where("id > ?", after)
+	query.OrderBy("id", "ASC")
+	query.Limit(exportBatchSize)
+
+	if _, err := query.Load(&bookmarks); err != nil || len(bookmarks) == 0 {
+		return nil, "", err
+	}
+
+	records := make([]interface{}, len(bookmarks))
+	for i, bookmark := range bookmarks {
+		records[i] = bookmark
+	}
+
+	return records, bookmarks[len(bookmarks)-1].ID, nil
+}
+
+func (store *Store) exportFeeds(ctx context.Context, after string) ([]interface{}, string, error) {
+	feeds := []*Feed{}
+
+	query := store.db.Select(ctx).From("feeds")
+	query.Where("deleted_at IS NULL")
+	query.Where("id > ?", after)
+	query.OrderBy("id", "ASC")
+	query.Limit(exportBatchSize)
+
+	if _, err := query.Load(&feeds); err != nil || len(feeds) == 0 {
+		return nil, "", err
+	}
+
+	records := make([]interface{}, len(feeds))
+	for i, feed := range feeds {
+		records[i] = feed
+	}
+
+	return records, feeds[len(feeds)-1].ID, nil
+}
+
+func (store *Store) exportThoughts(ctx context.Context, after string) ([]interface{}, string, error) {
+	thoughts := []*Thought{}
+
+	query := store.db.Select(ctx).From("thoughts")
+	query.Columns("id", "created", "updated", "content", "tags")
+	query.Where("deleted_at IS NULL")
+	query.Where("id > ?", after)
+	query.OrderBy("id", "ASC")
+	query.Limit(exportBatchSize)
+
+	if _, err := query.Load(&thoughts); err != nil || len(thoughts) == 0 {
+		return nil, "", err
+	}
+
+	records := make([]interface{}, len(thoughts))
+	for i, thought := range thoughts {
+		records[i] = thought
+	}
+
+	return records, thoughts[len(thoughts)-1].ID, nil
+}
+
+func (store *Store) exportTags(ctx context.Context, after string) ([]interface{}, string, error) {
+	tags := []*Tag{}
+
+	query := store.db.Select(ctx).From(tagCounts)
+	query.Columns("name", "bookmarks", "feeds", "thoughts")
+	query.Where("bookmarks + feeds + thoughts > 0")
+	query.Where("name > ?", after)
+	query.OrderBy("name", "ASC")
+	query.Limit(exportBatchSize)
+
+	if _, err := query.Load(&tags); err != nil || len(tags) == 0 {
+		return nil, "", err
+	}
+
+	records := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		records[i] = tag
+	}
+
+	return records, tags[len(tags)-1].Name, nil
+}
+
+// ExportNetscapeTo writes all bookmarks that are not deleted to w as a Netscape bookmark file, the
+// html format that browsers and other bookmark managers like Shiori import. Tags are written to the
+// TAGS attribute and excerpts to descriptions. It returns the number of bytes written.
+func (store *Store) ExportNetscapeTo(ctx context.Context, w io.Writer) (int64, error) {
+	ctx, span := store.start(ctx, "Store.ExportNetscapeTo")
+	defer span.End()
+
+	out := &countingWriter{w: w}
+
+	err := store.WithTx(ctx, func(tx *Store) error {
+		ctx := qb.WitTx(ctx, tx.tx)
+
+		header := "<!DOCTYPE NETSCAPE-Bookmark-file-1>\n" +
+			"<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=UTF-8\">\n" +
+			"<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n"
+		if _, err := io.WriteString(out, header); err != nil {
+			return err
+		}
+
+		after := ""
+
+		for {
+			records, last, err := tx.exportBookmarks(ctx, after)
+			if err != nil {
+				return err
+			}
+
+			for _, record := range records {
+				bookmark := record.(*Bookmark)
+
+				_, err := fmt.Fprintf(out, "<DT><A HREF=\"%s\" ADD_DATE=\"%d\" LAST_MODIFIED=\"%d\" TAGS=\"%s\">%s</A>\n",
+					html.EscapeString(bookmark.URL), bookmark.Created.Unix(), bookmark.Updated.Unix(),
+					html.EscapeString(strings.Join(bookmark.Tags, ",")), html.EscapeString(bookmark.Title))
+				if err != nil {
+					return err
+				}
+
+				if bookmark.Excerpt != "" {
+					if _, err := io.WriteString(out, "<DD>"+html.EscapeString(bookmark.Excerpt)+"\n"); err != nil {
+						return err
+					}
+				}
+			}
+
+			if len(records) < exportBatchSize {
+				break
+			}
+			after = last
+		}
+
+		_, err := io.WriteString(out, "</DL><p>\n")
+
+		return err
+	})
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Int64("written", out.written).Msg("Error exporting bookmarks")
+		return out.written, err
+	}
+
+	log.Ctx(ctx).Info().Int64("written", out.written).Msg("Exported bookmarks")
+
+	return out.written, nil
+}
@@ -2,14 +2,18 @@ package storage
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/mmcdole/gofeed"
+	"github.com/nrocco/qb"
 	"github.com/rs/zerolog/log"
 )
 
@@ -22,8 +26,18 @@ var (
 
 	// ErrNotExistingFeedItem is returned if a feed does not contain an item
 	ErrNotExistingFeedItem = errors.New("Item does not exist in Feed")
+
+	// ErrNotDeletedFeed is returned when restoring a feed that is not deleted
+	ErrNotDeletedFeed = errors.New("Feed is not deleted")
+
+	// ErrInvalidRefreshInterval is returned if the Feed has a negative refresh interval
+	ErrInvalidRefreshInterval = errors.New("Invalid Feed.RefreshInterval")
 )
 
+// maxBackoff caps the number of times the refresh interval of a broken feed doubles, to about
+// 40 days for feeds that are refreshed every hour
+const maxBackoff = 10
+
 // Feed represents a feed in the database
 type Feed struct {
 	ID           string
@@ -36,10 +50,74 @@ type Feed struct {
 	Etag         string
 	Tags         Tags
 	Items        FeedItems
+	Filters      FeedFilters
+	Seen         Seen `json:"-"`
+	DeletedAt    qb.NullTime
+
+	// RefreshInterval is how often the feed is refreshed, the refresh window of the sweeps if zero
+	RefreshInterval Duration
+
+	// Paused feeds are not refreshed by the sweeps, they keep their items
+	Paused bool
+
+	// FetchFullContent replaces the content of new items by the readable content of the page they
+	// link to, for feeds that only have a summary of their articles
+	FetchFullContent bool
+
+	// ErrorCount is the number of times in a row the feed could not be refreshed, LastError is why
+	// it could not be refreshed the last time and Failed is when
+	ErrorCount int
+	LastError  string
+	Failed     qb.NullTime
+}
+
+// Duration is a time.Duration that is a string like 15m in JSON and whole seconds in the database
+type Duration time.Duration
+
+// Value implements the Valuer interface
+func (d Duration) Value() (driver.Value, error) {
+	return int64(time.Duration(d) / time.Second), nil
+}
+
+// Scan implements the Scanner interface
+func (d *Duration) Scan(value interface{}) error {
+	seconds, ok := value.(int64)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into a Duration", value)
+	}
+
+	*d = Duration(time.Duration(seconds) * time.Second)
+
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(duration)
+
+	return nil
 }
 
 // Fetch fetches new items from the given Feed
 func (feed *Feed) Fetch(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Feed.Fetch")
+	defer span.End()
+
 	if feed.URL == "" {
 		return ErrNoFeedURL
 	}
@@ -48,14 +126,16 @@ func (feed *Feed) Fetch(ctx context.Context) error {
 
 	logger.Info().Msg("Fetching feed")
 
-	client := &http.Client{}
+	// The pages of the items are fetched with a timeout of their own
+	fetchCtx, cancel := withFetchTimeout(ctx)
+	defer cancel()
 
-	request, err := http.NewRequest("GET", feed.URL, nil)
+	request, err := http.NewRequestWithContext(fetchCtx, "GET", feed.URL, nil)
 	if err != nil {
 		return err
 	}
 
-	request.Header.Set("User-Agent", defaultUserAgent)
+	request.Header.Set("User-Agent", userAgent)
 
 	if feed.Etag != "" {
 		request.Header.Set("If-None-Match", feed.Etag)
@@ -66,33 +146,65 @@ func (feed *Feed) Fetch(ctx context.Context) error {
 		logger = logger.With().Str("If-Modified-Since", modifiedSince).Logger()
 	}
 
-	response, err := client.Do(request)
+	response, err := fetchClient.Do(request)
 	if err != nil {
-		logger.Warn().Err(err).Int("status_code", response.StatusCode).Msg("Error fetching feed")
-		return err
+		logger.Warn().Err(err).Msg("Error fetching feed")
+		span.RecordError(err)
+		return fmt.Errorf("%w: %s", ErrFetchFailed, err)
 	}
 
+	defer response.Body.Close()
+
 	logger.Info().Int("status_code", response.StatusCode).Msg("Successfully fetched feed")
 
 	if 304 == response.StatusCode {
 		return nil
 	}
 
-	defer response.Body.Close()
-
 	parsedFeed, err := gofeed.NewParser().Parse(response.Body)
 	if err != nil {
 		logger.Warn().Err(err).Msg("Unable to parse xml from feed")
-		return err
+		span.RecordError(err)
+		return fmt.Errorf("%w: %s", ErrFetchFailed, err)
 	}
 
 	logger.Info().Int("items", len(parsedFeed.Items)).Msg("Found items in Feed")
 
 	textCleaner := bluemonday.StrictPolicy()
 
+	// Entries are known by their GUID, or their link if they have none, once they were seen before
+	// or are still unread. Older unread items only have a link.
+	known := map[string]bool{}
+	for _, guid := range feed.Seen {
+		known[guid] = true
+	}
+	for _, item := range feed.Items {
+		known[item.GUID] = item.GUID != ""
+		known[item.URL] = item.URL != ""
+	}
+
+	guids := []string{}
+	added := FeedItems{}
+
 	for _, item := range parsedFeed.Items {
+		guid := item.GUID
+		if guid == "" {
+			guid = item.Link
+		}
+
+		if guid != "" {
+			guids = append(guids, guid)
+		}
+
+		if known[guid] || known[item.Link] {
+			continue
+		}
+
+		known[guid] = guid != ""
+
 		feedItem := &FeedItem{
 			ID:      generateUUID(),
+			GUID:    guid,
 			Created: time.Now(),
 			Updated: time.Now(),
 			Title:   item.Title,
@@ -105,6 +217,15 @@ func (feed *Feed) Fetch(ctx context.Context) error {
 			feedItem.Content = textCleaner.Sanitize(item.Description)
 		}
 
+		for _, enclosure := range item.Enclosures {
+			if enclosure.URL == "" {
+				continue
+			}
+
+			length, _ := strconv.ParseInt(enclosure.Length, 10, 64)
+			feedItem.Enclosures = append(feedItem.Enclosures, &FeedEnclosure{URL: enclosure.URL, Type: enclosure.Type, Length: length})
+		}
+
 		if item.PublishedParsed != nil {
 			feedItem.Date = *item.PublishedParsed
 		} else if item.UpdatedParsed != nil {
@@ -119,7 +240,17 @@ func (feed *Feed) Fetch(ctx context.Context) error {
 			continue
 		}
 
+		if !feed.Filters.allows(feedItem) {
+			logger.Debug().Str("item_url", feedItem.URL).Msg("Item was filtered out")
+			continue
+		}
+
 		feed.Items = append(feed.Items, feedItem)
+		added = append(added, feedItem)
+	}
+
+	if feed.FetchFullContent {
+		fetchContents(logger.WithContext(ctx), added)
 	}
 
 	if parsedFeed.Updated != "" {
@@ -128,18 +259,39 @@ func (feed *Feed) Fetch(ctx context.Context) error {
 
 	feed.Etag = response.Header.Get("Etag")
 	feed.Refreshed = time.Now()
+	feed.Seen = feed.Seen.remember(guids)
 
 	if feed.Title == "" {
 		feed.Title = parsedFeed.Title
 	}
 
-	sort.SliceStable(feed.Items, func(i, j int) bool {
-		return feed.Items[i].Date.After(feed.Items[j].Date)
-	})
+	feed.Items.sortByDate()
 
 	return nil
 }
 
+// itemIDs returns the IDs of the items of the feed, to tell apart the items Fetch adds
+func (feed *Feed) itemIDs() map[string]bool {
+	IDs := map[string]bool{}
+	for _, item := range feed.Items {
+		IDs[item.ID] = true
+	}
+
+	return IDs
+}
+
+// addedItems returns the items of the feed whose ID is not in before
+func (feed *Feed) addedItems(before map[string]bool) FeedItems {
+	added := FeedItems{}
+	for _, item := range feed.Items {
+		if !before[item.ID] {
+			added = append(added, item)
+		}
+	}
+
+	return added
+}
+
 // GetItem gets an item by ID from this feed list of items
 func (feed *Feed) GetItem(ID string) *FeedItem {
 	for _, item := range feed.Items {
@@ -171,56 +323,117 @@ type FeedListOptions struct {
 	Search            string
 	Tags              Tags
 	NotRefreshedSince time.Time
+	MaxErrors         int
+	Broken            bool
+	IncludeDeleted    bool
+	Sort              Sort
 	Limit             int
 	Offset            int
 }
 
-// FeedList fetches multiple feeds from the database
-func (store *Store) FeedList(ctx context.Context, options *FeedListOptions) (*[]*Feed, int) {
+// feedFilter selects the feeds that match the options, regardless of the page
+func (store *Store) feedFilter(ctx context.Context, options *FeedListOptions) *qb.SelectQuery {
 	query := store.db.Select(ctx).From("feeds")
 
 	if options.Search != "" {
-		query.Where("(title LIKE ? OR url LIKE ?)", "%"+options.Search+"%", "%"+options.Search+"%")
+		store.dialect.search(query, "feeds", options.Search)
 	}
 
+	// Feeds are due once their own refresh interval or else the window passed since they were
+	// refreshed, which doubles with every time in a row they could not be refreshed since they
+	// failed, unless they are paused
 	if !options.NotRefreshedSince.IsZero() {
-		query.Where("refreshed < ?", options.NotRefreshedSince)
+		now := time.Now()
+		window := int64(now.Sub(options.NotRefreshedSince) / time.Second)
+
+		query.Where("NOT paused")
+		store.dialect.feedsDue(query, window, maxBackoff, now)
 	}
 
-	for _, tag := range options.Tags {
-		if tag == "" {
-			continue
-		} else if strings.HasPrefix(tag, "-") {
-			query.Where("NOT EXISTS (SELECT 1 FROM json_each(thoughts.tags) where json_each.value = ?)", strings.TrimPrefix(tag, "-"))
-		} else {
-			query.Where("EXISTS (SELECT 1 FROM json_each(thoughts.tags) where json_each.value = ?)", tag)
-		}
+	if options.MaxErrors > 0 {
+		query.Where("error_count < ?", options.MaxErrors)
+	}
+
+	if options.Broken {
+		query.Where("error_count > 0")
+	}
+
+	filterTags(query, "feeds", options.Tags)
+
+	if !options.IncludeDeleted {
+		query.Where("deleted_at IS NULL")
 	}
 
+	return query
+}
+
+// FeedList fetches multiple feeds from the database
+func (store *Store) FeedList(ctx context.Context, options *FeedListOptions) (*[]*Feed, int) {
+	ctx, span := store.start(ctx, "Store.FeedList")
+	defer span.End()
+
+	// The feeds to refresh depend on the time, so they are never cached
+	if !options.NotRefreshedSince.IsZero() {
+		feeds, totalCount, _ := store.feedList(ctx, options)
+		return &feeds, totalCount
+	}
+
+	result := store.cached(ctx, "FeedList", *options, []string{"feeds"}, func() (interface{}, error) {
+		feeds, totalCount, err := store.feedList(ctx, options)
+		return listResult{feeds, totalCount}, err
+	}).(listResult)
+
+	// Callers may change the feeds, so they get a copy of the cached ones
+	feeds := []*Feed{}
+	for _, feed := range result.list.([]*Feed) {
+		feeds = append(feeds, copyFeed(feed))
+	}
+
+	return &feeds, result.totalCount
+}
+
+func (store *Store) feedList(ctx context.Context, options *FeedListOptions) ([]*Feed, int, error) {
+	query := store.feedFilter(ctx, options)
+
 	feeds := []*Feed{}
 	totalCount := 0
 
-	query.Columns("COUNT(id)")
-	if err := query.LoadValue(&totalCount); err != nil {
-		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed count")
-		return &feeds, 0
-	}
+	rows := []struct {
+		Feed
+		TotalCount int
+	}{}
 
-	query.Columns("*")
-	query.OrderBy("last_authored", "DESC")
+	query.Columns("feeds.*", totalCountColumn)
+	options.Sort.apply(query, ranked(options.Search, "", Sort{{"last_authored", true}}))
 	query.Limit(options.Limit)
 	query.Offset(options.Offset)
-	if _, err := query.Load(&feeds); err != nil {
+	if _, err := query.Load(&rows); err != nil {
 		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feeds")
-		return &feeds, 0
+		return feeds, 0, err
+	}
+
+	for i := range rows {
+		feeds = append(feeds, &rows[i].Feed)
+		totalCount = rows[i].TotalCount
+	}
+
+	if len(rows) == 0 {
+		if err := store.feedFilter(ctx, options).Columns("COUNT(id)").LoadValue(&totalCount); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed count")
+			return feeds, 0, err
+		}
 	}
 
-	return &feeds, totalCount
+	return feeds, totalCount, nil
 }
 
 // FeedGet finds a single feed by ID or URL
 func (store *Store) FeedGet(ctx context.Context, feed *Feed) error {
+	ctx, span := store.start(ctx, "Store.FeedGet")
+	defer span.End()
+
 	query := store.db.Select(ctx).From("feeds")
+	query.Where("deleted_at IS NULL")
 	query.Limit(1)
 
 	if feed.ID != "" {
@@ -240,10 +453,21 @@ func (store *Store) FeedGet(ctx context.Context, feed *Feed) error {
 
 // FeedPersist persists a feed to the database and schedules an async job to fetch the content
 func (store *Store) FeedPersist(ctx context.Context, feed *Feed) error {
+	ctx, span := store.start(ctx, "Store.FeedPersist")
+	defer span.End()
+
 	if feed.URL == "" {
 		return ErrNoFeedURL
 	}
 
+	if feed.RefreshInterval < 0 {
+		return ErrInvalidRefreshInterval
+	}
+
+	if err := feed.Filters.prepare(); err != nil {
+		return err
+	}
+
 	if feed.Title == "" {
 		feed.Title = feed.URL
 	}
@@ -264,16 +488,26 @@ func (store *Store) FeedPersist(ctx context.Context, feed *Feed) error {
 		feed.Items = FeedItems{}
 	}
 
+	if feed.Filters == nil {
+		feed.Filters = FeedFilters{}
+	}
+
+	if feed.Seen == nil {
+		feed.Seen = Seen{}
+	}
+
 	feed.Updated = time.Now()
 
 	// Check if there is already a feed with the same URL in the database
 	store.db.Select(ctx).From("feeds").Columns("id", "created").Where("url = ?", feed.URL).Limit(1).LoadValue(&feed)
 
-	if feed.ID == "" {
-		feed.ID = generateUUID()
+	if !store.exists(ctx, "feeds", feed.ID) {
+		if feed.ID == "" {
+			feed.ID = generateUUID()
+		}
 
 		query := store.db.Insert(ctx).InTo("feeds")
-		query.Columns("id", "created", "etag", "items", "last_authored", "refreshed", "tags", "title", "updated", "url")
+		query.Columns("id", "created", "error_count", "etag", "failed", "fetch_full_content", "filters", "items", "last_authored", "last_error", "paused", "refresh_interval", "refreshed", "seen", "tags", "title", "updated", "url")
 		query.Record(feed)
 
 		if _, err := query.Exec(); err != nil {
@@ -285,11 +519,20 @@ func (store *Store) FeedPersist(ctx context.Context, feed *Feed) error {
 		query.Set("etag", feed.Etag)
 		query.Set("items", feed.Items)
 		query.Set("last_authored", feed.LastAuthored)
+		query.Set("refresh_interval", feed.RefreshInterval)
+		query.Set("paused", feed.Paused)
+		query.Set("fetch_full_content", feed.FetchFullContent)
+		query.Set("filters", feed.Filters)
+		query.Set("seen", feed.Seen)
+		query.Set("error_count", feed.ErrorCount)
+		query.Set("last_error", feed.LastError)
+		query.Set("failed", feed.Failed)
 		query.Set("refreshed", feed.Refreshed)
 		query.Set("tags", feed.Tags)
 		query.Set("title", feed.Title)
 		query.Set("updated", feed.Updated)
 		query.Set("url", feed.URL)
+		query.Set("deleted_at", feed.DeletedAt)
 		query.Where("id = ?", feed.ID)
 
 		if _, err := query.Exec(); err != nil {
@@ -298,18 +541,27 @@ func (store *Store) FeedPersist(ctx context.Context, feed *Feed) error {
 		}
 	}
 
+	store.invalidate("feeds")
+
 	log.Ctx(ctx).Info().Str("id", feed.ID).Str("url", feed.URL).Msg("Persisted feed")
 
 	return nil
 }
 
-// FeedDelete deletes the given feed from the database
+// FeedDelete marks the given feed as deleted, it can be restored until it is purged
 func (store *Store) FeedDelete(ctx context.Context, feed *Feed) error {
+	ctx, span := store.start(ctx, "Store.FeedDelete")
+	defer span.End()
+
 	if feed.ID == "" && feed.URL == "" {
 		return ErrNoFeedKey
 	}
 
-	query := store.db.Delete(ctx).From("feeds")
+	feed.DeletedAt = nullTimeNow()
+
+	query := store.db.Update(ctx).Table("feeds")
+	query.Set("deleted_at", feed.DeletedAt)
+	query.Where("deleted_at IS NULL")
 
 	if feed.ID != "" {
 		query.Where("id = ?", feed.ID)
@@ -324,6 +576,8 @@ func (store *Store) FeedDelete(ctx context.Context, feed *Feed) error {
 		return err
 	}
 
+	store.invalidate("feeds")
+
 	log.Ctx(ctx).Info().Str("id", feed.ID).Str("url", feed.URL).Msg("Feed deleted")
 
 	return nil
@@ -331,15 +585,173 @@ func (store *Store) FeedDelete(ctx context.Context, feed *Feed) error {
 
 // FeedRefresh fetches the rss feed items and persists those to the database
 func (store *Store) FeedRefresh(ctx context.Context, feed *Feed) error {
+	ctx, span := store.start(ctx, "Store.FeedRefresh")
+	defer span.End()
+
+	before := feed.itemIDs()
+
 	if err := feed.Fetch(ctx); err != nil {
 		return err
 	}
 
-	if err := store.FeedPersist(ctx, feed); err != nil {
+	feed.ErrorCount = 0
+	feed.LastError = ""
+	feed.Failed = qb.NullTime{}
+
+	// A feed that is not persisted yet has no items to merge with
+	if !store.exists(ctx, "feeds", feed.ID) {
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			return err
+		}
+	} else if err := store.feedMerge(ctx, feed, feed.addedItems(before)); err != nil {
 		return err
 	}
 
+	refreshIcon(ctx, store, feed)
+
 	log.Ctx(ctx).Info().Str("id", feed.ID).Str("url", feed.URL).Msg("Feed refreshed")
 
 	return nil
 }
+
+// feedMerge adds the items to the items of the feed in the database and records that the feed was
+// refreshed. Fetching a feed takes a while, so the items in the database are not replaced: items
+// that were starred, read or deleted in the meantime keep those changes. The feed is loaded again
+// afterwards.
+func (store *Store) feedMerge(ctx context.Context, feed *Feed, items FeedItems) error {
+	// Dates are serialized with the time zone of their feed, so they are sorted as points in time
+	d := store.dialect
+	query := "UPDATE feeds SET items = (SELECT " + d.jsonArray("value") + " FROM (" +
+		"SELECT value FROM (SELECT value FROM " + d.jsonEach("feeds.items") + " UNION ALL SELECT value FROM " + d.jsonEach("?") + ") AS merged " +
+		"ORDER BY " + d.jsonTime(d.jsonField("value", "Date")) + " DESC) AS items), " +
+		"etag = ?, last_authored = ?, seen = ?, refreshed = ?, error_count = 0, last_error = '', failed = NULL, updated = ? " +
+		"WHERE id = ?"
+
+	if _, err := store.exec(ctx, query, items, feed.Etag, feed.LastAuthored, feed.Seen, feed.Refreshed, time.Now(), feed.ID); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", feed.ID).Str("url", feed.URL).Msg("Error merging the items of feed")
+		return err
+	}
+
+	store.invalidate("feeds")
+
+	log.Ctx(ctx).Info().Str("id", feed.ID).Int("items", len(items)).Msg("Merged the new items of feed")
+
+	return store.FeedGet(ctx, feed)
+}
+
+// FeedFailed records that the given feed could not be refreshed because of reason
+func (store *Store) FeedFailed(ctx context.Context, feed *Feed, reason string) error {
+	ctx, span := store.start(ctx, "Store.FeedFailed")
+	defer span.End()
+
+	if feed.ID == "" {
+		return ErrNoFeedKey
+	}
+
+	feed.Failed = nullTimeNow()
+
+	if _, err := store.exec(ctx, "UPDATE feeds SET error_count = error_count + 1, last_error = ?, failed = ? WHERE id = ?", reason, feed.Failed, feed.ID); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", feed.ID).Msg("Error recording feed failure")
+		return err
+	}
+
+	store.invalidate("feeds")
+
+	log.Ctx(ctx).Warn().Str("id", feed.ID).Str("error", reason).Msg("Feed could not be refreshed")
+
+	return store.FeedGet(ctx, feed)
+}
+
+// FeedRestore restores the given deleted feed
+func (store *Store) FeedRestore(ctx context.Context, feed *Feed) error {
+	ctx, span := store.start(ctx, "Store.FeedRestore")
+	defer span.End()
+
+	if feed.ID == "" {
+		return ErrNoFeedKey
+	}
+
+	query := store.db.Update(ctx).Table("feeds")
+	query.Set("deleted_at", qb.NullTime{})
+	query.Where("id = ?", feed.ID)
+	query.Where("deleted_at IS NOT NULL")
+
+	result, err := query.Exec()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", feed.ID).Msg("Error restoring feed")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotDeletedFeed
+	}
+
+	store.invalidate("feeds")
+
+	log.Ctx(ctx).Info().Str("id", feed.ID).Msg("Feed restored")
+
+	return store.FeedGet(ctx, feed)
+}
+
+// FeedReadOptions selects the feed items FeedRead marks as read
+type FeedReadOptions struct {
+	// ID limits the items to those of a single feed, all feeds if empty
+	ID string
+	// Tags limits the items to those of feeds that have every tag, or not a tag prefixed with -
+	Tags Tags
+	// Before limits the items to those dated before it, all items if zero
+	Before time.Time
+}
+
+// FeedRead marks the items of feeds as read by removing them, except starred items, in a single
+// statement, and returns the number of feeds that had items marked as read
+func (store *Store) FeedRead(ctx context.Context, options *FeedReadOptions) (int64, error) {
+	ctx, span := store.start(ctx, "Store.FeedRead")
+	defer span.End()
+
+	// Items are kept as a JSON array, the dates of its items are compared as points in time because
+	// they are serialized with the time zone of the feed. Starred items are kept.
+	d := store.dialect
+	unread := d.jsonFlag("value", "Starred")
+	args := []interface{}{time.Now()}
+
+	if !options.Before.IsZero() {
+		unread += " OR " + d.jsonTime(d.jsonField("value", "Date")) + " >= " + d.jsonTime("?")
+		args = append(args, options.Before.UTC().Format(time.RFC3339Nano))
+	}
+
+	query := "UPDATE feeds SET updated = ?, items = (SELECT " + d.jsonArray("value") + " FROM " + d.jsonEach("feeds.items") + " WHERE " + unread + ")"
+	query += " WHERE deleted_at IS NULL AND EXISTS (SELECT 1 FROM " + d.jsonEach("feeds.items") + " WHERE NOT (" + unread + "))"
+	args = append(args, args[1:]...)
+
+	if options.ID != "" {
+		query += " AND id = ?"
+		args = append(args, options.ID)
+	}
+
+	for _, tag := range options.Tags {
+		if tag == "" {
+			continue
+		} else if strings.HasPrefix(tag, "-") {
+			query += " AND NOT " + hasTag("feeds")
+			args = append(args, strings.TrimPrefix(tag, "-"))
+		} else {
+			query += " AND " + hasTag("feeds")
+			args = append(args, tag)
+		}
+	}
+
+	result, err := store.exec(ctx, query, args...)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", options.ID).Msg("Error marking feed items as read")
+		return 0, err
+	}
+
+	affected, _ := result.RowsAffected()
+
+	store.invalidate("feeds")
+
+	log.Ctx(ctx).Info().Str("id", options.ID).Int64("feeds", affected).Msg("Marked feed items as read")
+
+	return affected, nil
+}
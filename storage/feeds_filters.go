@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+
+	"github.com/nrocco/qb"
+)
+
+const (
+	// FilterDrop drops the items that match a filter
+	FilterDrop = "drop"
+
+	// FilterKeep only keeps the items that match a filter, or any of the filters with this action
+	FilterKeep = "keep"
+)
+
+var (
+	// ErrInvalidFeedFilter is returned if a filter of a Feed has an unknown field or action, or a
+	// pattern that is not a valid regular expression
+	ErrInvalidFeedFilter = errors.New("Invalid Feed.Filters")
+
+	// ErrNotExistingFeedFilter is returned if a feed does not have a filter
+	ErrNotExistingFeedFilter = errors.New("Filter does not exist in Feed")
+)
+
+// filterFields maps the fields a filter can match to the text of an item they match against
+var filterFields = map[string]func(item *FeedItem) string{
+	"":        func(item *FeedItem) string { return item.Title + "\n" + item.Content },
+	"title":   func(item *FeedItem) string { return item.Title },
+	"content": func(item *FeedItem) string { return item.Content },
+	"url":     func(item *FeedItem) string { return item.URL },
+}
+
+// FeedFilters represents a slice of FeedFilter
+type FeedFilters []*FeedFilter
+
+// Value implements the Valuer interface
+func (f FeedFilters) Value() (driver.Value, error) {
+	return qb.JSONValue(f)
+}
+
+// Scan implements the Scanner interface
+func (f *FeedFilters) Scan(value interface{}) error {
+	return qb.JSONScan(f, value)
+}
+
+// FeedFilter is a rule that drops the new items of a feed that match the regular expression
+// Pattern, or only keeps them. It matches the title, content or url of an item, or both the title
+// and content if Field is empty. Patterns are case sensitive unless they start with (?i).
+type FeedFilter struct {
+	ID      string
+	Field   string
+	Pattern string
+	Action  string
+
+	pattern *regexp.Regexp
+}
+
+// validate checks the field, action and pattern of the filter
+func (filter *FeedFilter) validate() error {
+	if _, ok := filterFields[filter.Field]; !ok {
+		return ErrInvalidFeedFilter
+	}
+
+	if filter.Action != FilterDrop && filter.Action != FilterKeep {
+		return ErrInvalidFeedFilter
+	}
+
+	pattern, err := regexp.Compile(filter.Pattern)
+	if err != nil || filter.Pattern == "" {
+		return ErrInvalidFeedFilter
+	}
+
+	filter.pattern = pattern
+
+	return nil
+}
+
+// matches tells if the pattern of the filter matches its field of item
+func (filter *FeedFilter) matches(item *FeedItem) bool {
+	if filter.pattern == nil && filter.validate() != nil {
+		return false
+	}
+
+	return filter.pattern.MatchString(filterFields[filter.Field](item))
+}
+
+// allows tells if an item passes the filters, it is dropped if any filter that drops items matches
+// and kept only if any of the filters that keep items match
+func (filters FeedFilters) allows(item *FeedItem) bool {
+	keep, kept := false, false
+
+	for _, filter := range filters {
+		switch filter.Action {
+		case FilterDrop:
+			if filter.matches(item) {
+				return false
+			}
+		case FilterKeep:
+			keep = true
+			kept = kept || filter.matches(item)
+		}
+	}
+
+	return !keep || kept
+}
+
+// prepare validates the filters and gives new filters an ID
+func (filters FeedFilters) prepare() error {
+	for _, filter := range filters {
+		if err := filter.validate(); err != nil {
+			return err
+		}
+
+		if filter.ID == "" {
+			filter.ID = generateUUID()
+		}
+	}
+
+	return nil
+}
+
+// GetFilter gets a filter by ID from the filters of this feed
+func (feed *Feed) GetFilter(ID string) *FeedFilter {
+	for _, filter := range feed.Filters {
+		if ID == filter.ID {
+			return filter
+		}
+	}
+
+	return nil
+}
+
+// DeleteFilter removes a filter by ID from the filters of this feed
+func (feed *Feed) DeleteFilter(ID string) error {
+	for i, filter := range feed.Filters {
+		if ID != filter.ID {
+			continue
+		}
+
+		feed.Filters = append(feed.Filters[:i], feed.Filters[i+1:]...)
+
+		return nil
+	}
+
+	return ErrNotExistingFeedFilter
+}
@@ -0,0 +1,213 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// iconMaxAge is how long the icon of a feed is cached before it is fetched again
+	iconMaxAge = 7 * 24 * time.Hour
+
+	// iconMaxSize is the largest icon in bytes that is kept
+	iconMaxSize = 512 << 10
+)
+
+// ErrNoFeedIcon is returned if the site of a Feed does not have an icon, or it was not fetched yet
+var ErrNoFeedIcon = errors.New("Feed does not have an icon")
+
+// FeedIcon is the favicon of the site of a Feed. An icon without Data records that the site does
+// not have one.
+type FeedIcon struct {
+	FeedID      string
+	Fetched     time.Time
+	ContentType string
+	Data        []byte
+}
+
+// stale tells if the icon was fetched longer ago than iconMaxAge
+func (icon *FeedIcon) stale() bool {
+	return time.Since(icon.Fetched) > iconMaxAge
+}
+
+// FetchIcon downloads the favicon of the site of the feed, the icon the home page links to with
+// <link rel="icon"> or else /favicon.ico
+func (feed *Feed) FetchIcon(ctx context.Context) (*FeedIcon, error) {
+	ctx, span := tracer.Start(ctx, "Feed.FetchIcon")
+	defer span.End()
+
+	feedURL, err := url.ParseRequestURI(feed.URL)
+	if err != nil {
+		return nil, ErrNoFeedURL
+	}
+
+	ctx, cancel := withFetchTimeout(ctx)
+	defer cancel()
+
+	site := &url.URL{Scheme: feedURL.Scheme, Host: feedURL.Host, Path: "/"}
+
+	iconURL, err := findIcon(ctx, site)
+	if err != nil {
+		log.Ctx(ctx).Debug().Err(err).Str("url", site.String()).Msg("Error finding the icon of the site, trying /favicon.ico")
+	}
+
+	if iconURL == nil {
+		iconURL = site.ResolveReference(&url.URL{Path: "/favicon.ico"})
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", iconURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err := fetchClient.Do(request)
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("%w: %s", ErrFetchFailed, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 {
+		return nil, fmt.Errorf("%w: %s", ErrFetchFailed, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, iconMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFetchFailed, err)
+	} else if len(data) > iconMaxSize {
+		return nil, ErrResponseTooLarge
+	}
+
+	// Servers often send icons as application/octet-stream, svg icons can not be sniffed
+	contentType := response.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "image/") {
+		contentType = http.DetectContentType(data)
+	}
+
+	if !strings.HasPrefix(contentType, "image/") {
+		return nil, ErrNoFeedIcon
+	}
+
+	return &FeedIcon{FeedID: feed.ID, Fetched: time.Now(), ContentType: contentType, Data: data}, nil
+}
+
+// findIcon returns the url of the first icon the page at site links to, nil if it does not link
+// to any
+func findIcon(ctx context.Context, site *url.URL) (*url.URL, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", site.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err := fetchClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= 400 || !strings.Contains(response.Header.Get("Content-Type"), "html") {
+		return nil, nil
+	}
+
+	document, err := goquery.NewDocumentFromReader(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	href, ok := document.Find("link[rel~=icon][href]").First().Attr("href")
+	if !ok {
+		return nil, nil
+	}
+
+	// Links are relative to the page the request was redirected to
+	return response.Request.URL.Parse(strings.TrimSpace(href))
+}
+
+// refreshIcon fetches the icon of the feed if it was not fetched yet or is stale, a site without an
+// icon is recorded so it is not fetched again until that is stale too
+func refreshIcon(ctx context.Context, store Storer, feed *Feed) {
+	icon := &FeedIcon{FeedID: feed.ID}
+	if err := store.FeedIconGet(ctx, icon); (err == nil || errors.Is(err, ErrNoFeedIcon)) && !icon.Fetched.IsZero() && !icon.stale() {
+		return
+	}
+
+	fetched, err := feed.FetchIcon(ctx)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("id", feed.ID).Msg("Error fetching the icon of feed")
+		fetched = &FeedIcon{FeedID: feed.ID, Fetched: time.Now()}
+	}
+
+	if err := store.FeedIconPersist(ctx, fetched); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("id", feed.ID).Msg("Error persisting the icon of feed")
+	}
+}
+
+// FeedIconGet loads the icon of the feed with icon.FeedID, it returns ErrNoFeedIcon if the icon was
+// not fetched yet or the site does not have one
+func (store *Store) FeedIconGet(ctx context.Context, icon *FeedIcon) error {
+	ctx, span := store.start(ctx, "Store.FeedIconGet")
+	defer span.End()
+
+	if icon.FeedID == "" {
+		return ErrNoFeedKey
+	}
+
+	query := store.db.Select(ctx).From("feed_icons")
+	query.Columns("feed_id", "fetched", "content_type", "data")
+	query.Where("feed_id = ?", icon.FeedID)
+	query.Limit(1)
+
+	icons := []*FeedIcon{}
+	if _, err := query.Load(&icons); err != nil {
+		return err
+	} else if len(icons) == 0 {
+		return ErrNoFeedIcon
+	}
+
+	*icon = *icons[0]
+
+	if len(icon.Data) == 0 {
+		return ErrNoFeedIcon
+	}
+
+	return nil
+}
+
+// FeedIconPersist stores the icon of a feed, replacing the icon it had before
+func (store *Store) FeedIconPersist(ctx context.Context, icon *FeedIcon) error {
+	ctx, span := store.start(ctx, "Store.FeedIconPersist")
+	defer span.End()
+
+	if icon.FeedID == "" {
+		return ErrNoFeedKey
+	}
+
+	if icon.Fetched.IsZero() {
+		icon.Fetched = time.Now()
+	}
+
+	query := "INSERT INTO feed_icons (feed_id, fetched, content_type, data) VALUES (?, ?, ?, ?) " +
+		"ON CONFLICT (feed_id) DO UPDATE SET fetched = excluded.fetched, content_type = excluded.content_type, data = excluded.data"
+
+	if _, err := store.exec(ctx, query, icon.FeedID, icon.Fetched, icon.ContentType, icon.Data); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", icon.FeedID).Msg("Error persisting feed icon")
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str("id", icon.FeedID).Int("size", len(icon.Data)).Msg("Persisted feed icon")
+
+	return nil
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"context"
 	"database/sql/driver"
+	"html"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/nrocco/qb"
+	"github.com/rs/zerolog/log"
 )
 
 // FeedItems represents a slice of FeedItem
@@ -23,12 +29,56 @@ func (i *FeedItems) Scan(value interface{}) error {
 // FeedItem represents a FeedItem as part of a Feed
 type FeedItem struct {
 	ID      string
+	GUID    string
 	Created time.Time
 	Updated time.Time
 	Title   string
 	Date    time.Time
 	URL     string
 	Content string
+	Starred bool
+
+	// Enclosures are the media files of the item, like the audio of a podcast episode
+	Enclosures []*FeedEnclosure `json:",omitempty"`
+}
+
+// FeedEnclosure is a media file attached to a FeedItem, Length is its size in bytes if the feed
+// tells
+type FeedEnclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// maxSeen is the number of GUIDs a feed remembers, well over the number of entries of most feeds
+const maxSeen = 1000
+
+// Seen holds the GUIDs of the entries of a feed that were seen before, the most recent first
+type Seen []string
+
+// Value implements the Valuer interface
+func (s Seen) Value() (driver.Value, error) {
+	return qb.JSONValue(s)
+}
+
+// Scan implements the Scanner interface
+func (s *Seen) Scan(value interface{}) error {
+	return qb.JSONScan(s, value)
+}
+
+// remember puts guids in front of the seen GUIDs, forgetting the oldest ones beyond maxSeen
+func (s Seen) remember(guids []string) Seen {
+	remembered := Seen{}
+	known := map[string]bool{}
+
+	for _, guid := range append(guids, s...) {
+		if !known[guid] && len(remembered) < maxSeen {
+			remembered = append(remembered, guid)
+			known[guid] = true
+		}
+	}
+
+	return remembered
 }
 
 // Value implements the Valuer interface
@@ -40,3 +90,221 @@ func (i FeedItem) Value() (driver.Value, error) {
 func (i *FeedItem) Scan(value interface{}) error {
 	return qb.JSONScan(i, value)
 }
+
+// fullContentWorkers is the number of pages of items that are fetched at a time
+const fullContentWorkers = 4
+
+// sortByDate puts the newest items first
+func (i FeedItems) sortByDate() {
+	sort.SliceStable(i, func(a, b int) bool {
+		return i[a].Date.After(i[b].Date)
+	})
+}
+
+// fetchContents fetches the full content of the items, fullContentWorkers at a time. Items whose
+// page cannot be fetched keep their summary.
+func fetchContents(ctx context.Context, items FeedItems) {
+	wg := sync.WaitGroup{}
+	pending := make(chan *FeedItem)
+
+	for i := 0; i < fullContentWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for item := range pending {
+				if err := item.fetchContent(ctx); err != nil {
+					log.Ctx(ctx).Warn().Err(err).Str("item_url", item.URL).Msg("Error fetching the full content of item, keeping its summary")
+				}
+			}
+		}()
+	}
+
+	for _, item := range items {
+		select {
+		case pending <- item:
+		case <-ctx.Done():
+		}
+	}
+
+	close(pending)
+	wg.Wait()
+}
+
+// fetchContent replaces the content of the item by the readable text of the page it links to, with
+// its entities escaped like the content of items from the feed
+func (item *FeedItem) fetchContent(ctx context.Context) error {
+	article, err := (&Bookmark{URL: item.URL}).fetchArticle(ctx)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(article.TextContent) != "" {
+		item.Content = html.EscapeString(article.TextContent)
+	}
+
+	return nil
+}
+
+// ListedFeedItem is a FeedItem listed by FeedItemList together with the feed it belongs to
+type ListedFeedItem struct {
+	FeedID    string
+	FeedTitle string
+	Item      FeedItem
+}
+
+// FeedItemListOptions can be passed to FeedItemList to filter and page through feed items
+type FeedItemListOptions struct {
+	ID      string
+	Search  string
+	Starred bool
+	Sort    Sort
+	Cursor  string
+	Limit   int
+	Offset  int
+}
+
+// feedItemFilter selects the items that match the options, regardless of the page
+func (store *Store) feedItemFilter(ctx context.Context, options *FeedItemListOptions) *qb.SelectQuery {
+	query := store.db.Select(ctx).From("feeds, " + store.dialect.jsonEach("feeds.items"))
+
+	if options.Search != "" {
+		store.dialect.searchItems(query, options.Search)
+	}
+
+	query.Where("feeds.deleted_at IS NULL")
+
+	if options.ID != "" {
+		query.Where(store.dialect.jsonField("json_each.value", "ID")+" = ?", options.ID)
+	}
+
+	if options.Starred {
+		query.Where(store.dialect.jsonFlag("json_each.value", "Starred"))
+	}
+
+	return query
+}
+
+// feedItemColumns returns the expressions FeedItemSortFields sort on. Dates are serialized with the
+// time zone of their feed, so they are sorted as points in time.
+func feedItemColumns(d dialect) map[string]string {
+	return map[string]string{
+		"date":       d.jsonTime(d.jsonField("json_each.value", "Date")),
+		"title":      d.jsonField("json_each.value", "Title"),
+		"feed_title": "feeds.title",
+	}
+}
+
+// FeedItemList lists the items of all feeds, the newest first unless options.Sort says otherwise
+func (store *Store) FeedItemList(ctx context.Context, options *FeedItemListOptions) (*[]*ListedFeedItem, int) {
+	ctx, span := store.start(ctx, "Store.FeedItemList")
+	defer span.End()
+
+	result := store.cached(ctx, "FeedItemList", *options, []string{"feeds"}, func() (interface{}, error) {
+		items, totalCount, err := store.feedItemList(ctx, options)
+		return listResult{items, totalCount}, err
+	}).(listResult)
+
+	// Callers may change the items, so they get a copy of the cached ones
+	items := []*ListedFeedItem{}
+	for _, item := range result.list.([]*ListedFeedItem) {
+		copied := *item
+		items = append(items, &copied)
+	}
+
+	return &items, result.totalCount
+}
+
+// FeedItemEach calls fn with the items FeedItemList would return, reading them from the database
+// one at a time instead of loading the whole list. The items are not cached.
+func (store *Store) FeedItemEach(ctx context.Context, options *FeedItemListOptions, fn func(item *ListedFeedItem) error) error {
+	ctx, span := store.start(ctx, "Store.FeedItemEach")
+	defer span.End()
+
+	query, err := store.feedItemPage(ctx, options)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed items")
+		return err
+	}
+
+	rows, err := store.rows(ctx, query.Columns("feeds.id AS feed_id", "feeds.title AS feed_title", "json_each.value AS item"))
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed items")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &ListedFeedItem{}
+		if err := rows.Scan(&item.FeedID, &item.FeedTitle, &item.Item); err != nil {
+			return err
+		}
+
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// feedItemPage selects the page of items that options describe, without columns
+func (store *Store) feedItemPage(ctx context.Context, options *FeedItemListOptions) (*qb.SelectQuery, error) {
+	query := store.feedItemFilter(ctx, options)
+
+	if options.Cursor != "" {
+		cursor, err := ParseCursor(options.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		date := feedItemColumns(store.dialect)["date"]
+		at := store.dialect.jsonTime("?")
+		created := cursor.Created.Format(time.RFC3339Nano)
+		query.Where("("+date+" < "+at+" OR ("+date+" = "+at+" AND "+store.dialect.jsonField("json_each.value", "ID")+" < ?))", created, created, cursor.ID)
+	}
+
+	options.Sort.applyColumns(query, ranked(options.Search, options.Cursor, Sort{{"date", true}}), feedItemColumns(store.dialect), store.dialect.jsonField("json_each.value", "ID"))
+	query.Limit(options.Limit)
+	if options.Cursor == "" {
+		query.Offset(options.Offset)
+	}
+
+	return query, nil
+}
+
+func (store *Store) feedItemList(ctx context.Context, options *FeedItemListOptions) ([]*ListedFeedItem, int, error) {
+	items := []*ListedFeedItem{}
+	totalCount := 0
+
+	query, err := store.feedItemPage(ctx, options)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed items")
+		return items, 0, err
+	}
+
+	rows := []struct {
+		ListedFeedItem
+		TotalCount int
+	}{}
+
+	query.Columns("feeds.id AS feed_id", "feeds.title AS feed_title", "json_each.value AS item", totalCountColumn)
+	if _, err := query.Load(&rows); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed items")
+		return items, 0, err
+	}
+
+	for i := range rows {
+		items = append(items, &rows[i].ListedFeedItem)
+		totalCount = rows[i].TotalCount
+	}
+
+	if options.Cursor != "" || len(rows) == 0 {
+		if err := store.feedItemFilter(ctx, options).Columns("COUNT(*)").LoadValue(&totalCount); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Error fetching feed item count")
+			return items, 0, err
+		}
+	}
+
+	return items, totalCount, nil
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	// fetchDialTimeout limits connecting to a remote host
+	fetchDialTimeout = 10 * time.Second
+
+	// fetchTLSHandshakeTimeout limits the tls handshake with a remote host
+	fetchTLSHandshakeTimeout = 10 * time.Second
+
+	// fetchResponseHeaderTimeout limits waiting for a remote host to answer once the request is sent
+	fetchResponseHeaderTimeout = 20 * time.Second
+
+	// fetchClientTimeout limits a whole request including reading the body, in case the caller set
+	// a later deadline than defaultFetchTimeout or none
+	fetchClientTimeout = 2 * time.Minute
+
+	// fetchMaxIdleConnsPerHost keeps connections open to hosts that are fetched from often, like a
+	// site with many feeds
+	fetchMaxIdleConnsPerHost = 4
+
+	// fetchMaxRedirects is the number of redirects followed before giving up
+	fetchMaxRedirects = 5
+
+	// DefaultFetchMaxSize is the largest response body read when fetching a bookmark or feed
+	DefaultFetchMaxSize = 10 << 20
+)
+
+var (
+	// ErrTooManyRedirects is returned if fetching a Bookmark or Feed redirected more than
+	// fetchMaxRedirects times
+	ErrTooManyRedirects = errors.New("Stopped after too many redirects")
+
+	// ErrPrivateHost is returned if the public fetch client is asked to connect to an address on
+	// the server itself or a network that is not the internet
+	ErrPrivateHost = errors.New("Only hosts on the internet can be connected to")
+
+	// ErrResponseTooLarge is returned if the body of a fetched Bookmark or Feed is larger than the
+	// maximum size
+	ErrResponseTooLarge = errors.New("Response is too large")
+
+	// fetchClient and userAgent fetch bookmarks and feeds, see SetFetchOptions
+	fetchClient       = newFetchClient(FetchOptions{MaxSize: DefaultFetchMaxSize}, false)
+	publicFetchClient = newFetchClient(FetchOptions{MaxSize: DefaultFetchMaxSize}, true)
+	userAgent         = defaultUserAgent
+
+	// specialPurpose are the networks of the IANA special purpose address registries, which are
+	// not the internet
+	specialPurpose = parseNetworks(
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+		"192.0.0.0/24", "192.0.2.0/24", "192.31.196.0/24", "192.52.193.0/24", "192.88.99.0/24",
+		"192.168.0.0/16", "192.175.48.0/24", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24",
+		"224.0.0.0/4", "240.0.0.0/4",
+		"::/127", "64:ff9b::/96", "64:ff9b:1::/48", "100::/64", "2001::/23", "2001:db8::/32",
+		"2002::/16", "2620:4f:8000::/48", "fc00::/7", "fe80::/10", "ff00::/8",
+	)
+)
+
+// FetchOptions configure how bookmarks and feeds are fetched
+type FetchOptions struct {
+	// UserAgent is sent with every request, empty for the default user agent
+	UserAgent string
+
+	// Proxy is the http proxy requests go through, they go directly if it is nil
+	Proxy *url.URL
+
+	// DNSCache is how long resolved host names are cached, 0 disables the cache
+	DNSCache time.Duration
+
+	// MaxSize is the largest response body in bytes that is read after decompressing it, 0
+	// disables the limit
+	MaxSize int64
+}
+
+// SetFetchOptions changes how bookmarks and feeds are fetched, all requests share a single pool of
+// connections. It must be called before anything is fetched.
+func SetFetchOptions(options FetchOptions) {
+	userAgent = defaultUserAgent
+	if options.UserAgent != "" {
+		userAgent = options.UserAgent
+	}
+
+	fetchClient = newFetchClient(options, false)
+	publicFetchClient = newFetchClient(options, true)
+}
+
+// FetchClient returns the client bookmarks and feeds are fetched with, for other requests to remote
+// hosts that should go through the same proxy, timeouts and pool of connections
+func FetchClient() *http.Client {
+	return fetchClient
+}
+
+// PublicFetchClient is FetchClient for requests to addresses that others choose, it only connects
+// to hosts on the internet. The address is checked when connecting, so a host name that resolves
+// to another address later can not get around it. Behind a proxy it is the proxy that connects.
+func PublicFetchClient() *http.Client {
+	return publicFetchClient
+}
+
+// IsPublic checks if ip is an address on the internet, rather than on the server itself, the
+// network it is in or any other special purpose network
+func IsPublic(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, network := range specialPurpose {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newFetchClient(options FetchOptions, public bool) *http.Client {
+	dialer := &net.Dialer{Timeout: fetchDialTimeout, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSHandshakeTimeout = fetchTLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = fetchResponseHeaderTimeout
+	transport.MaxIdleConnsPerHost = fetchMaxIdleConnsPerHost
+
+	if options.Proxy != nil {
+		transport.Proxy = http.ProxyURL(options.Proxy)
+	}
+
+	dialContext := dialer.DialContext
+	if options.DNSCache > 0 {
+		cache := &dnsCache{ttl: options.DNSCache, entries: map[string]dnsEntry{}}
+		dialContext = cache.dialContext(dialer)
+	}
+	transport.DialContext = dialContext
+
+	if public {
+		publicDialer := *dialer
+		publicDialer.Control = dialPublic
+		transport.DialContext = publicDialer.DialContext
+		if options.DNSCache > 0 {
+			cache := &dnsCache{ttl: options.DNSCache, entries: map[string]dnsEntry{}}
+			transport.DialContext = cache.dialContext(&publicDialer)
+		}
+
+		// The proxy itself is usually on a private network
+		if options.Proxy != nil {
+			proxy, dialPublicContext := proxyAddress(options.Proxy), transport.DialContext
+			transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+				if address == proxy {
+					return dialContext(ctx, network, address)
+				}
+
+				return dialPublicContext(ctx, network, address)
+			}
+		}
+	}
+
+	// The transport asks for gzip and decompresses the response on its own, as long as the request
+	// does not set Accept-Encoding itself
+	var roundTripper http.RoundTripper = transport
+	if options.MaxSize > 0 {
+		roundTripper = &limitedTransport{transport, options.MaxSize}
+	}
+
+	// Every request gets a client span of its own and sends the trace context to the remote server
+	roundTripper = otelhttp.NewTransport(roundTripper)
+
+	return &http.Client{
+		Transport: roundTripper,
+		Timeout:   fetchClientTimeout,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= fetchMaxRedirects {
+				return ErrTooManyRedirects
+			}
+
+			return nil
+		},
+	}
+}
+
+// dialPublic refuses to connect to an address that is not public, it runs after the host name is
+// resolved
+func dialPublic(network, address string, conn syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !IsPublic(ip) {
+		return ErrPrivateHost
+	}
+
+	return nil
+}
+
+// proxyAddress is the address the transport dials to connect to proxy, with the default port of
+// its scheme if it has none
+func proxyAddress(proxy *url.URL) string {
+	port := proxy.Port()
+	if port == "" {
+		port = map[string]string{"https": "443", "socks5": "1080"}[proxy.Scheme]
+	}
+	if port == "" {
+		port = "80"
+	}
+
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
+
+// parseNetworks parses cidrs, which must be valid
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := []*net.IPNet{}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+// limitedTransport fails responses with a body larger than maxSize, so a huge download cannot
+// exhaust memory or bandwidth
+type limitedTransport struct {
+	transport http.RoundTripper
+	maxSize   int64
+}
+
+func (transport *limitedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	response, err := transport.transport.RoundTrip(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.ContentLength > transport.maxSize {
+		response.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, response.ContentLength)
+	}
+
+	response.Body = &limitedBody{response.Body, io.LimitReader(response.Body, transport.maxSize+1), transport.maxSize}
+
+	return response, nil
+}
+
+// limitedBody reads up to remaining bytes and fails once the body turns out to be larger
+type limitedBody struct {
+	io.Closer
+	reader    io.Reader
+	remaining int64
+}
+
+func (body *limitedBody) Read(p []byte) (int, error) {
+	n, err := body.reader.Read(p)
+
+	body.remaining -= int64(n)
+	if body.remaining < 0 {
+		return n + int(body.remaining), ErrResponseTooLarge
+	}
+
+	return n, err
+}
+
+// dnsCache resolves a host name at most once per ttl
+type dnsCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addresses []string
+	expires   time.Time
+}
+
+func (cache *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	cache.mutex.Lock()
+	entry, ok := cache.entries[host]
+	cache.mutex.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.addresses, nil
+	}
+
+	addresses, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	// Forget the hosts that expired, so the cache does not grow with every host ever fetched
+	now := time.Now()
+	for name, entry := range cache.entries {
+		if now.After(entry.expires) {
+			delete(cache.entries, name)
+		}
+	}
+
+	cache.entries[host] = dnsEntry{addresses: addresses, expires: now.Add(cache.ttl)}
+
+	return addresses, nil
+}
+
+// dialContext dials the addresses of the host in turn until one answers
+func (cache *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		addresses, err := cache.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ip := range addresses {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip, port)); err == nil {
+				return conn, nil
+			}
+		}
+
+		return nil, err
+	}
+}
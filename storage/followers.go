@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNoFollowerKey is returned if the Follower does not have an ID or Inbox
+var ErrNoFollowerKey = errors.New("Missing Follower.ID or Follower.Inbox")
+
+// Follower is an ActivityPub actor that follows the shared bookmarks
+type Follower struct {
+	ID      string
+	Created time.Time
+	Inbox   string
+}
+
+// FollowerList lists all followers, oldest first
+func (store *Store) FollowerList(ctx context.Context) *[]*Follower {
+	ctx, span := store.start(ctx, "Store.FollowerList")
+	defer span.End()
+
+	followers := []*Follower{}
+
+	query := store.db.Select(ctx).From("followers")
+	query.Columns("id", "created", "inbox")
+	query.OrderBy("created", "ASC")
+
+	if _, err := query.Load(&followers); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching followers")
+	}
+
+	return &followers
+}
+
+// FollowerPersist adds a follower to the database, or updates the inbox of an existing one
+func (store *Store) FollowerPersist(ctx context.Context, follower *Follower) error {
+	ctx, span := store.start(ctx, "Store.FollowerPersist")
+	defer span.End()
+
+	if follower.ID == "" || follower.Inbox == "" {
+		return ErrNoFollowerKey
+	}
+
+	if follower.Created.IsZero() {
+		follower.Created = time.Now()
+	}
+
+	if !store.exists(ctx, "followers", follower.ID) {
+		query := store.db.Insert(ctx).InTo("followers")
+		query.Columns("id", "created", "inbox")
+		query.Record(follower)
+
+		if _, err := query.Exec(); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("id", follower.ID).Msg("Error persisting follower")
+			return err
+		}
+	} else {
+		query := store.db.Update(ctx).Table("followers")
+		query.Set("inbox", follower.Inbox)
+		query.Where("id = ?", follower.ID)
+
+		if _, err := query.Exec(); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("id", follower.ID).Msg("Error updating follower")
+			return err
+		}
+	}
+
+	log.Ctx(ctx).Info().Str("id", follower.ID).Msg("Persisted follower")
+
+	return nil
+}
+
+// FollowerDelete removes a follower from the database
+func (store *Store) FollowerDelete(ctx context.Context, follower *Follower) error {
+	ctx, span := store.start(ctx, "Store.FollowerDelete")
+	defer span.End()
+
+	if follower.ID == "" {
+		return ErrNoFollowerKey
+	}
+
+	query := store.db.Delete(ctx).From("followers")
+	query.Where("id = ?", follower.ID)
+
+	if _, err := query.Exec(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", follower.ID).Msg("Error deleting follower")
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str("id", follower.ID).Msg("Follower deleted")
+
+	return nil
+}
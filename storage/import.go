@@ -0,0 +1,269 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ImportStrategy determines what happens when an imported record already exists
+type ImportStrategy string
+
+const (
+	// ImportSkip leaves existing records untouched
+	ImportSkip = ImportStrategy("skip")
+
+	// ImportOverwrite replaces existing records with the imported ones
+	ImportOverwrite = ImportStrategy("overwrite")
+
+	// ImportMerge combines existing and imported records, imported values win when not empty
+	ImportMerge = ImportStrategy("merge")
+)
+
+var (
+	// ErrInvalidImportStrategy is returned if an unknown ImportStrategy is used
+	ErrInvalidImportStrategy = errors.New("Invalid import strategy, use skip, overwrite or merge")
+
+	// errDryRun rolls back the transaction of a dry run
+	errDryRun = errors.New("Dry run")
+)
+
+// Valid checks if the strategy is one of the known import strategies
+func (strategy ImportStrategy) Valid() bool {
+	return strategy == ImportSkip || strategy == ImportOverwrite || strategy == ImportMerge
+}
+
+// Document holds all bookmarks, feeds, thoughts and tags of an instance, and its settings
+type Document struct {
+	Bookmarks []*Bookmark
+	Feeds     []*Feed
+	Thoughts  []*Thought
+
+	// Tags reports how often every tag is used, they are restored by importing the records
+	Tags []*Tag `json:",omitempty"`
+
+	// Settings are the settings of the instance, which the api reads and applies since they are
+	// not stored in the database
+	Settings json.RawMessage `json:",omitempty"`
+}
+
+// ImportResult reports what happened during an import
+type ImportResult struct {
+	Created int
+	Updated int
+	Skipped int
+
+	// DryRun is true if nothing was written, Records then lists what would happen to every record
+	DryRun  bool           `json:",omitempty"`
+	Records []ImportRecord `json:",omitempty"`
+}
+
+// ImportRecord reports what a dry run would do with a single record of the document
+type ImportRecord struct {
+	// Kind is bookmark, feed or thought
+	Kind string
+
+	// Key is the URL of a bookmark or feed, or the ID of a thought
+	Key string
+
+	// Action is create for new records, or the strategy for existing records
+	Action string
+}
+
+func (result *ImportResult) count(kind, key string, existed bool, strategy ImportStrategy) {
+	action := "create"
+	if !existed {
+		result.Created++
+	} else if strategy == ImportSkip {
+		result.Skipped++
+		action = string(strategy)
+	} else {
+		result.Updated++
+		action = string(strategy)
+	}
+
+	if result.DryRun {
+		result.Records = append(result.Records, ImportRecord{kind, key, action})
+	}
+}
+
+// Import restores all records in the document in a single transaction
+func (store *Store) Import(ctx context.Context, document *Document, strategy ImportStrategy) (*ImportResult, error) {
+	ctx, span := store.start(ctx, "Store.Import")
+	defer span.End()
+
+	return store.importDocument(ctx, document, strategy, false)
+}
+
+// ImportDryRun reports what Import would create, skip, overwrite or merge without writing anything.
+// Records that occur more than once in the document are reported as existing after the first one.
+func (store *Store) ImportDryRun(ctx context.Context, document *Document, strategy ImportStrategy) (*ImportResult, error) {
+	ctx, span := store.start(ctx, "Store.ImportDryRun")
+	defer span.End()
+
+	return store.importDocument(ctx, document, strategy, true)
+}
+
+// importDocument imports the document in a transaction, which is rolled back for a dry run
+func (store *Store) importDocument(ctx context.Context, document *Document, strategy ImportStrategy, dryRun bool) (*ImportResult, error) {
+	if !strategy.Valid() {
+		return nil, ErrInvalidImportStrategy
+	}
+
+	// The transaction of a dry run can only be rolled back if it is not part of another one
+	if dryRun && store.tx != nil {
+		return nil, errors.New("A dry run cannot be part of a transaction")
+	}
+
+	result := &ImportResult{DryRun: dryRun}
+
+	err := store.WithTx(ctx, func(tx *Store) error {
+		for _, bookmark := range document.Bookmarks {
+			existing := Bookmark{URL: bookmark.URL}
+			existed := tx.BookmarkGet(ctx, &existing) == nil
+			result.count("bookmark", bookmark.URL, existed, strategy)
+
+			if existed && strategy == ImportSkip {
+				continue
+			} else if existed && strategy == ImportMerge {
+				bookmark.Tags = existing.Tags.Merge(bookmark.Tags)
+				bookmark.Title = coalesce(bookmark.Title, existing.Title)
+				bookmark.Excerpt = coalesce(bookmark.Excerpt, existing.Excerpt)
+				bookmark.Content = coalesce(bookmark.Content, existing.Content)
+			}
+
+			if err := tx.BookmarkPersist(ctx, bookmark); err != nil {
+				return err
+			}
+		}
+
+		for _, feed := range document.Feeds {
+			existing := Feed{URL: feed.URL}
+			existed := tx.FeedGet(ctx, &existing) == nil
+			result.count("feed", feed.URL, existed, strategy)
+
+			if existed && strategy == ImportSkip {
+				continue
+			} else if existed && strategy == ImportMerge {
+				feed.Tags = existing.Tags.Merge(feed.Tags)
+				feed.Title = coalesce(feed.Title, existing.Title)
+				for _, item := range existing.Items {
+					if feed.GetItem(item.ID) == nil {
+						feed.Items = append(feed.Items, item)
+					}
+				}
+			}
+
+			if err := tx.FeedPersist(ctx, feed); err != nil {
+				return err
+			}
+		}
+
+		for _, thought := range document.Thoughts {
+			existing := Thought{ID: thought.ID}
+			existed := thought.ID != "" && tx.ThoughtGet(ctx, &existing) == nil
+			result.count("thought", thought.ID, existed, strategy)
+
+			if existed && strategy == ImportSkip {
+				continue
+			} else if existed && strategy == ImportMerge {
+				thought.Tags = existing.Tags.Merge(thought.Tags)
+				thought.Content = coalesce(thought.Content, existing.Content)
+			}
+
+			if err := tx.ThoughtPersist(ctx, thought); err != nil {
+				return err
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	if dryRun {
+		log.Ctx(ctx).Info().Int("created", result.Created).Int("updated", result.Updated).Int("skipped", result.Skipped).Msg("Dry run of importing document")
+		return result, nil
+	}
+
+	log.Ctx(ctx).Info().Int("created", result.Created).Int("updated", result.Updated).Int("skipped", result.Skipped).Msg("Imported document")
+
+	return result, nil
+}
+
+func coalesce(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// FetchProgress is told after every bookmark how many of total bookmarks were fetched so far and
+// how many of those failed
+type FetchProgress func(done, failed, total int)
+
+// BookmarkFetchAll fetches the content of the bookmarks, with workers at a time, and returns how
+// many could not be fetched. Progress is called after every bookmark, unless it is nil.
+func (store *Store) BookmarkFetchAll(ctx context.Context, bookmarks []*Bookmark, workers int, progress FetchProgress) (int, error) {
+	ctx, span := store.start(ctx, "Store.BookmarkFetchAll")
+	defer span.End()
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	done, failed := 0, 0
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	pending := make(chan *Bookmark)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for bookmark := range pending {
+				err := store.BookmarkFetch(ctx, bookmark)
+
+				mutex.Lock()
+				done++
+				if err != nil {
+					failed++
+				}
+				if progress != nil {
+					progress(done, failed, len(bookmarks))
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, bookmark := range bookmarks {
+		select {
+		case pending <- bookmark:
+		case <-ctx.Done():
+		}
+	}
+
+	close(pending)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return failed, err
+	}
+
+	log.Ctx(ctx).Info().Int("fetched", done-failed).Int("failed", failed).Msg("Fetched the content of bookmarks")
+
+	return failed, nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/nrocco/bookmarks/queue"
+	"github.com/rs/zerolog/log"
+)
+
+var _ queue.Persistence = &Store{}
+
+// JobList lists the saved jobs of the queue, oldest first
+func (store *Store) JobList(ctx context.Context) ([]*queue.Job, error) {
+	ctx, span := store.start(ctx, "Store.JobList")
+	defer span.End()
+
+	jobs := []*queue.Job{}
+
+	query := store.db.Select(ctx).From("jobs")
+	query.Columns("id", "key", "kind", "payload", "priority", "state", "attempts", "error", "created", "run_at", "finished")
+	query.OrderBy("created", "ASC")
+
+	if _, err := query.Load(&jobs); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error fetching saved jobs")
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// JobSave saves a job of the queue, replacing the saved job with the same ID
+func (store *Store) JobSave(ctx context.Context, job *queue.Job) error {
+	ctx, span := store.start(ctx, "Store.JobSave")
+	defer span.End()
+
+	query := "INSERT INTO jobs (id, key, kind, payload, priority, state, attempts, error, created, run_at, finished) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) " +
+		"ON CONFLICT (id) DO UPDATE SET priority = excluded.priority, state = excluded.state, attempts = excluded.attempts, error = excluded.error, run_at = excluded.run_at, finished = excluded.finished"
+
+	if _, err := store.exec(ctx, query, job.ID, job.Key, job.Kind, job.Payload, int(job.Priority), string(job.State), job.Attempts, job.Error, job.Created, job.RunAt, job.Finished); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("job", job.ID).Msg("Error saving job")
+		return err
+	}
+
+	return nil
+}
+
+// JobDelete removes a saved job of the queue
+func (store *Store) JobDelete(ctx context.Context, ID string) error {
+	ctx, span := store.start(ctx, "Store.JobDelete")
+	defer span.End()
+
+	if _, err := store.exec(ctx, "DELETE FROM jobs WHERE id = ?", ID); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("job", ID).Msg("Error removing saved job")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// DeadLink is a bookmark whose URL answers with an error or cannot be reached
+type DeadLink struct {
+	ID     string
+	Title  string
+	URL    string
+	Status int    `json:",omitempty"`
+	Error  string `json:",omitempty"`
+}
+
+// CheckLinks requests the URL of every bookmark that is not deleted, with workers requests at a
+// time, and returns how many were checked and the bookmarks whose URL is dead
+func (store *Store) CheckLinks(ctx context.Context, workers int) (int, []*DeadLink, error) {
+	ctx, span := store.start(ctx, "Store.CheckLinks")
+	defer span.End()
+
+	bookmarks := []*Bookmark{}
+
+	query := store.db.Select(ctx).From("bookmarks")
+	query.Columns("id", "title", "url", "etag", "last_modified")
+	query.Where("deleted_at IS NULL")
+	query.OrderBy("created", "ASC")
+
+	if _, err := query.Load(&bookmarks); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error fetching bookmarks to check")
+		return 0, nil, err
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	dead := []*DeadLink{}
+	mutex := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	pending := make(chan *Bookmark)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for bookmark := range pending {
+				status, err := checkLink(ctx, bookmark)
+				if err == nil && status < 400 {
+					continue
+				}
+
+				link := &DeadLink{ID: bookmark.ID, Title: bookmark.Title, URL: bookmark.URL, Status: status}
+				if err != nil {
+					link.Error = err.Error()
+				}
+
+				log.Ctx(ctx).Warn().Str("id", bookmark.ID).Str("url", bookmark.URL).Int("status", status).Err(err).Msg("Found a dead link")
+
+				mutex.Lock()
+				dead = append(dead, link)
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	for _, bookmark := range bookmarks {
+		select {
+		case pending <- bookmark:
+		case <-ctx.Done():
+		}
+	}
+
+	close(pending)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	log.Ctx(ctx).Info().Int("checked", len(bookmarks)).Int("dead", len(dead)).Msg("Checked the links of bookmarks")
+
+	return len(bookmarks), dead, nil
+}
+
+// checkLink returns the status code of the page of the bookmark, servers that refuse HEAD requests
+// are asked again with a GET request, which is conditional so unchanged pages are not downloaded
+func checkLink(ctx context.Context, bookmark *Bookmark) (int, error) {
+	status := 0
+
+	for _, method := range []string{"HEAD", "GET"} {
+		ctx, cancel := withFetchTimeout(ctx)
+		defer cancel()
+
+		request, err := http.NewRequestWithContext(ctx, method, bookmark.URL, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		request.Header.Set("User-Agent", userAgent)
+		bookmark.setValidators(request)
+
+		response, err := fetchClient.Do(request)
+		if err != nil {
+			return 0, err
+		}
+		response.Body.Close()
+
+		status = response.StatusCode
+		if status < 400 {
+			break
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Vacuum rebuilds the database file, reclaiming unused space
+func (store *Store) Vacuum(ctx context.Context) error {
+	ctx, span := store.start(ctx, "Store.Vacuum")
+	defer span.End()
+
+	if _, err := store.db.ExecContext(ctx, "VACUUM"); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error vacuuming the database")
+		return err
+	}
+
+	log.Ctx(ctx).Info().Msg("Vacuumed the database")
+
+	return nil
+}
+
+// OptimizeFTS merges the segments of all full text search indexes
+func (store *Store) OptimizeFTS(ctx context.Context) error {
+	return store.ftsCommand(ctx, "optimize")
+}
+
+// RebuildFTS rebuilds all full text search indexes from their content tables
+func (store *Store) RebuildFTS(ctx context.Context) error {
+	return store.ftsCommand(ctx, "rebuild")
+}
+
+// Optimize keeps a long lived database fast, it lets the database update the statistics of the
+// query planner and merges some of the segments of the full text search indexes. Sqlite also
+// returns free pages to the file system if auto_vacuum is INCREMENTAL. Unlike Vacuum and
+// OptimizeFTS it is cheap enough to run while the database is in use.
+func (store *Store) Optimize(ctx context.Context) error {
+	ctx, span := store.start(ctx, "Store.Optimize")
+	defer span.End()
+
+	if err := store.dialect.optimize(ctx, store); err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Msg("Optimized the database")
+
+	return nil
+}
+
+func (store *Store) ftsCommand(ctx context.Context, command string) error {
+	ctx, span := store.start(ctx, "Store.FTS."+command)
+	defer span.End()
+
+	if err := store.dialect.ftsCommand(ctx, store, command); err != nil {
+		return err
+	}
+
+	log.Ctx(ctx).Info().Str("command", command).Msg("Maintained full text search indexes")
+
+	return nil
+}
+
+// Cleanup removes empty, duplicate and unused tags and returns the number of records that changed
+func (store *Store) Cleanup(ctx context.Context) (int64, error) {
+	ctx, span := store.start(ctx, "Store.Cleanup")
+	defer span.End()
+
+	total := int64(0)
+
+	for _, table := range []string{"bookmarks", "feeds", "thoughts"} {
+		cleaned := "(SELECT " + store.dialect.textArray("DISTINCT value") + " FROM " + store.dialect.jsonEachText(table+".tags") + " WHERE value != '')"
+
+		result, err := store.exec(ctx, "UPDATE "+table+" SET tags = "+cleaned+" WHERE tags != "+cleaned)
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("table", table).Msg("Error cleaning up tags")
+			return total, err
+		}
+
+		affected, _ := result.RowsAffected()
+		total += affected
+	}
+
+	// Tags that are no longer assigned to any bookmark, feed or thought
+	result, err := store.exec(ctx, "DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM bookmarks_tags UNION SELECT tag_id FROM feeds_tags UNION SELECT tag_id FROM thoughts_tags)")
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error removing unused tags")
+		return total, err
+	}
+
+	affected, _ := result.RowsAffected()
+	total += affected
+
+	store.invalidate()
+
+	log.Ctx(ctx).Info().Int64("records", total).Msg("Cleaned up the database")
+
+	return total, nil
+}
+
+// Purge permanently removes bookmarks, feeds and thoughts that were deleted before the given time
+// and returns the number of records removed
+func (store *Store) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := store.start(ctx, "Store.Purge")
+	defer span.End()
+
+	total := int64(0)
+
+	for _, table := range []string{"bookmarks", "feeds", "thoughts"} {
+		query := store.db.Delete(ctx).From(table)
+		query.Where("deleted_at IS NOT NULL")
+		query.Where("deleted_at < ?", before)
+
+		result, err := query.Exec()
+		if err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("table", table).Msg("Error purging deleted records")
+			return total, err
+		}
+
+		affected, _ := result.RowsAffected()
+		total += affected
+	}
+
+	store.invalidate("bookmarks", "feeds", "thoughts")
+
+	log.Ctx(ctx).Info().Int64("records", total).Time("before", before).Msg("Purged deleted records")
+
+	return total, nil
+}
+
+// IntegrityCheck runs the sqlite integrity check and returns the problems found, if any. A
+// PostgreSQL database has no integrity check.
+func (store *Store) IntegrityCheck(ctx context.Context) ([]string, error) {
+	ctx, span := store.start(ctx, "Store.IntegrityCheck")
+	defer span.End()
+
+	return store.dialect.integrityCheck(ctx, store)
+}
@@ -0,0 +1,1195 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nrocco/qb"
+)
+
+// NewMemory returns a new instance of a Bookmarks Store that keeps everything in memory
+func NewMemory() *MemoryStore {
+	return &MemoryStore{
+		bookmarks: map[string]*Bookmark{},
+		feeds:     map[string]*Feed{},
+		icons:     map[string]*FeedIcon{},
+		thoughts:  map[string]*Thought{},
+		users:     map[string]*User{},
+	}
+}
+
+// MemoryStore is a Storer that keeps Bookmark, Feed, Thought and User's in memory, it mimics the
+// behaviour of Store except that searching matches words instead of using full text search
+type MemoryStore struct {
+	mutex     sync.RWMutex
+	bookmarks map[string]*Bookmark
+	feeds     map[string]*Feed
+	icons     map[string]*FeedIcon
+	thoughts  map[string]*Thought
+	users     map[string]*User
+}
+
+// BookmarkList fetches multiple bookmarks from memory
+func (store *MemoryStore) BookmarkList(ctx context.Context, options *BookmarkListOptions) (*[]*Bookmark, int) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	bookmarks := []*Bookmark{}
+
+	for _, bookmark := range store.bookmarks {
+		if !options.IncludeDeleted && bookmark.DeletedAt.Valid {
+			continue
+		} else if !matchesSearch(options.Search, bookmark.Title, bookmark.URL, bookmark.Content, strings.Join(bookmark.Tags, " ")) {
+			continue
+		} else if !matchesTags(bookmark.Tags, options.Tags) {
+			continue
+		}
+
+		listed := *bookmark
+		listed.Content = ""
+		listed.Tags = append(Tags{}, bookmark.Tags...)
+		bookmarks = append(bookmarks, &listed)
+	}
+
+	sortRecords(len(bookmarks), options.Sort, func(i int) (string, map[string]interface{}) {
+		return bookmarks[i].ID, map[string]interface{}{
+			"created": bookmarks[i].Created,
+			"updated": bookmarks[i].Updated,
+			"title":   bookmarks[i].Title,
+			"url":     bookmarks[i].URL,
+		}
+	}, func(i, j int) { bookmarks[i], bookmarks[j] = bookmarks[j], bookmarks[i] })
+
+	totalCount := len(bookmarks)
+
+	if options.Cursor != "" {
+		cursor, err := ParseCursor(options.Cursor)
+		if err != nil {
+			return &[]*Bookmark{}, 0
+		}
+
+		after := []*Bookmark{}
+		for _, bookmark := range bookmarks {
+			if cursor.before(bookmark.Created, bookmark.ID) {
+				after = append(after, bookmark)
+			}
+		}
+		bookmarks = after
+		options.Offset = 0
+	}
+
+	start, end := paginate(len(bookmarks), options.Limit, options.Offset)
+	bookmarks = bookmarks[start:end]
+
+	return &bookmarks, totalCount
+}
+
+// BookmarkEach calls fn with every bookmark BookmarkList returns
+func (store *MemoryStore) BookmarkEach(ctx context.Context, options *BookmarkListOptions, fn func(bookmark *Bookmark) error) error {
+	if options.Cursor != "" {
+		if _, err := ParseCursor(options.Cursor); err != nil {
+			return err
+		}
+	}
+
+	bookmarks, _ := store.BookmarkList(ctx, options)
+	for _, bookmark := range *bookmarks {
+		if err := fn(bookmark); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BookmarkGet finds a single bookmark by ID or URL, unless it is deleted
+func (store *MemoryStore) BookmarkGet(ctx context.Context, bookmark *Bookmark) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if bookmark.ID == "" && bookmark.URL == "" {
+		return ErrNoBookmarkKey
+	}
+
+	found := store.findBookmark(bookmark)
+	if found == nil || found.DeletedAt.Valid {
+		return sql.ErrNoRows
+	}
+
+	*bookmark = *found
+	bookmark.Tags = append(Tags{}, found.Tags...)
+
+	return nil
+}
+
+// BookmarkPersist persists a bookmark in memory
+func (store *MemoryStore) BookmarkPersist(ctx context.Context, bookmark *Bookmark) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if bookmark.URL == "" {
+		return ErrNoBookmarkURL
+	}
+
+	if bookmark.Title == "" {
+		bookmark.Title = bookmark.URL
+	}
+
+	if bookmark.Created.IsZero() {
+		bookmark.Created = time.Now()
+	}
+
+	if bookmark.Tags == nil {
+		bookmark.Tags = Tags{}
+	}
+
+	if bookmark.Status == "" {
+		bookmark.Status = BookmarkFetched
+	}
+
+	bookmark.Updated = time.Now()
+
+	// Check if there is already a bookmark with the same URL
+	if existing := store.findBookmark(&Bookmark{URL: bookmark.URL}); existing != nil {
+		bookmark.ID = existing.ID
+		bookmark.Created = existing.Created
+	}
+
+	if bookmark.ID == "" {
+		bookmark.ID = generateUUID()
+	} else if existing, ok := store.bookmarks[bookmark.ID]; ok {
+		bookmark.Created = existing.Created
+	}
+
+	persisted := *bookmark
+	persisted.Tags = append(Tags{}, bookmark.Tags...)
+	store.bookmarks[bookmark.ID] = &persisted
+
+	return nil
+}
+
+// BookmarkDelete marks the given bookmark as deleted, it can be restored until it is purged
+func (store *MemoryStore) BookmarkDelete(ctx context.Context, bookmark *Bookmark) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if bookmark.ID == "" && bookmark.URL == "" {
+		return ErrNoBookmarkKey
+	}
+
+	bookmark.DeletedAt = nullTimeNow()
+
+	if found := store.findBookmark(bookmark); found != nil && !found.DeletedAt.Valid {
+		found.DeletedAt = bookmark.DeletedAt
+	}
+
+	return nil
+}
+
+// BookmarkRestore restores the given deleted bookmark
+func (store *MemoryStore) BookmarkRestore(ctx context.Context, bookmark *Bookmark) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if bookmark.ID == "" {
+		return ErrNoBookmarkKey
+	}
+
+	found, ok := store.bookmarks[bookmark.ID]
+	if !ok || !found.DeletedAt.Valid {
+		return ErrNotDeletedBookmark
+	}
+
+	found.DeletedAt = qb.NullTime{}
+	*bookmark = *found
+	bookmark.Tags = append(Tags{}, found.Tags...)
+
+	return nil
+}
+
+func (store *MemoryStore) findBookmark(bookmark *Bookmark) *Bookmark {
+	if bookmark.ID != "" {
+		found, ok := store.bookmarks[bookmark.ID]
+		if !ok || (bookmark.URL != "" && found.URL != bookmark.URL) {
+			return nil
+		}
+		return found
+	}
+
+	for _, found := range store.bookmarks {
+		if found.URL == bookmark.URL {
+			return found
+		}
+	}
+
+	return nil
+}
+
+// FeedList fetches multiple feeds from memory
+func (store *MemoryStore) FeedList(ctx context.Context, options *FeedListOptions) (*[]*Feed, int) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	feeds := []*Feed{}
+
+	for _, feed := range store.feeds {
+		if !options.IncludeDeleted && feed.DeletedAt.Valid {
+			continue
+		} else if !matchesSearch(options.Search, feed.Title, feed.URL) {
+			continue
+		} else if !options.NotRefreshedSince.IsZero() && !feedDue(feed, time.Since(options.NotRefreshedSince)) {
+			continue
+		} else if options.MaxErrors > 0 && feed.ErrorCount >= options.MaxErrors {
+			continue
+		} else if options.Broken && feed.ErrorCount == 0 {
+			continue
+		} else if !matchesTags(feed.Tags, options.Tags) {
+			continue
+		}
+
+		feeds = append(feeds, copyFeed(feed))
+	}
+
+	sortRecords(len(feeds), options.Sort, func(i int) (string, map[string]interface{}) {
+		return feeds[i].ID, map[string]interface{}{
+			"created":       feeds[i].Created,
+			"updated":       feeds[i].Updated,
+			"refreshed":     feeds[i].Refreshed,
+			"last_authored": feeds[i].LastAuthored,
+			"title":         feeds[i].Title,
+			"url":           feeds[i].URL,
+		}
+	}, func(i, j int) { feeds[i], feeds[j] = feeds[j], feeds[i] })
+
+	totalCount := len(feeds)
+
+	start, end := paginate(len(feeds), options.Limit, options.Offset)
+	feeds = feeds[start:end]
+
+	return &feeds, totalCount
+}
+
+// FeedGet gets a single feed by ID or URL, unless it is deleted
+func (store *MemoryStore) FeedGet(ctx context.Context, feed *Feed) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if feed.ID == "" && feed.URL == "" {
+		return ErrNoFeedKey
+	}
+
+	found := store.findFeed(feed)
+	if found == nil || found.DeletedAt.Valid {
+		return sql.ErrNoRows
+	}
+
+	*feed = *copyFeed(found)
+
+	return nil
+}
+
+// FeedPersist persists a feed in memory
+func (store *MemoryStore) FeedPersist(ctx context.Context, feed *Feed) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if feed.URL == "" {
+		return ErrNoFeedURL
+	}
+
+	if feed.RefreshInterval < 0 {
+		return ErrInvalidRefreshInterval
+	}
+
+	if err := feed.Filters.prepare(); err != nil {
+		return err
+	}
+
+	if feed.Title == "" {
+		feed.Title = feed.URL
+	}
+
+	if feed.Created.IsZero() {
+		feed.Created = time.Now()
+	}
+
+	if feed.Refreshed.IsZero() {
+		feed.Refreshed = time.Now().Add(time.Hour * 24 * 7 * -1) // For new feeds, fetch articles of last 7 days
+	}
+
+	if feed.Tags == nil {
+		feed.Tags = Tags{}
+	}
+
+	if feed.Items == nil {
+		feed.Items = FeedItems{}
+	}
+
+	if feed.Filters == nil {
+		feed.Filters = FeedFilters{}
+	}
+
+	if feed.Seen == nil {
+		feed.Seen = Seen{}
+	}
+
+	feed.Updated = time.Now()
+
+	// Check if there is already a feed with the same URL
+	if existing := store.findFeed(&Feed{URL: feed.URL}); existing != nil {
+		feed.ID = existing.ID
+		feed.Created = existing.Created
+	}
+
+	if feed.ID == "" {
+		feed.ID = generateUUID()
+	} else if existing, ok := store.feeds[feed.ID]; ok {
+		feed.Created = existing.Created
+	}
+
+	store.feeds[feed.ID] = copyFeed(feed)
+
+	return nil
+}
+
+// FeedDelete marks the given feed as deleted, it can be restored until it is purged
+func (store *MemoryStore) FeedDelete(ctx context.Context, feed *Feed) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if feed.ID == "" && feed.URL == "" {
+		return ErrNoFeedKey
+	}
+
+	feed.DeletedAt = nullTimeNow()
+
+	if found := store.findFeed(feed); found != nil && !found.DeletedAt.Valid {
+		found.DeletedAt = feed.DeletedAt
+	}
+
+	return nil
+}
+
+// FeedRestore restores the given deleted feed
+func (store *MemoryStore) FeedRestore(ctx context.Context, feed *Feed) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if feed.ID == "" {
+		return ErrNoFeedKey
+	}
+
+	found, ok := store.feeds[feed.ID]
+	if !ok || !found.DeletedAt.Valid {
+		return ErrNotDeletedFeed
+	}
+
+	found.DeletedAt = qb.NullTime{}
+	*feed = *copyFeed(found)
+
+	return nil
+}
+
+// FeedRefresh fetches the rss feed items and persists those in memory, merging the new items into
+// the stored ones like the sqlite store does
+func (store *MemoryStore) FeedRefresh(ctx context.Context, feed *Feed) error {
+	before := feed.itemIDs()
+
+	if err := feed.Fetch(ctx); err != nil {
+		return err
+	}
+
+	feed.ErrorCount = 0
+	feed.LastError = ""
+	feed.Failed = qb.NullTime{}
+
+	if !store.feedMerge(feed, feed.addedItems(before)) {
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			return err
+		}
+	}
+
+	refreshIcon(ctx, store, feed)
+
+	return nil
+}
+
+// feedMerge adds the items to the stored feed and records that it was refreshed, it returns false
+// if the feed is not stored yet
+func (store *MemoryStore) feedMerge(feed *Feed, items FeedItems) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	stored, ok := store.feeds[feed.ID]
+	if !ok {
+		return false
+	}
+
+	merged := copyFeed(stored)
+	merged.Items = append(merged.Items, copyFeed(&Feed{Items: items}).Items...)
+	merged.Items.sortByDate()
+	merged.Etag = feed.Etag
+	merged.LastAuthored = feed.LastAuthored
+	merged.Seen = append(Seen{}, feed.Seen...)
+	merged.Refreshed = feed.Refreshed
+	merged.ErrorCount = 0
+	merged.LastError = ""
+	merged.Failed = qb.NullTime{}
+	merged.Updated = time.Now()
+
+	store.feeds[feed.ID] = merged
+	*feed = *copyFeed(merged)
+
+	return true
+}
+
+// FeedIconGet gets the icon of a feed from memory
+func (store *MemoryStore) FeedIconGet(ctx context.Context, icon *FeedIcon) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if icon.FeedID == "" {
+		return ErrNoFeedKey
+	}
+
+	existing, ok := store.icons[icon.FeedID]
+	if !ok {
+		return ErrNoFeedIcon
+	}
+
+	*icon = *existing
+	icon.Data = append([]byte{}, existing.Data...)
+
+	if len(icon.Data) == 0 {
+		return ErrNoFeedIcon
+	}
+
+	return nil
+}
+
+// FeedIconPersist stores the icon of a feed in memory, replacing the icon it had before
+func (store *MemoryStore) FeedIconPersist(ctx context.Context, icon *FeedIcon) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if icon.FeedID == "" {
+		return ErrNoFeedKey
+	}
+
+	if icon.Fetched.IsZero() {
+		icon.Fetched = time.Now()
+	}
+
+	copied := *icon
+	copied.Data = append([]byte{}, icon.Data...)
+	store.icons[icon.FeedID] = &copied
+
+	return nil
+}
+
+// FeedRead marks the items of feeds as read by removing them, except starred items, and returns
+// the number of feeds that had items marked as read
+func (store *MemoryStore) FeedRead(ctx context.Context, options *FeedReadOptions) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	affected := int64(0)
+
+	for _, feed := range store.feeds {
+		if feed.DeletedAt.Valid || (options.ID != "" && feed.ID != options.ID) || !matchesTags(feed.Tags, options.Tags) {
+			continue
+		}
+
+		unread := FeedItems{}
+		for _, item := range feed.Items {
+			if item.Starred || (!options.Before.IsZero() && !item.Date.Before(options.Before)) {
+				unread = append(unread, item)
+			}
+		}
+
+		if len(unread) < len(feed.Items) {
+			feed.Items = unread
+			feed.Updated = time.Now()
+			affected++
+		}
+	}
+
+	return affected, nil
+}
+
+// feedDue tells if its own refresh interval or else the window passed since feed was refreshed, or
+// since it failed doubled for every time in a row it could not be refreshed, unless it is paused
+func feedDue(feed *Feed, window time.Duration) bool {
+	if feed.Paused {
+		return false
+	}
+
+	since := feed.Refreshed
+	if feed.ErrorCount > 0 && feed.Failed.Valid {
+		since = feed.Failed.Time
+	}
+
+	period := window
+	if feed.RefreshInterval > 0 {
+		period = time.Duration(feed.RefreshInterval)
+	}
+
+	backoff := feed.ErrorCount
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+
+	return since.Add(period << backoff).Before(time.Now())
+}
+
+// FeedFailed records that the given feed could not be refreshed because of reason
+func (store *MemoryStore) FeedFailed(ctx context.Context, feed *Feed, reason string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if feed.ID == "" {
+		return ErrNoFeedKey
+	}
+
+	found, ok := store.feeds[feed.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	found.ErrorCount++
+	found.LastError = reason
+	found.Failed = nullTimeNow()
+	*feed = *copyFeed(found)
+
+	return nil
+}
+
+func (store *MemoryStore) findFeed(feed *Feed) *Feed {
+	if feed.ID != "" {
+		found, ok := store.feeds[feed.ID]
+		if !ok {
+			return nil
+		}
+		return found
+	}
+
+	for _, found := range store.feeds {
+		if found.URL == feed.URL {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func copyFeed(feed *Feed) *Feed {
+	copied := *feed
+	copied.Tags = append(Tags{}, feed.Tags...)
+	copied.Filters = FeedFilters{}
+	copied.Seen = append(Seen{}, feed.Seen...)
+	copied.Items = FeedItems{}
+
+	for _, item := range feed.Items {
+		copiedItem := *item
+		copiedItem.Enclosures = nil
+
+		for _, enclosure := range item.Enclosures {
+			copiedEnclosure := *enclosure
+			copiedItem.Enclosures = append(copiedItem.Enclosures, &copiedEnclosure)
+		}
+
+		copied.Items = append(copied.Items, &copiedItem)
+	}
+
+	for _, filter := range feed.Filters {
+		copiedFilter := *filter
+		copied.Filters = append(copied.Filters, &copiedFilter)
+	}
+
+	return &copied
+}
+
+// FeedItemList lists the items of all feeds in memory, the newest first unless options.Sort says otherwise
+func (store *MemoryStore) FeedItemList(ctx context.Context, options *FeedItemListOptions) (*[]*ListedFeedItem, int) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	items := []*ListedFeedItem{}
+
+	for _, feed := range store.feeds {
+		if feed.DeletedAt.Valid {
+			continue
+		}
+
+		for _, item := range feed.Items {
+			if options.ID != "" && item.ID != options.ID {
+				continue
+			} else if options.Starred && !item.Starred {
+				continue
+			} else if !matchesSearch(options.Search, item.Title, item.URL, item.Content) {
+				continue
+			}
+
+			items = append(items, &ListedFeedItem{FeedID: feed.ID, FeedTitle: feed.Title, Item: *item})
+		}
+	}
+
+	order := options.Sort
+	if len(order) == 0 {
+		order = Sort{{"date", true}}
+	}
+
+	sortRecords(len(items), order, func(i int) (string, map[string]interface{}) {
+		return items[i].Item.ID, map[string]interface{}{
+			"date":       items[i].Item.Date,
+			"title":      items[i].Item.Title,
+			"feed_title": items[i].FeedTitle,
+		}
+	}, func(i, j int) { items[i], items[j] = items[j], items[i] })
+
+	totalCount := len(items)
+
+	if options.Cursor != "" {
+		cursor, err := ParseCursor(options.Cursor)
+		if err != nil {
+			return &[]*ListedFeedItem{}, 0
+		}
+
+		after := []*ListedFeedItem{}
+		for _, item := range items {
+			if cursor.before(item.Item.Date, item.Item.ID) {
+				after = append(after, item)
+			}
+		}
+		items = after
+		options.Offset = 0
+	}
+
+	start, end := paginate(len(items), options.Limit, options.Offset)
+	items = items[start:end]
+
+	return &items, totalCount
+}
+
+// FeedItemEach calls fn with every item FeedItemList returns
+func (store *MemoryStore) FeedItemEach(ctx context.Context, options *FeedItemListOptions, fn func(item *ListedFeedItem) error) error {
+	if options.Cursor != "" {
+		if _, err := ParseCursor(options.Cursor); err != nil {
+			return err
+		}
+	}
+
+	items, _ := store.FeedItemList(ctx, options)
+	for _, item := range *items {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ThoughtList lists thoughts from memory
+func (store *MemoryStore) ThoughtList(ctx context.Context, options *ThoughtListOptions) (*[]*Thought, int) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	thoughts := []*Thought{}
+
+	for _, thought := range store.thoughts {
+		if !options.IncludeDeleted && thought.DeletedAt.Valid {
+			continue
+		} else if !matchesSearch(options.Search, thought.Content, strings.Join(thought.Tags, " ")) {
+			continue
+		} else if !matchesTags(thought.Tags, options.Tags) {
+			continue
+		}
+
+		listed := *thought
+		listed.Tags = append(Tags{}, thought.Tags...)
+		thoughts = append(thoughts, &listed)
+	}
+
+	sortRecords(len(thoughts), options.Sort, func(i int) (string, map[string]interface{}) {
+		return thoughts[i].ID, map[string]interface{}{
+			"created": thoughts[i].Created,
+			"updated": thoughts[i].Updated,
+		}
+	}, func(i, j int) { thoughts[i], thoughts[j] = thoughts[j], thoughts[i] })
+
+	totalCount := len(thoughts)
+
+	if options.Cursor != "" {
+		cursor, err := ParseCursor(options.Cursor)
+		if err != nil {
+			return &[]*Thought{}, 0
+		}
+
+		after := []*Thought{}
+		for _, thought := range thoughts {
+			if cursor.before(thought.Created, thought.ID) {
+				after = append(after, thought)
+			}
+		}
+		thoughts = after
+		options.Offset = 0
+	}
+
+	start, end := paginate(len(thoughts), options.Limit, options.Offset)
+	thoughts = thoughts[start:end]
+
+	return &thoughts, totalCount
+}
+
+// ThoughtEach calls fn with every thought ThoughtList returns
+func (store *MemoryStore) ThoughtEach(ctx context.Context, options *ThoughtListOptions, fn func(thought *Thought) error) error {
+	if options.Cursor != "" {
+		if _, err := ParseCursor(options.Cursor); err != nil {
+			return err
+		}
+	}
+
+	thoughts, _ := store.ThoughtList(ctx, options)
+	for _, thought := range *thoughts {
+		if err := fn(thought); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ThoughtGet gets a single thought from memory, unless it is deleted
+func (store *MemoryStore) ThoughtGet(ctx context.Context, thought *Thought) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if thought.ID == "" {
+		return ErrNoThoughtID
+	}
+
+	found, ok := store.thoughts[thought.ID]
+	if !ok || found.DeletedAt.Valid {
+		return sql.ErrNoRows
+	}
+
+	*thought = *found
+	thought.Tags = append(Tags{}, found.Tags...)
+
+	return nil
+}
+
+// ThoughtPersist adds a thought to memory
+func (store *MemoryStore) ThoughtPersist(ctx context.Context, thought *Thought) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if thought.Created.IsZero() {
+		thought.Created = time.Now()
+	}
+
+	if thought.Tags == nil {
+		thought.Tags = Tags{}
+	}
+
+	thought.Updated = time.Now()
+
+	if thought.ID == "" {
+		thought.ID = generateUUID()
+	} else if existing, ok := store.thoughts[thought.ID]; ok {
+		thought.Created = existing.Created
+	}
+
+	persisted := *thought
+	persisted.Tags = append(Tags{}, thought.Tags...)
+	store.thoughts[thought.ID] = &persisted
+
+	return nil
+}
+
+// ThoughtDelete marks a thought as deleted, it can be restored until it is purged
+func (store *MemoryStore) ThoughtDelete(ctx context.Context, thought *Thought) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if thought.ID == "" {
+		return ErrNoThoughtID
+	}
+
+	thought.DeletedAt = nullTimeNow()
+
+	if found, ok := store.thoughts[thought.ID]; ok && !found.DeletedAt.Valid {
+		found.DeletedAt = thought.DeletedAt
+	}
+
+	return nil
+}
+
+// ThoughtRestore restores the given deleted thought
+func (store *MemoryStore) ThoughtRestore(ctx context.Context, thought *Thought) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if thought.ID == "" {
+		return ErrNoThoughtID
+	}
+
+	found, ok := store.thoughts[thought.ID]
+	if !ok || !found.DeletedAt.Valid {
+		return ErrNotDeletedThought
+	}
+
+	found.DeletedAt = qb.NullTime{}
+	*thought = *found
+	thought.Tags = append(Tags{}, found.Tags...)
+
+	return nil
+}
+
+// ThoughtTagList lists all tags assigned to thoughts, the most used first
+func (store *MemoryStore) ThoughtTagList(ctx context.Context) *[]string {
+	counts := []*Tag{}
+	for _, tag := range *store.TagList(ctx) {
+		if tag.Thoughts != 0 {
+			counts = append(counts, tag)
+		}
+	}
+
+	sort.SliceStable(counts, func(i, j int) bool {
+		return counts[i].Thoughts > counts[j].Thoughts
+	})
+
+	tags := []string{}
+	for _, tag := range counts {
+		tags = append(tags, tag.Name)
+	}
+
+	return &tags
+}
+
+// TagList lists all tags in use, the most used first
+func (store *MemoryStore) TagList(ctx context.Context) *[]*Tag {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	counts := map[string]*Tag{}
+	count := func(tags Tags) map[string]*Tag {
+		seen := map[string]*Tag{}
+		for _, name := range tags {
+			if name == "" {
+				continue
+			}
+			if _, ok := counts[name]; !ok {
+				counts[name] = &Tag{Name: name}
+			}
+			seen[name] = counts[name]
+		}
+		return seen
+	}
+
+	for _, bookmark := range store.bookmarks {
+		if bookmark.DeletedAt.Valid {
+			continue
+		}
+		for _, tag := range count(bookmark.Tags) {
+			tag.Bookmarks++
+		}
+	}
+
+	for _, feed := range store.feeds {
+		if feed.DeletedAt.Valid {
+			continue
+		}
+		for _, tag := range count(feed.Tags) {
+			tag.Feeds++
+		}
+	}
+
+	for _, thought := range store.thoughts {
+		if thought.DeletedAt.Valid {
+			continue
+		}
+		for _, tag := range count(thought.Tags) {
+			tag.Thoughts++
+		}
+	}
+
+	tags := []*Tag{}
+	for _, tag := range counts {
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		left := tags[i].Bookmarks + tags[i].Feeds + tags[i].Thoughts
+		right := tags[j].Bookmarks + tags[j].Feeds + tags[j].Thoughts
+		if left != right {
+			return left > right
+		}
+		return tags[i].Name < tags[j].Name
+	})
+
+	return &tags
+}
+
+// TagRename renames a tag on all bookmarks, feeds and thoughts, if a tag with the new name
+// already exists both are merged. It returns the number of records that changed.
+func (store *MemoryStore) TagRename(ctx context.Context, oldName, newName string) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if oldName == "" || newName == "" {
+		return 0, ErrNoTagName
+	}
+
+	total := int64(0)
+	rename := func(tags Tags) Tags {
+		if !matchesTags(tags, Tags{oldName}) {
+			return tags
+		}
+
+		renamed := Tags{}
+		for _, tag := range tags {
+			if tag == oldName {
+				tag = newName
+			}
+			renamed = append(renamed, tag)
+		}
+
+		total++
+
+		return Tags{}.Merge(renamed)
+	}
+
+	for _, bookmark := range store.bookmarks {
+		bookmark.Tags = rename(bookmark.Tags)
+	}
+
+	for _, feed := range store.feeds {
+		feed.Tags = rename(feed.Tags)
+	}
+
+	for _, thought := range store.thoughts {
+		thought.Tags = rename(thought.Tags)
+	}
+
+	if total == 0 {
+		return 0, ErrNotExistingTag
+	}
+
+	return total, nil
+}
+
+// UserCount counts all users in memory, disabled ones included
+func (store *MemoryStore) UserCount(ctx context.Context) (int, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return len(store.users), nil
+}
+
+// UserGet finds a single user in memory by ID or Username
+func (store *MemoryStore) UserGet(ctx context.Context, user *User) error {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if user.ID == "" && user.Username == "" {
+		return ErrNoUserKey
+	}
+
+	for _, found := range store.users {
+		if user.ID != "" && found.ID == user.ID || user.ID == "" && found.Username == user.Username {
+			*user = *found
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+// UserPersist adds a user to memory or updates the password, token, disabled and admin flags of
+// an existing one
+func (store *MemoryStore) UserPersist(ctx context.Context, user *User) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if user.Username == "" {
+		return ErrNoUserKey
+	}
+
+	user.Updated = time.Now()
+
+	if user.ID != "" {
+		if existing, ok := store.users[user.ID]; ok {
+			existing.Updated = user.Updated
+			existing.PasswordHash = user.PasswordHash
+			existing.TokenHash = user.TokenHash
+			existing.Disabled = user.Disabled
+			existing.Admin = user.Admin
+		}
+		return nil
+	}
+
+	for _, found := range store.users {
+		if found.Username == user.Username {
+			return errors.New("Username " + user.Username + " already exists")
+		}
+	}
+
+	user.ID = generateUUID()
+	user.Created = user.Updated
+
+	persisted := *user
+	store.users[user.ID] = &persisted
+
+	return nil
+}
+
+// UserAuthenticate finds the enabled user in memory with username and password
+func (store *MemoryStore) UserAuthenticate(ctx context.Context, username, password string) (*User, error) {
+	user := &User{Username: username}
+	if username == "" || store.UserGet(ctx, user) != nil || user.Disabled || !user.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// UserByToken finds the enabled user in memory with the api token
+func (store *MemoryStore) UserByToken(ctx context.Context, token string) (*User, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if token == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	for _, found := range store.users {
+		if found.TokenHash == hashToken(token) && !found.Disabled {
+			user := *found
+			return &user, nil
+		}
+	}
+
+	return nil, ErrInvalidCredentials
+}
+
+// before reports if the record created at created with ID comes after the cursor in a list sorted newest first
+func (cursor *Cursor) before(created time.Time, ID string) bool {
+	return created.Before(cursor.Created) || (created.Equal(cursor.Created) && ID < cursor.ID)
+}
+
+// matchesSearch reports if every word of search appears in one of the fields, ignoring case
+func matchesSearch(search string, fields ...string) bool {
+	text := strings.Join(fields, " ")
+
+	for _, word := range strings.Fields(search) {
+		if !containsFold(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesTags reports if tags contain every tag, and none of the tags prefixed with -
+func matchesTags(tags Tags, filter Tags) bool {
+	has := map[string]bool{}
+	for _, tag := range tags {
+		has[tag] = true
+	}
+
+	for _, tag := range filter {
+		if tag == "" {
+			continue
+		} else if strings.HasPrefix(tag, "-") {
+			if has[strings.TrimPrefix(tag, "-")] {
+				return false
+			}
+		} else if !has[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsFold(value, substring string) bool {
+	return strings.Contains(strings.ToLower(value), strings.ToLower(substring))
+}
+
+// sortRecords sorts n records like Sort.apply would, newest first if the sort is empty
+func sortRecords(n int, order Sort, values func(i int) (string, map[string]interface{}), swap func(i, j int)) {
+	if len(order) == 0 {
+		order = Sort{{"created", true}}
+	}
+
+	sort.Sort(&recordSorter{n, order, values, swap})
+}
+
+type recordSorter struct {
+	n      int
+	order  Sort
+	values func(i int) (string, map[string]interface{})
+	swap   func(i, j int)
+}
+
+func (s *recordSorter) Len() int {
+	return s.n
+}
+
+func (s *recordSorter) Swap(i, j int) {
+	s.swap(i, j)
+}
+
+func (s *recordSorter) Less(i, j int) bool {
+	leftID, left := s.values(i)
+	rightID, right := s.values(j)
+
+	for _, field := range s.order {
+		comparison := compareValues(left[field.Field], right[field.Field])
+		if comparison == 0 {
+			continue
+		}
+		if field.Descending {
+			return comparison > 0
+		}
+		return comparison < 0
+	}
+
+	return leftID > rightID
+}
+
+func compareValues(left, right interface{}) int {
+	switch left := left.(type) {
+	case time.Time:
+		if left.Before(right.(time.Time)) {
+			return -1
+		} else if left.After(right.(time.Time)) {
+			return 1
+		}
+	case string:
+		return strings.Compare(left, right.(string))
+	}
+
+	return 0
+}
+
+// paginate returns the bounds of the page of n records, a limit of 0 returns nothing like LIMIT 0 does
+func paginate(n, limit, offset int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > n {
+		offset = n
+	}
+	if limit < 0 || offset+limit > n {
+		return offset, n
+	}
+
+	return offset, offset + limit
+}
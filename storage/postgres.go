@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/stdlib"
+	"github.com/nrocco/qb"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// searchIndexes are the GIN indexes of the search_vector columns
+	searchIndexes = []string{"bookmarks_search", "feeds_search", "thoughts_search", "items_search"}
+)
+
+// isPostgres checks if storage is the url of a PostgreSQL database rather than a path
+func isPostgres(storage string) bool {
+	return strings.HasPrefix(storage, "postgres://") || strings.HasPrefix(storage, "postgresql://")
+}
+
+// Redact hides the password in the url of a PostgreSQL database, so the storage setting can be
+// logged. Paths are returned as they are.
+func Redact(storage string) string {
+	if !isPostgres(storage) {
+		return storage
+	}
+
+	location, err := url.Parse(storage)
+	if err != nil {
+		return "postgres://"
+	}
+
+	if query := location.Query(); query.Get("password") != "" {
+		query.Set("password", "xxxxx")
+		location.RawQuery = query.Encode()
+	}
+
+	return location.Redacted()
+}
+
+// openPostgres connects to the PostgreSQL database at the url dsn
+func openPostgres(ctx context.Context, dsn string) (*qb.DB, error) {
+	config, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db := sql.OpenDB(&postgresConnector{stdlib.GetConnector(*config)})
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &qb.DB{DB: db}, nil
+}
+
+// postgresConnector opens connections that accept the ? placeholders of qb
+type postgresConnector struct {
+	driver.Connector
+}
+
+func (connector *postgresConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := connector.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &postgresConn{conn.(*stdlib.Conn)}, nil
+}
+
+// postgresConn rewrites the ? placeholders of queries with arguments to the numbered placeholders
+// of PostgreSQL. Queries without arguments, like migrations, are sent as they are.
+type postgresConn struct {
+	*stdlib.Conn
+}
+
+func (conn *postgresConn) Prepare(query string) (driver.Stmt, error) {
+	return conn.Conn.Prepare(rebind(query))
+}
+
+func (conn *postgresConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return conn.Conn.PrepareContext(ctx, rebind(query))
+}
+
+func (conn *postgresConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) != 0 {
+		query = rebind(query)
+	}
+
+	return conn.Conn.ExecContext(ctx, query, args)
+}
+
+func (conn *postgresConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 0 {
+		query = rebind(query)
+	}
+
+	return conn.Conn.QueryContext(ctx, query, args)
+}
+
+// rebind numbers the ? placeholders of query as $1, $2 and so on, leaving those in quoted strings
+// and identifiers, dollar quoted strings and comments alone. The ? operators of jsonb can not be
+// used in queries with arguments.
+func rebind(query string) string {
+	rebound := strings.Builder{}
+	number := 0
+
+	for i := 0; i < len(query); i++ {
+		end := i
+
+		switch char := query[i]; {
+		case char == '\'' || char == '"':
+			end = skipPast(query, i+1, query[i:i+1])
+		case strings.HasPrefix(query[i:], "--"):
+			end = skipPast(query, i+2, "\n")
+		case strings.HasPrefix(query[i:], "/*"):
+			end = skipPast(query, i+2, "*/")
+		case char == '$':
+			if tag := dollarQuote(query[i:]); tag != "" {
+				end = skipPast(query, i+len(tag), tag)
+			}
+		case char == '?':
+			number++
+			rebound.WriteString("$" + strconv.Itoa(number))
+			continue
+		}
+
+		rebound.WriteString(query[i : end+1])
+		i = end
+	}
+
+	return rebound.String()
+}
+
+// skipPast returns the index of the last byte of the first closing after start, or of the last
+// byte of query if it is not closed. A doubled quote closes and opens a string again, so it needs
+// no special care.
+func skipPast(query string, start int, closing string) int {
+	if start > len(query) {
+		return len(query) - 1
+	}
+
+	index := strings.Index(query[start:], closing)
+	if index == -1 {
+		return len(query) - 1
+	}
+
+	return start + index + len(closing) - 1
+}
+
+// dollarQuote returns the opening tag of the dollar quoted string query starts with, like $$ or
+// $body$, or nothing if it does not start with one
+func dollarQuote(query string) string {
+	for i := 1; i < len(query); i++ {
+		char := query[i]
+
+		switch {
+		case char == '$':
+			return query[:i+1]
+		case char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z':
+		case char >= '0' && char <= '9' && i > 1:
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// postgresDialect stores everything in a PostgreSQL database, which unlike sqlite handles many
+// concurrent writers. Full text search uses generated tsvector columns with a GIN index.
+type postgresDialect struct{}
+
+func (postgresDialect) migrations() string {
+	return "sql/postgres"
+}
+
+func (postgresDialect) schemaMigrations() string {
+	return "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied TIMESTAMPTZ NOT NULL)"
+}
+
+func (postgresDialect) search(query *qb.SelectQuery, table string, text string) {
+	query.Join("JOIN LATERAL (SELECT query, -ts_rank(" + table + ".search_vector, query) AS rank FROM to_tsquery('simple', ?) AS query) AS search ON true")
+	query.Where(table+".search_vector @@ search.query", tsQuery(text))
+}
+
+func (postgresDialect) searchItems(query *qb.SelectQuery, text string) {
+	query.Join("JOIN (SELECT feed_id, item_id, -ts_rank(search_vector, query) AS rank FROM items_fts, to_tsquery('simple', ?) AS query WHERE search_vector @@ query) AS search ON true")
+	query.Where("search.feed_id = feeds.id AND search.item_id = (json_each.value ->> 'ID')", tsQuery(text))
+}
+
+func (postgresDialect) feedsDue(query *qb.SelectQuery, window int64, maxBackoff int, now time.Time) {
+	query.Where("CASE WHEN error_count > 0 AND failed IS NOT NULL THEN failed ELSE refreshed END + make_interval(secs => (CASE WHEN refresh_interval > 0 THEN refresh_interval ELSE ? END) * (1 << LEAST(error_count, ?))) < ?", window, maxBackoff, now)
+}
+
+func (postgresDialect) jsonEach(array string) string {
+	return "jsonb_array_elements(" + array + ") AS json_each(value)"
+}
+
+func (postgresDialect) jsonEachText(array string) string {
+	return "jsonb_array_elements_text(" + array + ") AS json_each(value)"
+}
+
+func (postgresDialect) jsonArray(values string) string {
+	return "COALESCE(jsonb_agg(" + values + "), '[]')"
+}
+
+func (postgresDialect) textArray(values string) string {
+	return "COALESCE(jsonb_agg(" + values + "), '[]')"
+}
+
+func (postgresDialect) jsonField(object string, field string) string {
+	return "(" + object + " ->> '" + field + "')"
+}
+
+func (postgresDialect) jsonFlag(object string, field string) string {
+	return "COALESCE(" + object + " -> '" + field + "' = 'true', false)"
+}
+
+func (postgresDialect) jsonTime(value string) string {
+	return "CAST(" + value + " AS TIMESTAMPTZ)"
+}
+
+func (postgresDialect) insertOrIgnore(insert string) string {
+	return "INSERT INTO " + insert + " ON CONFLICT DO NOTHING"
+}
+
+// integrityCheck finds nothing, PostgreSQL has no check of its files that works without extensions
+func (postgresDialect) integrityCheck(ctx context.Context, store *Store) ([]string, error) {
+	return []string{}, nil
+}
+
+// ftsCheck finds nothing, the search_vector columns are generated so they can not drift
+func (postgresDialect) ftsCheck(ctx context.Context, store *Store, repair bool) ([]string, error) {
+	return []string{}, nil
+}
+
+// ftsCommand rebuilds the search indexes, or optimizes them by moving their pending entries into
+// the main index
+func (postgresDialect) ftsCommand(ctx context.Context, store *Store, command string) error {
+	for _, index := range searchIndexes {
+		statement := "SELECT gin_clean_pending_list('" + index + "')"
+		if command == "rebuild" {
+			statement = "REINDEX INDEX " + index
+		}
+
+		if _, err := store.db.ExecContext(ctx, statement); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("index", index).Str("command", command).Msg("Error maintaining full text search index")
+			return err
+		}
+	}
+
+	return nil
+}
+
+// optimize updates the statistics of the query planner and moves the pending entries of the
+// search indexes into the main index, autovacuum takes care of free space
+func (d postgresDialect) optimize(ctx context.Context, store *Store) error {
+	if _, err := store.db.ExecContext(ctx, "ANALYZE"); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("statement", "ANALYZE").Msg("Error optimizing the database")
+		return err
+	}
+
+	return d.ftsCommand(ctx, store, "optimize")
+}
+
+// sizes measures the database and its search indexes, the write ahead log and free space of
+// PostgreSQL are shared with other databases of the server so they are not reported
+func (postgresDialect) sizes(ctx context.Context, store *Store, stats *Stats) error {
+	if err := store.db.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&stats.FileSize); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error measuring the database")
+		return err
+	}
+
+	for _, index := range searchIndexes {
+		size := int64(0)
+		if err := store.db.QueryRowContext(ctx, "SELECT pg_relation_size(?)", index).Scan(&size); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("index", index).Msg("Error measuring full text search index")
+			return err
+		}
+		stats.FTSSize += size
+	}
+
+	return nil
+}
+
+// tsQuery turns every word of search into a prefix query for full text search, quoted so
+// characters with a special meaning to tsquery cannot cause a syntax error
+func tsQuery(search string) string {
+	terms := []string{}
+
+	for _, word := range strings.Fields(search) {
+		word = strings.ReplaceAll(strings.ReplaceAll(word, `\`, `\\`), "'", "''")
+		terms = append(terms, "'"+word+"':*")
+	}
+
+	return strings.Join(terms, " & ")
+}
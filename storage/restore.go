@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrInvalidBackup is returned when restoring a file that is not a usable backup
+	ErrInvalidBackup = errors.New("Invalid backup")
+
+	// sqliteHeader is how every sqlite database file starts
+	sqliteHeader = "SQLite format 3\x00"
+
+	// dataTables are the tables that hold user data, in the order they are restored
+	dataTables = []string{"bookmarks", "feeds", "thoughts", "followers", "users"}
+)
+
+// Restore replaces all data in the database with the data in the backup at path. The backup is
+// validated and migrated to the current schema on a copy, so the file at path is left untouched,
+// after which all data is swapped in a single transaction. A PostgreSQL database is restored with
+// its own tools instead.
+func (store *Store) Restore(ctx context.Context, path string) error {
+	ctx, span := store.start(ctx, "Store.Restore")
+	defer span.End()
+
+	if store.path == "" {
+		return ErrUnsupported
+	}
+
+	dir, err := ioutil.TempDir(filepath.Dir(store.path), ".restore")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	copied := filepath.Join(dir, "backup.db")
+	if err := copyFile(path, copied); err != nil {
+		return err
+	}
+
+	if err := validateBackup(ctx, copied, store.key); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("path", path).Msg("Refusing to restore backup")
+		return err
+	}
+
+	conn, err := store.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	attach := "ATTACH DATABASE ? AS backup"
+	args := []interface{}{copied}
+	if store.key != "" {
+		attach += " KEY ?"
+		args = append(args, store.key)
+	}
+
+	if _, err := conn.ExecContext(ctx, attach, args...); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE backup")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range dataTables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM main."+table); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO main."+table+" SELECT * FROM backup."+table); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("path", path).Msg("Error restoring backup")
+		return err
+	}
+
+	store.invalidate()
+
+	log.Ctx(ctx).Info().Str("path", path).Msg("Restored backup")
+
+	return nil
+}
+
+// validateBackup opens the backup with key, which applies pending migrations, and checks its integrity
+func validateBackup(ctx context.Context, path string, key string) error {
+	// Opening anything else than a sqlite database, like an empty file, would create a new
+	// database. An encrypted database has no header, opening it fails if it was not encrypted
+	// with key.
+	if key == "" && !isSQLite(path) || key != "" && isEmpty(path) {
+		return fmt.Errorf("%w: not a sqlite database", ErrInvalidBackup)
+	}
+
+	backup, err := NewWithKey(ctx, path, key, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+	}
+	defer backup.Close()
+
+	latest := 0
+	if err := backup.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&latest); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+	}
+
+	migrations, err := loadMigrations(sqliteDialect{}.migrations())
+	if err != nil {
+		return err
+	}
+
+	if known := migrations[len(migrations)-1].Version; latest > known {
+		return fmt.Errorf("%w: made by a newer version of bookmarks with schema version %d", ErrInvalidBackup, latest)
+	}
+
+	problems, err := backup.IntegrityCheck(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, err)
+	} else if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidBackup, problems[0])
+	}
+
+	return nil
+}
+
+// isSQLite checks if the file at path starts like a sqlite database
+func isSQLite(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(file, header); err != nil {
+		return false
+	}
+
+	return string(header) == sqliteHeader
+}
+
+// isEmpty checks if the file at path is empty or can not be read
+func isEmpty(path string) bool {
+	info, err := os.Stat(path)
+
+	return err != nil || info.Size() == 0
+}
+
+func copyFile(source, destination string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(destination)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
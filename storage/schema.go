@@ -3,37 +3,203 @@ package storage
 import (
 	"context"
 	"embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
-//go:embed sql/*.sql
-var migrations embed.FS
+//go:embed sql/*.sql sql/postgres/*.sql
+var migrationFiles embed.FS
 
-func (store *Store) migrate(ctx context.Context) error {
-	tx, err := store.db.BeginTx(ctx, nil)
+// migrationFile matches the names of migration files, for example 0001_bookmarks.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered change to the database schema
+type Migration struct {
+	Version int
+	Name    string
+	Applied time.Time
+	up      string
+	down    string
+}
+
+// loadMigrations reads all migrations in dir embedded in the binary, ordered by version
+func loadMigrations(dir string) ([]*Migration, error) {
+	files, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		match := migrationFile.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("Invalid migration file name %s", file.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		contents, err := migrationFiles.ReadFile(dir + "/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if match[3] == "up" {
+			migration.up = string(contents)
+		} else {
+			migration.down = string(contents)
+		}
+	}
+
+	migrations := []*Migration{}
+	for _, migration := range byVersion {
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrations returns all migrations known to this version of bookmarks and when they were applied
+func (store *Store) Migrations(ctx context.Context) ([]*Migration, error) {
+	if _, err := store.db.ExecContext(ctx, store.dialect.schemaMigrations()); err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(store.dialect.migrations())
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []*Migration{}
+	if _, err := store.db.Select(ctx).From("schema_migrations").Columns("version", "name", "applied").Load(&applied); err != nil {
+		return nil, err
+	}
+
+	for _, migration := range migrations {
+		for _, record := range applied {
+			if record.Version == migration.Version {
+				migration.Applied = record.Applied
+			}
+		}
+	}
+
+	return migrations, nil
+}
+
+// MigrationsApplied returns an error if a migration known to this version of bookmarks was not
+// applied to the database yet
+func (store *Store) MigrationsApplied(ctx context.Context) error {
+	migrations, err := loadMigrations(store.dialect.migrations())
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
 
-	files, err := migrations.ReadDir("sql")
+	versions := []int{}
+	if _, err := store.db.Select(ctx).From("schema_migrations").Columns("version").Load(&versions); err != nil {
+		return err
+	}
+
+	applied := map[int]bool{}
+	for _, version := range versions {
+		applied[version] = true
+	}
+
+	for _, migration := range migrations {
+		if !applied[migration.Version] {
+			return fmt.Errorf("Migration %d_%s was not applied", migration.Version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// MigrateUp applies all migrations that were not applied yet, in order
+func (store *Store) MigrateUp(ctx context.Context) error {
+	migrations, err := store.Migrations(ctx)
 	if err != nil {
 		return err
 	}
 
-	for _, file := range files {
-		migration, err := migrations.ReadFile("sql/" + file.Name())
-		if err != nil {
-			return err
+	for _, migration := range migrations {
+		if !migration.Applied.IsZero() {
+			continue
 		}
-		if _, err := tx.ExecContext(ctx, string(migration[:])); err != nil {
-			return err
+
+		if err := store.applyMigration(ctx, migration, migration.up, "INSERT INTO schema_migrations (version, name, applied) VALUES (?, ?, ?)", migration.Version, migration.Name, time.Now()); err != nil {
+			return fmt.Errorf("Error applying migration %d_%s: %w", migration.Version, migration.Name, err)
 		}
+
+		log.Ctx(ctx).Info().Int("version", migration.Version).Str("name", migration.Name).Msg("Applied migration")
 	}
 
-	err = tx.Commit()
+	return nil
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+func (store *Store) MigrateDown(ctx context.Context, steps int) error {
+	migrations, err := store.Migrations(ctx)
 	if err != nil {
 		return err
 	}
 
-	return err
+	for i := len(migrations) - 1; i >= 0 && steps > 0; i-- {
+		migration := migrations[i]
+		if migration.Applied.IsZero() {
+			continue
+		}
+
+		if err := store.applyMigration(ctx, migration, migration.down, "DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil {
+			return fmt.Errorf("Error reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+
+		log.Ctx(ctx).Info().Int("version", migration.Version).Str("name", migration.Name).Msg("Reverted migration")
+
+		steps--
+	}
+
+	return nil
+}
+
+// applyMigration runs the statements of a migration and records the result in schema_migrations in a single transaction
+func (store *Store) applyMigration(ctx context.Context, migration *Migration, statements string, record string, args ...interface{}) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, statements); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	store.invalidate()
+
+	return nil
 }
@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nrocco/qb"
+)
+
+var (
+	// BookmarkSortFields lists the fields bookmarks can be sorted on
+	BookmarkSortFields = []string{"created", "updated", "title", "url"}
+
+	// FeedSortFields lists the fields feeds can be sorted on
+	FeedSortFields = []string{"created", "updated", "refreshed", "last_authored", "title", "url"}
+
+	// ThoughtSortFields lists the fields thoughts can be sorted on
+	ThoughtSortFields = []string{"created", "updated"}
+
+	// FeedItemSortFields lists the fields feed items can be sorted on
+	FeedItemSortFields = []string{"date", "title", "feed_title"}
+)
+
+// SortField is a single field to sort a list on
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// Sort is an ordered list of fields to sort a list on
+type Sort []SortField
+
+// ParseSort parses a comma separated list of fields, each optionally prefixed
+// with a - for descending order, and validates them against allowed
+func ParseSort(value string, allowed []string) (Sort, error) {
+	sort := Sort{}
+
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		sortField := SortField{Field: strings.TrimPrefix(field, "-"), Descending: strings.HasPrefix(field, "-")}
+
+		if !isAllowedSortField(sortField.Field, allowed) {
+			return nil, fmt.Errorf("Cannot sort on %s, use one of %s", sortField.Field, strings.Join(allowed, ", "))
+		}
+
+		sort = append(sort, sortField)
+	}
+
+	return sort, nil
+}
+
+func isAllowedSortField(field string, allowed []string) bool {
+	for _, candidate := range allowed {
+		if field == candidate {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply adds the ORDER BY clauses to the query, falling back to defaults if the sort is empty
+func (sort Sort) apply(query *qb.SelectQuery, defaults Sort) {
+	sort.applyColumns(query, defaults, nil, "id")
+}
+
+// applyColumns adds the ORDER BY clauses like apply, sorting on the expressions in columns for the
+// fields that are not a column themselves and on id last
+func (sort Sort) applyColumns(query *qb.SelectQuery, defaults Sort, columns map[string]string, id string) {
+	if len(sort) == 0 {
+		sort = defaults
+	}
+
+	for _, field := range sort {
+		column, ok := columns[field.Field]
+		if !ok {
+			column = field.Field
+		}
+
+		if field.Descending {
+			query.OrderBy(column, "DESC")
+		} else {
+			query.OrderBy(column, "ASC")
+		}
+	}
+
+	query.OrderBy(id, "DESC")
+}
+
+// ranked puts the best matches of a full text search first, unless the list is paged with a cursor
+// which relies on the order of defaults
+func ranked(search string, cursor string, defaults Sort) Sort {
+	if search == "" || cursor != "" {
+		return defaults
+	}
+
+	return append(Sort{{"search.rank", false}}, defaults...)
+}
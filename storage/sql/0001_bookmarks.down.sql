@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS bookmarks_au;
+DROP TRIGGER IF EXISTS bookmarks_ad;
+DROP TRIGGER IF EXISTS bookmarks_ai;
+DROP TABLE IF EXISTS bookmarks_fts;
+DROP TABLE IF EXISTS bookmarks;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS thoughts_au;
+DROP TRIGGER IF EXISTS thoughts_ad;
+DROP TRIGGER IF EXISTS thoughts_ai;
+DROP TABLE IF EXISTS thoughts_fts;
+DROP TABLE IF EXISTS thoughts;
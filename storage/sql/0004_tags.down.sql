@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS thoughts_tags_ad;
+DROP TRIGGER IF EXISTS thoughts_tags_au;
+DROP TRIGGER IF EXISTS thoughts_tags_ai;
+DROP TABLE IF EXISTS thoughts_tags;
+DROP TRIGGER IF EXISTS feeds_tags_ad;
+DROP TRIGGER IF EXISTS feeds_tags_au;
+DROP TRIGGER IF EXISTS feeds_tags_ai;
+DROP TABLE IF EXISTS feeds_tags;
+DROP TRIGGER IF EXISTS bookmarks_tags_ad;
+DROP TRIGGER IF EXISTS bookmarks_tags_au;
+DROP TRIGGER IF EXISTS bookmarks_tags_ai;
+DROP TABLE IF EXISTS bookmarks_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,85 @@
+-- The tags columns stay the lists of tag names the application reads and writes,
+-- and are indexed by full text search. Triggers keep the normalized tables in
+-- sync with them, which are used to filter, count and rename tags.
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks_tags (
+    bookmark_id CHAR(16) NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (bookmark_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_tags_tag_id ON bookmarks_tags(tag_id);
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_tags_ai AFTER INSERT ON bookmarks BEGIN
+    INSERT OR IGNORE INTO tags(name) SELECT value FROM json_each(new.tags) WHERE value != '';
+    INSERT OR IGNORE INTO bookmarks_tags(bookmark_id, tag_id) SELECT new.id, tags.id FROM json_each(new.tags) JOIN tags ON tags.name = json_each.value;
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_tags_au AFTER UPDATE OF tags ON bookmarks BEGIN
+    DELETE FROM bookmarks_tags WHERE bookmark_id = old.id;
+    INSERT OR IGNORE INTO tags(name) SELECT value FROM json_each(new.tags) WHERE value != '';
+    INSERT OR IGNORE INTO bookmarks_tags(bookmark_id, tag_id) SELECT new.id, tags.id FROM json_each(new.tags) JOIN tags ON tags.name = json_each.value;
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_tags_ad AFTER DELETE ON bookmarks BEGIN
+    DELETE FROM bookmarks_tags WHERE bookmark_id = old.id;
+END;
+
+INSERT OR IGNORE INTO tags(name) SELECT value FROM bookmarks, json_each(bookmarks.tags) WHERE value != '';
+INSERT OR IGNORE INTO bookmarks_tags(bookmark_id, tag_id) SELECT bookmarks.id, tags.id FROM bookmarks, json_each(bookmarks.tags) JOIN tags ON tags.name = json_each.value;
+
+CREATE TABLE IF NOT EXISTS feeds_tags (
+    feed_id CHAR(16) NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (feed_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS feeds_tags_tag_id ON feeds_tags(tag_id);
+
+CREATE TRIGGER IF NOT EXISTS feeds_tags_ai AFTER INSERT ON feeds BEGIN
+    INSERT OR IGNORE INTO tags(name) SELECT value FROM json_each(new.tags) WHERE value != '';
+    INSERT OR IGNORE INTO feeds_tags(feed_id, tag_id) SELECT new.id, tags.id FROM json_each(new.tags) JOIN tags ON tags.name = json_each.value;
+END;
+
+CREATE TRIGGER IF NOT EXISTS feeds_tags_au AFTER UPDATE OF tags ON feeds BEGIN
+    DELETE FROM feeds_tags WHERE feed_id = old.id;
+    INSERT OR IGNORE INTO tags(name) SELECT value FROM json_each(new.tags) WHERE value != '';
+    INSERT OR IGNORE INTO feeds_tags(feed_id, tag_id) SELECT new.id, tags.id FROM json_each(new.tags) JOIN tags ON tags.name = json_each.value;
+END;
+
+CREATE TRIGGER IF NOT EXISTS feeds_tags_ad AFTER DELETE ON feeds BEGIN
+    DELETE FROM feeds_tags WHERE feed_id = old.id;
+END;
+
+INSERT OR IGNORE INTO tags(name) SELECT value FROM feeds, json_each(feeds.tags) WHERE value != '';
+INSERT OR IGNORE INTO feeds_tags(feed_id, tag_id) SELECT feeds.id, tags.id FROM feeds, json_each(feeds.tags) JOIN tags ON tags.name = json_each.value;
+
+CREATE TABLE IF NOT EXISTS thoughts_tags (
+    thought_id CHAR(16) NOT NULL,
+    tag_id INTEGER NOT NULL,
+    PRIMARY KEY (thought_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS thoughts_tags_tag_id ON thoughts_tags(tag_id);
+
+CREATE TRIGGER IF NOT EXISTS thoughts_tags_ai AFTER INSERT ON thoughts BEGIN
+    INSERT OR IGNORE INTO tags(name) SELECT value FROM json_each(new.tags) WHERE value != '';
+    INSERT OR IGNORE INTO thoughts_tags(thought_id, tag_id) SELECT new.id, tags.id FROM json_each(new.tags) JOIN tags ON tags.name = json_each.value;
+END;
+
+CREATE TRIGGER IF NOT EXISTS thoughts_tags_au AFTER UPDATE OF tags ON thoughts BEGIN
+    DELETE FROM thoughts_tags WHERE thought_id = old.id;
+    INSERT OR IGNORE INTO tags(name) SELECT value FROM json_each(new.tags) WHERE value != '';
+    INSERT OR IGNORE INTO thoughts_tags(thought_id, tag_id) SELECT new.id, tags.id FROM json_each(new.tags) JOIN tags ON tags.name = json_each.value;
+END;
+
+CREATE TRIGGER IF NOT EXISTS thoughts_tags_ad AFTER DELETE ON thoughts BEGIN
+    DELETE FROM thoughts_tags WHERE thought_id = old.id;
+END;
+
+INSERT OR IGNORE INTO tags(name) SELECT value FROM thoughts, json_each(thoughts.tags) WHERE value != '';
+INSERT OR IGNORE INTO thoughts_tags(thought_id, tag_id) SELECT thoughts.id, tags.id FROM thoughts, json_each(thoughts.tags) JOIN tags ON tags.name = json_each.value;
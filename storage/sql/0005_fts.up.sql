@@ -0,0 +1,66 @@
+-- Full text search ignores accents and indexes prefixes of 2 and 3 characters,
+-- so searching for partial words is fast. Feeds are searched the same way.
+
+DROP TRIGGER IF EXISTS bookmarks_au;
+DROP TRIGGER IF EXISTS bookmarks_ad;
+DROP TRIGGER IF EXISTS bookmarks_ai;
+DROP TABLE IF EXISTS bookmarks_fts;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS bookmarks_fts
+USING fts5(title, url, content, tags, content=bookmarks, content_rowid=rowid, tokenize='unicode61 remove_diacritics 2', prefix='2 3');
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_ai AFTER INSERT ON bookmarks BEGIN
+    INSERT INTO bookmarks_fts(rowid, title, url, content, tags) VALUES (new.rowid, new.title, new.url, new.content, new.tags);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_ad AFTER DELETE ON bookmarks BEGIN
+    INSERT INTO bookmarks_fts(bookmarks_fts, rowid, title, url, content, tags) VALUES('delete', old.rowid, old.title, old.url, old.content, old.tags);
+END;
+
+CREATE TRIGGER IF NOT EXISTS bookmarks_au AFTER UPDATE ON bookmarks BEGIN
+    INSERT INTO bookmarks_fts(bookmarks_fts, rowid, title, url, content, tags) VALUES('delete', old.rowid, old.title, old.url, old.content, old.tags);
+    INSERT INTO bookmarks_fts(rowid, title, url, content, tags) VALUES (new.rowid, new.title, new.url, new.content, new.tags);
+END;
+
+INSERT INTO bookmarks_fts(bookmarks_fts) VALUES('rebuild');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS feeds_fts
+USING fts5(title, url, content=feeds, content_rowid=rowid, tokenize='unicode61 remove_diacritics 2', prefix='2 3');
+
+CREATE TRIGGER IF NOT EXISTS feeds_ai AFTER INSERT ON feeds BEGIN
+    INSERT INTO feeds_fts(rowid, title, url) VALUES (new.rowid, new.title, new.url);
+END;
+
+CREATE TRIGGER IF NOT EXISTS feeds_ad AFTER DELETE ON feeds BEGIN
+    INSERT INTO feeds_fts(feeds_fts, rowid, title, url) VALUES('delete', old.rowid, old.title, old.url);
+END;
+
+CREATE TRIGGER IF NOT EXISTS feeds_au AFTER UPDATE ON feeds BEGIN
+    INSERT INTO feeds_fts(feeds_fts, rowid, title, url) VALUES('delete', old.rowid, old.title, old.url);
+    INSERT INTO feeds_fts(rowid, title, url) VALUES (new.rowid, new.title, new.url);
+END;
+
+INSERT INTO feeds_fts(feeds_fts) VALUES('rebuild');
+
+DROP TRIGGER IF EXISTS thoughts_au;
+DROP TRIGGER IF EXISTS thoughts_ad;
+DROP TRIGGER IF EXISTS thoughts_ai;
+DROP TABLE IF EXISTS thoughts_fts;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS thoughts_fts
+USING fts5(content, tags, content=thoughts, content_rowid=rowid, tokenize='unicode61 remove_diacritics 2', prefix='2 3');
+
+CREATE TRIGGER IF NOT EXISTS thoughts_ai AFTER INSERT ON thoughts BEGIN
+    INSERT INTO thoughts_fts(rowid, content, tags) VALUES (new.rowid, new.content, new.tags);
+END;
+
+CREATE TRIGGER IF NOT EXISTS thoughts_ad AFTER DELETE ON thoughts BEGIN
+    INSERT INTO thoughts_fts(thoughts_fts, rowid, content, tags) VALUES('delete', old.rowid, old.content, old.tags);
+END;
+
+CREATE TRIGGER IF NOT EXISTS thoughts_au AFTER UPDATE ON thoughts BEGIN
+    INSERT INTO thoughts_fts(thoughts_fts, rowid, content, tags) VALUES('delete', old.rowid, old.content, old.tags);
+    INSERT INTO thoughts_fts(rowid, content, tags) VALUES (new.rowid, new.content, new.tags);
+END;
+
+INSERT INTO thoughts_fts(thoughts_fts) VALUES('rebuild');
@@ -0,0 +1,11 @@
+DELETE FROM bookmarks WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS bookmarks_deleted_at;
+ALTER TABLE bookmarks DROP COLUMN deleted_at;
+
+DELETE FROM feeds WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS feeds_deleted_at;
+ALTER TABLE feeds DROP COLUMN deleted_at;
+
+DELETE FROM thoughts WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS thoughts_deleted_at;
+ALTER TABLE thoughts DROP COLUMN deleted_at;
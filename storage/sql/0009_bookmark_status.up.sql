@@ -0,0 +1 @@
+ALTER TABLE bookmarks ADD COLUMN status TEXT NOT NULL DEFAULT 'fetched';
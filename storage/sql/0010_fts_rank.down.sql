@@ -0,0 +1,3 @@
+INSERT INTO bookmarks_fts(bookmarks_fts, rank) VALUES('rank', 'bm25()');
+INSERT INTO feeds_fts(feeds_fts, rank) VALUES('rank', 'bm25()');
+INSERT INTO thoughts_fts(thoughts_fts, rank) VALUES('rank', 'bm25()');
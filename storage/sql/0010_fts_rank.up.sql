@@ -0,0 +1,7 @@
+-- Rank full text search results with bm25, weighing matches in the title and
+-- tags over matches in the url and those over matches in the content, so the
+-- best match is no longer the one with the most words in its content.
+
+INSERT INTO bookmarks_fts(bookmarks_fts, rank) VALUES('rank', 'bm25(10.0, 2.0, 1.0, 5.0)');
+INSERT INTO feeds_fts(feeds_fts, rank) VALUES('rank', 'bm25(10.0, 2.0)');
+INSERT INTO thoughts_fts(thoughts_fts, rank) VALUES('rank', 'bm25(1.0, 5.0)');
@@ -0,0 +1,4 @@
+-- How often a feed is refreshed in seconds, feeds without one are refreshed
+-- by the sweeps as often as their window allows.
+
+ALTER TABLE feeds ADD COLUMN refresh_interval INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+ALTER TABLE feeds DROP COLUMN failed;
+ALTER TABLE feeds DROP COLUMN last_error;
+ALTER TABLE feeds DROP COLUMN error_count;
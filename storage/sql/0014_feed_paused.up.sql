@@ -0,0 +1,3 @@
+-- Paused feeds keep their items but are not refreshed by the sweeps.
+
+ALTER TABLE feeds ADD COLUMN paused BOOLEAN NOT NULL DEFAULT 0;
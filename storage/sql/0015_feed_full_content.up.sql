@@ -0,0 +1,4 @@
+-- Feeds that only have a summary of their articles get the full content of
+-- the pages their items link to.
+
+ALTER TABLE feeds ADD COLUMN fetch_full_content BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- The favicons of the sites of feeds, an icon without data records that the
+-- site does not have one so it is not looked for on every refresh.
+
+CREATE TABLE IF NOT EXISTS feed_icons (
+    feed_id TEXT PRIMARY KEY REFERENCES feeds (id) ON DELETE CASCADE,
+    fetched DATE NOT NULL,
+    content_type TEXT NOT NULL DEFAULT '',
+    data BLOB
+);
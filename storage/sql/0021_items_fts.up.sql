@@ -0,0 +1,27 @@
+-- Feed items are searched like bookmarks, matches in the title over those in
+-- the url and those over matches in the content. Items are kept in the items
+-- column of their feed, so its triggers index them again whenever the items of
+-- a feed change.
+
+CREATE VIRTUAL TABLE IF NOT EXISTS items_fts
+USING fts5(feed_id UNINDEXED, item_id UNINDEXED, title, url, content, tokenize='unicode61 remove_diacritics 2', prefix='2 3');
+
+CREATE TRIGGER IF NOT EXISTS items_fts_ai AFTER INSERT ON feeds BEGIN
+    INSERT INTO items_fts(feed_id, item_id, title, url, content)
+    SELECT new.id, json_extract(value, '$.ID'), json_extract(value, '$.Title'), json_extract(value, '$.URL'), json_extract(value, '$.Content') FROM json_each(new.items);
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_fts_ad AFTER DELETE ON feeds BEGIN
+    DELETE FROM items_fts WHERE feed_id = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS items_fts_au AFTER UPDATE OF items ON feeds BEGIN
+    DELETE FROM items_fts WHERE feed_id = old.id;
+    INSERT INTO items_fts(feed_id, item_id, title, url, content)
+    SELECT new.id, json_extract(value, '$.ID'), json_extract(value, '$.Title'), json_extract(value, '$.URL'), json_extract(value, '$.Content') FROM json_each(new.items);
+END;
+
+INSERT INTO items_fts(feed_id, item_id, title, url, content)
+SELECT feeds.id, json_extract(value, '$.ID'), json_extract(value, '$.Title'), json_extract(value, '$.URL'), json_extract(value, '$.Content') FROM feeds, json_each(feeds.items);
+
+INSERT INTO items_fts(items_fts, rank) VALUES('rank', 'bm25(0.0, 0.0, 10.0, 2.0, 1.0)');
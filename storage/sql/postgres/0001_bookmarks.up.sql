@@ -0,0 +1,23 @@
+-- Full text search uses a generated tsvector column with a GIN index instead
+-- of the fts5 table of sqlite. Words are not stemmed, like sqlite does not.
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id TEXT PRIMARY KEY,
+    -- The numbers of bookmarks, named after the sqlite column they stand in for
+    rowid BIGSERIAL UNIQUE,
+    created TIMESTAMPTZ DEFAULT now(),
+    updated TIMESTAMPTZ DEFAULT now(),
+    title TEXT NOT NULL,
+    url TEXT UNIQUE NOT NULL,
+    excerpt TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    tags JSONB NOT NULL DEFAULT '[]',
+    -- A tsvector is limited to 1MB, so only the start of long pages is indexed
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', title) ||
+        to_tsvector('simple', url) ||
+        to_tsvector('simple', left(content, 250000)) ||
+        to_tsvector('simple', tags)
+    ) STORED
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_search ON bookmarks USING GIN (search_vector);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS feeds (
+    id TEXT PRIMARY KEY,
+    created TIMESTAMPTZ DEFAULT now(),
+    updated TIMESTAMPTZ DEFAULT now(),
+    refreshed TIMESTAMPTZ DEFAULT now(),
+    last_authored TIMESTAMPTZ DEFAULT now(),
+    title TEXT NOT NULL,
+    url TEXT UNIQUE NOT NULL,
+    etag TEXT NOT NULL DEFAULT '',
+    tags JSONB NOT NULL DEFAULT '[]',
+    items JSONB NOT NULL DEFAULT '[]'
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS thoughts (
+    id TEXT PRIMARY KEY,
+    created TIMESTAMPTZ NOT NULL,
+    updated TIMESTAMPTZ NOT NULL,
+    tags JSONB NOT NULL DEFAULT '[]',
+    content TEXT NOT NULL DEFAULT '',
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        to_tsvector('simple', left(content, 250000)) ||
+        to_tsvector('simple', tags)
+    ) STORED
+);
+
+CREATE INDEX IF NOT EXISTS thoughts_search ON thoughts USING GIN (search_vector);
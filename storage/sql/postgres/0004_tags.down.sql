@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS thoughts_tags ON thoughts;
+DROP TRIGGER IF EXISTS feeds_tags ON feeds;
+DROP TRIGGER IF EXISTS bookmarks_tags ON bookmarks;
+DROP FUNCTION IF EXISTS sync_tags();
+DROP TABLE IF EXISTS thoughts_tags;
+DROP TABLE IF EXISTS feeds_tags;
+DROP TABLE IF EXISTS bookmarks_tags;
+DROP TABLE IF EXISTS tags;
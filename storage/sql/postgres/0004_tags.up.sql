@@ -0,0 +1,74 @@
+-- The tags columns stay the lists of tag names the application reads and writes,
+-- and are indexed by full text search. A trigger keeps the normalized tables in
+-- sync with them, which are used to filter, count and rename tags.
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS bookmarks_tags (
+    bookmark_id TEXT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (bookmark_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS bookmarks_tags_tag_id ON bookmarks_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS feeds_tags (
+    feed_id TEXT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (feed_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS feeds_tags_tag_id ON feeds_tags (tag_id);
+
+CREATE TABLE IF NOT EXISTS thoughts_tags (
+    thought_id TEXT NOT NULL,
+    tag_id BIGINT NOT NULL,
+    PRIMARY KEY (thought_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS thoughts_tags_tag_id ON thoughts_tags (tag_id);
+
+-- Called with the join table and its column that references the record
+CREATE OR REPLACE FUNCTION sync_tags() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        EXECUTE format('DELETE FROM %I WHERE %I = $1', TG_ARGV[0], TG_ARGV[1]) USING OLD.id;
+    END IF;
+
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        INSERT INTO tags (name) SELECT value FROM jsonb_array_elements_text(NEW.tags) WHERE value != '' ON CONFLICT DO NOTHING;
+        EXECUTE format('INSERT INTO %I (%I, tag_id) SELECT $1, tags.id FROM jsonb_array_elements_text($2) JOIN tags ON tags.name = value ON CONFLICT DO NOTHING', TG_ARGV[0], TG_ARGV[1]) USING NEW.id, NEW.tags;
+    END IF;
+
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER bookmarks_tags AFTER INSERT OR UPDATE OF tags OR DELETE ON bookmarks
+FOR EACH ROW EXECUTE FUNCTION sync_tags('bookmarks_tags', 'bookmark_id');
+
+CREATE TRIGGER feeds_tags AFTER INSERT OR UPDATE OF tags OR DELETE ON feeds
+FOR EACH ROW EXECUTE FUNCTION sync_tags('feeds_tags', 'feed_id');
+
+CREATE TRIGGER thoughts_tags AFTER INSERT OR UPDATE OF tags OR DELETE ON thoughts
+FOR EACH ROW EXECUTE FUNCTION sync_tags('thoughts_tags', 'thought_id');
+
+INSERT INTO tags (name)
+SELECT value FROM bookmarks CROSS JOIN LATERAL jsonb_array_elements_text(bookmarks.tags) WHERE value != ''
+UNION SELECT value FROM feeds CROSS JOIN LATERAL jsonb_array_elements_text(feeds.tags) WHERE value != ''
+UNION SELECT value FROM thoughts CROSS JOIN LATERAL jsonb_array_elements_text(thoughts.tags) WHERE value != ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO bookmarks_tags (bookmark_id, tag_id)
+SELECT bookmarks.id, tags.id FROM bookmarks CROSS JOIN LATERAL jsonb_array_elements_text(bookmarks.tags) JOIN tags ON tags.name = value
+ON CONFLICT DO NOTHING;
+
+INSERT INTO feeds_tags (feed_id, tag_id)
+SELECT feeds.id, tags.id FROM feeds CROSS JOIN LATERAL jsonb_array_elements_text(feeds.tags) JOIN tags ON tags.name = value
+ON CONFLICT DO NOTHING;
+
+INSERT INTO thoughts_tags (thought_id, tag_id)
+SELECT thoughts.id, tags.id FROM thoughts CROSS JOIN LATERAL jsonb_array_elements_text(thoughts.tags) JOIN tags ON tags.name = value
+ON CONFLICT DO NOTHING;
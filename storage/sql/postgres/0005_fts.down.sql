@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS feeds_search;
+ALTER TABLE feeds DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,8 @@
+-- Feeds are searched by their title and url, like bookmarks and thoughts. Prefix
+-- queries need no index of their own, accents are not ignored.
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', title) ||
+    to_tsvector('simple', url)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS feeds_search ON feeds USING GIN (search_vector);
@@ -0,0 +1,8 @@
+ALTER TABLE bookmarks ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS bookmarks_deleted_at ON bookmarks (deleted_at);
+
+ALTER TABLE feeds ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS feeds_deleted_at ON feeds (deleted_at);
+
+ALTER TABLE thoughts ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS thoughts_deleted_at ON thoughts (deleted_at);
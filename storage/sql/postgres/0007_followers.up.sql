@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS followers (
+    id TEXT PRIMARY KEY,
+    created TIMESTAMPTZ NOT NULL,
+    inbox TEXT NOT NULL
+);
@@ -0,0 +1,25 @@
+DROP INDEX IF EXISTS bookmarks_search;
+ALTER TABLE bookmarks DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE bookmarks ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', title) ||
+    to_tsvector('simple', url) ||
+    to_tsvector('simple', left(content, 250000)) ||
+    to_tsvector('simple', tags)
+) STORED;
+CREATE INDEX IF NOT EXISTS bookmarks_search ON bookmarks USING GIN (search_vector);
+
+DROP INDEX IF EXISTS feeds_search;
+ALTER TABLE feeds DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE feeds ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', title) ||
+    to_tsvector('simple', url)
+) STORED;
+CREATE INDEX IF NOT EXISTS feeds_search ON feeds USING GIN (search_vector);
+
+DROP INDEX IF EXISTS thoughts_search;
+ALTER TABLE thoughts DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE thoughts ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    to_tsvector('simple', left(content, 250000)) ||
+    to_tsvector('simple', tags)
+) STORED;
+CREATE INDEX IF NOT EXISTS thoughts_search ON thoughts USING GIN (search_vector);
@@ -0,0 +1,29 @@
+-- Rank full text search results with weights, matches in the title over those
+-- in the tags, those over matches in the url and those over matches in the
+-- content. Generated columns can not be altered, so they are added again.
+
+DROP INDEX IF EXISTS bookmarks_search;
+ALTER TABLE bookmarks DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE bookmarks ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') ||
+    setweight(to_tsvector('simple', tags), 'B') ||
+    setweight(to_tsvector('simple', url), 'C') ||
+    setweight(to_tsvector('simple', left(content, 250000)), 'D')
+) STORED;
+CREATE INDEX IF NOT EXISTS bookmarks_search ON bookmarks USING GIN (search_vector);
+
+DROP INDEX IF EXISTS feeds_search;
+ALTER TABLE feeds DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE feeds ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', title), 'A') ||
+    setweight(to_tsvector('simple', url), 'C')
+) STORED;
+CREATE INDEX IF NOT EXISTS feeds_search ON feeds USING GIN (search_vector);
+
+DROP INDEX IF EXISTS thoughts_search;
+ALTER TABLE thoughts DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE thoughts ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', tags), 'B') ||
+    setweight(to_tsvector('simple', left(content, 250000)), 'D')
+) STORED;
+CREATE INDEX IF NOT EXISTS thoughts_search ON thoughts USING GIN (search_vector);
@@ -0,0 +1,2 @@
+ALTER TABLE bookmarks DROP COLUMN last_modified;
+ALTER TABLE bookmarks DROP COLUMN etag;
@@ -0,0 +1,5 @@
+-- The ETag and Last-Modified headers of the page of a bookmark, sent along
+-- when fetching it again so unchanged pages are not downloaded twice.
+
+ALTER TABLE bookmarks ADD COLUMN etag TEXT NOT NULL DEFAULT '';
+ALTER TABLE bookmarks ADD COLUMN last_modified TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE feeds DROP COLUMN refresh_interval;
@@ -0,0 +1,6 @@
+-- The number of times in a row a feed could not be refreshed, the last error
+-- and when it happened, so broken feeds are refreshed less often.
+
+ALTER TABLE feeds ADD COLUMN error_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feeds ADD COLUMN last_error TEXT NOT NULL DEFAULT '';
+ALTER TABLE feeds ADD COLUMN failed TIMESTAMPTZ;
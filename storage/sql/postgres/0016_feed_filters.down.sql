@@ -0,0 +1 @@
+ALTER TABLE feeds DROP COLUMN filters;
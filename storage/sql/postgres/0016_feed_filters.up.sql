@@ -0,0 +1,3 @@
+-- The rules that decide which items of a feed are kept when it is refreshed.
+
+ALTER TABLE feeds ADD COLUMN filters JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,4 @@
+-- The GUIDs of the entries of a feed that were seen before, so entries that
+-- were edited or published again are not added as new items.
+
+ALTER TABLE feeds ADD COLUMN seen JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,16 @@
+-- Jobs of the background queue that outlive the process, like the pending
+-- jobs saved when the server stops.
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id TEXT PRIMARY KEY,
+    key TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL DEFAULT '',
+    priority INTEGER NOT NULL DEFAULT 0,
+    state TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL,
+    run_at TIMESTAMPTZ NOT NULL,
+    finished TIMESTAMPTZ NOT NULL
+);
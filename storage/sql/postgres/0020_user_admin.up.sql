@@ -0,0 +1,4 @@
+-- Admins may use the admin endpoints, like backups and maintenance. Users
+-- that existed before are not admins.
+
+ALTER TABLE users ADD COLUMN admin BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS items_fts_sync ON feeds;
+DROP FUNCTION IF EXISTS items_fts_sync();
+DROP TABLE IF EXISTS items_fts;
@@ -0,0 +1,38 @@
+-- Feed items are searched like bookmarks, matches in the title over those in
+-- the url and those over matches in the content. Items are kept in the items
+-- column of their feed, so a trigger copies them into items_fts whenever the
+-- items of a feed change.
+
+CREATE TABLE IF NOT EXISTS items_fts (
+    feed_id TEXT NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    item_id TEXT NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    content TEXT NOT NULL,
+    search_vector TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('simple', title), 'A') ||
+        setweight(to_tsvector('simple', url), 'C') ||
+        setweight(to_tsvector('simple', left(content, 250000)), 'D')
+    ) STORED
+);
+
+CREATE INDEX IF NOT EXISTS items_fts_feed_id ON items_fts (feed_id);
+CREATE INDEX IF NOT EXISTS items_search ON items_fts USING GIN (search_vector);
+
+CREATE OR REPLACE FUNCTION items_fts_sync() RETURNS trigger AS $$
+BEGIN
+    DELETE FROM items_fts WHERE feed_id = NEW.id;
+    INSERT INTO items_fts (feed_id, item_id, title, url, content)
+    SELECT NEW.id, COALESCE(value ->> 'ID', ''), COALESCE(value ->> 'Title', ''), COALESCE(value ->> 'URL', ''), COALESCE(value ->> 'Content', '')
+    FROM jsonb_array_elements(NEW.items);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS items_fts_sync ON feeds;
+CREATE TRIGGER items_fts_sync AFTER INSERT OR UPDATE OF items ON feeds
+FOR EACH ROW EXECUTE FUNCTION items_fts_sync();
+
+INSERT INTO items_fts (feed_id, item_id, title, url, content)
+SELECT feeds.id, COALESCE(value ->> 'ID', ''), COALESCE(value ->> 'Title', ''), COALESCE(value ->> 'URL', ''), COALESCE(value ->> 'Content', '')
+FROM feeds, jsonb_array_elements(feeds.items);
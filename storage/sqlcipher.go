@@ -0,0 +1,65 @@
+//go:build sqlcipher
+// +build sqlcipher
+
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strings"
+
+	sqlite3 "github.com/mutecomm/go-sqlcipher/v4"
+	"github.com/nrocco/qb"
+)
+
+// encryptedConnector opens connections to a SQLCipher database with the hook of its driver, which
+// applies the pragmas to every connection
+type encryptedConnector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+func (connector *encryptedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return connector.driver.Open(connector.dsn)
+}
+
+func (connector *encryptedConnector) Driver() driver.Driver {
+	return connector.driver
+}
+
+// openEncrypted opens the SQLCipher database at path, unlocking every connection with key before
+// the pragmas are applied to it
+func openEncrypted(ctx context.Context, path string, key string, pragmas map[string]string) (*qb.DB, error) {
+	// The driver sets the key as soon as it opens a connection, before it reads the database. It
+	// quotes the key with double quotes but does not escape them.
+	dsn := path + "?" + url.Values{"_pragma_key": {strings.ReplaceAll(key, `"`, `""`)}}.Encode()
+
+	connector := &encryptedConnector{dsn: dsn, driver: &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for name, value := range pragmas {
+				if value == "" {
+					continue
+				}
+
+				if _, err := conn.Exec("PRAGMA "+name+" = "+value, nil); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}}
+
+	db := sql.OpenDB(connector)
+
+	// SQLCipher only notices a wrong key once the database is read
+	if _, err := db.ExecContext(ctx, "SELECT COUNT(*) FROM sqlite_master"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: %s", ErrInvalidKey, err)
+	}
+
+	return &qb.DB{DB: db}, nil
+}
@@ -0,0 +1,15 @@
+//go:build !sqlcipher
+// +build !sqlcipher
+
+package storage
+
+import (
+	"context"
+
+	"github.com/nrocco/qb"
+)
+
+// openEncrypted needs the cgo SQLCipher driver, the pure go sqlite driver can not encrypt
+func openEncrypted(ctx context.Context, path string, key string, pragmas map[string]string) (*qb.DB, error) {
+	return nil, ErrEncryptionUnsupported
+}
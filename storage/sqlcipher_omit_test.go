@@ -0,0 +1,25 @@
+//go:build !sqlcipher
+// +build !sqlcipher
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncryptionUnsupported(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if _, err := NewWithKey(context.Background(), filepath.Join(tmpDir, "data.db"), "secret", nil); !errors.Is(err, ErrEncryptionUnsupported) {
+		t.Fatalf("Expected ErrEncryptionUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+//go:build sqlcipher
+// +build sqlcipher
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEncrypted(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := context.Background()
+	path := filepath.Join(tmpDir, "data.db")
+
+	store, err := NewWithKey(ctx, path, `it's a "secret"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	store.Close()
+
+	if isSQLite(path) {
+		t.Fatal("Expected the database to be encrypted")
+	}
+
+	if _, err := NewWithKey(ctx, path, "wrong", nil); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Expected ErrInvalidKey, got %v", err)
+	}
+
+	store, err = NewWithKey(ctx, path, `it's a "secret"`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{}); totalCount != 1 {
+		t.Fatalf("Expected 1 thought, got %d", totalCount)
+	}
+}
+
+func TestEncryptedBackup(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := context.Background()
+
+	store, err := NewWithKey(ctx, filepath.Join(tmpDir, "data.db"), "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Before the backup"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(tmpDir, "backup.db")
+	if err := store.Backup(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if isSQLite(path) {
+		t.Fatal("Expected the backup to be encrypted")
+	}
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "After the backup"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Restore(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{}); totalCount != 1 {
+		t.Fatalf("Expected 1 thought after restoring, got %d", totalCount)
+	}
+}
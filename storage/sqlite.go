@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nrocco/qb"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// ftsMergePages limits how much work a single merge of a full text search index does
+	ftsMergePages = 500
+)
+
+var (
+	ftsTables = []string{"bookmarks_fts", "feeds_fts", "thoughts_fts", "items_fts"}
+)
+
+// sqliteDialect stores everything in a single sqlite database file, with fts5 tables for full
+// text search that are kept in sync by triggers
+type sqliteDialect struct{}
+
+func (sqliteDialect) migrations() string {
+	return "sql"
+}
+
+func (sqliteDialect) schemaMigrations() string {
+	return "CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied DATE NOT NULL)"
+}
+
+func (sqliteDialect) search(query *qb.SelectQuery, table string, text string) {
+	query.Join("JOIN (SELECT rowid, rank FROM " + table + "_fts(?)) AS search")
+	query.Where("search.rowid = "+table+".rowid", ftsQuery(text))
+}
+
+func (sqliteDialect) searchItems(query *qb.SelectQuery, text string) {
+	query.Join("JOIN (SELECT feed_id, item_id, rank FROM items_fts(?)) AS search")
+	query.Where("search.feed_id = feeds.id AND search.item_id = json_extract(json_each.value, '$.ID')", ftsQuery(text))
+}
+
+// Times are stored as text in the local time zone, so the date and time they start with are
+// compared as julian days
+func (sqliteDialect) feedsDue(query *qb.SelectQuery, window int64, maxBackoff int, now time.Time) {
+	query.Where("julianday(substr(CASE WHEN error_count > 0 AND failed IS NOT NULL THEN failed ELSE refreshed END, 1, 19)) + (CASE WHEN refresh_interval > 0 THEN refresh_interval ELSE ? END) * (1 << min(error_count, ?)) / 86400.0 < julianday(?)", window, maxBackoff, now.Format("2006-01-02 15:04:05"))
+}
+
+func (sqliteDialect) jsonEach(array string) string {
+	return "json_each(" + array + ")"
+}
+
+func (sqliteDialect) jsonEachText(array string) string {
+	return "json_each(" + array + ")"
+}
+
+func (sqliteDialect) jsonArray(values string) string {
+	return "json_group_array(json(" + values + "))"
+}
+
+func (sqliteDialect) textArray(values string) string {
+	return "json_group_array(" + values + ")"
+}
+
+func (sqliteDialect) jsonField(object string, field string) string {
+	return "json_extract(" + object + ", '$." + field + "')"
+}
+
+func (d sqliteDialect) jsonFlag(object string, field string) string {
+	return d.jsonField(object, field) + " IS 1"
+}
+
+func (sqliteDialect) jsonTime(value string) string {
+	return "julianday(" + value + ")"
+}
+
+func (sqliteDialect) insertOrIgnore(insert string) string {
+	return "INSERT OR IGNORE INTO " + insert
+}
+
+func (sqliteDialect) integrityCheck(ctx context.Context, store *Store) ([]string, error) {
+	rows, err := store.db.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	problems := []string{}
+
+	for rows.Next() {
+		var message string
+		if err := rows.Scan(&message); err != nil {
+			return nil, err
+		}
+
+		if message != "ok" {
+			problems = append(problems, message)
+		}
+	}
+
+	return problems, rows.Err()
+}
+
+func (sqliteDialect) ftsCheck(ctx context.Context, store *Store, repair bool) ([]string, error) {
+	drifted := []string{}
+
+	for _, table := range ftsTables {
+		// With a rank of 1 the index is compared to the contents of its content table
+		if _, err := store.exec(ctx, "INSERT INTO "+table+"("+table+", rank) VALUES('integrity-check', 1)"); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("table", table).Msg("Full text search index is out of sync")
+			drifted = append(drifted, table)
+
+			if repair {
+				if _, err := store.exec(ctx, "INSERT INTO "+table+"("+table+") VALUES('rebuild')"); err != nil {
+					return drifted, err
+				}
+			}
+		}
+	}
+
+	return drifted, nil
+}
+
+func (sqliteDialect) ftsCommand(ctx context.Context, store *Store, command string) error {
+	for _, table := range ftsTables {
+		if _, err := store.db.ExecContext(ctx, "INSERT INTO "+table+"("+table+") VALUES(?)", command); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("table", table).Str("command", command).Msg("Error maintaining full text search index")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sqliteDialect) optimize(ctx context.Context, store *Store) error {
+	for _, statement := range []string{"PRAGMA optimize", "PRAGMA incremental_vacuum"} {
+		if _, err := store.db.ExecContext(ctx, statement); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("statement", statement).Msg("Error optimizing the database")
+			return err
+		}
+	}
+
+	for _, table := range ftsTables {
+		if _, err := store.db.ExecContext(ctx, "INSERT INTO "+table+"("+table+", rank) VALUES('merge', ?)", ftsMergePages); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("table", table).Msg("Error merging full text search index")
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (sqliteDialect) sizes(ctx context.Context, store *Store, stats *Stats) error {
+	if info, err := os.Stat(store.path); err == nil {
+		stats.FileSize = info.Size()
+	}
+
+	if info, err := os.Stat(store.path + "-wal"); err == nil {
+		stats.WALSize = info.Size()
+	}
+
+	if err := store.db.QueryRowContext(ctx, "SELECT freelist_count * page_size FROM pragma_freelist_count, pragma_page_size").Scan(&stats.FreeSize); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error measuring free pages")
+		return err
+	}
+
+	for _, table := range ftsTables {
+		size := int64(0)
+		if err := store.db.Select(ctx).From(table + "_data").Columns("COALESCE(SUM(length(block)), 0)").LoadValue(&size); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("table", table).Msg("Error measuring full text search index")
+			return err
+		}
+		stats.FTSSize += size
+	}
+
+	return nil
+}
+
+// ftsQuery turns every word of search into a prefix query for full text search, so partial
+// words match and characters with a special meaning to fts5 cannot cause a syntax error
+func ftsQuery(search string) string {
+	terms := []string{}
+
+	for _, word := range strings.Fields(search) {
+		terms = append(terms, "\""+strings.ReplaceAll(word, "\"", "\"\"")+"\"*")
+	}
+
+	return strings.Join(terms, " ")
+}
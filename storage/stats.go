@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// largestRowsLimit is the number of rows Stats reports as the largest ones
+	largestRowsLimit = 10
+)
+
+// Stats describes how large the database is and what takes up the space. The write ahead log and
+// free pages of a PostgreSQL database are not reported.
+type Stats struct {
+	Tables      []*TableStats
+	FileSize    int64
+	WALSize     int64
+	FreeSize    int64
+	FTSSize     int64
+	LargestRows []*RowSize
+}
+
+// TableStats counts the rows of a table, including the deleted ones that are not purged yet
+type TableStats struct {
+	Name    string
+	Rows    int64
+	Deleted int64
+}
+
+// RowSize reports the size of the text and json stored in a single bookmark, feed or thought
+type RowSize struct {
+	Table string
+	ID    string
+	Title string
+	Size  int64
+}
+
+// Stats reports the number of rows per table, the size of the database, its write ahead log, free
+// pages and full text search indexes and the largest bookmarks, feeds and thoughts
+func (store *Store) Stats(ctx context.Context) (*Stats, error) {
+	ctx, span := store.start(ctx, "Store.Stats")
+	defer span.End()
+
+	stats := &Stats{Tables: []*TableStats{}, LargestRows: []*RowSize{}}
+
+	for _, table := range []string{"bookmarks", "feeds", "thoughts"} {
+		tableStats := &TableStats{Name: table}
+		if err := store.db.Select(ctx).From(table).Columns(`COUNT(*) AS "rows"`, "COUNT(deleted_at) AS deleted").LoadValue(tableStats); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("table", table).Msg("Error counting rows")
+			return nil, err
+		}
+		stats.Tables = append(stats.Tables, tableStats)
+	}
+
+	tags := &TableStats{Name: "tags"}
+	if err := store.db.Select(ctx).From("tags").Columns(`COUNT(*) AS "rows"`).LoadValue(tags); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("table", "tags").Msg("Error counting rows")
+		return nil, err
+	}
+	stats.Tables = append(stats.Tables, tags)
+
+	if err := store.dialect.sizes(ctx, store, stats); err != nil {
+		return nil, err
+	}
+
+	sizes := "SELECT 'bookmarks' AS \"table\", id, title, length(title) + length(url) + length(excerpt) + length(content) + length(CAST(tags AS TEXT)) AS size FROM bookmarks" +
+		" UNION ALL SELECT 'feeds', id, title, length(title) + length(url) + length(CAST(items AS TEXT)) + length(CAST(tags AS TEXT)) FROM feeds" +
+		" UNION ALL SELECT 'thoughts', id, substr(content, 1, 80), length(content) + length(CAST(tags AS TEXT)) FROM thoughts"
+
+	query := store.db.Select(ctx).From("(" + sizes + ") AS sizes")
+	query.OrderBy("size", "DESC")
+	query.Limit(largestRowsLimit)
+
+	if _, err := query.Load(&stats.LargestRows); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error finding the largest rows")
+		return nil, err
+	}
+
+	return stats, nil
+}
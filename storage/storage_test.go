@@ -1,11 +1,26 @@
 package storage
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/nrocco/bookmarks/queue"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestNewGood(t *testing.T) {
@@ -41,3 +56,2168 @@ func TestNewCannotCreateDatabase(t *testing.T) {
 		t.Fatal("This should have failed, but it did not")
 	}
 }
+
+func TestCursor(t *testing.T) {
+	created := time.Date(2021, 7, 1, 12, 30, 0, 123456789, time.UTC)
+
+	cursor, err := ParseCursor(NewCursor(created, "abc123"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cursor.Created.Equal(created) || cursor.ID != "abc123" {
+		t.Fatalf("Unexpected cursor %v", cursor)
+	}
+
+	if _, err := ParseCursor("not a cursor"); err != ErrInvalidCursor {
+		t.Fatalf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestFeedItemListCursor(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		feed := &Feed{URL: "https://example.com/feed.xml", Items: FeedItems{
+			{ID: "1", Title: "First", Date: now.Add(-time.Hour)},
+			{ID: "2", Title: "Second", Date: now.Add(-time.Hour).In(time.FixedZone("CET", 3600))},
+			{ID: "3", Title: "Third", Date: now},
+		}}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := ""
+		cursor := ""
+		for page := 0; page < 3; page++ {
+			items, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Cursor: cursor, Limit: 1})
+			if totalCount != 3 || len(*items) != 1 {
+				t.Fatalf("%s: Expected 1 of 3 items on page %d, got %d of %d", name, page, len(*items), totalCount)
+			}
+
+			last := (*items)[0].Item
+			ids += last.ID
+			cursor = NewCursor(last.Date, last.ID)
+		}
+
+		if ids != "321" {
+			t.Fatalf("%s: Expected the newest items first and the same date ordered by ID, got %s", name, ids)
+		}
+
+		if items, _ := store.FeedItemList(ctx, &FeedItemListOptions{Cursor: cursor, Limit: 1}); len(*items) != 0 {
+			t.Fatalf("%s: Expected no items after the last one", name)
+		}
+
+		if err := store.FeedDelete(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Limit: 1}); totalCount != 0 {
+			t.Fatalf("%s: Expected the items of deleted feeds to be left out, got %d", name, totalCount)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	sort, err := ParseSort("-created, title", BookmarkSortFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sort) != 2 || sort[0] != (SortField{"created", true}) || sort[1] != (SortField{"title", false}) {
+		t.Fatalf("Unexpected sort %v", sort)
+	}
+
+	if _, err := ParseSort("content", BookmarkSortFields); err == nil {
+		t.Fatal("Sorting on content should not be allowed")
+	}
+}
+
+func newTestStore(t *testing.T) *Store {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(tmpDir) })
+
+	store, err := New(context.Background(), filepath.Join(tmpDir, "data.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestImport(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Title: "Example", Tags: Tags{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	document := &Document{
+		Bookmarks: []*Bookmark{
+			{URL: "https://example.com", Tags: Tags{"b"}},
+			{ID: "0123456789abcdef", URL: "https://example.org", Title: "Other"},
+		},
+		Thoughts: []*Thought{
+			{Content: "Hello", Tags: Tags{"c"}},
+		},
+	}
+
+	result, err := store.Import(ctx, document, ImportMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Created != 2 || result.Updated != 1 || result.Skipped != 0 {
+		t.Fatalf("Unexpected result %v", result)
+	}
+
+	bookmark := Bookmark{URL: "https://example.com"}
+	if err := store.BookmarkGet(ctx, &bookmark); err != nil {
+		t.Fatal(err)
+	}
+
+	if bookmark.Title != "Example" || len(bookmark.Tags) != 2 {
+		t.Fatalf("Bookmark was not merged: %v", bookmark)
+	}
+
+	imported := Bookmark{ID: "0123456789abcdef"}
+	if err := store.BookmarkGet(ctx, &imported); err != nil {
+		t.Fatal("Imported bookmark should keep its ID")
+	}
+
+	if _, err := store.Import(ctx, document, ImportStrategy("unknown")); err != ErrInvalidImportStrategy {
+		t.Fatalf("Expected ErrInvalidImportStrategy, got %v", err)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Title: "Example"}); err != nil {
+		t.Fatal(err)
+	}
+
+	document := &Document{
+		Bookmarks: []*Bookmark{
+			{URL: "https://example.com"},
+			{URL: "https://example.org"},
+			{URL: "https://example.org"},
+		},
+		Feeds: []*Feed{
+			{URL: "https://example.org/feed"},
+		},
+	}
+
+	result, err := store.ImportDryRun(ctx, document, ImportMerge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.DryRun || result.Created != 2 || result.Updated != 2 || len(result.Records) != 4 {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	if record := result.Records[2]; record.Kind != "bookmark" || record.Key != "https://example.org" || record.Action != "merge" {
+		t.Fatalf("Expected the second example.org to be merged into the first, got %+v", record)
+	}
+
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{}); totalCount != 1 {
+		t.Fatalf("Expected the dry run to write nothing, got %d bookmarks", totalCount)
+	}
+
+	if _, totalCount := store.FeedList(ctx, &FeedListOptions{}); totalCount != 0 {
+		t.Fatalf("Expected the dry run to write nothing, got %d feeds", totalCount)
+	}
+}
+
+func TestExport(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Title: "Example", Content: "Everything", Tags: Tags{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/feed", Items: FeedItems{{ID: "1", Title: "Item"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted := &Thought{Content: "Deleted"}
+	for _, thought := range []*Thought{{Content: "Hello"}, deleted} {
+		if err := store.ThoughtPersist(ctx, thought); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.ThoughtDelete(ctx, deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.Buffer{}
+	written, err := store.ExportTo(ctx, &buf, map[string]string{"Level": "debug"})
+	if err != nil || written != int64(buf.Len()) {
+		t.Fatalf("Expected the export to be written, got %d bytes and %v", written, err)
+	}
+
+	document := Document{}
+	if err := json.Unmarshal(buf.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(document.Bookmarks) != 1 || document.Bookmarks[0].Content != "Everything" || len(document.Feeds) != 1 || len(document.Feeds[0].Items) != 1 || len(document.Thoughts) != 1 {
+		t.Fatalf("Expected all records that are not deleted, got %s", buf.String())
+	}
+
+	if len(document.Tags) != 1 || *document.Tags[0] != (Tag{Name: "a", Bookmarks: 1}) || string(document.Settings) != `{"Level":"debug"}` {
+		t.Fatalf("Expected the tags and settings, got %s", buf.String())
+	}
+
+	other := newTestStore(t)
+	if result, err := other.Import(ctx, &document, ImportSkip); err != nil || result.Created != 3 {
+		t.Fatalf("Expected the export to be imported, got %v", err)
+	}
+
+	exported := buf.String()
+	buf.Reset()
+	if _, err := other.ExportTo(ctx, &buf, document.Settings); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := Document{}
+	if err := json.Unmarshal(buf.Bytes(), &imported); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(imported.Bookmarks) != 1 || imported.Bookmarks[0].ID != document.Bookmarks[0].ID || len(imported.Feeds) != 1 || len(imported.Thoughts) != 1 || len(imported.Tags) != 1 || *imported.Tags[0] != *document.Tags[0] || string(imported.Settings) != string(document.Settings) {
+		t.Fatalf("Expected the import to export the same document, got %s and %s", exported, buf.String())
+	}
+
+	buf.Reset()
+	if _, err := store.ExportNetscapeTo(ctx, &buf); err != nil || !strings.Contains(buf.String(), `<DT><A HREF="https://example.com" ADD_DATE=`) || !strings.Contains(buf.String(), `TAGS="a">Example</A>`) {
+		t.Fatalf("Expected the bookmarks in a Netscape bookmark file, got %s", buf.String())
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Hello", Tags: Tags{"a", "", "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cleaned, err := store.Cleanup(ctx); err != nil || cleaned != 1 {
+		t.Fatalf("Expected 1 cleaned record, got %d (%v)", cleaned, err)
+	}
+
+	if err := store.RebuildFTS(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.OptimizeFTS(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Optimize(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Vacuum(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err := store.IntegrityCheck(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v (%v)", problems, err)
+	}
+}
+
+func TestStats(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	thought := &Thought{Content: "A rather long thought"}
+	if err := store.ThoughtPersist(ctx, thought); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ThoughtDelete(ctx, thought); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Tags: Tags{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := store.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int64{}
+	for _, table := range stats.Tables {
+		counts[table.Name] = table.Rows - table.Deleted
+	}
+
+	if counts["bookmarks"] != 1 || counts["thoughts"] != 0 || counts["tags"] != 1 {
+		t.Fatalf("Expected 1 bookmark, no thoughts and 1 tag, got %v", counts)
+	}
+
+	if stats.FileSize == 0 || stats.FTSSize == 0 {
+		t.Fatalf("Expected the database and full text search indexes to take up space, got %d and %d", stats.FileSize, stats.FTSSize)
+	}
+
+	if len(stats.LargestRows) != 2 || stats.LargestRows[0].Table != "bookmarks" {
+		t.Fatalf("Expected the bookmark to be the largest row, got %d rows", len(stats.LargestRows))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Title: "Example", Tags: Tags{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if result, err := store.Check(ctx, false); err != nil || !result.Ok() {
+		t.Fatalf("Expected no problems, got %v", err)
+	}
+
+	for _, statement := range []string{
+		"INSERT INTO bookmarks_fts(bookmarks_fts, rowid, title, url, content, tags) SELECT 'delete', rowid, title, url, content, tags FROM bookmarks",
+		"DELETE FROM bookmarks_tags",
+		"INSERT INTO thoughts_tags(thought_id, tag_id) VALUES('missing', 1)",
+	} {
+		if _, err := store.db.ExecContext(ctx, statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := store.Check(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.FTS) != 1 || result.Orphans["bookmarks with tags missing from bookmarks_tags"] != 1 || result.Orphans["thoughts_tags referencing a missing record or tag"] != 1 || !result.Repaired {
+		t.Fatalf("Expected the drifted index and orphans to be repaired, got %v and %v", result.FTS, result.Orphans)
+	}
+
+	if result, err := store.Check(ctx, false); err != nil || !result.Ok() {
+		t.Fatalf("Expected no problems after repairing, got %v and %v", result.FTS, result.Orphans)
+	}
+
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Search: "example", Tags: Tags{"go"}}); totalCount != 1 {
+		t.Fatalf("Expected the bookmark to be found again, got %d", totalCount)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	migrations, err := store.Migrations(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, migration := range migrations {
+		if migration.Applied.IsZero() {
+			t.Fatalf("Expected migration %d_%s to be applied", migration.Version, migration.Name)
+		}
+	}
+
+	if err := store.MigrationsApplied(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.MigrateDown(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrations, _ = store.Migrations(ctx); !migrations[len(migrations)-1].Applied.IsZero() {
+		t.Fatal("Expected the last migration to be reverted")
+	}
+
+	if err := store.MigrationsApplied(ctx); err == nil {
+		t.Fatal("Expected an error while the last migration is reverted")
+	}
+
+	if err := store.MigrateUp(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if migrations, _ = store.Migrations(ctx); migrations[len(migrations)-1].Applied.IsZero() {
+		t.Fatal("Expected the last migration to be applied again")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		expected string
+	}{
+		{"SELECT * FROM bookmarks", "SELECT * FROM bookmarks"},
+		{"SELECT * FROM bookmarks WHERE id = ? AND url = ?", "SELECT * FROM bookmarks WHERE id = $1 AND url = $2"},
+		{"SELECT '?', \"?\" FROM bookmarks WHERE id = ?", "SELECT '?', \"?\" FROM bookmarks WHERE id = $1"},
+		{"SELECT 'it''s ?' FROM bookmarks WHERE id = ?", "SELECT 'it''s ?' FROM bookmarks WHERE id = $1"},
+		{"SELECT * FROM bookmarks -- why?\nWHERE id = ?", "SELECT * FROM bookmarks -- why?\nWHERE id = $1"},
+		{"SELECT * FROM bookmarks /* why? */ WHERE id = ?", "SELECT * FROM bookmarks /* why? */ WHERE id = $1"},
+		{"SELECT $$?$$, $tag$'?$tag$ FROM bookmarks WHERE id = ?", "SELECT $$?$$, $tag$'?$tag$ FROM bookmarks WHERE id = $1"},
+		{"SELECT * FROM bookmarks WHERE id = ? -- unterminated?", "SELECT * FROM bookmarks WHERE id = $1 -- unterminated?"},
+		{"SELECT 'unterminated ?", "SELECT 'unterminated ?"},
+		{"SELECT ? - ?", "SELECT $1 - $2"},
+	} {
+		if rebound := rebind(test.query); rebound != test.expected {
+			t.Fatalf("Expected %s, got %s", test.expected, rebound)
+		}
+	}
+}
+
+func TestTSQuery(t *testing.T) {
+	for _, test := range []struct {
+		search   string
+		expected string
+	}{
+		{"", ""},
+		{"go", "'go':*"},
+		{" go  sql ", "'go':* & 'sql':*"},
+		{"it's", "'it''s':*"},
+		{`a\b`, `'a\\b':*`},
+		{"!go | (sql) & <->", "'!go':* & '|':* & '(sql)':* & '&':* & '<->':*"},
+	} {
+		if query := tsQuery(test.search); query != test.expected {
+			t.Fatalf("Expected %s for %s, got %s", test.expected, test.search, query)
+		}
+	}
+}
+
+func TestPostgresMigrations(t *testing.T) {
+	sqlite, err := loadMigrations(sqliteDialect{}.migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	postgres, err := loadMigrations(postgresDialect{}.migrations())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("Expected %d PostgreSQL migrations, got %d", len(sqlite), len(postgres))
+	}
+
+	for i, migration := range postgres {
+		if migration.Version != sqlite[i].Version || migration.Name != sqlite[i].Name || migration.up == "" || migration.down == "" {
+			t.Fatalf("Expected PostgreSQL migration %d_%s to mirror %d_%s", migration.Version, migration.Name, sqlite[i].Version, sqlite[i].Name)
+		}
+	}
+}
+
+// newPostgresTestStore opens the empty PostgreSQL database in BOOKMARKS_TEST_POSTGRES, like
+// postgres://bookmarks@localhost/bookmarks_test, and reverts all migrations afterwards
+func newPostgresTestStore(t *testing.T) *Store {
+	dsn := os.Getenv("BOOKMARKS_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("BOOKMARKS_TEST_POSTGRES is not set")
+	}
+
+	ctx := context.Background()
+
+	store, err := New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		migrations, _ := store.Migrations(ctx)
+		store.MigrateDown(ctx, len(migrations))
+		store.Close()
+	})
+
+	return store
+}
+
+func TestPostgres(t *testing.T) {
+	store := newPostgresTestStore(t)
+	ctx := context.Background()
+
+	if store.Path() != "" {
+		t.Fatalf("Expected no path, got %s", store.Path())
+	}
+
+	bookmark := &Bookmark{URL: "https://example.com", Title: "Go databases", Content: "Working with PostgreSQL", Tags: Tags{"go", "sql"}}
+	if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+		t.Fatal(err)
+	}
+
+	if bookmarks, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Search: "postgres", Limit: 10}); totalCount != 1 || (*bookmarks)[0].ID != bookmark.ID {
+		t.Fatalf("Expected to find the bookmark by a word, got %d", totalCount)
+	}
+
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Tags: Tags{"sql", "-python"}, Limit: 10}); totalCount != 1 {
+		t.Fatalf("Expected to find the bookmark by its tag, got %d", totalCount)
+	}
+
+	numbered := &Bookmark{}
+	if err := store.BookmarkGetNumber(ctx, store.BookmarkNumbers(ctx, []*Bookmark{bookmark})[bookmark.ID], numbered); err != nil || numbered.ID != bookmark.ID {
+		t.Fatalf("Expected to find the bookmark by its number, got %v", err)
+	}
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Hello", Tags: Tags{"a", "", "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cleaned, err := store.Cleanup(ctx); err != nil || cleaned != 1 {
+		t.Fatalf("Expected 1 cleaned record, got %d (%v)", cleaned, err)
+	}
+
+	if tags := store.ThoughtTagList(ctx); len(*tags) != 1 || (*tags)[0] != "a" {
+		t.Fatalf("Expected the cleaned up tags, got %v", *tags)
+	}
+
+	if renamed, err := store.TagRename(ctx, "sql", "a"); err != nil || renamed != 1 {
+		t.Fatalf("Expected 1 renamed record, got %d (%v)", renamed, err)
+	}
+
+	if tags := store.TagList(ctx); len(*tags) != 2 || (*tags)[0].Name != "a" || (*tags)[0].Bookmarks != 1 || (*tags)[0].Thoughts != 1 {
+		t.Fatalf("Expected the renamed tag to be merged, got %d tags", len(*tags))
+	}
+
+	if err := store.BookmarkDelete(ctx, bookmark); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.BookmarkRestore(ctx, bookmark); err != nil || bookmark.DeletedAt.Valid {
+		t.Fatalf("Expected the bookmark to be restored, got %v", err)
+	}
+
+	if purged, err := store.Purge(ctx, time.Now()); err != nil || purged != 0 {
+		t.Fatalf("Expected nothing to purge, got %d (%v)", purged, err)
+	}
+
+	if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/feed.xml", Title: "Example", Items: FeedItems{
+		{ID: "1", Title: "Older", Date: time.Now().Add(-time.Hour).In(time.FixedZone("CET", 3600))},
+		{ID: "2", Title: "Newer", Date: time.Now()},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, totalCount := store.FeedList(ctx, &FeedListOptions{Search: "exam feed"}); totalCount != 1 {
+		t.Fatalf("Expected to find the feed by the start of its words, got %d", totalCount)
+	}
+
+	if items, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Limit: 1}); totalCount != 2 || (*items)[0].Item.ID != "2" {
+		t.Fatalf("Expected the newest of 2 items first, got %d", totalCount)
+	}
+
+	if read, err := store.FeedRead(ctx, &FeedReadOptions{Before: time.Now().Add(-30 * time.Minute)}); err != nil || read != 1 {
+		t.Fatalf("Expected the older item of 1 feed to be read, got %d (%v)", read, err)
+	}
+
+	if items, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Limit: 10}); totalCount != 1 || (*items)[0].Item.ID != "2" {
+		t.Fatalf("Expected the newer item to be left, got %d", totalCount)
+	}
+
+	for _, maintain := range []func(context.Context) error{store.OptimizeFTS, store.RebuildFTS, store.Optimize, store.Vacuum} {
+		if err := maintain(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if problems, err := store.IntegrityCheck(ctx); err != nil || len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v (%v)", problems, err)
+	}
+
+	if err := store.FollowerPersist(ctx, &Follower{ID: "https://example.com/users/alice", Inbox: "https://example.com/inbox"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if followers := store.FollowerList(ctx); len(*followers) != 1 {
+		t.Fatalf("Expected 1 follower, got %d", len(*followers))
+	}
+
+	user := &User{Username: "alice"}
+	token := user.NewToken()
+	if err := store.UserPersist(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	if found, err := store.UserByToken(ctx, token); err != nil || found.ID != user.ID {
+		t.Fatalf("Expected the token of alice to authenticate, got %v", err)
+	}
+
+	if result, err := store.Check(ctx, true); err != nil || !result.Ok() {
+		t.Fatalf("Expected no drift, got %v (%v)", result, err)
+	}
+
+	if stats, err := store.Stats(ctx); err != nil || stats.FileSize == 0 || len(stats.LargestRows) != 3 {
+		t.Fatalf("Expected the size of the database and 3 rows, got %v", err)
+	}
+
+	// A match in the title outweighs a match in the content
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/postgres", Title: "PostgreSQL", Content: "Tuning"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if bookmarks, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Search: "postgres", Limit: 10}); totalCount != 2 || (*bookmarks)[0].URL != "https://example.com/postgres" {
+		t.Fatalf("Expected the match in the title first, got %d", totalCount)
+	}
+
+	if _, err := store.DiskFree(); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported, got %v", err)
+	}
+
+	if _, err := NewWithKey(ctx, os.Getenv("BOOKMARKS_TEST_POSTGRES"), "secret", nil); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("Expected ErrUnsupported for a database key, got %v", err)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(filepath.Dir(store.Path()), "backup.db")
+	if err := store.Backup(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	backup, err := New(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+
+	if _, totalCount := backup.ThoughtList(ctx, &ThoughtListOptions{}); totalCount != 1 {
+		t.Fatalf("Expected 1 thought in the backup, got %d", totalCount)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Before the backup"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(filepath.Dir(store.Path()), "backup.db")
+	if err := store.Backup(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "After the backup"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Restore(ctx, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{}); totalCount != 1 {
+		t.Fatalf("Expected 1 thought after restoring, got %d", totalCount)
+	}
+
+	invalid := filepath.Join(filepath.Dir(store.Path()), "invalid.db")
+	ioutil.WriteFile(invalid, []byte("not a database"), 0644)
+
+	if err := store.Restore(ctx, invalid); !errors.Is(err, ErrInvalidBackup) {
+		t.Fatalf("Expected ErrInvalidBackup, got %v", err)
+	}
+}
+
+func TestPragmas(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ctx := context.Background()
+
+	store, err := NewWithPragmas(ctx, filepath.Join(tmpDir, "data.db"), map[string]string{"busy_timeout": "1234"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	journalMode := ""
+	if err := store.db.QueryRowContext(ctx, "PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Fatalf("Expected journal mode wal, got %s (%v)", journalMode, err)
+	}
+
+	busyTimeout := 0
+	if err := store.db.QueryRowContext(ctx, "PRAGMA busy_timeout").Scan(&busyTimeout); err != nil || busyTimeout != 1234 {
+		t.Fatalf("Expected busy timeout 1234, got %d (%v)", busyTimeout, err)
+	}
+}
+
+func TestTags(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Title: "Example", Tags: Tags{"go", "web"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/feed", Tags: Tags{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Hello", Tags: Tags{"golang"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Tags: Tags{"go", "-web"}}); totalCount != 0 {
+		t.Fatalf("Expected no bookmarks, got %d", totalCount)
+	}
+
+	if _, totalCount := store.FeedList(ctx, &FeedListOptions{Tags: Tags{"go"}}); totalCount != 1 {
+		t.Fatalf("Expected 1 feed, got %d", totalCount)
+	}
+
+	tags := *store.TagList(ctx)
+	if len(tags) != 3 || tags[0].Name != "go" || tags[0].Bookmarks != 1 || tags[0].Feeds != 1 {
+		t.Fatalf("Unexpected tags %v", tags)
+	}
+
+	if renamed, err := store.TagRename(ctx, "golang", "go"); err != nil || renamed != 1 {
+		t.Fatalf("Expected 1 renamed record, got %d (%v)", renamed, err)
+	}
+
+	if _, err := store.TagRename(ctx, "golang", "go"); err != ErrNotExistingTag {
+		t.Fatalf("Expected ErrNotExistingTag, got %v", err)
+	}
+
+	if thoughts, _ := store.ThoughtList(ctx, &ThoughtListOptions{Tags: Tags{"go"}, Limit: 10}); len(*thoughts) != 1 || (*thoughts)[0].Tags[0] != "go" {
+		t.Fatalf("Expected the thought to be tagged go, got %v", *thoughts)
+	}
+
+	if tags := *store.TagList(ctx); len(tags) != 2 || tags[0].Thoughts != 1 {
+		t.Fatalf("Unexpected tags after rename %v", tags)
+	}
+}
+
+func TestStorer(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		first := &Bookmark{URL: "https://example.com", Title: "First", Tags: Tags{"a"}, Created: time.Now().Add(-time.Hour)}
+		if err := store.BookmarkPersist(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.org", Title: "Second", Tags: Tags{"a", "b"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		duplicate := &Bookmark{URL: "https://example.com", Title: "Renamed", Tags: Tags{"a"}}
+		if err := store.BookmarkPersist(ctx, duplicate); err != nil || duplicate.ID != first.ID {
+			t.Fatalf("%s: Expected the bookmark with the same URL to be updated (%v)", name, err)
+		}
+
+		bookmarks, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Tags: Tags{"a", "-b"}, Limit: 10})
+		if totalCount != 1 || (*bookmarks)[0].Title != "Renamed" {
+			t.Fatalf("%s: Expected 1 bookmark, got %d", name, totalCount)
+		}
+
+		bookmarks, totalCount = store.BookmarkList(ctx, &BookmarkListOptions{Limit: 1})
+		if totalCount != 2 || len(*bookmarks) != 1 || (*bookmarks)[0].Title != "Second" {
+			t.Fatalf("%s: Expected the newest bookmark first", name)
+		}
+
+		last := (*bookmarks)[0]
+		bookmarks, _ = store.BookmarkList(ctx, &BookmarkListOptions{Cursor: NewCursor(last.Created, last.ID), Limit: 10})
+		if len(*bookmarks) != 1 || (*bookmarks)[0].ID != first.ID {
+			t.Fatalf("%s: Expected the oldest bookmark after the cursor", name)
+		}
+
+		if err := store.BookmarkDelete(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.BookmarkGet(ctx, &Bookmark{ID: first.ID}); err == nil {
+			t.Fatalf("%s: Expected the bookmark to be deleted", name)
+		}
+
+		if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{IncludeDeleted: true}); totalCount != 2 {
+			t.Fatalf("%s: Expected 2 bookmarks including deleted ones, got %d", name, totalCount)
+		}
+
+		restored := &Bookmark{ID: first.ID}
+		if err := store.BookmarkRestore(ctx, restored); err != nil || restored.Title != "Renamed" || restored.DeletedAt.Valid {
+			t.Fatalf("%s: Expected the bookmark to be restored (%v)", name, err)
+		}
+
+		if err := store.BookmarkRestore(ctx, restored); err != ErrNotDeletedBookmark {
+			t.Fatalf("%s: Expected ErrNotDeletedBookmark, got %v", name, err)
+		}
+
+		if err := store.BookmarkDelete(ctx, first); err != nil {
+			t.Fatal(err)
+		}
+
+		thought := &Thought{Content: "Hello world", Tags: Tags{"c"}}
+		if err := store.ThoughtPersist(ctx, thought); err != nil {
+			t.Fatal(err)
+		}
+
+		if thoughts, _ := store.ThoughtList(ctx, &ThoughtListOptions{Search: "hello", Limit: 10}); len(*thoughts) != 1 {
+			t.Fatalf("%s: Expected to find the thought", name)
+		}
+
+		if renamed, err := store.TagRename(ctx, "a", "b"); err != nil || renamed != 2 {
+			t.Fatalf("%s: Expected 2 renamed records, got %d (%v)", name, renamed, err)
+		}
+
+		if tags := *store.TagList(ctx); len(tags) != 2 || tags[0].Name != "b" || tags[0].Bookmarks != 1 {
+			t.Fatalf("%s: Unexpected tags %v", name, tags)
+		}
+
+		if tags := *store.ThoughtTagList(ctx); len(tags) != 1 || tags[0] != "c" {
+			t.Fatalf("%s: Unexpected thought tags %v", name, tags)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com", Title: "Crème brûlée recipes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/feed", Title: "Programming"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "Visit the café"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, search := range []string{"creme", "brul", "rec CRÈME", "\"recipes"} {
+		if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Search: search}); totalCount != 1 {
+			t.Fatalf("Expected 1 bookmark for %s, got %d", search, totalCount)
+		}
+	}
+
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Search: "cake"}); totalCount != 0 {
+		t.Fatalf("Expected no bookmarks, got %d", totalCount)
+	}
+
+	if _, totalCount := store.FeedList(ctx, &FeedListOptions{Search: "prog"}); totalCount != 1 {
+		t.Fatalf("Expected 1 feed, got %d", totalCount)
+	}
+
+	if _, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{Search: "cafe"}); totalCount != 1 {
+		t.Fatalf("Expected 1 thought, got %d", totalCount)
+	}
+
+	for _, search := range []string{"%", "_", "cr%me", "cr_me"} {
+		if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Search: search}); totalCount != 0 {
+			t.Fatalf("Expected %s not to act as a wildcard, got %d bookmarks", search, totalCount)
+		}
+	}
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/desserts", Title: "Desserts", Content: "Recipes for cakes and crème brûlée, so many recipes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/bread", Title: "Bread", Content: "Bread recipes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, _ := store.BookmarkList(ctx, &BookmarkListOptions{Search: "creme", Limit: 10})
+	if len(*bookmarks) != 2 || (*bookmarks)[0].URL != "https://example.com" {
+		t.Fatalf("Expected the best match first, got %d bookmarks", len(*bookmarks))
+	}
+
+	// A match in the title outweighs many matches in the content
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/bakery", Title: "Bakery", Content: "Sourdough, more sourdough and even more sourdough"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/starter", Title: "Sourdough starter", Content: "Mix flour and water, wait a few days and feed it every day until it bubbles"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, _ = store.BookmarkList(ctx, &BookmarkListOptions{Search: "sourdough", Limit: 10})
+	if len(*bookmarks) != 2 || (*bookmarks)[0].URL != "https://example.com/starter" {
+		t.Fatalf("Expected the match in the title first, got %d bookmarks", len(*bookmarks))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	thought := &Thought{Content: "Hello"}
+	if err := store.ThoughtPersist(ctx, thought); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.ThoughtDelete(ctx, thought); err != nil {
+		t.Fatal(err)
+	}
+
+	if purged, err := store.Purge(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Fatalf("Expected nothing to be purged, got %d (%v)", purged, err)
+	}
+
+	if purged, err := store.Purge(ctx, time.Now()); err != nil || purged != 1 {
+		t.Fatalf("Expected 1 purged record, got %d (%v)", purged, err)
+	}
+
+	if err := store.ThoughtRestore(ctx, thought); err != ErrNotDeletedThought {
+		t.Fatalf("Expected the thought to be purged, got %v", err)
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	failed := errors.New("failed")
+
+	err := store.WithTx(ctx, func(tx *Store) error {
+		if err := tx.ThoughtPersist(ctx, &Thought{Content: "Rolled back"}); err != nil {
+			return err
+		}
+
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Expected the error of fn, got %v", err)
+	}
+
+	err = store.WithTx(ctx, func(tx *Store) error {
+		if err := tx.ThoughtPersist(ctx, &Thought{Content: "Committed"}); err != nil {
+			return err
+		}
+
+		return tx.WithTx(ctx, func(nested *Store) error {
+			return nested.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com"})
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if thoughts, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{Limit: 10}); totalCount != 1 || (*thoughts)[0].Content != "Committed" {
+		t.Fatalf("Expected only the committed thought, got %d", totalCount)
+	}
+
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{}); totalCount != 1 {
+		t.Fatalf("Expected the bookmark of the nested transaction, got %d", totalCount)
+	}
+}
+
+func TestListTotalCount(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	for _, content := range []string{"One", "Two", "Three"} {
+		if err := store.ThoughtPersist(ctx, &Thought{Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	thoughts, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{Limit: 2})
+	if len(*thoughts) != 2 || totalCount != 3 {
+		t.Fatalf("Expected 2 of 3 thoughts, got %d of %d", len(*thoughts), totalCount)
+	}
+
+	cursor := NewCursor((*thoughts)[1].Created, (*thoughts)[1].ID)
+	if thoughts, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{Cursor: cursor, Limit: 2}); len(*thoughts) != 1 || totalCount != 3 {
+		t.Fatalf("Expected the last of 3 thoughts, got %d of %d", len(*thoughts), totalCount)
+	}
+
+	if thoughts, totalCount := store.ThoughtList(ctx, &ThoughtListOptions{Limit: 2, Offset: 4}); len(*thoughts) != 0 || totalCount != 3 {
+		t.Fatalf("Expected an empty page of 3 thoughts, got %d of %d", len(*thoughts), totalCount)
+	}
+}
+
+func TestListEach(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		for i, title := range []string{"One", "Two", "Three"} {
+			created := now.Add(time.Duration(i) * time.Minute)
+			if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/" + title, Title: title, Content: "Long content", Created: created}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.ThoughtPersist(ctx, &Thought{Content: title, Created: created}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		feed := &Feed{URL: "https://example.com/feed.xml", Title: "News", Items: FeedItems{
+			{ID: "1", Title: "One", Date: now.Add(-time.Hour)},
+			{ID: "2", Title: "Two", Date: now},
+		}}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		titles := []string{}
+		if err := store.BookmarkEach(ctx, &BookmarkListOptions{Limit: -1, Offset: 1}, func(bookmark *Bookmark) error {
+			titles = append(titles, bookmark.Title+":"+bookmark.Content)
+			return nil
+		}); err != nil || strings.Join(titles, ",") != "Two:,One:" {
+			t.Fatalf("%s: Expected the bookmarks after the first without content, got %v (%v)", name, titles, err)
+		}
+
+		bookmarks, _ := store.BookmarkList(ctx, &BookmarkListOptions{Limit: 1})
+		titles = []string{}
+		if err := store.BookmarkEach(ctx, &BookmarkListOptions{Cursor: NewCursor((*bookmarks)[0].Created, (*bookmarks)[0].ID), Limit: 1}, func(bookmark *Bookmark) error {
+			titles = append(titles, bookmark.Title)
+			return nil
+		}); err != nil || strings.Join(titles, ",") != "Two" {
+			t.Fatalf("%s: Expected the bookmark after the cursor, got %v (%v)", name, titles, err)
+		}
+
+		if err := store.BookmarkEach(ctx, &BookmarkListOptions{Cursor: "invalid"}, func(bookmark *Bookmark) error { return nil }); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("%s: Expected ErrInvalidCursor, got %v", name, err)
+		}
+
+		stop := errors.New("stop")
+		count := 0
+		if err := store.ThoughtEach(ctx, &ThoughtListOptions{Limit: -1}, func(thought *Thought) error {
+			count++
+			return stop
+		}); err != stop || count != 1 {
+			t.Fatalf("%s: Expected the error of fn to stop the thoughts, got %d (%v)", name, count, err)
+		}
+
+		contents := []string{}
+		if err := store.ThoughtEach(ctx, &ThoughtListOptions{Search: "two", Limit: -1}, func(thought *Thought) error {
+			contents = append(contents, thought.Content)
+			return nil
+		}); err != nil || strings.Join(contents, ",") != "Two" {
+			t.Fatalf("%s: Expected the thought that matches the search, got %v (%v)", name, contents, err)
+		}
+
+		ids := []string{}
+		if err := store.FeedItemEach(ctx, &FeedItemListOptions{Limit: -1}, func(item *ListedFeedItem) error {
+			ids = append(ids, item.FeedTitle+":"+item.Item.ID)
+			return nil
+		}); err != nil || strings.Join(ids, ",") != "News:2,News:1" {
+			t.Fatalf("%s: Expected the newest item first, got %v (%v)", name, ids, err)
+		}
+	}
+
+	// Streamed lists are not cached
+	store := newTestStore(t)
+	store.SetCache(10, time.Minute)
+	if err := store.BookmarkEach(ctx, &BookmarkListOptions{Limit: -1}, func(bookmark *Bookmark) error { return nil }); err != nil || store.cache.recent.Len() != 0 {
+		t.Fatalf("Expected the bookmarks to bypass the cache, got %d cached (%v)", store.cache.recent.Len(), err)
+	}
+}
+
+func TestFollowers(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	if err := store.FollowerPersist(ctx, &Follower{ID: "https://example.com/users/alice"}); !errors.Is(err, ErrNoFollowerKey) {
+		t.Fatalf("Expected ErrNoFollowerKey for a follower without inbox, got %v", err)
+	}
+
+	follower := &Follower{ID: "https://example.com/users/alice", Inbox: "https://example.com/users/alice/inbox"}
+	if err := store.FollowerPersist(ctx, follower); err != nil {
+		t.Fatal(err)
+	}
+
+	follower.Inbox = "https://example.com/inbox"
+	if err := store.FollowerPersist(ctx, follower); err != nil {
+		t.Fatal(err)
+	}
+
+	if followers := *store.FollowerList(ctx); len(followers) != 1 || followers[0].Inbox != "https://example.com/inbox" {
+		t.Fatalf("Expected a single follower with the shared inbox, got %v", followers)
+	}
+
+	if err := store.FollowerDelete(ctx, follower); err != nil {
+		t.Fatal(err)
+	}
+
+	if followers := *store.FollowerList(ctx); len(followers) != 0 {
+		t.Fatalf("Expected no followers after the unfollow, got %d", len(followers))
+	}
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		if err := store.UserPersist(ctx, &User{}); !errors.Is(err, ErrNoUserKey) {
+			t.Fatalf("%s: Expected ErrNoUserKey for a user without username, got %v", name, err)
+		}
+
+		user := &User{Username: "alice"}
+		if err := user.SetPassword("secret"); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.UserPersist(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.UserPersist(ctx, &User{Username: "alice"}); err == nil {
+			t.Fatalf("%s: Expected an error for a duplicate username", name)
+		}
+
+		if _, err := store.UserAuthenticate(ctx, "alice", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: Expected ErrInvalidCredentials for a wrong password, got %v", name, err)
+		}
+		if found, err := store.UserAuthenticate(ctx, "alice", "secret"); err != nil || found.ID != user.ID {
+			t.Fatalf("%s: Expected alice to authenticate, got %v", name, err)
+		}
+
+		token := user.NewToken()
+		user.Admin = true
+		if err := store.UserPersist(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if found, err := store.UserByToken(ctx, token); err != nil || found.Username != "alice" || !found.Admin {
+			t.Fatalf("%s: Expected the token of alice as an admin, got %v", name, err)
+		}
+		if count, err := store.UserCount(ctx); err != nil || count != 1 {
+			t.Fatalf("%s: Expected 1 user, got %d (%v)", name, count, err)
+		}
+
+		user.Disabled = true
+		if err := store.UserPersist(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.UserByToken(ctx, token); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: Expected a disabled user to be rejected, got %v", name, err)
+		}
+		if _, err := store.UserAuthenticate(ctx, "alice", "secret"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: Expected a disabled user to be rejected, got %v", name, err)
+		}
+		if count, err := store.UserCount(ctx); err != nil || count != 1 {
+			t.Fatalf("%s: Expected the disabled user to be counted, got %d (%v)", name, count, err)
+		}
+	}
+}
+
+func TestSetFetchOptions(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "feeds.invalid" || r.UserAgent() != "bookmarks-test" {
+			w.WriteHeader(400)
+			return
+		}
+
+		w.Write([]byte(`<rss version="2.0"><channel><title>Proxied</title><item><title>One</title><link>http://feeds.invalid/one</link></item></channel></rss>`))
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	SetFetchOptions(FetchOptions{UserAgent: "bookmarks-test", Proxy: proxyURL})
+	defer SetFetchOptions(FetchOptions{MaxSize: DefaultFetchMaxSize})
+
+	feed := &Feed{URL: "http://feeds.invalid/rss"}
+	if err := feed.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(feed.Items) != 1 {
+		t.Fatalf("Expected the item of the feed fetched through the proxy, got %d", len(feed.Items))
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/gone":
+			w.WriteHeader(410)
+		case r.URL.Path == "/no-head" && r.Method == "HEAD":
+			w.WriteHeader(405)
+		}
+	}))
+	defer server.Close()
+
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	for _, path := range []string{"/ok", "/gone", "/no-head", "/deleted"} {
+		bookmark := &Bookmark{Title: path, URL: server.URL + path}
+		if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+			t.Fatal(err)
+		}
+
+		if path == "/deleted" {
+			if err := store.BookmarkDelete(ctx, bookmark); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	checked, dead, err := store.CheckLinks(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checked != 3 || len(dead) != 1 || dead[0].Title != "/gone" || dead[0].Status != 410 {
+		t.Fatalf("Expected /gone to be the only dead link of 3, got %d %+v", checked, dead)
+	}
+}
+
+func TestFetchClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/loop" {
+			http.Redirect(w, r, "/loop", 302)
+		}
+	}))
+	defer server.Close()
+
+	client := newFetchClient(FetchOptions{DNSCache: time.Minute}, false)
+
+	if _, err := client.Get(server.URL + "/loop"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Fatalf("Expected too many redirects, got %v", err)
+	}
+
+	// Connect through the host name to resolve it with the cache
+	serverURL, _ := url.Parse(server.URL)
+	response, err := client.Get("http://localhost:" + serverURL.Port() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	cache := &dnsCache{ttl: time.Minute, entries: map[string]dnsEntry{}}
+	if addresses, err := cache.lookup(context.Background(), "localhost"); err != nil || len(addresses) == 0 || len(cache.entries) != 1 {
+		t.Fatalf("Expected localhost to be cached, got %v %v", addresses, err)
+	}
+}
+
+func TestPublicFetchClient(t *testing.T) {
+	for _, address := range []string{"127.0.0.1", "10.1.2.3", "100.64.0.1", "169.254.169.254", "172.16.0.1", "192.168.1.1", "198.18.0.1", "0.0.0.0", "::1", "::ffff:127.0.0.1", "fd00::1", "fe80::1", "64:ff9b::a00:1"} {
+		if IsPublic(net.ParseIP(address)) {
+			t.Fatalf("Expected %s not to be public", address)
+		}
+	}
+
+	for _, address := range []string{"93.184.216.34", "100.128.0.1", "2606:2800:220:1::1"} {
+		if !IsPublic(net.ParseIP(address)) {
+			t.Fatalf("Expected %s to be public", address)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	for _, options := range []FetchOptions{{}, {DNSCache: time.Minute}} {
+		client := newFetchClient(options, true)
+
+		if _, err := client.Get("http://localhost:" + serverURL.Port() + "/"); !errors.Is(err, ErrPrivateHost) {
+			t.Fatalf("Expected a host name that resolves to a loopback address to be refused, got %v", err)
+		}
+	}
+
+	// The proxy is on a private network, the hosts it connects to are not checked
+	response, err := newFetchClient(FetchOptions{Proxy: serverURL}, true).Get("http://feeds.invalid/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+}
+
+func TestFetchClientTracing(t *testing.T) {
+	traceparent := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer server.Close()
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled}))
+
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	response, err := newFetchClient(FetchOptions{}, false).Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	if !strings.Contains(traceparent, traceID.String()) {
+		t.Fatalf("Expected the trace context to be sent to the remote server, got %q", traceparent)
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	store.SetCache(2, time.Minute)
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/first", Tags: Tags{"go"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Limit: 10})
+	if totalCount != 1 {
+		t.Fatalf("Expected 1 bookmark, got %d", totalCount)
+	}
+
+	// Changing the result must not change the cached one
+	(*bookmarks)[0].Title = "Changed"
+	if bookmarks, _ := store.BookmarkList(ctx, &BookmarkListOptions{Limit: 10}); (*bookmarks)[0].Title == "Changed" {
+		t.Fatal("Expected a copy of the cached bookmarks")
+	}
+
+	// Writes to another table keep the result, writes through another process do not show up
+	if _, err := store.db.ExecContext(ctx, "UPDATE bookmarks SET title = 'Outside'"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.ThoughtPersist(ctx, &Thought{Content: "A thought"}); err != nil {
+		t.Fatal(err)
+	}
+	if bookmarks, _ := store.BookmarkList(ctx, &BookmarkListOptions{Limit: 10}); (*bookmarks)[0].Title == "Outside" {
+		t.Fatal("Expected the cached bookmarks")
+	}
+
+	if err := store.BookmarkPersist(ctx, &Bookmark{URL: "https://example.com/second"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, totalCount := store.BookmarkList(ctx, &BookmarkListOptions{Limit: 10}); totalCount != 2 {
+		t.Fatalf("Expected the cache to be invalidated, got %d bookmarks", totalCount)
+	}
+
+	if tags := store.TagList(ctx); len(*tags) != 1 || (*tags)[0].Bookmarks != 1 {
+		t.Fatalf("Expected 1 tag, got %v", *tags)
+	}
+	if _, err := store.TagRename(ctx, "go", "golang"); err != nil {
+		t.Fatal(err)
+	}
+	if tags := store.TagList(ctx); len(*tags) != 1 || (*tags)[0].Name != "golang" {
+		t.Fatalf("Expected the renamed tag after the transaction, got %v", *tags)
+	}
+
+	if len(store.cache.entries) > 2 {
+		t.Fatalf("Expected at most 2 cached results, got %d", len(store.cache.entries))
+	}
+
+	store.SetCache(0, time.Minute)
+	if _, err := store.db.ExecContext(ctx, "UPDATE bookmarks SET title = 'Outside'"); err != nil {
+		t.Fatal(err)
+	}
+	if bookmarks, _ := store.BookmarkList(ctx, &BookmarkListOptions{Limit: 10}); (*bookmarks)[0].Title != "Outside" {
+		t.Fatal("Expected the cache to be disabled")
+	}
+}
+
+func TestFetchMaxSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.WriteHeader(400)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		writer := gzip.NewWriter(w)
+		writer.Write([]byte("<html><head><title>Compressed</title></head><body><p>" + strings.Repeat("Large ", 1000) + "</p></body></html>"))
+		writer.Close()
+	}))
+	defer server.Close()
+
+	bookmark := &Bookmark{URL: server.URL}
+	if err := bookmark.Fetch(context.Background()); err != nil || bookmark.Title != "Compressed" {
+		t.Fatalf("Expected the compressed bookmark to be fetched, got %s (%v)", bookmark.Title, err)
+	}
+
+	// The limit applies to the decompressed body
+	SetFetchOptions(FetchOptions{MaxSize: 1000})
+	defer SetFetchOptions(FetchOptions{MaxSize: DefaultFetchMaxSize})
+
+	if err := bookmark.Fetch(context.Background()); !errors.Is(err, ErrFetchFailed) || !strings.Contains(err.Error(), ErrResponseTooLarge.Error()) {
+		t.Fatalf("Expected the bookmark to be too large, got %v", err)
+	}
+}
+
+func TestBookmarkConditionalFetch(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(304)
+			return
+		}
+
+		downloads++
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`<html><head><title>Unchanged</title></head><body><p>Content that does not change</p></body></html>`))
+	}))
+	defer server.Close()
+
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	bookmark := &Bookmark{URL: server.URL}
+	if err := bookmark.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+		t.Fatal(err)
+	}
+
+	fetched := &Bookmark{ID: bookmark.ID}
+	if err := store.BookmarkGet(ctx, fetched); err != nil || fetched.Etag != `"v1"` {
+		t.Fatalf("Expected the etag to be stored, got %s (%v)", fetched.Etag, err)
+	}
+
+	if err := fetched.Fetch(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if downloads != 1 || fetched.Title != "Unchanged" || fetched.Content != bookmark.Content {
+		t.Fatalf("Expected the unchanged page to be downloaded once, got %d downloads of %s", downloads, fetched.Title)
+	}
+
+	if checked, dead, err := store.CheckLinks(ctx, 1); err != nil || checked != 1 || len(dead) != 0 {
+		t.Fatalf("Expected the unchanged page to be alive, got %d %v (%v)", checked, dead, err)
+	}
+}
+
+func TestBookmarkFetchAll(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(410)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Page ` + r.URL.Path + `</title></head><body><p>Content of ` + r.URL.Path + `</p></body></html>`))
+	}))
+	defer server.Close()
+
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	bookmarks := []*Bookmark{}
+	for _, path := range []string{"/one", "/two", "/three", "/gone"} {
+		bookmark := &Bookmark{URL: server.URL + path}
+		if path == "/two" {
+			bookmark.Title = "Chosen by the user"
+		}
+		if err := store.BookmarkPersist(ctx, bookmark); err != nil {
+			t.Fatal(err)
+		}
+		bookmarks = append(bookmarks, bookmark)
+	}
+
+	calls := 0
+	failed, err := store.BookmarkFetchAll(ctx, bookmarks, 2, func(done, failed, total int) {
+		calls++
+		if done != calls || total != 4 {
+			t.Errorf("Unexpected progress %d of %d", done, total)
+		}
+	})
+	if err != nil || failed != 1 || calls != 4 {
+		t.Fatalf("Expected 1 of 4 bookmarks to fail, got %d after %d calls (%v)", failed, calls, err)
+	}
+
+	for i, expected := range []string{"Page /one", "Chosen by the user", "Page /three"} {
+		bookmark := &Bookmark{ID: bookmarks[i].ID}
+		if err := store.BookmarkGet(ctx, bookmark); err != nil || bookmark.Title != expected || bookmark.Content == "" {
+			t.Fatalf("Expected %s with content, got %s (%v)", expected, bookmark.Title, err)
+		}
+	}
+}
+
+func TestDiscoverFeeds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head>
+				<link rel="stylesheet" href="/style.css">
+				<link rel="alternate" type="application/atom+xml" title="Atom" href="/atom.xml">
+				<link rel="alternate" type="application/rss+xml" title="RSS" href="https://feeds.example.com/rss">
+				<link rel="alternate" type="text/html" hreflang="nl" href="/nl/">
+			</head></html>`))
+		case "/plain":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>No feeds</title></head></html>`))
+		default:
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Feed</title></channel></rss>`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	feeds, err := DiscoverFeeds(ctx, server.URL+"/")
+	if err != nil || len(feeds) != 2 {
+		t.Fatalf("Expected 2 feeds, got %d (%v)", len(feeds), err)
+	}
+	if feeds[0].URL != server.URL+"/atom.xml" || feeds[0].Title != "Atom" || feeds[1].URL != "https://feeds.example.com/rss" {
+		t.Fatalf("Expected the atom feed first, got %+v %+v", feeds[0], feeds[1])
+	}
+
+	if feeds, err := DiscoverFeeds(ctx, server.URL+"/rss.xml"); err != nil || len(feeds) != 1 || feeds[0].URL != server.URL+"/rss.xml" {
+		t.Fatalf("Expected the feed itself, got %v (%v)", feeds, err)
+	}
+
+	if _, err := DiscoverFeeds(ctx, server.URL+"/plain"); err != ErrNoFeedFound {
+		t.Fatalf("Expected no feed to be found, got %v", err)
+	}
+}
+
+func TestFeedRead(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	amsterdam := time.FixedZone("CET", 3600)
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		news := &Feed{URL: "https://example.com/feed.xml", Tags: Tags{"news"}, Items: FeedItems{
+			{ID: "new", Title: "New", Date: now.In(amsterdam)},
+			{ID: "old", Title: "Old", Date: now.Add(-48 * time.Hour).In(amsterdam)},
+		}}
+		blog := &Feed{URL: "https://example.org/feed.xml", Items: FeedItems{
+			{ID: "post", Title: "Post", Date: now.Add(-48 * time.Hour).UTC()},
+		}}
+
+		for _, feed := range []*Feed{news, blog} {
+			if err := store.FeedPersist(ctx, feed); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if read, err := store.FeedRead(ctx, &FeedReadOptions{ID: news.ID, Before: now.Add(-time.Hour)}); err != nil || read != 1 {
+			t.Fatalf("%s: Expected the old items of a feed to be read, got %d (%v)", name, read, err)
+		}
+
+		store.FeedGet(ctx, news)
+		if len(news.Items) != 1 || news.Items[0].ID != "new" {
+			t.Fatalf("%s: Expected only the new item to be unread, got %d", name, len(news.Items))
+		}
+
+		if read, err := store.FeedRead(ctx, &FeedReadOptions{Tags: Tags{"-news"}}); err != nil || read != 1 {
+			t.Fatalf("%s: Expected the items of the feed without the tag to be read, got %d (%v)", name, read, err)
+		}
+
+		if read, err := store.FeedRead(ctx, &FeedReadOptions{}); err != nil || read != 1 {
+			t.Fatalf("%s: Expected the remaining items to be read, got %d (%v)", name, read, err)
+		}
+
+		feeds, _ := store.FeedList(ctx, &FeedListOptions{Limit: 10})
+		for _, feed := range *feeds {
+			if len(feed.Items) != 0 {
+				t.Fatalf("%s: Expected every item to be read, %s has %d", name, feed.URL, len(feed.Items))
+			}
+		}
+	}
+}
+
+func TestFeedItemList(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		feed := &Feed{URL: "https://example.com/feed.xml", Title: "News", Items: FeedItems{
+			{ID: "starred", Title: "Starred", Date: now.Add(-time.Hour), Starred: true},
+			{ID: "newest", Title: "Newest", Date: now.In(time.FixedZone("CET", 3600))},
+			{ID: "oldest", Title: "Oldest", Date: now.Add(-48 * time.Hour)},
+		}}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		items, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Limit: 2})
+		if totalCount != 3 || len(*items) != 2 || (*items)[0].Item.ID != "newest" || (*items)[1].Item.ID != "starred" || (*items)[0].FeedTitle != "News" {
+			t.Fatalf("%s: Expected the newest items first, got %d", name, totalCount)
+		}
+
+		if items, _ := store.FeedItemList(ctx, &FeedItemListOptions{ID: "oldest", Limit: 1}); len(*items) != 1 || (*items)[0].Item.Title != "Oldest" {
+			t.Fatalf("%s: Expected to find the item by its ID", name)
+		}
+
+		if _, err := store.FeedRead(ctx, &FeedReadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		items, totalCount = store.FeedItemList(ctx, &FeedItemListOptions{Starred: true, Limit: 10})
+		if totalCount != 1 || (*items)[0].Item.ID != "starred" || (*items)[0].FeedID != feed.ID {
+			t.Fatalf("%s: Expected the starred item to be kept after marking all items as read, got %d", name, totalCount)
+		}
+
+		if _, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Limit: 10, Offset: 10}); totalCount != 1 {
+			t.Fatalf("%s: Expected the total count beyond the last page, got %d", name, totalCount)
+		}
+	}
+}
+
+func TestFeedItemListSort(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/a.xml", Title: "A", Items: FeedItems{
+			{ID: "1", Title: "Charlie", Date: now.Add(-time.Hour)},
+			{ID: "2", Title: "Alpha", Date: now.Add(-time.Hour).In(time.FixedZone("CET", 3600))},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/b.xml", Title: "B", Items: FeedItems{
+			{ID: "3", Title: "Bravo", Date: now},
+		}}); err != nil {
+			t.Fatal(err)
+		}
+
+		items, _ := store.FeedItemList(ctx, &FeedItemListOptions{Sort: Sort{{"title", false}}, Limit: 10})
+		if len(*items) != 3 || (*items)[0].Item.Title != "Alpha" || (*items)[2].Item.Title != "Charlie" {
+			t.Fatalf("%s: Expected the items sorted on title, got %d", name, len(*items))
+		}
+
+		items, _ = store.FeedItemList(ctx, &FeedItemListOptions{Sort: Sort{{"feed_title", true}}, Limit: 1})
+		if len(*items) != 1 || (*items)[0].FeedTitle != "B" {
+			t.Fatalf("%s: Expected the items sorted on the title of their feed", name)
+		}
+
+		items, _ = store.FeedItemList(ctx, &FeedItemListOptions{Sort: Sort{{"date", false}}, Limit: 10})
+		if len(*items) != 3 || (*items)[0].Item.ID != "2" || (*items)[1].Item.ID != "1" || (*items)[2].Item.ID != "3" {
+			t.Fatalf("%s: Expected the oldest items first and the same date ordered by ID", name)
+		}
+	}
+}
+
+func TestFeedItemSearch(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/feed.xml" {
+			w.WriteHeader(404)
+			return
+		}
+
+		w.Write([]byte(`<rss version="2.0"><channel><title>Baking</title><item><title>Sourdough bread</title><link>https://example.com/merged</link><guid>merged</guid></item></channel></rss>`))
+	}))
+	defer site.Close()
+
+	stores := map[string]*Store{"sqlite": newTestStore(t)}
+	if os.Getenv("BOOKMARKS_TEST_POSTGRES") != "" {
+		stores["postgres"] = newPostgresTestStore(t)
+	}
+
+	for name, store := range stores {
+		feed := &Feed{URL: site.URL + "/feed.xml", Title: "Baking", Items: FeedItems{
+			{ID: "content", Title: "Weekend", Content: "Sourdough, more sourdough and even more sourdough", Date: now, Starred: true},
+			{ID: "title", Title: "Sourdough starter", Content: "Mix flour and water", Date: now.Add(-time.Hour)},
+			{ID: "other", Title: "Cakes", Content: "Crème brûlée", Date: now.Add(-2 * time.Hour)},
+		}}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		items, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Search: "sourd", Limit: 10})
+		if totalCount != 2 || (*items)[0].Item.ID != "title" || (*items)[1].Item.ID != "content" {
+			t.Fatalf("%s: Expected the match in the title first, got %d", name, totalCount)
+		}
+
+		// PostgreSQL does not ignore accents
+		if _, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Search: "crème", Limit: 10}); totalCount != 1 {
+			t.Fatalf("%s: Expected 1 item, got %d", name, totalCount)
+		}
+
+		if err := store.FeedRefresh(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Search: "sourdough", Limit: 10}); totalCount != 3 {
+			t.Fatalf("%s: Expected the merged item to be found, got %d", name, totalCount)
+		}
+
+		if _, err := store.FeedRead(ctx, &FeedReadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		items, totalCount = store.FeedItemList(ctx, &FeedItemListOptions{Search: "sourdough", Limit: 10})
+		if totalCount != 1 || (*items)[0].Item.ID != "content" {
+			t.Fatalf("%s: Expected only the starred item after marking all items as read, got %d", name, totalCount)
+		}
+
+		if err := store.FeedDelete(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, totalCount := store.FeedItemList(ctx, &FeedItemListOptions{Search: "sourdough", Limit: 10}); totalCount != 0 {
+			t.Fatalf("%s: Expected no items of a deleted feed, got %d", name, totalCount)
+		}
+	}
+
+	memory := NewMemory()
+	if err := memory.FeedPersist(ctx, &Feed{URL: "https://example.com/feed.xml", Items: FeedItems{{ID: "1", Title: "Sourdough starter"}, {ID: "2", Title: "Cakes"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, totalCount := memory.FeedItemList(ctx, &FeedItemListOptions{Search: "sourd", Limit: 10}); totalCount != 1 {
+		t.Fatalf("memory: Expected 1 item, got %d", totalCount)
+	}
+}
+
+func TestFeedRefreshInterval(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	stores := map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()}
+	if os.Getenv("BOOKMARKS_TEST_POSTGRES") != "" {
+		stores["postgres"] = newPostgresTestStore(t)
+	}
+
+	for name, store := range stores {
+		for _, feed := range []*Feed{
+			{URL: "https://example.com/busy.xml", Title: "Busy", RefreshInterval: Duration(15 * time.Minute), Refreshed: now.Add(-20 * time.Minute)},
+			{URL: "https://example.com/slow.xml", Title: "Slow", RefreshInterval: Duration(24 * time.Hour), Refreshed: now.Add(-2 * time.Hour)},
+			{URL: "https://example.com/default.xml", Title: "Default", Refreshed: now.Add(-2 * time.Hour)},
+			{URL: "https://example.com/fresh.xml", Title: "Fresh", Refreshed: now.Add(-time.Minute)},
+			{URL: "https://example.com/paused.xml", Title: "Paused", Refreshed: now.Add(-2 * time.Hour), Paused: true},
+		} {
+			if err := store.FeedPersist(ctx, feed); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := store.FeedPersist(ctx, &Feed{URL: "https://example.com/negative.xml", RefreshInterval: Duration(-time.Hour)}); err != ErrInvalidRefreshInterval {
+			t.Fatalf("%s: Expected ErrInvalidRefreshInterval, got %v", name, err)
+		}
+
+		feeds, totalCount := store.FeedList(ctx, &FeedListOptions{NotRefreshedSince: now.Add(-time.Hour), Sort: Sort{{"title", false}}, Limit: 10})
+		if totalCount != 2 || (*feeds)[0].Title != "Busy" || (*feeds)[1].Title != "Default" {
+			t.Fatalf("%s: Expected the busy feed and the feed without an interval to be due, but not the paused feed, got %d", name, totalCount)
+		}
+
+		if (*feeds)[0].RefreshInterval != Duration(15*time.Minute) {
+			t.Fatalf("%s: Expected the refresh interval to be kept, got %v", name, time.Duration((*feeds)[0].RefreshInterval))
+		}
+	}
+}
+
+func TestFeedFailed(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	stores := map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()}
+	if os.Getenv("BOOKMARKS_TEST_POSTGRES") != "" {
+		stores["postgres"] = newPostgresTestStore(t)
+	}
+
+	for name, store := range stores {
+		feed := &Feed{URL: "https://example.com/feed.xml", Refreshed: now.Add(-2 * time.Hour)}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		due := func(options FeedListOptions) bool {
+			options.NotRefreshedSince = now.Add(-time.Hour)
+			options.Limit = 10
+			_, totalCount := store.FeedList(ctx, &options)
+			return totalCount == 1
+		}
+
+		if !due(FeedListOptions{}) {
+			t.Fatalf("%s: Expected the feed to be due", name)
+		}
+
+		if err := store.FeedFailed(ctx, feed, "connection refused"); err != nil || feed.ErrorCount != 1 || feed.LastError != "connection refused" || !feed.Failed.Valid {
+			t.Fatalf("%s: Expected the failure to be recorded, got %d (%v)", name, feed.ErrorCount, err)
+		}
+
+		if due(FeedListOptions{}) {
+			t.Fatalf("%s: Expected the feed to back off after it failed", name)
+		}
+
+		if feeds, _ := store.FeedList(ctx, &FeedListOptions{Broken: true, Limit: 10}); len(*feeds) != 1 || (*feeds)[0].LastError != "connection refused" {
+			t.Fatalf("%s: Expected the feed to be listed as broken", name)
+		}
+
+		// Pretend the feed failed three hours ago, past its backoff of two hours
+		feed.Failed.Time = now.Add(-3 * time.Hour)
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		if !due(FeedListOptions{}) || due(FeedListOptions{MaxErrors: 1}) {
+			t.Fatalf("%s: Expected the feed to be due once it backed off and suspended at its maximum number of errors", name)
+		}
+
+		feed.ErrorCount, feed.LastError = 0, ""
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		if feeds, _ := store.FeedList(ctx, &FeedListOptions{Broken: true, Limit: 10}); len(*feeds) != 0 {
+			t.Fatalf("%s: Expected no broken feeds after the errors were reset", name)
+		}
+	}
+}
+
+func TestFeedFetchFullContent(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/feed.xml":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Truncated</title>
+				<item><title>Article</title><link>` + server.URL + `/article</link><description>Read more...</description></item>
+				<item><title>Missing</title><link>http://127.0.0.1:1/missing</link><description>Only a summary</description></item>
+			</channel></rss>`))
+		case "/article":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><title>Article</title></head><body><article><p>` + strings.Repeat("Fish &amp; chips are the full story. ", 20) + `</p></article></body></html>`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	for _, full := range []bool{false, true} {
+		feed := &Feed{URL: server.URL + "/feed.xml", FetchFullContent: full}
+		if err := feed.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(feed.Items) != 2 {
+			t.Fatalf("Expected 2 items, got %d", len(feed.Items))
+		}
+
+		article, missing := feed.Items[0], feed.Items[1]
+		if article.Title != "Article" {
+			article, missing = missing, article
+		}
+
+		if full != strings.Contains(article.Content, "Fish &amp; chips are the full story.") {
+			t.Fatalf("Expected the full content to be fetched only when enabled (%v), got %s", full, article.Content)
+		}
+
+		if missing.Content != "Only a summary" {
+			t.Fatalf("Expected the summary of an item whose page cannot be fetched, got %s", missing.Content)
+		}
+	}
+
+	store := newTestStore(t)
+	if err := store.FeedPersist(ctx, &Feed{URL: server.URL + "/feed.xml", FetchFullContent: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if feed := (&Feed{URL: server.URL + "/feed.xml"}); store.FeedGet(ctx, feed) != nil || !feed.FetchFullContent {
+		t.Fatal("Expected the feed to keep fetching the full content")
+	}
+}
+
+func TestFeedRefreshKeepsChangedItems(t *testing.T) {
+	ctx := context.Background()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		var feed *Feed
+
+		// The items are changed while the feed is being fetched
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/feed.xml" {
+				http.NotFound(w, r)
+				return
+			}
+
+			changed := &Feed{ID: feed.ID}
+			if err := store.FeedGet(ctx, changed); err != nil {
+				t.Fatal(err)
+			}
+
+			changed.GetItem("starred").Starred = true
+			changed.DeleteItem("read")
+
+			if err := store.FeedPersist(ctx, changed); err != nil {
+				t.Fatal(err)
+			}
+
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>News</title>
+				<item><title>New</title><guid>new</guid><pubDate>` + time.Now().Add(-time.Minute).Format(time.RFC1123Z) + `</pubDate></item>
+			</channel></rss>`))
+		}))
+
+		feed = &Feed{URL: server.URL + "/feed.xml", Items: FeedItems{
+			{ID: "starred", GUID: "starred", Date: time.Now().Add(-time.Hour)},
+			{ID: "read", GUID: "read", Date: time.Now().Add(-2 * time.Hour)},
+		}}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		err := store.FeedRefresh(ctx, feed)
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stored := &Feed{ID: feed.ID}
+		if err := store.FeedGet(ctx, stored); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(stored.Items) != 2 || stored.Items[0].Title != "New" || stored.Items[1].ID != "starred" || !stored.Items[1].Starred {
+			t.Fatalf("%s: Expected the new item to be added to the starred item, got %d items", name, len(stored.Items))
+		}
+
+		if len(feed.Items) != 2 || len(feed.Seen) != 1 {
+			t.Fatalf("%s: Expected the refreshed feed to be loaded again, got %d items", name, len(feed.Items))
+		}
+	}
+}
+
+func TestFeedFilters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss version="2.0"><channel><title>News</title>
+			<item><title>Go 1.22 is released</title><description>The golang team released a new version</description></item>
+			<item><title>SPONSORED: Buy now</title><description>Golang hoodies for sale</description></item>
+			<item><title>Rust 2.0</title><description>Not about go at all</description></item>
+		</channel></rss>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	for filters, expected := range map[string][]string{
+		`[]`: {"Go 1.22 is released", "SPONSORED: Buy now", "Rust 2.0"},
+		`[{"Field": "title", "Pattern": "(?i)sponsored", "Action": "drop"}]`:                                              {"Go 1.22 is released", "Rust 2.0"},
+		`[{"Pattern": "golang", "Action": "keep"}]`:                                                                       {"Go 1.22 is released"},
+		`[{"Pattern": "(?i)golang", "Action": "keep"}, {"Field": "title", "Pattern": "(?i)sponsored", "Action": "drop"}]`: {"Go 1.22 is released"},
+	} {
+		feed := &Feed{URL: server.URL}
+		if err := json.Unmarshal([]byte(filters), &feed.Filters); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := feed.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		titles := map[string]bool{}
+		for _, item := range feed.Items {
+			titles[item.Title] = true
+		}
+
+		if len(titles) != len(expected) {
+			t.Fatalf("Expected %v with %s, got %v", expected, filters, titles)
+		}
+
+		for _, title := range expected {
+			if !titles[title] {
+				t.Fatalf("Expected %v with %s, got %v", expected, filters, titles)
+			}
+		}
+	}
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		for _, filter := range []*FeedFilter{{Pattern: "(", Action: FilterDrop}, {Pattern: "ads", Action: "hide"}, {Field: "author", Pattern: "ads", Action: FilterDrop}} {
+			if err := store.FeedPersist(ctx, &Feed{URL: server.URL, Filters: FeedFilters{filter}}); err != ErrInvalidFeedFilter {
+				t.Fatalf("%s: Expected ErrInvalidFeedFilter for %+v, got %v", name, filter, err)
+			}
+		}
+
+		feed := &Feed{URL: server.URL, Filters: FeedFilters{{Field: "title", Pattern: "(?i)sponsored", Action: FilterDrop}}}
+		if err := store.FeedPersist(ctx, feed); err != nil || feed.Filters[0].ID == "" {
+			t.Fatalf("%s: Expected the filter to get an ID (%v)", name, err)
+		}
+
+		if err := store.FeedRefresh(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		found := &Feed{ID: feed.ID}
+		if err := store.FeedGet(ctx, found); err != nil || len(found.Filters) != 1 || len(found.Items) != 2 {
+			t.Fatalf("%s: Expected the filtered items of the feed with its filter, got %d items (%v)", name, len(found.Items), err)
+		}
+	}
+}
+
+func TestFeedDeduplication(t *testing.T) {
+	entries := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss version="2.0"><channel><title>Blog</title>` + entries + `</channel></rss>`))
+	}))
+	defer server.Close()
+
+	entry := func(guid, title string, date time.Time) string {
+		return `<item><guid>` + guid + `</guid><title>` + title + `</title><link>https://example.com/` + guid + `</link><pubDate>` + date.Format(time.RFC1123Z) + `</pubDate></item>`
+	}
+
+	ctx := context.Background()
+	feed := &Feed{URL: server.URL, Refreshed: time.Now().Add(-time.Hour)}
+
+	entries = entry("first", "First", time.Now().Add(-time.Minute)) + entry("second", "Second", time.Now().Add(-time.Minute))
+	if err := feed.Fetch(ctx); err != nil || len(feed.Items) != 2 || feed.Items[0].GUID == "" {
+		t.Fatalf("Expected 2 items with a GUID, got %d (%v)", len(feed.Items), err)
+	}
+
+	// The first item is read, then it is published again and the second is edited, both with a
+	// date after the feed was refreshed
+	feed.DeleteItem(feed.Items[0].ID)
+	feed.Refreshed = time.Now().Add(-time.Hour)
+	entries = entry("first", "First again", time.Now()) + entry("second", "Second edited", time.Now()) + entry("third", "Third", time.Now())
+	if err := feed.Fetch(ctx); err != nil || len(feed.Items) != 2 {
+		t.Fatalf("Expected only the third item to be new, got %d (%v)", len(feed.Items), err)
+	}
+
+	for _, item := range feed.Items {
+		if item.Title != "Second" && item.Title != "Third" {
+			t.Fatalf("Expected the read and edited items to be skipped, got %s", item.Title)
+		}
+	}
+
+	// Entries without a GUID are known by their link
+	entries = `<item><title>No GUID</title><link>https://example.com/no-guid</link></item>`
+	for i := 0; i < 2; i++ {
+		feed.Refreshed = time.Now().Add(-time.Hour)
+		if err := feed.Fetch(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(feed.Items) != 3 {
+		t.Fatalf("Expected the entry without a GUID to be added once, got %d items", len(feed.Items))
+	}
+
+	store := newTestStore(t)
+	if err := store.FeedPersist(ctx, feed); err != nil {
+		t.Fatal(err)
+	}
+
+	if found := (&Feed{ID: feed.ID}); store.FeedGet(ctx, found) != nil || len(found.Seen) != 4 || found.Seen[0] != "https://example.com/no-guid" {
+		t.Fatalf("Expected the seen entries to be kept, the most recent first, got %v", found.Seen)
+	}
+}
+
+func TestFeedEnclosures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<rss version="2.0"><channel><title>Podcast</title><item><guid>episode-1</guid><title>Episode 1</title>` +
+			`<link>https://example.com/episode-1</link><pubDate>` + time.Now().Format(time.RFC1123Z) + `</pubDate>` +
+			`<enclosure url="https://example.com/episode-1.mp3" type="audio/mpeg" length="12345"/></item></channel></rss>`))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		feed := &Feed{URL: server.URL, Refreshed: time.Now().Add(-time.Hour)}
+		if err := feed.Fetch(ctx); err != nil || len(feed.Items) != 1 {
+			t.Fatalf("%s: Expected 1 item, got %d (%v)", name, len(feed.Items), err)
+		}
+
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		items, _ := store.FeedItemList(ctx, &FeedItemListOptions{ID: feed.Items[0].ID, Limit: 10})
+		if len(*items) != 1 || len((*items)[0].Item.Enclosures) != 1 {
+			t.Fatalf("%s: Expected the item with its enclosure, got %v", name, *items)
+		}
+
+		if enclosure := (*items)[0].Item.Enclosures[0]; enclosure.URL != "https://example.com/episode-1.mp3" || enclosure.Type != "audio/mpeg" || enclosure.Length != 12345 {
+			t.Fatalf("%s: Expected the enclosure of the episode, got %+v", name, enclosure)
+		}
+	}
+}
+
+func TestFeedIcon(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	fetched := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="shortcut icon" href="/static/icon.png"></head></html>`))
+		case "/static/icon.png":
+			fetched++
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(png)
+		default:
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(`<rss version="2.0"><channel><title>Blog</title></channel></rss>`))
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+
+	for name, store := range map[string]Storer{"sqlite": newTestStore(t), "memory": NewMemory()} {
+		fetched = 0
+
+		feed := &Feed{URL: server.URL + "/feed.xml"}
+		if err := store.FeedPersist(ctx, feed); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.FeedIconGet(ctx, &FeedIcon{FeedID: feed.ID}); !errors.Is(err, ErrNoFeedIcon) {
+			t.Fatalf("%s: Expected no icon before the feed is refreshed, got %v", name, err)
+		}
+
+		// The icon is fetched once, it is cached on later refreshes
+		for i := 0; i < 2; i++ {
+			if err := store.FeedRefresh(ctx, feed); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		icon := &FeedIcon{FeedID: feed.ID}
+		if err := store.FeedIconGet(ctx, icon); err != nil || icon.ContentType != "image/png" || string(icon.Data) != string(png) || fetched != 1 {
+			t.Fatalf("%s: Expected the icon the site links to to be fetched once, got %s fetched %d times (%v)", name, icon.ContentType, fetched, err)
+		}
+	}
+}
+
+func TestJobs(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+
+	job := &queue.Job{ID: "1", Key: "feed.refresh:1", Kind: "feed.refresh", Payload: "1", Priority: queue.PriorityHigh, State: queue.StatePending, Created: time.Now(), RunAt: time.Now()}
+	if err := store.JobSave(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	job.State = queue.StateFailed
+	job.Attempts = 2
+	if err := store.JobSave(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := store.JobList(ctx)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("Expected a single saved job, got %d (%v)", len(jobs), err)
+	}
+
+	if saved := jobs[0]; saved.Key != job.Key || saved.Priority != queue.PriorityHigh || saved.State != queue.StateFailed || saved.Attempts != 2 || saved.RunAt.Unix() != job.RunAt.Unix() {
+		t.Fatalf("Expected the updated job, got %+v", saved)
+	}
+
+	if err := store.JobDelete(ctx, job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if jobs, _ := store.JobList(ctx); len(jobs) != 0 {
+		t.Fatalf("Expected the job to be removed, got %d", len(jobs))
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"context"
+)
+
+// Storer persists bookmarks, feeds with their items, thoughts and users. Store implements it on
+// top of sqlite or PostgreSQL, MemoryStore keeps everything in memory which is useful for testing.
+type Storer interface {
+	BookmarkList(ctx context.Context, options *BookmarkListOptions) (*[]*Bookmark, int)
+	BookmarkEach(ctx context.Context, options *BookmarkListOptions, fn func(bookmark *Bookmark) error) error
+	BookmarkGet(ctx context.Context, bookmark *Bookmark) error
+	BookmarkPersist(ctx context.Context, bookmark *Bookmark) error
+	BookmarkDelete(ctx context.Context, bookmark *Bookmark) error
+	BookmarkRestore(ctx context.Context, bookmark *Bookmark) error
+
+	FeedList(ctx context.Context, options *FeedListOptions) (*[]*Feed, int)
+	FeedGet(ctx context.Context, feed *Feed) error
+	FeedPersist(ctx context.Context, feed *Feed) error
+	FeedDelete(ctx context.Context, feed *Feed) error
+	FeedRestore(ctx context.Context, feed *Feed) error
+	FeedRefresh(ctx context.Context, feed *Feed) error
+	FeedFailed(ctx context.Context, feed *Feed, reason string) error
+	FeedRead(ctx context.Context, options *FeedReadOptions) (int64, error)
+	FeedItemList(ctx context.Context, options *FeedItemListOptions) (*[]*ListedFeedItem, int)
+	FeedItemEach(ctx context.Context, options *FeedItemListOptions, fn func(item *ListedFeedItem) error) error
+	FeedIconGet(ctx context.Context, icon *FeedIcon) error
+	FeedIconPersist(ctx context.Context, icon *FeedIcon) error
+
+	ThoughtList(ctx context.Context, options *ThoughtListOptions) (*[]*Thought, int)
+	ThoughtEach(ctx context.Context, options *ThoughtListOptions, fn func(thought *Thought) error) error
+	ThoughtGet(ctx context.Context, thought *Thought) error
+	ThoughtPersist(ctx context.Context, thought *Thought) error
+	ThoughtDelete(ctx context.Context, thought *Thought) error
+	ThoughtRestore(ctx context.Context, thought *Thought) error
+	ThoughtTagList(ctx context.Context) *[]string
+
+	TagList(ctx context.Context) *[]*Tag
+	TagRename(ctx context.Context, oldName, newName string) (int64, error)
+
+	UserCount(ctx context.Context) (int, error)
+	UserGet(ctx context.Context, user *User) error
+	UserPersist(ctx context.Context, user *User) error
+	UserAuthenticate(ctx context.Context, username, password string) (*User, error)
+	UserByToken(ctx context.Context, token string) (*User, error)
+}
+
+var (
+	_ Storer = &Store{}
+	_ Storer = &MemoryStore{}
+)
@@ -1,9 +1,36 @@
 package storage
 
 import (
+	"context"
 	"database/sql/driver"
+	"errors"
+	"strings"
 
 	"github.com/nrocco/qb"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	// ErrNoTagName is returned if a tag is renamed without an old or new name
+	ErrNoTagName = errors.New("Missing Tag.Name")
+
+	// ErrNotExistingTag is returned if a tag is not assigned to any bookmark, feed or thought
+	ErrNotExistingTag = errors.New("Tag does not exist")
+
+	// tagCounts selects every tag with the number of bookmarks, feeds and thoughts that are not
+	// deleted it is assigned to
+	tagCounts = "(SELECT name" +
+		", (SELECT COUNT(*) FROM bookmarks_tags JOIN bookmarks ON bookmarks.id = bookmark_id WHERE tag_id = tags.id AND deleted_at IS NULL) AS bookmarks" +
+		", (SELECT COUNT(*) FROM feeds_tags JOIN feeds ON feeds.id = feed_id WHERE tag_id = tags.id AND deleted_at IS NULL) AS feeds" +
+		", (SELECT COUNT(*) FROM thoughts_tags JOIN thoughts ON thoughts.id = thought_id WHERE tag_id = tags.id AND deleted_at IS NULL) AS thoughts" +
+		" FROM tags) AS counts"
+
+	// tagColumns maps every table with tags to the column of its join table that references it
+	tagColumns = map[string]string{
+		"bookmarks": "bookmark_id",
+		"feeds":     "feed_id",
+		"thoughts":  "thought_id",
+	}
 )
 
 // Tags is a slice of string values
@@ -18,3 +45,123 @@ func (t Tags) Value() (driver.Value, error) {
 func (t *Tags) Scan(value interface{}) error {
 	return qb.JSONScan(t, value)
 }
+
+// Merge returns the union of both Tags, preserving the order they appear in
+func (t Tags) Merge(other Tags) Tags {
+	merged := Tags{}
+	seen := map[string]bool{}
+
+	for _, tag := range append(append(Tags{}, t...), other...) {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		merged = append(merged, tag)
+	}
+
+	return merged
+}
+
+// Tag reports how many bookmarks, feeds and thoughts a tag is assigned to
+type Tag struct {
+	Name      string
+	Bookmarks int
+	Feeds     int
+	Thoughts  int
+}
+
+// hasTag returns a condition that matches records of table that have the tag passed as parameter
+func hasTag(table string) string {
+	return "EXISTS (SELECT 1 FROM " + table + "_tags JOIN tags ON tags.id = " + table + "_tags.tag_id WHERE " + table + "_tags." + tagColumns[table] + " = " + table + ".id AND tags.name = ?)"
+}
+
+// filterTags limits query to records of table that have every tag, or that do not have a tag prefixed with -
+func filterTags(query *qb.SelectQuery, table string, tags Tags) {
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		} else if strings.HasPrefix(tag, "-") {
+			query.Where("NOT "+hasTag(table), strings.TrimPrefix(tag, "-"))
+		} else {
+			query.Where(hasTag(table), tag)
+		}
+	}
+}
+
+// TagList lists all tags in use, the most used first
+func (store *Store) TagList(ctx context.Context) *[]*Tag {
+	ctx, span := store.start(ctx, "Store.TagList")
+	defer span.End()
+
+	result := store.cached(ctx, "TagList", nil, []string{"tags", "bookmarks", "feeds", "thoughts"}, func() (interface{}, error) {
+		return store.tagList(ctx)
+	}).([]*Tag)
+
+	tags := []*Tag{}
+	for _, tag := range result {
+		copied := *tag
+		tags = append(tags, &copied)
+	}
+
+	return &tags
+}
+
+func (store *Store) tagList(ctx context.Context) ([]*Tag, error) {
+	query := store.db.Select(ctx).From(tagCounts)
+	query.Columns("name", "bookmarks", "feeds", "thoughts")
+	query.Where("bookmarks + feeds + thoughts > 0")
+	query.OrderBy("bookmarks + feeds + thoughts", "DESC")
+	query.OrderBy("name", "ASC")
+
+	tags := []*Tag{}
+
+	if _, err := query.Load(&tags); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching tags")
+		return tags, err
+	}
+
+	return tags, nil
+}
+
+// TagRename renames a tag on all bookmarks, feeds and thoughts in a single transaction, if a tag
+// with the new name already exists both are merged. It returns the number of records that changed.
+func (store *Store) TagRename(ctx context.Context, oldName, newName string) (int64, error) {
+	ctx, span := store.start(ctx, "Store.TagRename")
+	defer span.End()
+
+	if oldName == "" || newName == "" {
+		return 0, ErrNoTagName
+	}
+
+	total := int64(0)
+
+	err := store.WithTx(ctx, func(tx *Store) error {
+		for _, table := range []string{"bookmarks", "feeds", "thoughts"} {
+			renamed := "(SELECT " + tx.dialect.textArray("DISTINCT CASE value WHEN ? THEN ? ELSE value END") + " FROM " + tx.dialect.jsonEachText(table+".tags") + ")"
+
+			result, err := tx.exec(ctx, "UPDATE "+table+" SET tags = "+renamed+" WHERE "+hasTag(table), oldName, newName, oldName)
+			if err != nil {
+				log.Ctx(ctx).Error().Err(err).Str("table", table).Str("tag", oldName).Msg("Error renaming tag")
+				return err
+			}
+
+			affected, _ := result.RowsAffected()
+			total += affected
+		}
+
+		if total == 0 {
+			return ErrNotExistingTag
+		}
+
+		_, err := tx.exec(ctx, "DELETE FROM tags WHERE name = ?", oldName)
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	log.Ctx(ctx).Info().Str("tag", oldName).Str("name", newName).Int64("records", total).Msg("Renamed tag")
+
+	return total, nil
+}
@@ -3,77 +3,182 @@ package storage
 import (
 	"context"
 	"errors"
-	"strings"
 	"time"
 
+	"github.com/nrocco/qb"
 	"github.com/rs/zerolog/log"
 )
 
+var (
+	// ErrNoThoughtID is returned if the Thought does not have an ID
+	ErrNoThoughtID = errors.New("Missing Thought.ID")
+
+	// ErrNotDeletedThought is returned when restoring a thought that is not deleted
+	ErrNotDeletedThought = errors.New("Thought is not deleted")
+)
+
 // Thought holds information about a thought
 type Thought struct {
-	ID      string
-	Created time.Time
-	Updated time.Time
-	Content string
-	Tags    Tags
+	ID        string
+	Created   time.Time
+	Updated   time.Time
+	Content   string
+	Tags      Tags
+	DeletedAt qb.NullTime
 }
 
 // ThoughtListOptions can be passed to ThoughtList to filter thoughts
 type ThoughtListOptions struct {
-	Search string
-	Tags   Tags
-	Limit  int
-	Offset int
+	Search         string
+	Tags           Tags
+	IncludeDeleted bool
+	Sort           Sort
+	Cursor         string
+	Limit          int
+	Offset         int
 }
 
-// ThoughtList lists thoughts from the database
-func (store *Store) ThoughtList(ctx context.Context, options *ThoughtListOptions) (*[]*Thought, int) {
+// thoughtFilter selects the thoughts that match the options, regardless of the page
+func (store *Store) thoughtFilter(ctx context.Context, options *ThoughtListOptions) *qb.SelectQuery {
 	query := store.db.Select(ctx).From("thoughts")
 
 	if options.Search != "" {
-		query.Where("rowid IN (SELECT rowid FROM thoughts_fts(?))", options.Search)
+		store.dialect.search(query, "thoughts", options.Search)
+	}
+
+	filterTags(query, "thoughts", options.Tags)
+
+	if !options.IncludeDeleted {
+		query.Where("deleted_at IS NULL")
+	}
+
+	return query
+}
+
+// ThoughtList lists thoughts from the database
+func (store *Store) ThoughtList(ctx context.Context, options *ThoughtListOptions) (*[]*Thought, int) {
+	ctx, span := store.start(ctx, "Store.ThoughtList")
+	defer span.End()
+
+	result := store.cached(ctx, "ThoughtList", *options, []string{"thoughts"}, func() (interface{}, error) {
+		thoughts, totalCount, err := store.thoughtList(ctx, options)
+		return listResult{thoughts, totalCount}, err
+	}).(listResult)
+
+	// Callers may change the thoughts, so they get a copy of the cached ones
+	thoughts := []*Thought{}
+	for _, thought := range result.list.([]*Thought) {
+		copied := *thought
+		copied.Tags = append(Tags{}, thought.Tags...)
+		thoughts = append(thoughts, &copied)
 	}
 
-	for _, tag := range options.Tags {
-		if tag == "" {
-			continue
-		} else if strings.HasPrefix(tag, "-") {
-			query.Where("NOT EXISTS (SELECT 1 FROM json_each(thoughts.tags) where json_each.value = ?)", strings.TrimPrefix(tag, "-"))
-		} else {
-			query.Where("EXISTS (SELECT 1 FROM json_each(thoughts.tags) where json_each.value = ?)", tag)
+	return &thoughts, result.totalCount
+}
+
+// ThoughtEach calls fn with the thoughts ThoughtList would return, reading them from the database
+// one at a time instead of loading the whole list. The thoughts are not cached.
+func (store *Store) ThoughtEach(ctx context.Context, options *ThoughtListOptions, fn func(thought *Thought) error) error {
+	ctx, span := store.start(ctx, "Store.ThoughtEach")
+	defer span.End()
+
+	query, err := store.thoughtPage(ctx, options)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thoughts")
+		return err
+	}
+
+	rows, err := store.rows(ctx, query.Columns("id", "created", "updated", "content", "tags", "deleted_at"))
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thoughts")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		thought := &Thought{}
+		if err := rows.Scan(&thought.ID, &thought.Created, &thought.Updated, &thought.Content, &thought.Tags, &thought.DeletedAt); err != nil {
+			return err
 		}
+
+		if err := fn(thought); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// thoughtPage selects the page of thoughts that options describe, without columns
+func (store *Store) thoughtPage(ctx context.Context, options *ThoughtListOptions) (*qb.SelectQuery, error) {
+	query := store.thoughtFilter(ctx, options)
+
+	if options.Cursor != "" {
+		cursor, err := ParseCursor(options.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query.Where("(created < ? OR (created = ? AND id < ?))", cursor.Created, cursor.Created, cursor.ID)
+	}
+
+	options.Sort.apply(query, ranked(options.Search, options.Cursor, Sort{{"created", true}}))
+	query.Limit(options.Limit)
+	if options.Cursor == "" {
+		query.Offset(options.Offset)
 	}
 
+	return query, nil
+}
+
+func (store *Store) thoughtList(ctx context.Context, options *ThoughtListOptions) ([]*Thought, int, error) {
 	thoughts := []*Thought{}
 	totalCount := 0
 
-	query.Columns("COUNT(id)")
-	if err := query.LoadValue(&totalCount); err != nil {
-		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thought count")
-		return &thoughts, 0
+	query, err := store.thoughtPage(ctx, options)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thoughts")
+		return thoughts, 0, err
 	}
 
-	query.Columns("id", "created", "updated", "content", "tags")
-	query.OrderBy("created", "DESC")
-	query.Limit(options.Limit)
-	query.Offset(options.Offset)
-	if _, err := query.Load(&thoughts); err != nil {
+	rows := []struct {
+		Thought
+		TotalCount int
+	}{}
+
+	query.Columns("id", "created", "updated", "content", "tags", "deleted_at", totalCountColumn)
+	if _, err := query.Load(&rows); err != nil {
 		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thoughts")
-		return &thoughts, 0
+		return thoughts, 0, err
+	}
+
+	for i := range rows {
+		thoughts = append(thoughts, &rows[i].Thought)
+		totalCount = rows[i].TotalCount
+	}
+
+	if options.Cursor != "" || len(rows) == 0 {
+		if err := store.thoughtFilter(ctx, options).Columns("COUNT(id)").LoadValue(&totalCount); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thought count")
+			return thoughts, 0, err
+		}
 	}
 
-	return &thoughts, totalCount
+	return thoughts, totalCount, nil
 }
 
-// ThoughtGet gets a single thought from the database
+// ThoughtGet gets a single thought from the database, unless it is deleted
 func (store *Store) ThoughtGet(ctx context.Context, thought *Thought) error {
+	ctx, span := store.start(ctx, "Store.ThoughtGet")
+	defer span.End()
+
 	query := store.db.Select(ctx).From("thoughts")
+	query.Where("deleted_at IS NULL")
 	query.Limit(1)
 
 	if thought.ID != "" {
 		query.Where("id = ?", thought.ID)
 	} else {
-		return errors.New("Missing Thought.ID")
+		return ErrNoThoughtID
 	}
 
 	if err := query.LoadValue(&thought); err != nil {
@@ -85,6 +190,9 @@ func (store *Store) ThoughtGet(ctx context.Context, thought *Thought) error {
 
 // ThoughtPersist adds a thought to the database
 func (store *Store) ThoughtPersist(ctx context.Context, thought *Thought) error {
+	ctx, span := store.start(ctx, "Store.ThoughtPersist")
+	defer span.End()
+
 	if thought.Created.IsZero() {
 		thought.Created = time.Now()
 	}
@@ -95,8 +203,10 @@ func (store *Store) ThoughtPersist(ctx context.Context, thought *Thought) error
 
 	thought.Updated = time.Now()
 
-	if thought.ID == "" {
-		thought.ID = generateUUID()
+	if !store.exists(ctx, "thoughts", thought.ID) {
+		if thought.ID == "" {
+			thought.ID = generateUUID()
+		}
 
 		query := store.db.Insert(ctx).InTo("thoughts")
 		query.Columns("id", "created", "content", "tags", "updated")
@@ -111,6 +221,7 @@ func (store *Store) ThoughtPersist(ctx context.Context, thought *Thought) error
 		query.Set("content", thought.Content)
 		query.Set("tags", thought.Tags)
 		query.Set("updated", thought.Updated)
+		query.Set("deleted_at", thought.DeletedAt)
 		query.Where("id = ?", thought.ID)
 
 		if _, err := query.Exec(); err != nil {
@@ -119,18 +230,27 @@ func (store *Store) ThoughtPersist(ctx context.Context, thought *Thought) error
 		}
 	}
 
+	store.invalidate("thoughts")
+
 	log.Ctx(ctx).Info().Str("id", thought.ID).Msg("Persisted thought")
 
 	return nil
 }
 
-// ThoughtDelete removes a thought from the database
+// ThoughtDelete marks a thought as deleted, it can be restored until it is purged
 func (store *Store) ThoughtDelete(ctx context.Context, thought *Thought) error {
+	ctx, span := store.start(ctx, "Store.ThoughtDelete")
+	defer span.End()
+
 	if thought.ID == "" {
-		return errors.New("Missing Thought.ID")
+		return ErrNoThoughtID
 	}
 
-	query := store.db.Delete(ctx).From("thoughts")
+	thought.DeletedAt = nullTimeNow()
+
+	query := store.db.Update(ctx).Table("thoughts")
+	query.Set("deleted_at", thought.DeletedAt)
+	query.Where("deleted_at IS NULL")
 
 	if thought.ID != "" {
 		query.Where("id = ?", thought.ID)
@@ -141,25 +261,74 @@ func (store *Store) ThoughtDelete(ctx context.Context, thought *Thought) error {
 		return err
 	}
 
-	log.Ctx(ctx).Info().Str("id", thought.ID).Msg("Thought refreshed")
+	store.invalidate("thoughts")
+
+	log.Ctx(ctx).Info().Str("id", thought.ID).Msg("Thought deleted")
 
 	return nil
 }
 
 // ThoughtTagList lists all tags assigned to thoughts
 func (store *Store) ThoughtTagList(ctx context.Context) *[]string {
+	ctx, span := store.start(ctx, "Store.ThoughtTagList")
+	defer span.End()
+
+	tags := store.cached(ctx, "ThoughtTagList", nil, []string{"thoughts"}, func() (interface{}, error) {
+		return store.thoughtTagList(ctx)
+	}).([]string)
+
+	copied := append([]string{}, tags...)
+
+	return &copied
+}
+
+func (store *Store) thoughtTagList(ctx context.Context) ([]string, error) {
 	query := store.db.Select(ctx)
-	query.From("thoughts, json_each(thoughts.tags) AS tags")
-	query.Columns("tags.value AS tag")
-	query.GroupBy("tags.value")
-	query.OrderBy("COUNT(tags)", "DESC")
+	query.From("tags")
+	query.Join("JOIN thoughts_tags ON thoughts_tags.tag_id = tags.id")
+	query.Join("JOIN thoughts ON thoughts.id = thoughts_tags.thought_id")
+	query.Where("thoughts.deleted_at IS NULL")
+	query.Columns("tags.name")
+	query.GroupBy("tags.id")
+	query.OrderBy("COUNT(*)", "DESC")
 
 	tags := []string{}
 
 	if _, err := query.Load(&tags); err != nil {
 		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching thought tags")
-		return &tags
+		return tags, err
 	}
 
-	return &tags
+	return tags, nil
+}
+
+// ThoughtRestore restores the given deleted thought
+func (store *Store) ThoughtRestore(ctx context.Context, thought *Thought) error {
+	ctx, span := store.start(ctx, "Store.ThoughtRestore")
+	defer span.End()
+
+	if thought.ID == "" {
+		return ErrNoThoughtID
+	}
+
+	query := store.db.Update(ctx).Table("thoughts")
+	query.Set("deleted_at", qb.NullTime{})
+	query.Where("id = ?", thought.ID)
+	query.Where("deleted_at IS NOT NULL")
+
+	result, err := query.Exec()
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("id", thought.ID).Msg("Error restoring thought")
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotDeletedThought
+	}
+
+	store.invalidate("thoughts")
+
+	log.Ctx(ctx).Info().Str("id", thought.ID).Msg("Thought restored")
+
+	return store.ThoughtGet(ctx, thought)
 }
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	"github.com/nrocco/qb"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTx runs fn in a transaction, every method called on the Store passed to fn takes part in
+// it. The transaction is committed if fn returns nil and rolled back otherwise. Calling WithTx
+// on a Store that is already part of a transaction runs fn in that same transaction.
+func (store *Store) WithTx(ctx context.Context, fn func(tx *Store) error) error {
+	if store.tx != nil {
+		return fn(store)
+	}
+
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&Store{db: store.db, tx: tx, dialect: store.dialect, path: store.path, key: store.key}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Writes in the transaction could not invalidate the cache before they were committed
+	store.invalidate()
+
+	return nil
+}
+
+// start starts a span for a method of the store and routes its queries through the transaction
+// of the store, if any
+func (store *Store) start(ctx context.Context, name string) (context.Context, trace.Span) {
+	if store.tx != nil && qb.GetTxCtx(ctx) == nil {
+		ctx = qb.WitTx(ctx, store.tx)
+	}
+
+	return tracer.Start(ctx, name)
+}
+
+// exec executes a raw query in the transaction of the store, if any
+func (store *Store) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if store.tx != nil {
+		return store.tx.ExecContext(ctx, query, args...)
+	}
+
+	return store.db.ExecContext(ctx, query, args...)
+}
+
+// queryRow executes a raw query that returns a single row in the transaction of the store, if any
+func (store *Store) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if store.tx != nil {
+		return store.tx.QueryRowContext(ctx, query, args...)
+	}
+
+	return store.db.QueryRowContext(ctx, query, args...)
+}
+
+// rows executes a select query in the transaction of the store, if any, and returns its rows to be
+// read one at a time
+func (store *Store) rows(ctx context.Context, query *qb.SelectQuery) (*sql.Rows, error) {
+	buf := bytes.Buffer{}
+	if err := query.Build(&buf); err != nil {
+		return nil, err
+	}
+
+	if store.tx != nil {
+		return store.tx.QueryContext(ctx, buf.String(), query.Params()...)
+	}
+
+	return store.db.QueryContext(ctx, buf.String(), query.Params()...)
+}
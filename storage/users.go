@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrNoUserKey is returned if the User does not have an ID or Username
+	ErrNoUserKey = errors.New("Missing User.ID or User.Username")
+
+	// ErrInvalidCredentials is returned if a username and password or a token do not match an
+	// enabled user
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+)
+
+// User logs in to the rest api with a password, or authenticates with an api token. Only hashes of
+// the password and token are stored.
+type User struct {
+	ID           string
+	Created      time.Time
+	Updated      time.Time
+	Username     string
+	PasswordHash string `json:"-"`
+	TokenHash    string `json:"-"`
+	Disabled     bool
+	Admin        bool
+}
+
+// SetPassword replaces the password of the user, which logs out the sessions of the old password
+func (user *User) SetPassword(password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user.PasswordHash = string(hash)
+
+	return nil
+}
+
+// CheckPassword checks if password is the password of the user
+func (user *User) CheckPassword(password string) bool {
+	return user.PasswordHash != "" && bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// NewToken replaces the api token of the user with a random one, the token is returned once and
+// cannot be recovered afterwards
+func (user *User) NewToken() string {
+	random := make([]byte, 32)
+	rand.Read(random)
+
+	token := hex.EncodeToString(random)
+	user.TokenHash = hashToken(token)
+
+	return token
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// UserList lists all users by username
+func (store *Store) UserList(ctx context.Context) *[]*User {
+	ctx, span := store.start(ctx, "Store.UserList")
+	defer span.End()
+
+	users := []*User{}
+
+	query := store.db.Select(ctx).From("users")
+	query.OrderBy("username", "ASC")
+
+	if _, err := query.Load(&users); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Error fetching users")
+	}
+
+	return &users
+}
+
+// UserCount counts all users, disabled ones included so disabling the last user does not turn
+// off authentication
+func (store *Store) UserCount(ctx context.Context) (int, error) {
+	ctx, span := store.start(ctx, "Store.UserCount")
+	defer span.End()
+
+	count := 0
+	if err := store.db.Select(ctx).From("users").Columns("COUNT(id)").LoadValue(&count); err != nil {
+		log.Ctx(ctx).Error().Err(err).Msg("Error counting users")
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// UserGet finds a single user by ID or Username
+func (store *Store) UserGet(ctx context.Context, user *User) error {
+	ctx, span := store.start(ctx, "Store.UserGet")
+	defer span.End()
+
+	query := store.db.Select(ctx).From("users")
+	query.Limit(1)
+
+	if user.ID != "" {
+		query.Where("id = ?", user.ID)
+	} else if user.Username != "" {
+		query.Where("username = ?", user.Username)
+	} else {
+		return ErrNoUserKey
+	}
+
+	return query.LoadValue(user)
+}
+
+// UserPersist creates a user or updates the password, token, disabled and admin flags of an
+// existing one
+func (store *Store) UserPersist(ctx context.Context, user *User) error {
+	ctx, span := store.start(ctx, "Store.UserPersist")
+	defer span.End()
+
+	if user.Username == "" {
+		return ErrNoUserKey
+	}
+
+	user.Updated = time.Now()
+
+	if user.ID == "" {
+		user.ID = generateUUID()
+		user.Created = user.Updated
+
+		query := store.db.Insert(ctx).InTo("users")
+		query.Columns("id", "created", "updated", "username", "password_hash", "token_hash", "disabled", "admin")
+		query.Record(user)
+
+		if _, err := query.Exec(); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("username", user.Username).Msg("Error persisting user")
+			user.ID = ""
+			return err
+		}
+	} else {
+		query := store.db.Update(ctx).Table("users")
+		query.Set("updated", user.Updated)
+		query.Set("password_hash", user.PasswordHash)
+		query.Set("token_hash", user.TokenHash)
+		query.Set("disabled", user.Disabled)
+		query.Set("admin", user.Admin)
+		query.Where("id = ?", user.ID)
+
+		if _, err := query.Exec(); err != nil {
+			log.Ctx(ctx).Error().Err(err).Str("username", user.Username).Msg("Error updating user")
+			return err
+		}
+	}
+
+	log.Ctx(ctx).Info().Str("id", user.ID).Str("username", user.Username).Msg("Persisted user")
+
+	return nil
+}
+
+// UserAuthenticate finds the enabled user with username and password
+func (store *Store) UserAuthenticate(ctx context.Context, username, password string) (*User, error) {
+	user := &User{Username: username}
+	if username == "" || store.UserGet(ctx, user) != nil || user.Disabled || !user.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// UserByToken finds the enabled user with the api token
+func (store *Store) UserByToken(ctx context.Context, token string) (*User, error) {
+	if token == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	user := &User{}
+	if err := store.db.Select(ctx).From("users").Where("token_hash = ?", hashToken(token)).Limit(1).LoadValue(user); err != nil || user.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
@@ -0,0 +1,51 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestListeners(t *testing.T) {
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+	os.Setenv("LISTEN_FDS", "1")
+
+	listeners, err := Listeners()
+	if err != nil || len(listeners) != 0 {
+		t.Fatalf("Expected no listeners for another process, got %d %v", len(listeners), err)
+	}
+
+	if os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDS") != "" {
+		t.Fatal("Expected the environment to be unset")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	os.Setenv("NOTIFY_SOCKET", "")
+
+	if sent, err := Notify("READY=1"); sent || err != nil {
+		t.Fatalf("Expected no notification without a socket, got %t %v", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	if sent, err := Notify("READY=1"); !sent || err != nil {
+		t.Fatalf("Expected a notification, got %t %v", sent, err)
+	}
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil || string(buf[:n]) != "READY=1" {
+		t.Fatalf("Expected READY=1, got %q %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package telegram runs a Telegram bot that saves the links sent to it as bookmarks
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nrocco/bookmarks/capture"
+	"github.com/nrocco/bookmarks/storage"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// pollTimeout is how long a request for updates waits for new messages
+	pollTimeout = 30 * time.Second
+
+	// retryDelay is how long the bot waits after failing to fetch updates
+	retryDelay = 5 * time.Second
+
+	// unreadLimit is the number of bookmarks /unread replies with
+	unreadLimit = 10
+
+	usage = "Send me a link to save it as a bookmark, add #hashtags to tag it.\n\n/unread lists the bookmarks you did not read yet."
+)
+
+// Bot saves the links sent to it in the allowed chats as bookmarks
+type Bot struct {
+	token   string
+	chats   map[int64]bool
+	store   storage.Storer
+	client  *http.Client
+	baseURL string
+}
+
+// New creates a bot for the given token that only accepts messages from the given chats
+func New(token string, chats []int64, store storage.Storer) *Bot {
+	allowed := map[int64]bool{}
+	for _, chat := range chats {
+		allowed[chat] = true
+	}
+
+	return &Bot{
+		token:   token,
+		chats:   allowed,
+		store:   store,
+		client:  &http.Client{Timeout: pollTimeout + 10*time.Second},
+		baseURL: "https://api.telegram.org",
+	}
+}
+
+type response struct {
+	Ok          bool
+	Description string
+	Result      json.RawMessage
+}
+
+type update struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *message
+}
+
+type message struct {
+	Chat struct {
+		ID int64
+	}
+	Text string
+}
+
+// Run fetches and handles new messages until the context is cancelled
+func (bot *Bot) Run(ctx context.Context) {
+	log.Ctx(ctx).Info().Int("chats", len(bot.chats)).Msg("Telegram bot ready")
+
+	offset := int64(0)
+
+	for ctx.Err() == nil {
+		updates := []update{}
+		params := map[string]interface{}{"offset": offset, "timeout": int(pollTimeout.Seconds()), "allowed_updates": []string{"message"}}
+
+		if err := bot.call(ctx, "getUpdates", params, &updates); err != nil {
+			if ctx.Err() == nil {
+				log.Ctx(ctx).Warn().Err(err).Msg("Error fetching Telegram updates")
+				sleep(ctx, retryDelay)
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+
+			if update.Message != nil {
+				bot.handle(ctx, update.Message)
+			}
+		}
+	}
+}
+
+// handle saves the links in a message or answers a command
+func (bot *Bot) handle(ctx context.Context, message *message) {
+	chat := message.Chat.ID
+	logger := log.Ctx(ctx).With().Int64("chat", chat).Logger()
+
+	if !bot.chats[chat] {
+		logger.Warn().Msg("Ignoring Telegram message from a chat that is not allowed")
+		bot.reply(ctx, chat, "This chat is not allowed to save bookmarks, add "+strconv.FormatInt(chat, 10)+" to the allowed chats first.")
+		return
+	}
+
+	command := ""
+	if fields := strings.Fields(message.Text); len(fields) != 0 {
+		// In groups commands are addressed to a bot, like /unread@bookmarks_bot
+		command = strings.SplitN(fields[0], "@", 2)[0]
+	}
+
+	switch command {
+	case "/start", "/help":
+		bot.reply(ctx, chat, usage)
+		return
+	case "/unread":
+		lines := []string{}
+		for _, bookmark := range capture.Unread(ctx, bot.store, unreadLimit) {
+			lines = append(lines, bookmark.Title+"\n"+bookmark.URL)
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "Nothing left to read.")
+		}
+		bot.reply(ctx, chat, strings.Join(lines, "\n\n"))
+		return
+	}
+
+	urls, tags := capture.Parse(message.Text)
+	if len(urls) == 0 {
+		bot.reply(ctx, chat, usage)
+		return
+	}
+
+	for _, pageURL := range urls {
+		bookmark, err := capture.Save(logger.WithContext(ctx), bot.store, pageURL, tags)
+		if err != nil {
+			logger.Error().Err(err).Str("url", pageURL).Msg("Error saving bookmark from Telegram")
+			bot.reply(ctx, chat, "Could not save "+pageURL+": "+err.Error())
+			continue
+		}
+
+		bot.reply(ctx, chat, "Saved "+bookmark.Title)
+	}
+}
+
+// reply sends a text message to a chat, failures are only logged
+func (bot *Bot) reply(ctx context.Context, chat int64, text string) {
+	params := map[string]interface{}{"chat_id": chat, "text": text, "disable_web_page_preview": true}
+
+	if err := bot.call(ctx, "sendMessage", params, nil); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Int64("chat", chat).Msg("Error sending Telegram message")
+	}
+}
+
+// call invokes a method of the Telegram bot api and decodes its result into result, if not nil
+func (bot *Bot) call(ctx context.Context, method string, params map[string]interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", bot.baseURL+"/bot"+bot.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := bot.client.Do(request)
+	if err != nil {
+		// The error contains the url, which contains the token
+		return errors.New("Error calling " + method + ": " + strings.ReplaceAll(err.Error(), bot.token, "***"))
+	}
+	defer resp.Body.Close()
+
+	decoded := response{}
+	if err := json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return err
+	}
+
+	if !decoded.Ok {
+		return fmt.Errorf("Error calling %s: %s", method, decoded.Description)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(decoded.Result, result)
+}
+
+func sleep(ctx context.Context, duration time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(duration):
+	}
+}
@@ -0,0 +1,62 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nrocco/bookmarks/storage"
+)
+
+func TestHandle(t *testing.T) {
+	replies := map[int64][]string{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bottoken/sendMessage" {
+			t.Errorf("Unexpected call to %s", r.URL.Path)
+			return
+		}
+
+		params := struct {
+			ChatID int64 `json:"chat_id"`
+			Text   string
+		}{}
+		json.NewDecoder(r.Body).Decode(&params)
+		replies[params.ChatID] = append(replies[params.ChatID], params.Text)
+
+		w.Write([]byte(`{"ok": true, "result": {}}`))
+	}))
+	defer server.Close()
+
+	store := storage.NewMemory()
+	ctx := context.Background()
+
+	bot := New("token", []int64{1}, store)
+	bot.baseURL = server.URL
+
+	incoming := &message{Text: "http://127.0.0.1:1/article #Go"}
+	incoming.Chat.ID = 1
+	bot.handle(ctx, incoming)
+
+	if bookmarks, totalCount := store.BookmarkList(ctx, &storage.BookmarkListOptions{Tags: storage.Tags{"go"}, Limit: 10}); totalCount != 1 || (*bookmarks)[0].URL != "http://127.0.0.1:1/article" {
+		t.Fatalf("Expected the link to be saved, got %d bookmarks", totalCount)
+	}
+
+	incoming.Text = "/unread@bookmarks_bot"
+	bot.handle(ctx, incoming)
+
+	if len(replies[1]) != 2 || !strings.Contains(replies[1][1], "http://127.0.0.1:1/article") {
+		t.Fatalf("Expected the unread bookmark in the reply, got %v", replies[1])
+	}
+
+	stranger := &message{Text: "http://127.0.0.1:1/other"}
+	stranger.Chat.ID = 2
+	bot.handle(ctx, stranger)
+
+	if _, totalCount := store.BookmarkList(ctx, &storage.BookmarkListOptions{}); totalCount != 1 || len(replies[2]) != 1 {
+		t.Fatalf("Expected links from other chats to be refused, got %d bookmarks", totalCount)
+	}
+}
@@ -2,7 +2,7 @@ import axios from 'axios'
 import Router from '@/router'
 
 const client = axios.create({
-  baseURL: `/api`,
+  baseURL: `api/v1`,
   withCredentials: true
 })
 
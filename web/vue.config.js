@@ -1,4 +1,5 @@
 module.exports = {
+  publicPath: '',
   productionSourceMap: false,
   devServer: {
     disableHostCheck: true,